@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
 	"jwe-go/model"
 	"jwe-go/packages/schema"
 	"jwe-go/routes"
@@ -14,7 +13,7 @@ import (
 )
 
 func setupRouter() *gin.Engine {
-	schema.Validate = validator.New(validator.WithRequiredStructEnabled())
+	schema.Validate = schema.New()
 	router := gin.Default()
 	router.POST("/encrypt", routes.EncryptEndpoint)
 	router.POST("/decrypt", routes.DecryptEndpoint)
@@ -0,0 +1,72 @@
+package benchmark
+
+import (
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/crypto"
+	"testing"
+)
+
+const benchmarkPublicKeyPem = "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAt5TICyK59sJggCB8YbGp0uTYMTr3V4fJIvaZgujqEAEtGB6QDCS6IOnqtZzetVspDVH1tIV/wlOuFzgga3kKhMawb2Q/zKLTtK+QnNngaPcND8PClnY/ro1BBy9sxjO3FgCHKrRkRAnzif3qGLQHgvGNk1MWJ/qvdg8F2rCqAbcmCxdROUcLNEjbeW1pReSFEVOJRvrQDmDGvJRZArSx8CCCPRJPqzjByV3pSqqHCqIQ2P9aeXW8L1lvzOuwFCGpFupjoc5v3G8M8hthxGfueVjGz6iw0ka6+V/Zem6XkEJFXHWTnvmemYziMDswFE0GxpeizuVaY/jLZ30gCG/0CQIDAQAB"
+
+// Import, JWK conversion and thumbprint on every call, as the endpoint used to do
+func BenchmarkImportPublicKeyUncached(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		publicKey, _, err := crypto.ImportPublicKeyFromPEM(benchmarkPublicKeyPem)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := crypto.NewPublicKeyEntry(publicKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetOrImportPublicKey(b *testing.B) {
+	crypto.PublicKeys = crypto.NewKeyCache(16)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := crypto.GetOrImportPublicKey(benchmarkPublicKeyPem); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewEncrypter(b *testing.B) {
+	entry, err := crypto.GetOrImportPublicKey(benchmarkPublicKeyPem)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := jose.NewEncrypter(
+			jose.A256GCM,
+			jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: entry.PublicKey},
+			(&jose.EncrypterOptions{}).WithHeader(crypto.ServerKidHeader, entry.Thumbprint),
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPooledEncrypter(b *testing.B) {
+	entry, err := crypto.GetOrImportPublicKey(benchmarkPublicKeyPem)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pool := crypto.NewEncrypterPool(16)
+	key := crypto.EncrypterKey{
+		Thumbprint:        entry.Thumbprint,
+		KeyAlgorithm:      jose.RSA_OAEP_256,
+		ContentEncryption: jose.A256GCM,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := pool.Get(key, entry.PublicKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,23 +1,292 @@
 package main
 
 import (
+	stdcontext "context"
+	stdcrypto "crypto"
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"jwe-go/packages/audit"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/json"
+	"jwe-go/packages/middleware"
 	"jwe-go/packages/schema"
+	"jwe-go/packages/server"
+	"jwe-go/packages/tracing"
 	"jwe-go/routes"
+	"log"
+	"os"
 )
 
 func main() {
-	schema.Validate = validator.New(validator.WithRequiredStructEnabled())
+	schema.Validate = schema.New()
+	config.Current = config.Load()
+	crypto.PublicKeys = crypto.NewKeyCache(config.Current.KeyCacheSize)
+	crypto.Encrypters = crypto.NewEncrypterPool(config.Current.EncrypterPoolSize)
+	crypto.MinRSAKeyBits = config.Current.MinRSAKeyBits
+	if config.Current.MaxInflatedSize <= 0 {
+		log.Fatalf("MAX_INFLATED_SIZE must be at least 1")
+	}
+	crypto.MaxInflatedSize = config.Current.MaxInflatedSize
+	json.RejectDuplicateKeys = config.Current.RejectDuplicateKeys
+	if config.Current.MinPBES2Iterations < 1 || config.Current.MinPBES2Iterations > crypto.MaxPBES2Iterations {
+		log.Fatalf("MIN_PBES2_ITERATIONS must be between 1 and %d", crypto.MaxPBES2Iterations)
+	}
+	crypto.MinPBES2Iterations = config.Current.MinPBES2Iterations
+	if config.Current.KeyExpiryGracePeriod < 0 {
+		log.Fatalf("KEY_EXPIRY_GRACE_SECONDS cannot be negative")
+	}
+	crypto.DecryptionGracePeriod = config.Current.KeyExpiryGracePeriod
+	if config.Current.CryptoTimeout <= 0 {
+		log.Fatalf("CRYPTO_TIMEOUT_SECONDS must be at least 1")
+	}
+	if config.Current.ShutdownTimeout <= 0 {
+		log.Fatalf("SHUTDOWN_TIMEOUT_SECONDS must be at least 1")
+	}
+	if config.Current.ReadHeaderTimeout <= 0 {
+		log.Fatalf("READ_HEADER_TIMEOUT_SECONDS must be at least 1")
+	}
+	if config.Current.ReadTimeout < 0 || config.Current.WriteTimeout < 0 || config.Current.IdleTimeout < 0 {
+		log.Fatalf("READ_TIMEOUT_SECONDS, WRITE_TIMEOUT_SECONDS and IDLE_TIMEOUT_SECONDS must not be negative")
+	}
+	if config.Current.Leeway < 0 {
+		log.Fatalf("LEEWAY_SECONDS must not be negative")
+	}
+	if config.Current.ReplayWindow <= 0 {
+		log.Fatalf("REPLAY_WINDOW_SECONDS must be at least 1")
+	}
+	if config.Current.IdempotencyTTL <= 0 {
+		log.Fatalf("IDEMPOTENCY_TTL_SECONDS must be at least 1")
+	}
+	if config.Current.MaxRecipients < 1 {
+		log.Fatalf("MAX_RECIPIENTS must be at least 1")
+	}
+	if config.Current.MaxPlaintextSize < 1 {
+		log.Fatalf("MAX_PLAINTEXT_SIZE must be at least 1")
+	}
+	if len(config.Current.AcceptedContentTypes) == 0 {
+		log.Fatalf("ACCEPTED_CONTENT_TYPES must list at least one media type")
+	}
+	if config.Current.GzipMinSize < 0 {
+		log.Fatalf("GZIP_MIN_SIZE must not be negative")
+	}
+	serverKidHash, err := crypto.ParseThumbprintHash(config.Current.ServerKidHash)
+	if err != nil {
+		log.Fatalf("invalid SERVER_KID_HASH: %v", err)
+	}
+	if serverKidHash == stdcrypto.SHA1 && !config.Current.AllowSHA1ServerKid {
+		log.Fatalf("SERVER_KID_HASH SHA-1 is for legacy interop only, set ALLOW_SHA1_SERVER_KID to use it")
+	}
+	crypto.ServerKidHash = serverKidHash
+	// Spans are dropped unless an exporter is configured, traceparent is still passed on to them
+	exporter, err := tracing.NewExporter(config.Current.TracingExporter)
+	if err != nil {
+		log.Fatalf("invalid TRACING_EXPORTER: %v", err)
+	}
+	shutdownTracing := func(stdcontext.Context) error { return nil }
+	if exporter != nil {
+		shutdownTracing = tracing.SetExporter(exporter)
+	}
+	// Crypto routes are audited to stdout or an append-only file, the events never hold plaintext or keys
+	auditSink, err := audit.NewSink(config.Current.AuditLog)
+	if err != nil {
+		log.Fatalf("invalid AUDIT_LOG: %v", err)
+	}
+	audit.SetSink(auditSink)
+	// Test vectors reuse a fixed CEK and IV and key benchmarks tie up a worker, they must never be reachable in production
+	if config.Current.EnableTestVectors && gin.Mode() == gin.ReleaseMode {
+		log.Fatalf("ENABLE_TEST_VECTORS cannot be set in release mode")
+	}
+
+	// Forbid algorithms centrally, whatever the requests ask for
+	if err := routes.SetAlgorithmPolicy(config.Current.AllowedKeyAlgs, config.Current.AllowedContentEncs, config.Current.AllowedSignatureAlgs); err != nil {
+		log.Fatalf("invalid algorithm allowlist: %v", err)
+	}
+	if err := routes.SetCustomHeaderPolicy(config.Current.AllowedCustomHeaders); err != nil {
+		log.Fatalf("invalid custom header allowlist: %v", err)
+	}
+	if err := routes.SetAPIKeys(config.Current.APIKeyHashes); err != nil {
+		log.Fatalf("invalid API_KEY_HASHES: %v", err)
+	}
+	if err := routes.SetStreamLimits(config.Current.StreamChunkSize, config.Current.MaxConcurrentStreams); err != nil {
+		log.Fatalf("invalid stream limits: %v", err)
+	}
+	if err := routes.SetMasterSecret(config.Current.MasterSecret); err != nil {
+		log.Fatalf("invalid MASTER_SECRET: %v", err)
+	}
+	var blockedContentPatterns []string
+	if config.Current.ContentScanning {
+		if config.Current.BlockedContentPatternsFile == "" {
+			log.Fatalf("CONTENT_SCANNING needs BLOCKED_CONTENT_PATTERNS_FILE")
+		}
+		if blockedContentPatterns, err = routes.ReadContentPatterns(config.Current.BlockedContentPatternsFile); err != nil {
+			log.Fatalf("invalid BLOCKED_CONTENT_PATTERNS_FILE: %v", err)
+		}
+	}
+	if err := routes.SetContentPolicy(config.Current.ContentScanning, blockedContentPatterns); err != nil {
+		log.Fatalf("invalid BLOCKED_CONTENT_PATTERNS_FILE: %v", err)
+	}
+
+	// The keys loaded from disk are imported into the key cache before the first request
+	var bootKeys []string
 
-	router := gin.Default()
+	// Load the published public keys from a directory of PEM files
+	if config.Current.JWKSKeyDir != "" {
+		publicKeys, err := crypto.LoadPublicKeysFromDir(config.Current.JWKSKeyDir)
+		if err != nil {
+			log.Fatalf("failed to load public keys: %v", err)
+		}
+		if err := routes.SetPublicKeySet(publicKeys); err != nil {
+			log.Fatalf("failed to publish public keys: %v", err)
+		}
+
+		// Each subdirectory named after a tenant holds the public keys published to that tenant
+		tenantDirs, err := crypto.TenantDirs(config.Current.JWKSKeyDir)
+		if err != nil {
+			log.Fatalf("failed to list tenant public keys: %v", err)
+		}
+		for tenant, dir := range tenantDirs {
+			publicKeys, err := crypto.LoadPublicKeysFromDir(dir)
+			if err != nil {
+				log.Fatalf("failed to load public keys of tenant %q: %v", tenant, err)
+			}
+			if err := routes.SetTenantPublicKeySet(tenant, publicKeys); err != nil {
+				log.Fatalf("failed to publish public keys of tenant %q: %v", tenant, err)
+			}
+		}
+
+		dirs := []string{config.Current.JWKSKeyDir}
+		for _, dir := range tenantDirs {
+			dirs = append(dirs, dir)
+		}
+		for _, dir := range dirs {
+			publicKeyPEMs, err := crypto.ReadPEMFiles(dir)
+			if err != nil {
+				log.Fatalf("failed to read public keys: %v", err)
+			}
+			bootKeys = append(bootKeys, publicKeyPEMs...)
+		}
+	}
 
-	// Simple group: v1
-	v1 := router.Group("/v1")
-	{
-		v1.POST("/encrypt", routes.EncryptEndpoint)
-		v1.POST("/decrypt", routes.DecryptEndpoint)
+	// Register the server private keys from the key provider, the admin route can reload them later
+	var provider crypto.KeyProvider
+	if config.Current.PrivateKeyDir != "" {
+		provider = crypto.NewFileKeyProvider(config.Current.PrivateKeyDir)
 	}
+	if provider != nil {
+		routes.SetKeyProvider(provider)
+		ctx := stdcontext.Background()
+		keyStore, err := crypto.LoadKeyStore(ctx, provider)
+		if err != nil {
+			log.Fatalf("failed to load private keys: %v", err)
+		}
+		crypto.PrivateKeys.Replace(keyStore)
+		stores := []*crypto.KeyStore{keyStore}
 
-	router.Run(":8080")
+		// The provider also holds the private keys of each tenant
+		tenants, err := provider.Tenants(ctx)
+		if err != nil {
+			log.Fatalf("failed to list tenant private keys: %v", err)
+		}
+		for _, tenant := range tenants {
+			tenantProvider, err := provider.Tenant(tenant)
+			if err != nil {
+				log.Fatalf("failed to load private keys of tenant %q: %v", tenant, err)
+			}
+			keyStore, err := crypto.LoadKeyStore(ctx, tenantProvider)
+			if err != nil {
+				log.Fatalf("failed to load private keys of tenant %q: %v", tenant, err)
+			}
+			crypto.TenantKeys.Store(tenant).Replace(keyStore)
+			stores = append(stores, keyStore)
+		}
+		// Only an API key bound to a tenant may use its keys, without any the tenants are reachable by admin requests alone
+		if len(tenants) > 0 && len(config.Current.APIKeyHashes) == 0 {
+			log.Printf("tenant private keys are loaded but API_KEY_HASHES is empty, v1 requests naming a tenant get 403")
+		}
+
+		for _, store := range stores {
+			publicKeyPEMs, err := store.PublicKeyPEMs()
+			if err != nil {
+				log.Fatalf("failed to export the registered public keys: %v", err)
+			}
+			bootKeys = append(bootKeys, publicKeyPEMs...)
+		}
+	}
+
+	warmed, err := crypto.WarmCache(bootKeys)
+	if err != nil {
+		log.Fatalf("failed to warm the key cache: %v", err)
+	}
+	log.Printf("warmed %d keys in the key cache", warmed)
+
+	// Load the server key used to sign nested JWTs
+	if config.Current.SigningKeyFile != "" {
+		signingKeyPem, err := os.ReadFile(config.Current.SigningKeyFile)
+		if err != nil {
+			log.Fatalf("failed to read signing key: %v", err)
+		}
+		signingKey, err := crypto.ImportRSAPrivateKeyFromPEM(string(signingKeyPem))
+		if err != nil {
+			log.Fatalf("failed to import signing key: %v", err)
+		}
+		if err := routes.SetSigningKey(signingKey); err != nil {
+			log.Fatalf("failed to set up signing key: %v", err)
+		}
+	}
+
+	// Structured request logs replace the default gin logger
+	router := gin.New()
+	// Client IPs come from X-Forwarded-For only behind the configured proxies, otherwise any client could pick its rate limit bucket
+	if err := router.SetTrustedProxies(config.Current.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	// A panic is answered with a bare 500, recovering after the logger still logs the request
+	router.Use(middleware.RequestID(), middleware.Tracing(), middleware.Logger(config.Current.LogFormat), middleware.Recovery(config.Current.LogFormat))
+
+	// Browser clients are served from the allowed origins only, preflights are answered before the rate limiter
+	cors := middleware.CORSConfig{
+		AllowedOrigins:   config.Current.CORSAllowedOrigins,
+		AllowedMethods:   config.Current.CORSAllowedMethods,
+		AllowedHeaders:   config.Current.CORSAllowedHeaders,
+		ExposedHeaders:   []string{middleware.RequestIDHeader, "Retry-After", routes.WarningResponseHeader, middleware.IdempotentReplayedHeader, routes.ResponseSignatureHeader, routes.TokenIDResponseHeader, routes.ServerKidResponseHeader},
+		AllowCredentials: config.Current.CORSAllowCredentials,
+		MaxAge:           config.Current.CORSMaxAge,
+	}
+	if err := cors.Validate(); err != nil {
+		log.Fatalf("invalid CORS configuration: %v", err)
+	}
+	router.Use(middleware.CORS(cors))
+
+	router.GET("/.well-known/jwks.json", routes.Compressed(routes.JWKSEndpoint)...)
+	router.GET("/tenants/:tenant/.well-known/jwks.json", routes.Compressed(routes.JWKSEndpoint)...)
+	router.GET("/keys/:kid", routes.PublicKeyEndpoint)
+	router.GET("/tenants/:tenant/keys/:kid", routes.PublicKeyEndpoint)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/healthz", routes.HealthEndpoint)
+	router.GET("/readyz", routes.ReadyEndpoint)
+
+	// The API is versioned, /v1 keeps its contract when a later version changes it
+	routes.RegisterV1(router)
+
+	// SIGTERM stops accepting connections, encrypt and decrypt calls in flight still get to finish
+	options := server.Options{
+		ReadHeaderTimeout: config.Current.ReadHeaderTimeout,
+		ReadTimeout:       config.Current.ReadTimeout,
+		WriteTimeout:      config.Current.WriteTimeout,
+		IdleTimeout:       config.Current.IdleTimeout,
+		ShutdownTimeout:   config.Current.ShutdownTimeout,
+		H2C:               config.Current.H2C,
+	}
+	if err := server.Run(":8080", router, options); err != nil {
+		log.Fatalf("server stopped: %v", err)
+	}
+
+	// Flush the spans still batched, within the same grace period as the requests
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), config.Current.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("failed to flush spans: %v", err)
+	}
+	log.Printf("server stopped")
 }
@@ -0,0 +1,21 @@
+package model
+
+type AlgorithmsResponse struct {
+	KeyAlgorithms AlgorithmCategory `json:"keyAlgorithms"`
+	// LegacyKeyAlgorithms are only accepted with allowLegacyRSA15 or allowLegacyHash
+	LegacyKeyAlgorithms []string `json:"legacyKeyAlgorithms"`
+	// NonStandardKeyAlgorithms are not in the JOSE registry, only recipients that agreed on them can decrypt
+	NonStandardKeyAlgorithms []string          `json:"nonStandardKeyAlgorithms"`
+	ContentEncryptions       AlgorithmCategory `json:"contentEncryptions"`
+	SignatureAlgorithms      AlgorithmCategory `json:"signatureAlgorithms"`
+	KeyTypes                 []string          `json:"keyTypes"`
+	Curves                   []string          `json:"curves"`
+	Serializations           AlgorithmCategory `json:"serializations"`
+}
+
+type AlgorithmCategory struct {
+	Supported []string `json:"supported"`
+	// Default is used when a request picks none, Defaults replaces it where the choice depends on the key
+	Default  string            `json:"default,omitempty"`
+	Defaults map[string]string `json:"defaults,omitempty"`
+}
@@ -0,0 +1,6 @@
+package model
+
+type BatchEncryptResult struct {
+	Jwe   string         `json:"jwe,omitempty"`
+	Error *ErrorResponse `json:"error,omitempty"`
+}
@@ -0,0 +1,13 @@
+package model
+
+type BatchRewrapRequest struct {
+	Ciphertexts       []string `json:"ciphertexts" validate:"required,min=1,dive,required"`
+	PrivateKeyPem     string   `json:"privateKeyPem" validate:"required,pem=private"`
+	PublicKeyPem      string   `json:"publicKeyPem" validate:"required,pem=public"`
+	ContentEncryption string   `json:"contentEncryption" validate:"omitempty,oneof=A128GCM A192GCM A256GCM A128CBC-HS256 A256CBC-HS512"`
+	KeyAlgorithm      string   `json:"keyAlgorithm" validate:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 RSA-OAEP-384 RSA-OAEP-512 RSA1_5 ECDH-ES+A256KW"`
+	AllowLegacyRSA15  bool     `json:"allowLegacyRSA15"`
+	AllowLegacyHash   bool     `json:"allowLegacyHash"`
+	// PreserveHeaders names the protected headers copied to the new JWEs, cty when not set
+	PreserveHeaders []string `json:"preserveHeaders" validate:"omitempty,max=16,dive,required"`
+}
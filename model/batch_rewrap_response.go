@@ -0,0 +1,18 @@
+package model
+
+type BatchRewrapResponse struct {
+	Results   []BatchRewrapResult `json:"results"`
+	Rewrapped int                 `json:"rewrapped"`
+	Failed    int                 `json:"failed"`
+	// Errors counts the failed items by error code
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+type BatchRewrapResult struct {
+	// Status is "rewrapped" or "failed", Error says why an item failed
+	Status string         `json:"status"`
+	JWE    string         `json:"jwe,omitempty"`
+	Alg    string         `json:"alg,omitempty"`
+	Enc    string         `json:"enc,omitempty"`
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
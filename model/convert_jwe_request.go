@@ -0,0 +1,7 @@
+package model
+
+type ConvertJWERequest struct {
+	JWE string `json:"jwe" validate:"required"`
+	// Serialization is the form to convert to, a token already in it is returned as is
+	Serialization string `json:"serialization" validate:"required,oneof=compact json"`
+}
@@ -0,0 +1,9 @@
+package model
+
+import "encoding/json"
+
+type ConvertJWEResponse struct {
+	Serialization string `json:"serialization"`
+	// JWE is a string for the compact serialization and an object for the JSON one
+	JWE json.RawMessage `json:"jwe"`
+}
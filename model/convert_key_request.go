@@ -0,0 +1,12 @@
+package model
+
+import "encoding/json"
+
+type ConvertKeyRequest struct {
+	// KeyPem or KeyJwk holds the key to convert, public or private, Format names the output
+	KeyPem string          `json:"keyPem"`
+	KeyJwk json.RawMessage `json:"keyJwk" validate:"omitempty,mutex=KeyPem"`
+	Format string          `json:"format" validate:"required,oneof=pem jwk"`
+	// PrivateKeyFormat is the encoding of a private key converted to PEM, pkcs8 by default, pkcs1 for RSA keys only
+	PrivateKeyFormat string `json:"privateKeyFormat" validate:"omitempty,oneof=pkcs8 pkcs1"`
+}
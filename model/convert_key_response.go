@@ -0,0 +1,11 @@
+package model
+
+import "encoding/json"
+
+type ConvertKeyResponse struct {
+	KeyPem     string          `json:"keyPem,omitempty"`
+	KeyJwk     json.RawMessage `json:"keyJwk,omitempty"`
+	Kid        string          `json:"kid"`
+	Thumbprint string          `json:"thumbprint"`
+	Private    bool            `json:"private"`
+}
@@ -0,0 +1,7 @@
+package model
+
+type DecryptFailureDetails struct {
+	ServerKid string `json:"serverKid,omitempty"`
+	Alg       string `json:"alg,omitempty"`
+	Enc       string `json:"enc,omitempty"`
+}
@@ -1,7 +1,30 @@
 package model
 
+import "encoding/json"
+
 type DecryptRequest struct {
 	Ciphertext      string `json:"ciphertext" validate:"required"`
 	SecretKey       string `json:"secretKey"`
 	SecretKeyBase64 string `json:"secretKeyBase64"`
+	PrivateKeyPem   string `json:"privateKeyPem" validate:"omitempty,pem=private"`
+	// PrivateKeyJwk is an RSA or EC private JWK marked with use enc or a decrypt key_ops
+	PrivateKeyJwk json.RawMessage `json:"privateKeyJwk" validate:"omitempty,mutex=PrivateKeyPem SecretKey SecretKeyBase64"`
+	// Password decrypts PBES2 tokens
+	Password string `json:"password" validate:"omitempty,mutex=PrivateKeyPem PrivateKeyJwk SecretKey SecretKeyBase64"`
+	// Audience is the aud expected in JWT claims payloads
+	Audience string `json:"audience" validate:"omitempty,max=256"`
+	// MaxAgeSeconds rejects tokens whose iat header is older, overriding the configured maximum age
+	MaxAgeSeconds int `json:"maxAgeSeconds" validate:"omitempty,min=1"`
+	// RejectReplay refuses a token already decrypted within the replay window, for one-time tokens
+	RejectReplay bool `json:"rejectReplay"`
+	// OutputEncoding base64url returns the plaintext base64url encoded, utf8 refuses binary plaintexts
+	OutputEncoding string `json:"outputEncoding" validate:"omitempty,oneof=utf8 base64url"`
+	// DetachedCiphertext is the base64url ciphertext of a JWE sent without it, put back before parsing
+	DetachedCiphertext string `json:"detachedCiphertext" validate:"omitempty,base64rawurl"`
+	// FailureMetadata adds the server_kid, alg and enc of the token to a key mismatch error, for debugging which key was used
+	FailureMetadata bool `json:"failureMetadata"`
+	// SecretKeyBase64 may be base64 or base64url, padded or not, StrictBase64 only accepts unpadded base64url
+	StrictBase64 bool `json:"strictBase64"`
+	// Stream returns the plaintext alone as an application/octet-stream body written in chunks, for large payloads
+	Stream bool `json:"stream" validate:"mutex=OutputEncoding"`
 }
@@ -0,0 +1,23 @@
+package model
+
+type DecryptResponse struct {
+	Plaintext string `json:"plaintext"`
+	// PlaintextBase64 replaces Plaintext when the plaintext isn't valid UTF-8, as with encrypted files
+	PlaintextBase64 string `json:"plaintextBase64,omitempty"`
+	// PlaintextEncoding is the encoding of Plaintext when the request asked for one
+	PlaintextEncoding string `json:"plaintextEncoding,omitempty"`
+	// ContentType is the cty header, the media type of an encrypted file
+	ContentType string `json:"contentType,omitempty"`
+	ServerKid   string `json:"server_kid,omitempty"`
+	// RecipientIndex is the recipient of a JSON serialized JWE the key opened, 0 for compact tokens
+	RecipientIndex int `json:"recipientIndex"`
+	// AdditionalData is the base64url AAD the token authenticated, if any
+	AdditionalData string `json:"additionalData,omitempty"`
+	// PartyUInfo and PartyVInfo are the base64url apu and apv headers the ECDH-ES key agreement was bound to
+	PartyUInfo string `json:"apu,omitempty"`
+	PartyVInfo string `json:"apv,omitempty"`
+	// RecipientHeader is the unprotected header of the recipient the key opened, JSON serialized tokens only
+	RecipientHeader map[string]interface{} `json:"recipientHeader,omitempty"`
+	// Fields replaces Plaintext for a token encrypted from named fields, a JSON object of strings with cty application/json
+	Fields map[string]string `json:"fields,omitempty"`
+}
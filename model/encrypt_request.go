@@ -1,7 +1,70 @@
 package model
 
+import "encoding/json"
+
 type EncryptRequest struct {
-	Plaintext      string `json:"plaintext" validate:"required"`
-	PublicKeyPem   string `json:"publicKeyPem"`
-	CertificatePem string `json:"certificatePem"`
+	Plaintext         string            `json:"plaintext" validate:"nonempty=AllowEmpty Fields"`
+	PublicKeyPem      string            `json:"publicKeyPem" validate:"omitempty,pem=public"`
+	CertificatePem    string            `json:"certificatePem" validate:"omitempty,pem=certificate"`
+	SymmetricKey      string            `json:"symmetricKey" validate:"omitempty,flexbase64=StrictBase64,mutex=PublicKeyPem CertificatePem PublicKeyJwk"`
+	PublicKeyJwk      json.RawMessage   `json:"publicKeyJwk" validate:"omitempty,mutex=PublicKeyPem CertificatePem"`
+	ContentEncryption string            `json:"contentEncryption" validate:"omitempty,oneof=A128GCM A192GCM A256GCM A128CBC-HS256 A256CBC-HS512"`
+	KeyAlgorithm      string            `json:"keyAlgorithm" validate:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 RSA-OAEP-384 RSA-OAEP-512 RSA1_5 ECDH-ES+A256KW dir A128KW A192KW A256KW A128GCMKW A192GCMKW A256GCMKW PBES2-HS256+A128KW PBES2-HS512+A256KW"`
+	AllowLegacyRSA15  bool              `json:"allowLegacyRSA15"`
+	AllowLegacyHash   bool              `json:"allowLegacyHash"`
+	Serialization     string            `json:"serialization" validate:"omitempty,oneof=compact json"`
+	ProtectedHeaders  map[string]string `json:"protectedHeaders"`
+	Compress          bool              `json:"compress"`
+	// CriticalHeaders names protected headers to list in crit, recipients reject the token unless they understand them
+	CriticalHeaders []string `json:"criticalHeaders" validate:"omitempty,max=16,dive,required"`
+	// Password switches to PBES2, PBES2Iterations is the p2c and defaults to 600000
+	Password        string `json:"password" validate:"omitempty,min=8,mutex=PublicKeyPem CertificatePem PublicKeyJwk SymmetricKey"`
+	PBES2Iterations int    `json:"pbes2Iterations" validate:"omitempty,min=1"`
+	// Kid is emitted as the JWE kid header, a pointer so an explicit empty value is rejected.
+	// Without key material it selects the registered server key with that thumbprint.
+	Kid *string `json:"kid" validate:"omitempty,min=1,max=256,printascii"`
+	// ServerKidHash picks the server_kid thumbprint hash over the configured one, SHA-1 only where legacy interop is allowed
+	ServerKidHash string `json:"serverKidHash" validate:"omitempty,oneof=SHA-1 SHA-256 SHA-384 SHA-512"`
+	// IncludeServerKid false leaves the server_kid headers out and skips the thumbprint, nil means true
+	IncludeServerKid *bool `json:"includeServerKid"`
+	// Typ is emitted as the typ header, the media type systems routing tokens by their declared type look at
+	Typ string `json:"typ" validate:"omitempty,max=256,printascii,mediatype"`
+	// PublicKeyJwks is a JWK set, the key to encrypt to is the encryption key whose kid matches Kid
+	PublicKeyJwks json.RawMessage `json:"publicKeyJwks" validate:"omitempty,mutex=PublicKeyPem CertificatePem PublicKeyJwk SymmetricKey Password"`
+	// CertificateChainPem is a PEM bundle, leaf first, emitted as the x5c and x5t#S256 headers
+	CertificateChainPem string `json:"certificateChainPem" validate:"omitempty,pem=certificate"`
+	// Recipients switches to multi-recipient mode, the result is always the JSON serialization
+	Recipients []RecipientSpec `json:"recipients" validate:"omitempty,dive"`
+	// AdditionalData is base64 JWE AAD, authenticated but not encrypted, json serialization only
+	AdditionalData string `json:"additionalData" validate:"omitempty,flexbase64=StrictBase64"`
+	// Audience, Subject and ExpiresInSeconds send the plaintext JSON object as JWT claims with cty JWT
+	Audience         string `json:"audience" validate:"omitempty,max=256"`
+	Subject          string `json:"subject" validate:"omitempty,max=256"`
+	ExpiresInSeconds int    `json:"expiresInSeconds" validate:"omitempty,min=1"`
+	// IssuedAt stamps the iat protected header, NotBeforeInSeconds the nbf header that many seconds from now
+	IssuedAt           bool `json:"issuedAt"`
+	NotBeforeInSeconds *int `json:"notBeforeInSeconds" validate:"omitempty,min=0,max=31536000"`
+	// DetachedContent returns the ciphertext apart from the JWE, the response is then always JSON
+	DetachedContent bool `json:"detachedContent"`
+	// PartyUInfo and PartyVInfo are the base64url apu and apv headers, bound into the ECDH-ES key agreement
+	PartyUInfo string `json:"apu" validate:"omitempty,base64rawurl,max=1024,mutex=SymmetricKey Password Recipients"`
+	PartyVInfo string `json:"apv" validate:"omitempty,base64rawurl,max=1024,mutex=SymmetricKey Password Recipients"`
+	// PlaintextEncoding base64url sends binary plaintexts, Plaintext is decoded before encrypting
+	PlaintextEncoding string `json:"plaintextEncoding" validate:"omitempty,oneof=utf8 base64url"`
+	// ContentEncryptionKey is a base64 CEK wrapped in place of a random one, only with ALLOW_CLIENT_CEK.
+	// Every message encrypted under a CEK can be read with it, a supplied CEK must never be reused.
+	ContentEncryptionKey string `json:"contentEncryptionKey" validate:"omitempty,flexbase64=StrictBase64,mutex=Recipients Password"`
+	// AllowEmpty lets an empty Plaintext through, the token then only proves who encrypted it
+	AllowEmpty bool `json:"allowEmpty"`
+	// SymmetricKey, AdditionalData and ContentEncryptionKey may be base64 or base64url, padded or not.
+	// StrictBase64 only accepts the unpadded base64url of the JOSE specs.
+	StrictBase64 bool `json:"strictBase64"`
+	// Fields replaces Plaintext with named values, encrypted together as a JSON object with cty application/json
+	Fields map[string]string `json:"fields" validate:"omitempty,min=1,mutex=Plaintext PlaintextEncoding Audience Subject ExpiresInSeconds,dive,keys,required,endkeys"`
+	// KeyDerivationInfo derives the shared secret from the master secret with this HKDF info label in place of SymmetricKey.
+	// The label is emitted as the hkdf_info header, so decryption derives the same secret.
+	KeyDerivationInfo string `json:"keyDerivationInfo" validate:"omitempty,max=256,printascii,mutex=SymmetricKey PublicKeyPem CertificatePem PublicKeyJwk PublicKeyJwks Password Recipients"`
+	// IncludeTokenID stamps a random jti protected header, returned in X-Token-ID and recorded in the audit events
+	// of the encrypt and of every decrypt of the token
+	IncludeTokenID bool `json:"includeTokenId"`
 }
@@ -0,0 +1,14 @@
+package model
+
+import "encoding/json"
+
+type EncryptResponse struct {
+	// JWE is a string for the compact serialization and an object for the JSON one
+	JWE           json.RawMessage `json:"jwe"`
+	Serialization string          `json:"serialization"`
+	Kid           string          `json:"kid,omitempty"`
+	Alg           string          `json:"alg,omitempty"`
+	Enc           string          `json:"enc"`
+	// Ciphertext is the base64url ciphertext of a detached JWE, whose own ciphertext is left empty
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
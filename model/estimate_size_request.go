@@ -0,0 +1,19 @@
+package model
+
+type EstimateSizeRequest struct {
+	// PlaintextLength is in bytes, a pointer so an explicit 0 is told apart from a missing value
+	PlaintextLength   *int   `json:"plaintextLength" validate:"required,min=0"`
+	KeyAlgorithm      string `json:"keyAlgorithm" validate:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 RSA-OAEP-384 RSA-OAEP-512 RSA1_5 ECDH-ES+A256KW dir A128KW A192KW A256KW A128GCMKW A192GCMKW A256GCMKW PBES2-HS256+A128KW PBES2-HS512+A256KW"`
+	ContentEncryption string `json:"contentEncryption" validate:"omitempty,oneof=A128GCM A192GCM A256GCM A128CBC-HS256 A256CBC-HS512"`
+	// KeySize is the RSA modulus in bits, 2048 by default. Curve picks an EC or X25519 recipient, P-256 by default for ECDH-ES.
+	KeySize int    `json:"keySize" validate:"omitempty,min=1024,max=16384"`
+	Curve   string `json:"curve" validate:"omitempty,oneof=P-256 P-384 P-521 X25519"`
+	// Kid, ServerKidHash and IncludeServerKid mirror the encrypt request, they change the header length
+	Kid              string `json:"kid" validate:"omitempty,max=256,printascii"`
+	ServerKidHash    string `json:"serverKidHash" validate:"omitempty,oneof=SHA-1 SHA-256 SHA-384 SHA-512"`
+	IncludeServerKid *bool  `json:"includeServerKid"`
+	PBES2Iterations  int    `json:"pbes2Iterations" validate:"omitempty,min=1"`
+	// CompressionRatio is the expected compressed size over the plaintext size, without one the plaintext is taken as incompressible
+	Compress         bool    `json:"compress"`
+	CompressionRatio float64 `json:"compressionRatio" validate:"omitempty,gt=0,lte=1"`
+}
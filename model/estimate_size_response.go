@@ -0,0 +1,10 @@
+package model
+
+type EstimateSizeResponse struct {
+	// Size is the length in bytes of the compact JWE
+	Size int    `json:"size"`
+	Alg  string `json:"alg"`
+	Enc  string `json:"enc"`
+	// Exact is false for compressed tokens, whose size depends on the plaintext itself
+	Exact bool `json:"exact"`
+}
@@ -0,0 +1,11 @@
+package model
+
+type FileEncryptRequest struct {
+	PublicKeyPem      string `json:"publicKeyPem" validate:"required,pem=public"`
+	ContentEncryption string `json:"contentEncryption" validate:"omitempty,oneof=A128GCM A192GCM A256GCM A128CBC-HS256 A256CBC-HS512"`
+	KeyAlgorithm      string `json:"keyAlgorithm" validate:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 RSA-OAEP-384 RSA-OAEP-512 RSA1_5 ECDH-ES+A256KW"`
+	AllowLegacyRSA15  bool   `json:"allowLegacyRSA15"`
+	AllowLegacyHash   bool   `json:"allowLegacyHash"`
+	// ContentType is the media type of the uploaded file, emitted as the cty header
+	ContentType string `json:"contentType" validate:"required,max=256"`
+}
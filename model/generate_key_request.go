@@ -0,0 +1,9 @@
+package model
+
+type GenerateKeyRequest struct {
+	KeyType string `json:"keyType" validate:"required,oneof=RSA EC"`
+	Size    int    `json:"size" validate:"required_if=KeyType RSA,omitempty,oneof=2048 3072 4096"`
+	Curve   string `json:"curve" validate:"required_if=KeyType EC,omitempty,oneof=P-256 P-384 P-521"`
+	// PrivateKeyFormat is the encoding of the private key PEM, pkcs8 by default, pkcs1 for RSA keys only
+	PrivateKeyFormat string `json:"privateKeyFormat" validate:"omitempty,oneof=pkcs8 pkcs1"`
+}
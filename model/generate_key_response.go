@@ -0,0 +1,7 @@
+package model
+
+type GenerateKeyResponse struct {
+	PublicKeyPem  string `json:"publicKeyPem"`
+	PrivateKeyPem string `json:"privateKeyPem"`
+	Thumbprint    string `json:"thumbprint"`
+}
@@ -0,0 +1,5 @@
+package model
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
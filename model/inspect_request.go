@@ -0,0 +1,11 @@
+package model
+
+type InspectRequest struct {
+	Ciphertext string `json:"ciphertext" validate:"required"`
+	// MaxAgeSeconds rejects tokens whose iat header is older, overriding the configured maximum age
+	MaxAgeSeconds int `json:"maxAgeSeconds" validate:"omitempty,min=1"`
+	// Components adds the segments of a compact JWE to the response, never the CEK or the plaintext
+	Components bool `json:"components"`
+	// Strict rejects a token whose IV or tag length doesn't match its enc
+	Strict bool `json:"strict"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type InspectResponse struct {
+	Header map[string]interface{} `json:"header"`
+	// Typ is the declared type from the typ header, for clients routing tokens by it
+	Typ string `json:"typ,omitempty"`
+	// Components are the decoded segments, when the request asked for them
+	Components *JWEComponents `json:"components,omitempty"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type JWEComponents struct {
+	ProtectedHeader  map[string]interface{} `json:"protectedHeader"`
+	EncryptedKey     string                 `json:"encryptedKey"`
+	IV               string                 `json:"iv"`
+	CiphertextLength int                    `json:"ciphertextLength"`
+	Tag              string                 `json:"tag"`
+}
@@ -0,0 +1,13 @@
+package model
+
+type KeyBenchmarkRequest struct {
+	PublicKeyPem      string `json:"publicKeyPem" validate:"required,pem=public"`
+	ContentEncryption string `json:"contentEncryption" validate:"omitempty,oneof=A128GCM A192GCM A256GCM A128CBC-HS256 A256CBC-HS512"`
+	KeyAlgorithm      string `json:"keyAlgorithm" validate:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 RSA-OAEP-384 RSA-OAEP-512 RSA1_5 ECDH-ES+A256KW"`
+	AllowLegacyRSA15  bool   `json:"allowLegacyRSA15"`
+	AllowLegacyHash   bool   `json:"allowLegacyHash"`
+	// Iterations is the number of timed encryptions, 100 when unset
+	Iterations int `json:"iterations" validate:"omitempty,min=1,max=1000"`
+	// PlaintextSize is the length of the random plaintext encrypted each time, 1 KiB when unset
+	PlaintextSize int `json:"plaintextSize" validate:"omitempty,min=1,max=1048576"`
+}
@@ -0,0 +1,14 @@
+package model
+
+type KeyBenchmarkResponse struct {
+	KeyType       string `json:"keyType"`
+	KeySize       int    `json:"keySize"`
+	Alg           string `json:"alg"`
+	Enc           string `json:"enc"`
+	Iterations    int    `json:"iterations"`
+	PlaintextSize int    `json:"plaintextSize"`
+	// Latencies of a single encryption in microseconds
+	AverageMicroseconds float64 `json:"averageMicroseconds"`
+	P99Microseconds     float64 `json:"p99Microseconds"`
+	OpsPerSecond        float64 `json:"opsPerSecond"`
+}
@@ -0,0 +1,10 @@
+package model
+
+type KeyCacheResponse struct {
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+	Hits     uint64 `json:"hits"`
+	Misses   uint64 `json:"misses"`
+	// Thumbprints of the cached keys, the most recently used first
+	Thumbprints []string `json:"thumbprints"`
+}
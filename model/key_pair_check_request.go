@@ -0,0 +1,6 @@
+package model
+
+type KeyPairCheckRequest struct {
+	PublicKeyPem  string `json:"publicKeyPem" validate:"required,pem=public"`
+	PrivateKeyPem string `json:"privateKeyPem" validate:"required,pem=private"`
+}
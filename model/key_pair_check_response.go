@@ -0,0 +1,10 @@
+package model
+
+type KeyPairCheckResponse struct {
+	Match bool `json:"match"`
+	// Method is how the pair was exercised: encrypt-decrypt, sign-verify or key-agreement
+	Method string `json:"method"`
+	// Thumbprint is the SHA-256 thumbprint both keys share, only set when they match
+	Thumbprint string `json:"thumbprint,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
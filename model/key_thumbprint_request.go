@@ -0,0 +1,5 @@
+package model
+
+type KeyThumbprintRequest struct {
+	Thumbprint string `json:"thumbprint" validate:"required"`
+}
@@ -0,0 +1,17 @@
+package model
+
+type ListKeysResponse struct {
+	Tenant  string       `json:"tenant,omitempty"`
+	Primary string       `json:"primary"`
+	Keys    []KeySummary `json:"keys"`
+}
+
+type KeySummary struct {
+	Thumbprint string `json:"thumbprint"`
+	KeyType    string `json:"keyType"`
+	Primary    bool   `json:"primary"`
+	// Algorithms lists the only algorithms the key may be used with, left out when it allows any
+	Algorithms []string `json:"algorithms,omitempty"`
+	// NotAfter is when the key expires, in RFC 3339, left out when it never does
+	NotAfter string `json:"notAfter,omitempty"`
+}
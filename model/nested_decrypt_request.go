@@ -0,0 +1,10 @@
+package model
+
+type NestedDecryptRequest struct {
+	Ciphertext    string `json:"ciphertext" validate:"required"`
+	PrivateKeyPem string `json:"privateKeyPem" validate:"required,pem=private"`
+	// PublicKeyPem verifies the JWS the JWE carries, the key of whoever signed it
+	PublicKeyPem string `json:"publicKeyPem" validate:"required,pem=public"`
+	// Audience is the aud expected when the signed payload is a JWT claims set
+	Audience string `json:"audience" validate:"omitempty,max=256"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type NestedDecryptResponse struct {
+	Payload string                 `json:"payload"`
+	Header  map[string]interface{} `json:"header"`
+	// DecryptionKid and VerificationKid are the thumbprints of the key that decrypted the JWE and the one that verified the JWS
+	DecryptionKid   string `json:"decryptionKid"`
+	VerificationKid string `json:"verificationKid"`
+}
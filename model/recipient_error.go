@@ -0,0 +1,7 @@
+package model
+
+type RecipientError struct {
+	Index   int    `json:"index"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
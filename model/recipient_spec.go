@@ -0,0 +1,10 @@
+package model
+
+type RecipientSpec struct {
+	PublicKeyPem     string `json:"publicKeyPem" validate:"required,pem=public"`
+	KeyAlgorithm     string `json:"keyAlgorithm" validate:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 RSA-OAEP-384 RSA-OAEP-512 RSA1_5 ECDH-ES+A256KW"`
+	AllowLegacyRSA15 bool   `json:"allowLegacyRSA15"`
+	AllowLegacyHash  bool   `json:"allowLegacyHash"`
+	// Header is emitted as the unprotected header of the recipient, a kid in it replaces the thumbprint
+	Header map[string]string `json:"header"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type RegisterKeyResponse struct {
+	Thumbprint   string `json:"thumbprint"`
+	KeyType      string `json:"keyType"`
+	PublicKeyPem string `json:"publicKeyPem"`
+	Subject      string `json:"subject"`
+	NotAfter     string `json:"notAfter"`
+}
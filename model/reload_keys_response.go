@@ -0,0 +1,8 @@
+package model
+
+type ReloadKeysResponse struct {
+	Tenant      string   `json:"tenant,omitempty"`
+	Count       int      `json:"count"`
+	Primary     string   `json:"primary"`
+	Thumbprints []string `json:"thumbprints"`
+}
@@ -0,0 +1,13 @@
+package model
+
+type RewrapRequest struct {
+	Ciphertext        string `json:"ciphertext" validate:"required"`
+	PrivateKeyPem     string `json:"privateKeyPem" validate:"required,pem=private"`
+	PublicKeyPem      string `json:"publicKeyPem" validate:"required,pem=public"`
+	ContentEncryption string `json:"contentEncryption" validate:"omitempty,oneof=A128GCM A192GCM A256GCM A128CBC-HS256 A256CBC-HS512"`
+	KeyAlgorithm      string `json:"keyAlgorithm" validate:"omitempty,oneof=RSA-OAEP RSA-OAEP-256 RSA-OAEP-384 RSA-OAEP-512 RSA1_5 ECDH-ES+A256KW"`
+	AllowLegacyRSA15  bool   `json:"allowLegacyRSA15"`
+	AllowLegacyHash   bool   `json:"allowLegacyHash"`
+	// PreserveHeaders names the protected headers copied to the new JWE, cty when not set
+	PreserveHeaders []string `json:"preserveHeaders" validate:"omitempty,max=16,dive,required"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type RewrapResponse struct {
+	JWE                 string `json:"jwe"`
+	SourceThumbprint    string `json:"sourceThumbprint"`
+	RecipientThumbprint string `json:"recipientThumbprint"`
+	Alg                 string `json:"alg"`
+	Enc                 string `json:"enc"`
+}
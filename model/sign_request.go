@@ -0,0 +1,13 @@
+package model
+
+type SignRequest struct {
+	Payload       string `json:"payload" validate:"required"`
+	PrivateKeyPem string `json:"privateKeyPem" validate:"required_without=Signers,omitempty,pem=private,mutex=Signers"`
+	Algorithm     string `json:"algorithm" validate:"omitempty,oneof=RS256 RS384 RS512 PS256 PS384 PS512 ES256 EdDSA,mutex=Signers"`
+	// PSSSaltLength is the salt length in bytes of the PS algorithms, the hash length when not set
+	PSSSaltLength *int `json:"pssSaltLength" validate:"omitempty,min=1,mutex=Signers"`
+	// Signers each add a signature over the payload, the result is always the JSON serialization
+	Signers []SignerSpec `json:"signers" validate:"omitempty,min=1,max=16,dive"`
+	// Canonicalize signs the JSON payload in its RFC 8785 canonical form
+	Canonicalize bool `json:"canonicalize"`
+}
@@ -0,0 +1,8 @@
+package model
+
+type SignatureResult struct {
+	Index int    `json:"index"`
+	Alg   string `json:"alg"`
+	Kid   string `json:"kid,omitempty"`
+	Valid bool   `json:"valid"`
+}
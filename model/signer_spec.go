@@ -0,0 +1,7 @@
+package model
+
+type SignerSpec struct {
+	PrivateKeyPem string `json:"privateKeyPem" validate:"required,pem=private"`
+	Algorithm     string `json:"algorithm" validate:"omitempty,oneof=RS256 RS384 RS512 PS256 PS384 PS512 ES256 EdDSA"`
+	PSSSaltLength *int   `json:"pssSaltLength" validate:"omitempty,min=1"`
+}
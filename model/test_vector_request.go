@@ -0,0 +1,13 @@
+package model
+
+type TestVectorRequest struct {
+	Plaintext         string `json:"plaintext" validate:"required"`
+	SymmetricKey      string `json:"symmetricKey" validate:"required,base64rawurl"`
+	KeyAlgorithm      string `json:"keyAlgorithm" validate:"omitempty,oneof=dir A128KW A192KW A256KW"`
+	ContentEncryption string `json:"contentEncryption" validate:"omitempty,oneof=A128GCM A192GCM A256GCM A128CBC-HS256 A256CBC-HS512"`
+	// ContentEncryptionKey and IV are base64url, the CEK is wrapped by the key wrap algorithms and left out for dir
+	ContentEncryptionKey string            `json:"contentEncryptionKey" validate:"omitempty,base64rawurl"`
+	IV                   string            `json:"iv" validate:"required,base64rawurl"`
+	ProtectedHeaders     map[string]string `json:"protectedHeaders"`
+	Kid                  *string           `json:"kid" validate:"omitempty,min=1,max=256,printascii"`
+}
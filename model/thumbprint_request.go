@@ -0,0 +1,6 @@
+package model
+
+type ThumbprintRequest struct {
+	PublicKeyPem string `json:"publicKeyPem" validate:"required,pem=public"`
+	Hash         string `json:"hash" validate:"omitempty,oneof=SHA-256 SHA-1 SHA-384 SHA-512"`
+}
@@ -0,0 +1,9 @@
+package model
+
+type ThumbprintResponse struct {
+	Thumbprint   string `json:"thumbprint"`
+	Hash         string `json:"hash"`
+	CanonicalJwk string `json:"canonicalJwk"`
+	// ThumbprintURI is the RFC 9278 form of the thumbprint, absent for SHA-1
+	ThumbprintURI string `json:"thumbprintUri,omitempty"`
+}
@@ -0,0 +1,14 @@
+package model
+
+type TrialDecryptRequest struct {
+	Ciphertext     string   `json:"ciphertext" validate:"required"`
+	PrivateKeyPems []string `json:"privateKeyPems" validate:"required,min=1,max=16,dive,pem=private"`
+	// Audience is the aud expected in JWT claims payloads
+	Audience string `json:"audience" validate:"omitempty,max=256"`
+	// MaxAgeSeconds rejects tokens whose iat header is older, overriding the configured maximum age
+	MaxAgeSeconds int `json:"maxAgeSeconds" validate:"omitempty,min=1"`
+	// RejectReplay refuses a token already decrypted within the replay window, for one-time tokens
+	RejectReplay bool `json:"rejectReplay"`
+	// OutputEncoding base64url returns the plaintext base64url encoded, utf8 refuses binary plaintexts
+	OutputEncoding string `json:"outputEncoding" validate:"omitempty,oneof=utf8 base64url"`
+}
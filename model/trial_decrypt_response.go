@@ -0,0 +1,18 @@
+package model
+
+type TrialDecryptResponse struct {
+	Plaintext  string `json:"plaintext"`
+	Thumbprint string `json:"thumbprint"`
+	ServerKid  string `json:"server_kid,omitempty"`
+	// RecipientIndex is the recipient of a JSON serialized JWE the key opened, 0 for compact tokens
+	RecipientIndex int `json:"recipientIndex"`
+	// AdditionalData is the base64url AAD the token authenticated, if any
+	AdditionalData string `json:"additionalData,omitempty"`
+	// PartyUInfo and PartyVInfo are the base64url apu and apv headers the ECDH-ES key agreement was bound to
+	PartyUInfo string `json:"apu,omitempty"`
+	PartyVInfo string `json:"apv,omitempty"`
+	// RecipientHeader is the unprotected header of the recipient the key opened, JSON serialized tokens only
+	RecipientHeader map[string]interface{} `json:"recipientHeader,omitempty"`
+	// PlaintextEncoding is the encoding of Plaintext when the request asked for one
+	PlaintextEncoding string `json:"plaintextEncoding,omitempty"`
+}
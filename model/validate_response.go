@@ -0,0 +1,9 @@
+package model
+
+type ValidateResponse struct {
+	Valid     bool   `json:"valid"`
+	Kid       string `json:"kid,omitempty"`
+	ServerKid string `json:"server_kid,omitempty"`
+	Alg       string `json:"alg,omitempty"`
+	Enc       string `json:"enc"`
+}
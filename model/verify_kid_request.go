@@ -0,0 +1,6 @@
+package model
+
+type VerifyKidRequest struct {
+	Ciphertext   string `json:"ciphertext" validate:"required"`
+	PublicKeyPem string `json:"publicKeyPem" validate:"required,pem=public"`
+}
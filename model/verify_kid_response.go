@@ -0,0 +1,9 @@
+package model
+
+type VerifyKidResponse struct {
+	Match             bool   `json:"match"`
+	ServerKid         string `json:"server_kid"`
+	ExpectedKid       string `json:"expected_kid"`
+	KeyAlgorithm      string `json:"alg"`
+	ContentEncryption string `json:"enc"`
+}
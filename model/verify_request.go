@@ -0,0 +1,13 @@
+package model
+
+import "encoding/json"
+
+type VerifyRequest struct {
+	Jws          string          `json:"jws" validate:"required"`
+	PublicKeyPem string          `json:"publicKeyPem" validate:"omitempty,pem=public"`
+	PublicKeyJwk json.RawMessage `json:"publicKeyJwk" validate:"omitempty,mutex=PublicKeyPem"`
+	// PublicKeyPems are tried against every signature of a JWS with several, e.g. one key per countersigning party
+	PublicKeyPems []string `json:"publicKeyPems" validate:"omitempty,min=1,max=16,mutex=PublicKeyPem PublicKeyJwk,dive,pem=public"`
+	// Algorithms are the JWS algorithms the caller expects, a signature naming any other one is rejected unverified
+	Algorithms []string `json:"algorithms" validate:"required,min=1,max=8,dive,oneof=RS256 RS384 RS512 PS256 PS384 PS512 ES256 EdDSA"`
+}
@@ -0,0 +1,8 @@
+package model
+
+type VerifyResponse struct {
+	Payload string                 `json:"payload"`
+	Header  map[string]interface{} `json:"header"`
+	// Signatures reports each signature of a JWS with several, Header is the one of the first valid signature
+	Signatures []SignatureResult `json:"signatures,omitempty"`
+}
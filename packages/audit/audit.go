@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"jwe-go/packages/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Types of the audited operations
+const (
+	EventEncrypt     = "encrypt"
+	EventDecrypt     = "decrypt"
+	EventRewrap      = "rewrap"
+	EventSign        = "sign"
+	EventVerify      = "verify"
+	EventKeyGenerate = "key-generate"
+)
+
+// Outcomes of an audited operation
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// SinkNone and SinkStdout name the sinks NewSink builds, any other name is the path of an audit file
+const (
+	SinkNone   = "none"
+	SinkStdout = "stdout"
+)
+
+// AuditEvent is one crypto operation, it never carries plaintext nor key material
+type AuditEvent struct {
+	Type              string    `json:"type"`
+	Time              time.Time `json:"time"`
+	RequestID         string    `json:"request_id,omitempty"`
+	KeyThumbprint     string    `json:"key_thumbprint,omitempty"`
+	Algorithm         string    `json:"alg,omitempty"`
+	ContentEncryption string    `json:"enc,omitempty"`
+	Outcome           string    `json:"outcome"`
+	ErrorCode         string    `json:"error_code,omitempty"`
+	// TokenID matches the encrypt event of a token with its decrypt events
+	TokenID string `json:"token_id,omitempty"`
+}
+
+// Sink receives the audit events, Record is called concurrently by the requests
+type Sink interface {
+	Record(event AuditEvent)
+}
+
+// WriterSink writes every event as a JSON line, appended after the previous ones
+type WriterSink struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewWriterSink creates a sink writing to the writer
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{writer: writer}
+}
+
+// NewFileSink opens the file for appending only, the events already in it are never rewritten
+func NewFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log: %v", err)
+	}
+	return NewWriterSink(file), nil
+}
+
+// Record writes the event, a failed write is logged since the request already completed
+func (sink *WriterSink) Record(event AuditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("failed to encode audit event: %v", err)
+		return
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if _, err := sink.writer.Write(append(line, '\n')); err != nil {
+		log.Printf("failed to write audit event: %v", err)
+	}
+}
+
+// discardSink drops every event, the sink used until one is set
+type discardSink struct{}
+
+func (discardSink) Record(AuditEvent) {}
+
+var current Sink = discardSink{}
+
+// NewSink builds the sink named by the configuration: none, stdout or the path of an audit file
+func NewSink(name string) (Sink, error) {
+	switch name {
+	case "", SinkNone:
+		return discardSink{}, nil
+	case SinkStdout:
+		return NewWriterSink(os.Stdout), nil
+	default:
+		return NewFileSink(name)
+	}
+}
+
+// SetSink replaces the sink the events are recorded to, it is called once at startup
+func SetSink(sink Sink) {
+	current = sink
+}
+
+// Record sends the event to the current sink
+func Record(event AuditEvent) {
+	current.Record(event)
+}
@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"bufio"
+	encodingjson "encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Reopening the file keeps the events already written
+	for _, outcome := range []string{OutcomeSuccess, OutcomeFailure} {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink.Record(AuditEvent{Type: EventEncrypt, Time: at, RequestID: "r1", KeyThumbprint: "tp", Algorithm: "RSA-OAEP-256", ContentEncryption: "A256GCM", Outcome: outcome})
+		sink.writer.(*os.File).Close()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var events []AuditEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := encodingjson.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("expected a JSON line, got %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	expected := AuditEvent{Type: EventEncrypt, Time: at, RequestID: "r1", KeyThumbprint: "tp", Algorithm: "RSA-OAEP-256", ContentEncryption: "A256GCM", Outcome: OutcomeSuccess}
+	if len(events) != 2 || events[0] != expected || events[1].Outcome != OutcomeFailure {
+		t.Fatalf("expected both events in order, got %+v", events)
+	}
+
+	if _, err := NewSink(filepath.Join(path, "not-a-directory", "audit.log")); err == nil {
+		t.Fatal("expected an unopenable audit file to be refused")
+	}
+}
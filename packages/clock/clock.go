@@ -0,0 +1,63 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time every expiry, validity and rate check reads
+type Clock interface {
+	Now() time.Time
+}
+
+// Real reads the system clock. The readings are wall clock times without their monotonic part, so they
+// follow NTP corrections like the clients' clocks do; durations are measured with time.Since instead.
+type Real struct{}
+
+// NewReal creates a clock reading the system time
+func NewReal() *Real {
+	return &Real{}
+}
+
+func (clock *Real) Now() time.Time {
+	return time.Now().Round(0)
+}
+
+// Fake only moves when told to, for tests checking time dependent behavior deterministically
+type Fake struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewFake creates a fake clock reading now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (clock *Fake) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+// Set moves the clock to now, backwards as well
+func (clock *Fake) Set(now time.Time) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = now
+}
+
+// Advance moves the clock forward by the duration
+func (clock *Fake) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(duration)
+}
+
+// Current is the clock the service reads, tests swap in a Fake
+var Current Clock = NewReal()
+
+// Now reads the current clock
+func Now() time.Time {
+	return Current.Now()
+}
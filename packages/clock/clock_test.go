@@ -0,0 +1,38 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeOnlyMovesWhenTold(t *testing.T) {
+	defer func(previous Clock) { Current = previous }(Current)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	Current = fake
+
+	if !Now().Equal(start) {
+		t.Fatalf("expected %s, got %s", start, Now())
+	}
+	fake.Advance(90 * time.Second)
+	if !Now().Equal(start.Add(90 * time.Second)) {
+		t.Fatalf("expected the clock advanced by 90s, got %s", Now())
+	}
+	fake.Set(start.Add(-time.Hour))
+	if !Now().Equal(start.Add(-time.Hour)) {
+		t.Fatalf("expected the clock set back, got %s", Now())
+	}
+}
+
+func TestRealHasNoMonotonicReading(t *testing.T) {
+	real := NewReal()
+	first := real.Now()
+	// Round(0) strips the monotonic reading, so readings compare and serialize as wall clock times
+	if first != first.Round(0) {
+		t.Fatalf("expected a wall clock reading, got %s", first)
+	}
+	// The reading is the system time, not one extrapolated from when the clock was created
+	if drift := time.Now().Sub(first); drift < 0 || drift > time.Second {
+		t.Fatalf("expected the reading to follow the system clock, it is %s off", drift)
+	}
+}
@@ -0,0 +1,283 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings loaded at startup
+type Config struct {
+	// Directory of PEM public keys published by the JWKS endpoint, a subdirectory per tenant holds the keys of that tenant
+	JWKSKeyDir string
+	// Largest plaintext a compressed JWE may inflate to on decrypt
+	MaxInflatedSize int
+	// Largest number of plaintexts accepted by the batch encrypt endpoint
+	MaxBatchSize int
+	// Number of imported public keys kept in the LRU key cache
+	KeyCacheSize int
+	// Number of reusable encrypters kept per key and algorithm combination
+	EncrypterPoolSize int
+	// Smallest RSA modulus in bits accepted for imported keys
+	MinRSAKeyBits int
+	// Request log format, json or text
+	LogFormat string
+	// PEM file with the RSA private key used to sign nested JWTs
+	SigningKeyFile string
+	// Largest request body accepted by routes without their own limit
+	MaxBodySize int64
+	// Largest request body accepted by the encrypt routes, which carry plaintexts
+	MaxEncryptBodySize int64
+	// Largest request body accepted by the routes that only read a token
+	MaxInspectBodySize int64
+	// Clock skew tolerated by every time check: the exp, nbf and iat claims and the iat and nbf protected headers
+	Leeway time.Duration
+	// Oldest iat header accepted on decrypt and inspect unless the request sets its own, zero accepts any age
+	MaxTokenAge time.Duration
+	// Key management algorithms the encrypt endpoints accept, empty allows every supported one
+	AllowedKeyAlgs []string
+	// Content encryption algorithms the encrypt endpoints accept, empty allows every supported one
+	AllowedContentEncs []string
+	// JWS algorithms the sign and verify endpoints accept, empty allows every supported one
+	AllowedSignatureAlgs []string
+	// Smallest PBES2 iteration count accepted for password-based encryption
+	MinPBES2Iterations int
+	// Time a request may spend in encryption or decryption before it gets a 503
+	CryptoTimeout time.Duration
+	// Requests per second and burst allowed per client on the v1 routes, a zero rate disables limiting
+	RateLimitPerSecond int
+	RateLimitBurst     int
+	// Proxies whose X-Forwarded-For header names the client IP, none by default
+	TrustedProxies []string
+	// Tighter limit for the routes doing the most crypto work per request
+	HeavyRateLimitPerSecond int
+	HeavyRateLimitBurst     int
+	// Largest plaintext accepted by the streaming encrypt route
+	MaxStreamBodySize int64
+	// Plaintext bytes encrypted into each JWE of a stream
+	StreamChunkSize int
+	// Number of streams encrypted at the same time, further requests get a 503
+	MaxConcurrentStreams int
+	// Registers the deterministic test vectors route, refused in gin release mode
+	EnableTestVectors bool
+	// Origins browser clients may call from, none by default so browsers refuse cross-origin calls
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	// How long browsers may cache a preflight response
+	CORSMaxAge time.Duration
+	// Time in-flight requests get to finish after SIGTERM before the server exits
+	ShutdownTimeout time.Duration
+	// Timeouts of the HTTP server, ReadHeaderTimeout keeps slow clients from holding connections open.
+	// Uploads to the stream route have to fit into ReadTimeout, their encrypted response into WriteTimeout.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// Serves HTTP/2 without TLS to clients asking for it, for proxies speaking h2c to the service
+	H2C bool
+	// Rejects every token decrypted before within the replay window, requests can also opt in one by one
+	ReplayProtection bool
+	ReplayWindow     time.Duration
+	// Directory of PEM private keys registered at startup, the admin reload route reads it again.
+	// Each subdirectory named after a tenant holds the keys of that tenant.
+	PrivateKeyDir string
+	// Bearer token the admin reload route requires, the route is not registered without one
+	AdminToken string
+	// Salted hashes of the API keys the v1 routes require, each the hex salt and the hex SHA-256 of the salt
+	// followed by the key, separated by a colon. A third field binds the key to the keys of a tenant. None leaves
+	// the routes open.
+	APIKeyHashes []string
+	// Thumbprint hash the server_kid header is computed with, SHA-1 also needs AllowSHA1ServerKid
+	ServerKidHash      string
+	AllowSHA1ServerKid bool
+	// How long the encrypt routes keep a response for the retries sharing its Idempotency-Key
+	IdempotencyTTL time.Duration
+	// Responses of the JWKS and encrypt routes are compressed from GzipMinSize bytes for clients accepting gzip,
+	// JWE media types never are
+	GzipResponses bool
+	GzipMinSize   int
+	// Lets encrypt requests supply their own CEK, a reused CEK exposes every message encrypted under it
+	AllowClientContentKey bool
+	// Where request spans are exported, none keeps the no-op tracer and stdout prints them
+	TracingExporter string
+	// Refuses to encrypt to a recipient certificate outside its validity period
+	EnforceCertValidity bool
+	// Where the audit events of the crypto routes go: none, stdout or the path of a file they are appended to
+	AuditLog string
+	// Media types the JSON routes accept as Content-Type, the upload routes take multipart/form-data
+	AcceptedContentTypes []string
+	// Custom protected header names encrypt requests may set, empty allows any name that isn't reserved
+	AllowedCustomHeaders []string
+	// Signs the JWE responses with the primary key of the tenant, a detached JWS in X-Response-Signature
+	SignResponses bool
+	// How long a server key past its Not-After still decrypts, it no longer encrypts or is published
+	KeyExpiryGracePeriod time.Duration
+	// Most recipients a multi-recipient encrypt request may list
+	MaxRecipients int
+	// Base64 master secret the shared secrets of requests with a KeyDerivationInfo label are derived from, empty disables it
+	MasterSecret string
+	// Refuses to encrypt plaintexts matching one of the regular expressions of the file, one per line
+	ContentScanning            bool
+	BlockedContentPatternsFile string
+	// Largest plaintext the encrypt route accepts once decoded, whatever its encoding made of its size in the body
+	MaxPlaintextSize int
+	// Refuses request bodies with an object repeating a key, which JSON parsers disagree on. Off by default.
+	RejectDuplicateKeys bool
+}
+
+// use a single instance of Config, it is read by the handlers
+var Current = Default()
+
+// Default returns the settings used when nothing is configured
+func Default() Config {
+	return Config{
+		MaxInflatedSize:         10 << 20,
+		MaxBatchSize:            1000,
+		KeyCacheSize:            1024,
+		EncrypterPoolSize:       1024,
+		MinRSAKeyBits:           2048,
+		LogFormat:               "text",
+		MaxBodySize:             1 << 20,
+		MaxEncryptBodySize:      10 << 20,
+		MaxInspectBodySize:      64 << 10,
+		Leeway:                  time.Minute,
+		MinPBES2Iterations:      100000,
+		CryptoTimeout:           10 * time.Second,
+		RateLimitPerSecond:      100,
+		RateLimitBurst:          200,
+		HeavyRateLimitPerSecond: 5,
+		HeavyRateLimitBurst:     10,
+		MaxStreamBodySize:       1 << 30,
+		StreamChunkSize:         1 << 20,
+		MaxConcurrentStreams:    8,
+		CORSAllowedMethods:      []string{"GET", "POST"},
+		CORSAllowedHeaders:      []string{"Content-Type", "X-API-Key", "X-Request-ID", "Idempotency-Key", "X-Tenant-ID"},
+		CORSMaxAge:              10 * time.Minute,
+		ShutdownTimeout:         30 * time.Second,
+		ReadHeaderTimeout:       5 * time.Second,
+		ReadTimeout:             5 * time.Minute,
+		WriteTimeout:            5 * time.Minute,
+		IdleTimeout:             2 * time.Minute,
+		ReplayWindow:            10 * time.Minute,
+		ServerKidHash:           "SHA-256",
+		IdempotencyTTL:          24 * time.Hour,
+		GzipMinSize:             1024,
+		TracingExporter:         "none",
+		EnforceCertValidity:     true,
+		AuditLog:                "none",
+		AcceptedContentTypes:    []string{"application/json"},
+		KeyExpiryGracePeriod:    7 * 24 * time.Hour,
+		MaxRecipients:           50,
+		MaxPlaintextSize:        10 << 20,
+	}
+}
+
+// Load reads the settings from the environment, falling back to the defaults
+func Load() Config {
+	cfg := Default()
+	cfg.JWKSKeyDir = envString("JWKS_KEY_DIR", cfg.JWKSKeyDir)
+	cfg.MaxInflatedSize = envInt("MAX_INFLATED_SIZE", cfg.MaxInflatedSize)
+	cfg.MaxBatchSize = envInt("MAX_BATCH_SIZE", cfg.MaxBatchSize)
+	cfg.KeyCacheSize = envInt("KEY_CACHE_SIZE", cfg.KeyCacheSize)
+	cfg.EncrypterPoolSize = envInt("ENCRYPTER_POOL_SIZE", cfg.EncrypterPoolSize)
+	cfg.MinRSAKeyBits = envInt("MIN_RSA_KEY_BITS", cfg.MinRSAKeyBits)
+	cfg.LogFormat = envString("LOG_FORMAT", cfg.LogFormat)
+	cfg.SigningKeyFile = envString("SIGNING_KEY_FILE", cfg.SigningKeyFile)
+	cfg.MaxBodySize = int64(envInt("MAX_BODY_SIZE", int(cfg.MaxBodySize)))
+	cfg.MaxEncryptBodySize = int64(envInt("MAX_ENCRYPT_BODY_SIZE", int(cfg.MaxEncryptBodySize)))
+	cfg.MaxInspectBodySize = int64(envInt("MAX_INSPECT_BODY_SIZE", int(cfg.MaxInspectBodySize)))
+	cfg.Leeway = time.Duration(envInt("LEEWAY_SECONDS", int(cfg.Leeway/time.Second))) * time.Second
+	cfg.MaxTokenAge = time.Duration(envInt("MAX_TOKEN_AGE_SECONDS", int(cfg.MaxTokenAge/time.Second))) * time.Second
+	cfg.AllowedKeyAlgs = envList("ALLOWED_KEY_ALGS", cfg.AllowedKeyAlgs)
+	cfg.AllowedContentEncs = envList("ALLOWED_CONTENT_ENCS", cfg.AllowedContentEncs)
+	cfg.AllowedSignatureAlgs = envList("ALLOWED_SIGNATURE_ALGS", cfg.AllowedSignatureAlgs)
+	cfg.MinPBES2Iterations = envInt("MIN_PBES2_ITERATIONS", cfg.MinPBES2Iterations)
+	cfg.CryptoTimeout = time.Duration(envInt("CRYPTO_TIMEOUT_SECONDS", int(cfg.CryptoTimeout/time.Second))) * time.Second
+	cfg.RateLimitPerSecond = envInt("RATE_LIMIT_PER_SECOND", cfg.RateLimitPerSecond)
+	cfg.RateLimitBurst = envInt("RATE_LIMIT_BURST", cfg.RateLimitBurst)
+	cfg.TrustedProxies = envList("TRUSTED_PROXIES", cfg.TrustedProxies)
+	cfg.HeavyRateLimitPerSecond = envInt("HEAVY_RATE_LIMIT_PER_SECOND", cfg.HeavyRateLimitPerSecond)
+	cfg.HeavyRateLimitBurst = envInt("HEAVY_RATE_LIMIT_BURST", cfg.HeavyRateLimitBurst)
+	cfg.MaxStreamBodySize = int64(envInt("MAX_STREAM_BODY_SIZE", int(cfg.MaxStreamBodySize)))
+	cfg.StreamChunkSize = envInt("STREAM_CHUNK_SIZE", cfg.StreamChunkSize)
+	cfg.MaxConcurrentStreams = envInt("MAX_CONCURRENT_STREAMS", cfg.MaxConcurrentStreams)
+	cfg.EnableTestVectors = envBool("ENABLE_TEST_VECTORS", cfg.EnableTestVectors)
+	cfg.CORSAllowedOrigins = envList("CORS_ALLOWED_ORIGINS", cfg.CORSAllowedOrigins)
+	cfg.CORSAllowedMethods = envList("CORS_ALLOWED_METHODS", cfg.CORSAllowedMethods)
+	cfg.CORSAllowedHeaders = envList("CORS_ALLOWED_HEADERS", cfg.CORSAllowedHeaders)
+	cfg.CORSAllowCredentials = envBool("CORS_ALLOW_CREDENTIALS", cfg.CORSAllowCredentials)
+	cfg.CORSMaxAge = time.Duration(envInt("CORS_MAX_AGE_SECONDS", int(cfg.CORSMaxAge/time.Second))) * time.Second
+	cfg.ShutdownTimeout = time.Duration(envInt("SHUTDOWN_TIMEOUT_SECONDS", int(cfg.ShutdownTimeout/time.Second))) * time.Second
+	cfg.ReadHeaderTimeout = time.Duration(envInt("READ_HEADER_TIMEOUT_SECONDS", int(cfg.ReadHeaderTimeout/time.Second))) * time.Second
+	cfg.ReadTimeout = time.Duration(envInt("READ_TIMEOUT_SECONDS", int(cfg.ReadTimeout/time.Second))) * time.Second
+	cfg.WriteTimeout = time.Duration(envInt("WRITE_TIMEOUT_SECONDS", int(cfg.WriteTimeout/time.Second))) * time.Second
+	cfg.IdleTimeout = time.Duration(envInt("IDLE_TIMEOUT_SECONDS", int(cfg.IdleTimeout/time.Second))) * time.Second
+	cfg.H2C = envBool("H2C", cfg.H2C)
+	cfg.ReplayProtection = envBool("REPLAY_PROTECTION", cfg.ReplayProtection)
+	cfg.ReplayWindow = time.Duration(envInt("REPLAY_WINDOW_SECONDS", int(cfg.ReplayWindow/time.Second))) * time.Second
+	cfg.PrivateKeyDir = envString("PRIVATE_KEY_DIR", cfg.PrivateKeyDir)
+	cfg.AdminToken = envString("ADMIN_TOKEN", cfg.AdminToken)
+	cfg.APIKeyHashes = envList("API_KEY_HASHES", cfg.APIKeyHashes)
+	cfg.ServerKidHash = envString("SERVER_KID_HASH", cfg.ServerKidHash)
+	cfg.AllowSHA1ServerKid = envBool("ALLOW_SHA1_SERVER_KID", cfg.AllowSHA1ServerKid)
+	cfg.IdempotencyTTL = time.Duration(envInt("IDEMPOTENCY_TTL_SECONDS", int(cfg.IdempotencyTTL/time.Second))) * time.Second
+	cfg.GzipResponses = envBool("GZIP_RESPONSES", cfg.GzipResponses)
+	cfg.GzipMinSize = envInt("GZIP_MIN_SIZE", cfg.GzipMinSize)
+	cfg.AllowClientContentKey = envBool("ALLOW_CLIENT_CEK", cfg.AllowClientContentKey)
+	cfg.TracingExporter = envString("TRACING_EXPORTER", cfg.TracingExporter)
+	cfg.EnforceCertValidity = envBool("ENFORCE_CERT_VALIDITY", cfg.EnforceCertValidity)
+	cfg.AuditLog = envString("AUDIT_LOG", cfg.AuditLog)
+	cfg.AcceptedContentTypes = envList("ACCEPTED_CONTENT_TYPES", cfg.AcceptedContentTypes)
+	cfg.AllowedCustomHeaders = envList("ALLOWED_CUSTOM_HEADERS", cfg.AllowedCustomHeaders)
+	cfg.SignResponses = envBool("SIGN_RESPONSES", cfg.SignResponses)
+	cfg.KeyExpiryGracePeriod = time.Duration(envInt("KEY_EXPIRY_GRACE_SECONDS", int(cfg.KeyExpiryGracePeriod/time.Second))) * time.Second
+	cfg.MaxRecipients = envInt("MAX_RECIPIENTS", cfg.MaxRecipients)
+	cfg.MasterSecret = envString("MASTER_SECRET", cfg.MasterSecret)
+	cfg.ContentScanning = envBool("CONTENT_SCANNING", cfg.ContentScanning)
+	cfg.BlockedContentPatternsFile = envString("BLOCKED_CONTENT_PATTERNS_FILE", cfg.BlockedContentPatternsFile)
+	cfg.MaxPlaintextSize = envInt("MAX_PLAINTEXT_SIZE", cfg.MaxPlaintextSize)
+	cfg.RejectDuplicateKeys = envBool("REJECT_DUPLICATE_KEYS", cfg.RejectDuplicateKeys)
+	return cfg
+}
+
+func envString(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
+
+// envList reads a comma separated list, ignoring blank entries
+func envList(name string, fallback []string) []string {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func envBool(name string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,259 @@
+package crypto
+
+import (
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"strings"
+)
+
+// DefaultContentEncryption is used when a request does not pick a content encryption algorithm
+const DefaultContentEncryption = jose.A256GCM
+
+// RSA-OAEP with SHA-384 or SHA-512 for both OAEP and MGF1. These names are not in the JOSE registry,
+// only recipients that agreed on them can read the tokens, go-jose itself knows neither.
+const (
+	RSA_OAEP_384 = jose.KeyAlgorithm("RSA-OAEP-384")
+	RSA_OAEP_512 = jose.KeyAlgorithm("RSA-OAEP-512")
+)
+
+// NonStandardKeyAlgorithms are the supported key management algorithms outside the JOSE registry
+var NonStandardKeyAlgorithms = []jose.KeyAlgorithm{RSA_OAEP_384, RSA_OAEP_512}
+
+// SupportedKeyAlgorithms lists the key management algorithms accepted by the encrypt endpoint
+var SupportedKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.RSA_OAEP,
+	jose.RSA_OAEP_256,
+	RSA_OAEP_384,
+	RSA_OAEP_512,
+	jose.RSA1_5,
+	jose.ECDH_ES_A256KW,
+}
+
+// DecryptionKeyAlgorithms lists the public key algorithms the decrypting endpoints accept, RSA1_5 is left out
+var DecryptionKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.RSA_OAEP,
+	jose.RSA_OAEP_256,
+	RSA_OAEP_384,
+	RSA_OAEP_512,
+	jose.ECDH_ES_A256KW,
+}
+
+// IsNonStandardKeyAlgorithm reports whether the key management algorithm is outside the JOSE registry
+func IsNonStandardKeyAlgorithm(keyAlgorithm jose.KeyAlgorithm) bool {
+	for _, alg := range NonStandardKeyAlgorithms {
+		if alg == keyAlgorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// SymmetricKeyAlgorithms lists the key management algorithms used with a shared secret
+var SymmetricKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.DIRECT,
+	jose.A128KW,
+	jose.A192KW,
+	jose.A256KW,
+	jose.A128GCMKW,
+	jose.A192GCMKW,
+	jose.A256GCMKW,
+}
+
+// PasswordKeyAlgorithms lists the PBES2 key management algorithms used with a passphrase
+var PasswordKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.PBES2_HS256_A128KW,
+	jose.PBES2_HS512_A256KW,
+}
+
+// PBES2 iteration counts, go-jose refuses to decrypt tokens above MaxPBES2Iterations
+const (
+	DefaultPBES2Iterations = 600000
+	MaxPBES2Iterations     = 1000000
+)
+
+// MinPBES2Iterations is the smallest p2c accepted for password-based encryption
+var MinPBES2Iterations = 100000
+
+// SupportedContentEncryptions lists the content encryption algorithms accepted by the endpoints
+var SupportedContentEncryptions = []jose.ContentEncryption{
+	jose.A128GCM,
+	jose.A192GCM,
+	jose.A256GCM,
+	jose.A128CBC_HS256,
+	jose.A256CBC_HS512,
+}
+
+// ParseContentEncryption maps a content encryption name to its jose value, falling back to the default when empty
+func ParseContentEncryption(name string) (jose.ContentEncryption, error) {
+	if name == "" {
+		return DefaultContentEncryption, nil
+	}
+
+	for _, enc := range SupportedContentEncryptions {
+		if string(enc) == name {
+			return enc, nil
+		}
+	}
+
+	supported := make([]string, len(SupportedContentEncryptions))
+	for i, enc := range SupportedContentEncryptions {
+		supported[i] = string(enc)
+	}
+
+	return "", fmt.Errorf("unsupported content encryption %q, supported values are: %s", name, strings.Join(supported, ", "))
+}
+
+// DefaultKeyAlgorithm returns the key management algorithm used for a key type when a request does not pick one
+func DefaultKeyAlgorithm(keyType KeyType) jose.KeyAlgorithm {
+	if keyType == KeyTypeEC || keyType == KeyTypeX25519 {
+		return jose.ECDH_ES_A256KW
+	}
+	return jose.RSA_OAEP_256
+}
+
+// ParseKeyAlgorithm maps a key management algorithm name to its jose value and checks it fits the key type
+func ParseKeyAlgorithm(name string, keyType KeyType, allowLegacyRSA15, allowLegacyHash bool) (jose.KeyAlgorithm, error) {
+	if keyType == KeyTypeEd25519 {
+		return "", fmt.Errorf("Ed25519 keys can only sign, use an X25519 key for ECDH-ES")
+	}
+
+	if name == "" {
+		return DefaultKeyAlgorithm(keyType), nil
+	}
+
+	var keyAlgorithm jose.KeyAlgorithm
+	for _, alg := range SupportedKeyAlgorithms {
+		if string(alg) == name {
+			keyAlgorithm = alg
+		}
+	}
+	if keyAlgorithm == "" {
+		supported := make([]string, len(SupportedKeyAlgorithms))
+		for i, alg := range SupportedKeyAlgorithms {
+			supported[i] = string(alg)
+		}
+		return "", fmt.Errorf("unsupported key algorithm %q, supported values are: %s", name, strings.Join(supported, ", "))
+	}
+
+	// RSA1_5 is vulnerable to padding oracle attacks, so it has to be requested explicitly
+	if keyAlgorithm == jose.RSA1_5 && !allowLegacyRSA15 {
+		return "", fmt.Errorf("key algorithm RSA1_5 is vulnerable to padding oracle attacks and requires allowLegacyRSA15")
+	}
+
+	// RSA-OAEP uses SHA-1 for OAEP and MGF1, still unbroken there but deprecated, so partners have to opt in
+	if keyAlgorithm == jose.RSA_OAEP && !allowLegacyHash {
+		return "", fmt.Errorf("key algorithm RSA-OAEP relies on SHA-1, which is deprecated, prefer RSA-OAEP-256 or set allowLegacyHash")
+	}
+
+	switch keyAlgorithm {
+	case jose.ECDH_ES_A256KW:
+		if keyType != KeyTypeEC && keyType != KeyTypeX25519 {
+			return "", fmt.Errorf("key algorithm %s requires an EC or X25519 key", keyAlgorithm)
+		}
+	default:
+		if keyType != KeyTypeRSA {
+			return "", fmt.Errorf("key algorithm %s requires an RSA key", keyAlgorithm)
+		}
+	}
+
+	return keyAlgorithm, nil
+}
+
+// ParseSymmetricKeyAlgorithm maps a shared secret key algorithm name to its jose value and checks the key length fits it
+func ParseSymmetricKeyAlgorithm(name string, contentEncryption jose.ContentEncryption, key []byte) (jose.KeyAlgorithm, error) {
+	if name == "" {
+		name = string(jose.DIRECT)
+	}
+
+	var keyAlgorithm jose.KeyAlgorithm
+	for _, alg := range SymmetricKeyAlgorithms {
+		if string(alg) == name {
+			keyAlgorithm = alg
+		}
+	}
+	if keyAlgorithm == "" {
+		supported := make([]string, len(SymmetricKeyAlgorithms))
+		for i, alg := range SymmetricKeyAlgorithms {
+			supported[i] = string(alg)
+		}
+		return "", fmt.Errorf("unsupported symmetric key algorithm %q, supported values are: %s", name, strings.Join(supported, ", "))
+	}
+
+	if err := CheckSymmetricKeySize(keyAlgorithm, contentEncryption, key); err != nil {
+		return "", err
+	}
+
+	return keyAlgorithm, nil
+}
+
+// CheckSymmetricKeySize checks the shared secret has the size the key algorithm takes. go-jose unwraps an
+// A256GCMKW key with a 16 byte secret as AES-128, so decryption has to check it as much as encryption.
+func CheckSymmetricKeySize(keyAlgorithm jose.KeyAlgorithm, contentEncryption jose.ContentEncryption, key []byte) error {
+	keySize, err := SymmetricKeySize(keyAlgorithm, contentEncryption)
+	if err != nil {
+		return err
+	}
+	if len(key) != keySize {
+		return fmt.Errorf("key algorithm %s with %s requires a %d byte key, got %d bytes", keyAlgorithm, contentEncryption, keySize, len(key))
+	}
+	return nil
+}
+
+// SymmetricKeySize returns the size of the shared secret the key algorithm takes with the content encryption
+func SymmetricKeySize(keyAlgorithm jose.KeyAlgorithm, contentEncryption jose.ContentEncryption) (int, error) {
+	// dir uses the secret as the content key, the key wrap algorithms have a fixed key size
+	switch keyAlgorithm {
+	case jose.DIRECT:
+		return contentEncryptionKeySizes[contentEncryption], nil
+	case jose.A128KW, jose.A128GCMKW:
+		return 16, nil
+	case jose.A192KW, jose.A192GCMKW:
+		return 24, nil
+	case jose.A256KW, jose.A256GCMKW:
+		return 32, nil
+	default:
+		return 0, fmt.Errorf("key algorithm %s does not use a shared secret", keyAlgorithm)
+	}
+}
+
+// ParsePasswordKeyAlgorithm maps a PBES2 algorithm name to its jose value, falling back to PBES2-HS256+A128KW when empty
+func ParsePasswordKeyAlgorithm(name string) (jose.KeyAlgorithm, error) {
+	if name == "" {
+		return jose.PBES2_HS256_A128KW, nil
+	}
+
+	for _, alg := range PasswordKeyAlgorithms {
+		if string(alg) == name {
+			return alg, nil
+		}
+	}
+
+	supported := make([]string, len(PasswordKeyAlgorithms))
+	for i, alg := range PasswordKeyAlgorithms {
+		supported[i] = string(alg)
+	}
+	return "", fmt.Errorf("unsupported password key algorithm %q, supported values are: %s", name, strings.Join(supported, ", "))
+}
+
+// ResolvePBES2Iterations returns the p2c to use, the default when zero, and checks it lies within the accepted range
+func ResolvePBES2Iterations(iterations int) (int, error) {
+	if iterations == 0 {
+		iterations = DefaultPBES2Iterations
+	}
+	if iterations < MinPBES2Iterations {
+		return 0, fmt.Errorf("PBES2 iteration count %d is below the minimum of %d", iterations, MinPBES2Iterations)
+	}
+	if iterations > MaxPBES2Iterations {
+		return 0, fmt.Errorf("PBES2 iteration count %d is above the maximum of %d", iterations, MaxPBES2Iterations)
+	}
+	return iterations, nil
+}
+
+// contentEncryptionKeySizes holds the content key length in bytes for each content encryption algorithm
+var contentEncryptionKeySizes = map[jose.ContentEncryption]int{
+	jose.A128GCM:       16,
+	jose.A192GCM:       24,
+	jose.A256GCM:       32,
+	jose.A128CBC_HS256: 32,
+	jose.A256CBC_HS512: 64,
+}
@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v4"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyAlgorithmGatesSHA1OAEP(t *testing.T) {
+	if _, err := ParseKeyAlgorithm("RSA-OAEP", KeyTypeRSA, false, false); err == nil || !strings.Contains(err.Error(), "SHA-1") {
+		t.Fatalf("expected RSA-OAEP to be rejected with a SHA-1 warning, got %v", err)
+	}
+
+	keyAlgorithm, err := ParseKeyAlgorithm("RSA-OAEP", KeyTypeRSA, false, true)
+	if err != nil || keyAlgorithm != jose.RSA_OAEP {
+		t.Fatalf("expected RSA-OAEP with allowLegacyHash, got %q, %v", keyAlgorithm, err)
+	}
+
+	keyAlgorithm, err = ParseKeyAlgorithm("RSA-OAEP-256", KeyTypeRSA, false, false)
+	if err != nil || keyAlgorithm != jose.RSA_OAEP_256 {
+		t.Fatalf("expected RSA-OAEP-256 without flags, got %q, %v", keyAlgorithm, err)
+	}
+}
+
+func TestEncryptRoundTripsWithBothOAEPHashes(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"RSA-OAEP", "RSA-OAEP-256"} {
+		keyAlgorithm, err := ParseKeyAlgorithm(name, KeyTypeRSA, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encrypter, err := NewEncrypterPool(1).Get(EncrypterKey{
+			Thumbprint:        "test-kid",
+			KeyAlgorithm:      keyAlgorithm,
+			ContentEncryption: DefaultContentEncryption,
+		}, &privateKey.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jwe, err := encrypter.Encrypt([]byte(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		serialized, err := jwe.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := jose.ParseEncrypted(serialized, []jose.KeyAlgorithm{keyAlgorithm}, SupportedContentEncryptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Header.Algorithm != name {
+			t.Fatalf("expected alg %s, got %s", name, parsed.Header.Algorithm)
+		}
+
+		plaintext, err := parsed.Decrypt(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plaintext) != name {
+			t.Fatalf("round trip mismatch for %s: %q", name, plaintext)
+		}
+	}
+}
+
+func TestResolvePBES2IterationsEnforcesBounds(t *testing.T) {
+	if iterations, err := ResolvePBES2Iterations(0); err != nil || iterations != DefaultPBES2Iterations {
+		t.Fatalf("expected the default iteration count, got %d, %v", iterations, err)
+	}
+	if _, err := ResolvePBES2Iterations(MinPBES2Iterations - 1); err == nil {
+		t.Fatalf("expected an iteration count below the minimum to be rejected")
+	}
+	if _, err := ResolvePBES2Iterations(MaxPBES2Iterations + 1); err == nil {
+		t.Fatalf("expected an iteration count above the maximum to be rejected")
+	}
+	if iterations, err := ResolvePBES2Iterations(MinPBES2Iterations); err != nil || iterations != MinPBES2Iterations {
+		t.Fatalf("expected the minimum to be accepted, got %d, %v", iterations, err)
+	}
+}
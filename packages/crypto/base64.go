@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// flexibleEncodings are the encodings DecodeFlexibleBase64 tries, in order
+var flexibleEncodings = []*base64.Encoding{
+	base64.RawURLEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.StdEncoding,
+}
+
+// ErrInvalidBase64 is returned for a value none of the accepted base64 encodings decode
+var ErrInvalidBase64 = errors.New("not valid base64 or base64url")
+
+// DecodeFlexibleBase64 decodes base64url or standard base64, padded or not, as different clients send keys.
+// The alphabets only differ in two characters, a value mixing both decodes under neither.
+func DecodeFlexibleBase64(s string) ([]byte, error) {
+	for _, encoding := range flexibleEncodings {
+		if decoded, err := encoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, ErrInvalidBase64
+}
+
+// DecodeBase64 decodes the value with DecodeFlexibleBase64, or when strict only as the unpadded base64url
+// of RFC 7515, with no stray bits in the last character either
+func DecodeBase64(s string, strict bool) ([]byte, error) {
+	if !strict {
+		return DecodeFlexibleBase64(s)
+	}
+	decoded, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil {
+		return nil, errors.New("not valid unpadded base64url")
+	}
+	return decoded, nil
+}
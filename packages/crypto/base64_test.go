@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeFlexibleBase64AcceptsAllFourEncodings(t *testing.T) {
+	// 0xfb 0xff encodes to + and / in standard base64 and - and _ in base64url, the odd length needs padding
+	data := []byte{0xfb, 0xff, 0xbf, 0xfe, 0x01}
+	for _, test := range []struct {
+		name     string
+		encoding *base64.Encoding
+		strict   bool
+	}{
+		{"base64url", base64.RawURLEncoding, true},
+		{"padded base64url", base64.URLEncoding, false},
+		{"base64", base64.RawStdEncoding, false},
+		{"padded base64", base64.StdEncoding, false},
+	} {
+		encoded := test.encoding.EncodeToString(data)
+		if decoded, err := DecodeFlexibleBase64(encoded); err != nil || !bytes.Equal(decoded, data) {
+			t.Fatalf("expected %s %q to decode, got %x: %v", test.name, encoded, decoded, err)
+		}
+		if decoded, err := DecodeBase64(encoded, true); test.strict != (err == nil) {
+			t.Fatalf("expected strict decoding of %s %q to succeed only for unpadded base64url, got %x: %v", test.name, encoded, decoded, err)
+		}
+	}
+
+	for _, invalid := range []string{"+-_/", "a", "abc$", "ab=c"} {
+		if _, err := DecodeFlexibleBase64(invalid); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+	// The last character of "AB" carries bits beyond the byte it encodes, the strict mode refuses them
+	if _, err := DecodeBase64("AB", true); err == nil {
+		t.Fatal("expected stray bits to be rejected in strict mode")
+	}
+}
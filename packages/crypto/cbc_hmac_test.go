@@ -0,0 +1,158 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/go-jose/go-jose/v4"
+	"strings"
+	"testing"
+)
+
+// RFC 7516 appendix A.2 content encryption and RFC 7518 appendix B.3, through the cipher every path of this package uses
+func TestContentCipherMatchesTheCBCHMACVectors(t *testing.T) {
+	sequence := func(start, length int) []byte {
+		out := make([]byte, length)
+		for i := range out {
+			out[i] = byte(start + i)
+		}
+		return out
+	}
+	for _, test := range []struct {
+		name       string
+		enc        jose.ContentEncryption
+		key        []byte
+		iv         []byte
+		plaintext  []byte
+		aad        []byte
+		ciphertext []byte
+		tag        []byte
+	}{
+		{
+			name:      "RFC 7516 A.2",
+			enc:       jose.A128CBC_HS256,
+			key:       []byte{4, 211, 31, 197, 84, 157, 252, 254, 11, 100, 157, 250, 63, 170, 106, 206, 107, 124, 212, 45, 111, 107, 9, 219, 200, 177, 0, 240, 143, 156, 44, 207},
+			iv:        []byte{3, 22, 60, 12, 43, 67, 104, 105, 108, 108, 105, 99, 111, 116, 104, 101},
+			plaintext: []byte("Live long and prosper."),
+			aad:       []byte("eyJhbGciOiJSU0ExXzUiLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0"),
+			ciphertext: []byte{40, 57, 83, 181, 119, 33, 133, 148, 198, 185, 243, 24, 152, 230, 6, 75, 129, 223, 127, 19, 210, 82,
+				183, 230, 168, 33, 215, 104, 143, 112, 56, 102},
+			tag: []byte{246, 17, 244, 190, 4, 95, 98, 3, 231, 0, 115, 157, 242, 203, 100, 191},
+		},
+		{
+			name:      "RFC 7518 B.3",
+			enc:       jose.A256CBC_HS512,
+			key:       sequence(0, 64),
+			iv:        []byte{0x1a, 0xf3, 0x8c, 0x2d, 0xc2, 0xb9, 0x6f, 0xfd, 0xd8, 0x66, 0x94, 0x09, 0x23, 0x41, 0xbc, 0x04},
+			plaintext: []byte("A cipher system must not be required to be secret, and it must be able to fall into the hands of the enemy without inconvenience"),
+			aad:       []byte("The second principle of Auguste Kerckhoffs"),
+			ciphertext: []byte{
+				0x4a, 0xff, 0xaa, 0xad, 0xb7, 0x8c, 0x31, 0xc5, 0xda, 0x4b, 0x1b, 0x59, 0x0d, 0x10, 0xff, 0xbd,
+				0x3d, 0xd8, 0xd5, 0xd3, 0x02, 0x42, 0x35, 0x26, 0x91, 0x2d, 0xa0, 0x37, 0xec, 0xbc, 0xc7, 0xbd,
+				0x82, 0x2c, 0x30, 0x1d, 0xd6, 0x7c, 0x37, 0x3b, 0xcc, 0xb5, 0x84, 0xad, 0x3e, 0x92, 0x79, 0xc2,
+				0xe6, 0xd1, 0x2a, 0x13, 0x74, 0xb7, 0x7f, 0x07, 0x75, 0x53, 0xdf, 0x82, 0x94, 0x10, 0x44, 0x6b,
+				0x36, 0xeb, 0xd9, 0x70, 0x66, 0x29, 0x6a, 0xe6, 0x42, 0x7e, 0xa7, 0x5c, 0x2e, 0x08, 0x46, 0xa1,
+				0x1a, 0x09, 0xcc, 0xf5, 0x37, 0x0d, 0xc8, 0x0b, 0xfe, 0xcb, 0xad, 0x28, 0xc7, 0x3f, 0x09, 0xb3,
+				0xa3, 0xb7, 0x5e, 0x66, 0x2a, 0x25, 0x94, 0x41, 0x0a, 0xe4, 0x96, 0xb2, 0xe2, 0xe6, 0x60, 0x9e,
+				0x31, 0xe6, 0xe0, 0x2c, 0xc8, 0x37, 0xf0, 0x53, 0xd2, 0x1f, 0x37, 0xff, 0x4f, 0x51, 0x95, 0x0b,
+				0xbe, 0x26, 0x38, 0xd0, 0x9d, 0xd7, 0xa4, 0x93, 0x09, 0x30, 0x80, 0x6d, 0x07, 0x03, 0xb1, 0xf6},
+			tag: []byte{
+				0x4d, 0xd3, 0xb4, 0xc0, 0x88, 0xa7, 0xf4, 0x5c, 0x21, 0x68, 0x39, 0x64, 0x5b, 0x20, 0x12, 0xbf,
+				0x2e, 0x62, 0x69, 0xa8, 0xc5, 0x6a, 0x81, 0x6d, 0xbc, 0x1b, 0x26, 0x77, 0x61, 0x95, 0x5b, 0xc5},
+		},
+	} {
+		aead, tagSize, err := newContentCipher(test.enc, test.key)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if aead.NonceSize() != len(test.iv) || tagSize != len(test.tag) {
+			t.Fatalf("%s: expected a %d byte IV and %d byte tag, got %d and %d", test.name, len(test.iv), len(test.tag), aead.NonceSize(), tagSize)
+		}
+		sealed := aead.Seal(nil, test.iv, test.plaintext, test.aad)
+		if !bytes.Equal(sealed, append(append([]byte{}, test.ciphertext...), test.tag...)) {
+			t.Fatalf("%s: expected the ciphertext and tag of the vector, got %x", test.name, sealed)
+		}
+		opened, err := aead.Open(nil, test.iv, sealed, test.aad)
+		if err != nil || !bytes.Equal(opened, test.plaintext) {
+			t.Fatalf("%s: expected the plaintext back, got %q: %v", test.name, opened, err)
+		}
+	}
+}
+
+// CBC-HMAC is encrypt-then-MAC, a token whose ciphertext was altered fails on the tag before any block is decrypted,
+// so a padding error can't tell an attacker anything
+func TestCBCHMACChecksTheTagBeforeDecrypting(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	iv := bytes.Repeat([]byte{2}, 16)
+	aead, tagSize, err := newContentCipher(jose.A128CBC_HS256, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := aead.Seal(nil, iv, []byte("sixteen byte msg"), []byte("aad"))
+
+	// Flipping the last ciphertext byte breaks the padding too, the tag check has to report first
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-tagSize-1] ^= 0xff
+	if _, err := aead.Open(nil, iv, tampered, []byte("aad")); err == nil || !strings.Contains(err.Error(), "auth tag") {
+		t.Fatalf("expected the tag mismatch to be reported, got %v", err)
+	}
+	if _, err := aead.Open(nil, iv, sealed, []byte("other aad")); err == nil {
+		t.Fatal("expected other additional data to fail the tag check")
+	}
+
+	// The RFC 7516 A.3 token opens through go-jose and through the crit path, a tampered tag through neither
+	token := "eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0." +
+		"6KB707dM9YTIgHtLvtgWQ8mKwboJW3of9locizkDTHzBC2IlrT1oOQ." +
+		"AxY8DCtDaGlsbGljb3RoZQ." +
+		"KDlTtXchhZTGufMYmOYGS4HffxPSUrfmqCHXaI9wOGY." +
+		"U0m_YmjN04DJvceFICbCVQ"
+	wrappingKey, _ := base64.RawURLEncoding.DecodeString("GawgguFyGrWKav7AX4VKUg")
+	parsed, err := jose.ParseEncryptedCompact(token, []jose.KeyAlgorithm{jose.A128KW}, []jose.ContentEncryption{jose.A128CBC_HS256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := parsed.Decrypt(wrappingKey); err != nil || string(plaintext) != "Live long and prosper." {
+		t.Fatalf("expected go-jose to decrypt the RFC token, got %q: %v", plaintext, err)
+	}
+	if _, _, plaintext, err := decryptSerialized(token, wrappingKey); err != nil || string(plaintext) != "Live long and prosper." {
+		t.Fatalf("expected the crit path to decrypt the RFC token, got %q: %v", plaintext, err)
+	}
+	tamperedToken := token[:len(token)-1] + "A"
+	if _, _, _, err := decryptSerialized(tamperedToken, wrappingKey); err == nil {
+		t.Fatal("expected a tampered tag to fail the crit path")
+	}
+}
+
+func TestCBCHMACTokensDrawAFreshIV(t *testing.T) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, recipient := range []jose.Recipient{
+		{Algorithm: jose.A128KW, Key: bytes.Repeat([]byte{3}, 16)},
+		// X25519 tokens are sealed by this package rather than go-jose
+		{Algorithm: jose.ECDH_ES_A256KW, Key: privateKey.PublicKey()},
+	} {
+		encrypter, err := NewEncrypter(jose.A128CBC_HS256, recipient, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ivs := make(map[string]bool)
+		for range 8 {
+			jwe, err := encrypter.Encrypt([]byte("same plaintext"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			serialized, err := jwe.CompactSerialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			iv, _ := base64.RawURLEncoding.DecodeString(strings.Split(serialized, ".")[2])
+			if len(iv) != 16 || ivs[string(iv)] {
+				t.Fatalf("%s: expected a fresh 16 byte IV per token, got %x again", recipient.Algorithm, iv)
+			}
+			ivs[string(iv)] = true
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors of certificates used outside their validity period
+var (
+	ErrCertificateExpired     = errors.New("certificate is expired")
+	ErrCertificateNotYetValid = errors.New("certificate is not valid yet")
+)
+
+// ParseCertificatePEM parses the certificate of a PEM, a bundled key is skipped
+func ParseCertificatePEM(certificatePEM string) (*x509.Certificate, error) {
+	block, err := decodePEMBlock(certificatePEM, "CERTIFICATE", "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	return certificate, nil
+}
+
+// PublicKeyFromCertificate returns the RSA or EC public key of the certificate, with the RSA key size checked like imported keys
+func PublicKeyFromCertificate(certificate *x509.Certificate) (interface{}, error) {
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if err := checkRSAKeySize(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	case *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("certificate holds a %T key, only RSA and EC keys can be encrypted to", certificate.PublicKey)
+	}
+}
+
+// CheckCertificateValidity rejects a certificate used outside its validity period
+func CheckCertificateValidity(certificate *x509.Certificate, now time.Time) error {
+	if now.After(certificate.NotAfter) {
+		return fmt.Errorf("%w since %s", ErrCertificateExpired, certificate.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Before(certificate.NotBefore) {
+		return fmt.Errorf("%w until %s", ErrCertificateNotYetValid, certificate.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CertificateThumbprint returns the x5t#S256 value of the certificate, the base64url SHA-256 of its DER
+func CertificateThumbprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
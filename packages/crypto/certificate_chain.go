@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+)
+
+// Header names for the certificate chain and the leaf certificate thumbprint
+const (
+	CertificateChainHeader      = "x5c"
+	CertificateThumbprintHeader = "x5t#S256"
+)
+
+// ParseCertificateChainPEM parses a PEM bundle, leaf first, and checks each certificate is signed by the next
+func ParseCertificateChainPEM(bundle string) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	rest := []byte(NormalizePEM(bundle))
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block type %q in certificate chain", block.Type)
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", len(chain), err)
+		}
+		chain = append(chain, certificate)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("certificate chain contains no certificates")
+	}
+
+	for i := 0; i < len(chain)-1; i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, fmt.Errorf("certificate %d is not signed by certificate %d: %v", i, i+1, err)
+		}
+	}
+
+	return chain, nil
+}
+
+// CertificateChainHeaders returns the x5c value (base64 DER, not base64url) and the x5t#S256 thumbprint of the leaf
+func CertificateChainHeaders(chain []*x509.Certificate) ([]string, string) {
+	x5c := make([]string, len(chain))
+	for i, certificate := range chain {
+		x5c[i] = base64.StdEncoding.EncodeToString(certificate.Raw)
+	}
+	return x5c, CertificateThumbprint(chain[0])
+}
+
+// CertificateMatchesKey reports whether the certificate holds the given RSA or EC public key
+func CertificateMatchesKey(certificate *x509.Certificate, publicKey interface{}) bool {
+	key, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(publicKey)
+}
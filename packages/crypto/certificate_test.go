@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// selfSignedCertificatePEM self-signs a certificate for the key, valid from notBefore to notAfter
+func selfSignedCertificatePEM(t *testing.T, publicKey, privateKey interface{}, notBefore, notAfter time.Time) string {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "recipient"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestPublicKeyFromCertificate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	for _, test := range []struct {
+		name       string
+		publicKey  interface{ Equal(crypto.PublicKey) bool }
+		privateKey interface{}
+	}{
+		{"RSA", &rsaKey.PublicKey, rsaKey},
+		{"EC", &ecKey.PublicKey, ecKey},
+	} {
+		certificate, err := ParseCertificatePEM(selfSignedCertificatePEM(t, test.publicKey, test.privateKey, now.Add(-time.Hour), now.Add(time.Hour)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		publicKey, err := PublicKeyFromCertificate(certificate)
+		if err != nil || !test.publicKey.Equal(publicKey) {
+			t.Fatalf("%s: expected the certificate key, got %v", test.name, err)
+		}
+		sum := sha256.Sum256(certificate.Raw)
+		if thumbprint := CertificateThumbprint(certificate); thumbprint != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			t.Fatalf("%s: unexpected x5t#S256 %s", test.name, thumbprint)
+		}
+	}
+
+	// Signature only keys have no key management algorithm
+	certificate, err := ParseCertificatePEM(selfSignedCertificatePEM(t, edPublicKey, edPrivateKey, now.Add(-time.Hour), now.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PublicKeyFromCertificate(certificate); err == nil {
+		t.Fatal("expected an Ed25519 certificate to be refused")
+	}
+}
+
+func TestCheckCertificateValidity(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	for _, test := range []struct {
+		name                string
+		notBefore, notAfter time.Time
+		expected            error
+	}{
+		{"valid", now.Add(-time.Hour), now.Add(time.Hour), nil},
+		{"expired", now.Add(-2 * time.Hour), now.Add(-time.Hour), ErrCertificateExpired},
+		{"not yet valid", now.Add(time.Hour), now.Add(2 * time.Hour), ErrCertificateNotYetValid},
+	} {
+		certificate, err := ParseCertificatePEM(selfSignedCertificatePEM(t, &privateKey.PublicKey, privateKey, test.notBefore, test.notAfter))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckCertificateValidity(certificate, now); !errors.Is(err, test.expected) || (test.expected == nil) != (err == nil) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
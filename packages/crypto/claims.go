@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"jwe-go/packages/clock"
+	"time"
+)
+
+// JWTContentType marks a JWE whose payload is a JWT claims set
+const JWTContentType = "JWT"
+
+// JSONContentType marks a JWE whose payload is a JSON object of named fields
+const JSONContentType = "application/json"
+
+// Errors returned when validating claims, so callers can map them to a response
+var (
+	ErrTokenExpired    = errors.New("token is expired")
+	ErrInvalidAudience = errors.New("token audience does not match")
+)
+
+// BuildClaims wraps a JSON object payload in a claims set, the standard claims override payload members of the same name
+func BuildClaims(payload, subject, audience string, expiresIn time.Duration) ([]byte, error) {
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(payload), &claims); err != nil {
+		return nil, fmt.Errorf("plaintext must be a JSON object to be sent as JWT claims: %v", err)
+	}
+
+	now := clock.Now()
+	claims["iat"] = jwt.NewNumericDate(now)
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+	if expiresIn > 0 {
+		claims["exp"] = jwt.NewNumericDate(now.Add(expiresIn))
+	}
+
+	return json.Marshal(claims)
+}
+
+// IsClaimsSet reports whether the payload is a JSON object, nested JWTs carry a JWS instead
+func IsClaimsSet(payload []byte) bool {
+	var claims map[string]json.RawMessage
+	return json.Unmarshal(payload, &claims) == nil
+}
+
+// ValidateClaims checks exp, nbf and iat against Now with the leeway, and aud when an audience is expected
+func ValidateClaims(payload []byte, audience string, leeway time.Duration) error {
+	var claims jwt.Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return fmt.Errorf("failed to parse JWT claims: %v", err)
+	}
+
+	expected := jwt.Expected{Time: clock.Now()}
+	if audience != "" {
+		expected.AnyAudience = jwt.Audience{audience}
+	}
+
+	switch err := claims.ValidateWithLeeway(expected, leeway); {
+	case err == nil:
+		return nil
+	case errors.Is(err, jwt.ErrExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrInvalidAudience):
+		return fmt.Errorf("%w, expected %q", ErrInvalidAudience, audience)
+	case errors.Is(err, jwt.ErrNotValidYet):
+		return errors.New("token is not valid yet")
+	case errors.Is(err, jwt.ErrIssuedInTheFuture):
+		return errors.New("token was issued in the future")
+	default:
+		return fmt.Errorf("invalid JWT claims: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"errors"
+	"jwe-go/packages/clock"
+	"testing"
+	"time"
+)
+
+func TestValidateClaimsRejectsExpiredAndWrongAudience(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	defer func(previous clock.Clock) { clock.Current = previous }(clock.Current)
+	fake := clock.NewFake(issued)
+	clock.Current = fake
+
+	claims, err := BuildClaims(`{"role":"admin"}`, "user-1", "service-a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateClaims(claims, "service-a", 0); err != nil {
+		t.Fatalf("expected fresh claims to validate, got %v", err)
+	}
+	if err := ValidateClaims(claims, "service-b", 0); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("expected a wrong audience to be rejected, got %v", err)
+	}
+
+	// Past exp the leeway still covers small clock skew
+	fake.Set(issued.Add(90 * time.Second))
+	if err := ValidateClaims(claims, "service-a", time.Minute); err != nil {
+		t.Fatalf("expected the leeway to cover the skew, got %v", err)
+	}
+	if err := ValidateClaims(claims, "service-a", 0); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected expired claims to be rejected, got %v", err)
+	}
+
+	if _, err := BuildClaims("not json", "", "service-a", 0); err == nil {
+		t.Fatalf("expected a non JSON plaintext to be rejected")
+	}
+}
@@ -0,0 +1,38 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// ErrUnsupportedCompression is returned for a zip header other than DEF, the only registered compression algorithm
+var ErrUnsupportedCompression = errors.New("unsupported compression algorithm")
+
+// MaxInflatedSize is the largest plaintext a compressed token may inflate to on decrypt
+var MaxInflatedSize = 10 << 20
+
+// ErrInflatedTooLarge is returned for a compressed token whose plaintext inflates beyond MaxInflatedSize
+var ErrInflatedTooLarge = errors.New("decompressed plaintext exceeds the configured limit")
+
+// ValidateCompression rejects a zip value other than DEF
+func ValidateCompression(zip string) error {
+	if zip != string(jose.DEFLATE) {
+		return fmt.Errorf("%w %q, only DEF is registered", ErrUnsupportedCompression, zip)
+	}
+	return nil
+}
+
+// CheckCompression validates the zip header of a parsed token, before any key is used on it.
+// go-jose only fails on an unknown zip once the content is decrypted, which reads as a key mismatch.
+func CheckCompression(header jose.Header) error {
+	value, present := header.ExtraHeaders["zip"]
+	if !present {
+		return nil
+	}
+	zip, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("%w, zip must be a string", ErrUnsupportedCompression)
+	}
+	return ValidateCompression(zip)
+}
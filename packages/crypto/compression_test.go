@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func TestCheckCompressionRejectsUnknownZip(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		zip      interface{}
+		expected error
+	}{
+		{nil, nil},
+		{"DEF", nil},
+		{"LZW", ErrUnsupportedCompression},
+		{"def", ErrUnsupportedCompression},
+		{1, ErrUnsupportedCompression},
+	} {
+		// The crafted zip goes in as an extra protected header, go-jose only sets zip itself for DEF
+		options := &jose.EncrypterOptions{}
+		if test.zip != nil {
+			options.WithHeader("zip", test.zip)
+		}
+		encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: key}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		object, err := encrypter.Encrypt([]byte("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := object.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := jose.ParseEncrypted(compact, []jose.KeyAlgorithm{jose.DIRECT}, []jose.ContentEncryption{jose.A256GCM})
+		if err != nil {
+			t.Fatalf("zip %v: %v", test.zip, err)
+		}
+		if err := CheckCompression(parsed.Header); !errors.Is(err, test.expected) || (test.expected == nil) != (err == nil) {
+			t.Fatalf("zip %v: expected %v, got %v", test.zip, test.expected, err)
+		}
+	}
+}
+
+func TestDecryptInflatesCompressedTokensWithinTheLimit(t *testing.T) {
+	defer func(previous int) { MaxInflatedSize = previous }(MaxInflatedSize)
+	MaxInflatedSize = 1 << 16
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	first, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := &jose.EncrypterOptions{Compression: jose.DEFLATE}
+	encrypt := func(recipients []jose.Recipient, plaintext []byte) string {
+		encrypter, err := jose.NewMultiEncrypter(jose.A256GCM, recipients, options)
+		if len(recipients) == 1 {
+			encrypter, err = jose.NewEncrypter(jose.A256GCM, recipients[0], options)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		object, err := encrypter.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return object.FullSerialize()
+	}
+	decrypt := func(serialized string, key interface{}) (DecryptedRecipient, error) {
+		parsed, err := jose.ParseEncrypted(serialized, append(append(DecryptionKeyAlgorithms, SymmetricKeyAlgorithms...), PasswordKeyAlgorithms...), SupportedContentEncryptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return DecryptRecipient(serialized, parsed, key)
+	}
+
+	// Every key algorithm the decrypt endpoint accepts goes through this package's inflate, several recipients included
+	mixed := []jose.Recipient{{Algorithm: jose.RSA_OAEP, Key: &first.PublicKey}, {Algorithm: jose.RSA_OAEP_256, Key: &second.PublicKey, KeyID: "second"}}
+	for _, test := range []struct {
+		name       string
+		recipients []jose.Recipient
+		key        interface{}
+		index      int
+		algorithm  jose.KeyAlgorithm
+	}{
+		{"A256GCMKW", []jose.Recipient{{Algorithm: jose.A256GCMKW, Key: secret}}, secret, 0, jose.A256GCMKW},
+		{"PBES2", []jose.Recipient{{Algorithm: jose.PBES2_HS512_A256KW, Key: []byte("correct horse"), PBES2Count: 1000}}, []byte("correct horse"), 0, jose.PBES2_HS512_A256KW},
+		{"second recipient", mixed, second, 1, jose.RSA_OAEP_256},
+	} {
+		decrypted, err := decrypt(encrypt(test.recipients, []byte("compressed plaintext")), test.key)
+		if err != nil || string(decrypted.Plaintext) != "compressed plaintext" {
+			t.Fatalf("%s: expected the plaintext back, got %q: %v", test.name, decrypted.Plaintext, err)
+		}
+		if decrypted.Index != test.index || decrypted.Header.Algorithm != string(test.algorithm) {
+			t.Fatalf("%s: expected recipient %d with %s, got %d with %s", test.name, test.index, test.algorithm, decrypted.Index, decrypted.Header.Algorithm)
+		}
+	}
+
+	// go-jose inflates to 250 kB at least, the limit stops the plaintext one byte past it
+	bomb := encrypt([]jose.Recipient{{Algorithm: jose.DIRECT, Key: secret}}, make([]byte, MaxInflatedSize+1))
+	if _, err := decrypt(bomb, secret); !errors.Is(err, ErrInflatedTooLarge) {
+		t.Fatalf("expected ErrInflatedTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// ContentKeyAlgorithms are the key management algorithms that wrap a CEK, dir and the AES-GCM key wraps are left out
+var ContentKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.RSA_OAEP, jose.RSA_OAEP_256, RSA_OAEP_384, RSA_OAEP_512, jose.RSA1_5, jose.ECDH_ES_A256KW, jose.A128KW, jose.A192KW, jose.A256KW,
+}
+
+// ContentKeyMaterial hands out a client supplied CEK with a fresh random IV for every message.
+// The CEK is the whole secret of the message: whoever learns it reads every message encrypted under it,
+// so a supplied CEK must never be used for more than one message.
+type ContentKeyMaterial struct {
+	ContentEncryptionKey []byte
+}
+
+func (material ContentKeyMaterial) ContentKey(size int) ([]byte, error) {
+	if len(material.ContentEncryptionKey) != size {
+		return nil, fmt.Errorf("content encryption key must be %d bytes", size)
+	}
+	return material.ContentEncryptionKey, nil
+}
+
+func (material ContentKeyMaterial) IV(size int) ([]byte, error) {
+	return randomBytes(size)
+}
+
+// ValidateContentEncryptionKey checks the CEK has the length the content encryption algorithm requires
+func ValidateContentEncryptionKey(cek []byte, contentEncryption jose.ContentEncryption) error {
+	size, ok := contentEncryptionKeySizes[contentEncryption]
+	if !ok {
+		return fmt.Errorf("unsupported content encryption %q", contentEncryption)
+	}
+	if len(cek) != size {
+		return fmt.Errorf("content encryption key for %s must be %d bytes, got %d", contentEncryption, size, len(cek))
+	}
+	return nil
+}
+
+// SupportsContentKey reports whether the key management algorithm can wrap a supplied CEK
+func SupportsContentKey(keyAlgorithm jose.KeyAlgorithm) bool {
+	for _, alg := range ContentKeyAlgorithms {
+		if alg == keyAlgorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// NewContentKeyEncrypter creates an encrypter wrapping the given CEK for the recipient in place of a random one.
+// go-jose always draws its own CEK, so the messages are built by the encrypters of this package.
+func NewContentKeyEncrypter(contentEncryption jose.ContentEncryption, recipient jose.Recipient, options *jose.EncrypterOptions, cek []byte) (jose.Encrypter, error) {
+	if !SupportsContentKey(recipient.Algorithm) {
+		return nil, fmt.Errorf("key algorithm %s cannot wrap a supplied content encryption key", recipient.Algorithm)
+	}
+	if err := ValidateContentEncryptionKey(cek, contentEncryption); err != nil {
+		return nil, err
+	}
+	material := ContentKeyMaterial{ContentEncryptionKey: cek}
+
+	switch key := recipient.Key.(type) {
+	case *rsa.PublicKey:
+		return newRSAEncrypter(contentEncryption, recipient, key, options, material)
+	case *ecdsa.PublicKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("unsupported EC key: %v", err)
+		}
+		return newECDHESEncrypter(contentEncryption, recipient, ecdhKey, options, material)
+	case *ecdh.PublicKey:
+		return newECDHESEncrypter(contentEncryption, recipient, key, options, material)
+	case []byte:
+		// AES key wrap output only depends on the key and CEK, the IV still comes fresh from the key material
+		return NewTestVectorEncrypter(contentEncryption, recipient, options, material)
+	}
+	return nil, fmt.Errorf("unsupported key type %T for a supplied content encryption key", recipient.Key)
+}
+
+// rsaEncrypter implements the RSA key encryption algorithms over the CEK of its key material,
+// crypto/rsa uses the OAEP hash for MGF1 as well, as RSA-OAEP-384 and RSA-OAEP-512 require
+type rsaEncrypter struct {
+	contentEncryption jose.ContentEncryption
+	keyAlgorithm      jose.KeyAlgorithm
+	publicKey         *rsa.PublicKey
+	keyID             string
+	options           jose.EncrypterOptions
+	keyMaterial       KeyMaterial
+}
+
+func newRSAEncrypter(contentEncryption jose.ContentEncryption, recipient jose.Recipient, publicKey *rsa.PublicKey, options *jose.EncrypterOptions, material KeyMaterial) (jose.Encrypter, error) {
+	switch recipient.Algorithm {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256, RSA_OAEP_384, RSA_OAEP_512, jose.RSA1_5:
+	default:
+		return nil, fmt.Errorf("key algorithm %s cannot be used with an RSA key", recipient.Algorithm)
+	}
+	if _, ok := contentEncryptionKeySizes[contentEncryption]; !ok {
+		return nil, fmt.Errorf("unsupported content encryption %q", contentEncryption)
+	}
+
+	encrypter := &rsaEncrypter{
+		contentEncryption: contentEncryption,
+		keyAlgorithm:      recipient.Algorithm,
+		publicKey:         publicKey,
+		keyID:             recipient.KeyID,
+		keyMaterial:       material,
+	}
+	if options != nil {
+		encrypter.options = *options
+	}
+	if encrypter.options.Compression != "" && encrypter.options.Compression != jose.DEFLATE {
+		return nil, fmt.Errorf("unsupported compression %q", encrypter.options.Compression)
+	}
+	return encrypter, nil
+}
+
+func (encrypter *rsaEncrypter) Encrypt(plaintext []byte) (*jose.JSONWebEncryption, error) {
+	return encrypter.EncryptWithAuthData(plaintext, nil)
+}
+
+// EncryptWithAuthData encrypts the content key to the recipient key, sealJWE assembles the message
+func (encrypter *rsaEncrypter) EncryptWithAuthData(plaintext []byte, aad []byte) (*jose.JSONWebEncryption, error) {
+	cek, err := encrypter.keyMaterial.ContentKey(contentEncryptionKeySizes[encrypter.contentEncryption])
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content encryption key: %v", err)
+	}
+
+	var encryptedKey []byte
+	switch encrypter.keyAlgorithm {
+	case jose.RSA1_5:
+		encryptedKey, err = rsa.EncryptPKCS1v15(jose.RandReader, encrypter.publicKey, cek)
+	case jose.RSA_OAEP:
+		encryptedKey, err = rsa.EncryptOAEP(sha1.New(), jose.RandReader, encrypter.publicKey, cek, nil)
+	case RSA_OAEP_384:
+		encryptedKey, err = rsa.EncryptOAEP(sha512.New384(), jose.RandReader, encrypter.publicKey, cek, nil)
+	case RSA_OAEP_512:
+		encryptedKey, err = rsa.EncryptOAEP(sha512.New(), jose.RandReader, encrypter.publicKey, cek, nil)
+	default:
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), jose.RandReader, encrypter.publicKey, cek, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt content encryption key: %v", err)
+	}
+
+	header := protectedHeader(encrypter.keyAlgorithm, encrypter.contentEncryption, encrypter.keyID, encrypter.options)
+	return sealJWE(header, encryptedKey, encrypter.contentEncryption, cek, encrypter.keyMaterial, plaintext, aad)
+}
+
+func (encrypter *rsaEncrypter) Options() jose.EncrypterOptions {
+	return encrypter.options
+}
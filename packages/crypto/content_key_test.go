@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/go-jose/go-jose/v4"
+	josecipher "github.com/go-jose/go-jose/v4/cipher"
+	"strings"
+	"testing"
+)
+
+func TestContentKeyEncrypterWrapsTheSuppliedKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappingKey := make([]byte, 16)
+	rand.Read(wrappingKey)
+	cek := make([]byte, 32)
+	rand.Read(cek)
+
+	for _, test := range []struct {
+		name       string
+		recipient  jose.Recipient
+		privateKey interface{}
+		unwrap     func(encryptedKey []byte) ([]byte, error)
+	}{
+		{"RSA-OAEP-256", jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &rsaKey.PublicKey}, rsaKey, func(encryptedKey []byte) ([]byte, error) {
+			return rsa.DecryptOAEP(sha256.New(), nil, rsaKey, encryptedKey, nil)
+		}},
+		{"ECDH-ES+A256KW", jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: &ecKey.PublicKey}, ecKey, nil},
+		{"X25519", jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: x25519Key.PublicKey()}, x25519Key, nil},
+		{"A128KW", jose.Recipient{Algorithm: jose.A128KW, Key: wrappingKey}, wrappingKey, func(encryptedKey []byte) ([]byte, error) {
+			block, err := aes.NewCipher(wrappingKey)
+			if err != nil {
+				return nil, err
+			}
+			return josecipher.KeyUnwrap(block, encryptedKey)
+		}},
+	} {
+		encrypter, err := NewContentKeyEncrypter(jose.A256GCM, test.recipient, nil, cek)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var ivs [2][]byte
+		for i := range ivs {
+			jwe, err := encrypter.Encrypt([]byte("chosen key"))
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			serialized, err := jwe.CompactSerialize()
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			parsed, err := jose.ParseEncrypted(serialized, []jose.KeyAlgorithm{test.recipient.Algorithm}, []jose.ContentEncryption{jose.A256GCM})
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			var plaintext []byte
+			if privateKey, ok := test.privateKey.(*ecdh.PrivateKey); ok {
+				plaintext = decryptX25519(t, serialized, "", privateKey)
+			} else if plaintext, err = Decrypt(serialized, parsed, test.privateKey); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if string(plaintext) != "chosen key" {
+				t.Fatalf("%s: expected the token to decrypt, got %q", test.name, plaintext)
+			}
+			parts := strings.Split(serialized, ".")
+			if test.unwrap != nil {
+				encryptedKey, _ := base64.RawURLEncoding.DecodeString(parts[1])
+				if unwrapped, err := test.unwrap(encryptedKey); err != nil || !bytes.Equal(unwrapped, cek) {
+					t.Fatalf("%s: expected the supplied CEK in the token, got %x %v", test.name, unwrapped, err)
+				}
+			}
+			ivs[i] = []byte(parts[2])
+		}
+		if bytes.Equal(ivs[0], ivs[1]) {
+			t.Fatalf("%s: expected a fresh IV for every message", test.name)
+		}
+	}
+
+	if _, err := NewContentKeyEncrypter(jose.A128GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &rsaKey.PublicKey}, nil, cek); err == nil {
+		t.Fatal("expected a 32 byte CEK to be refused for A128GCM")
+	}
+	if _, err := NewContentKeyEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: cek}, nil, cek); err == nil {
+		t.Fatal("expected dir to be refused, it has no CEK to wrap")
+	}
+}
@@ -0,0 +1,477 @@
+package crypto
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	josecipher "github.com/go-jose/go-jose/v4/cipher"
+	"golang.org/x/crypto/pbkdf2"
+	"hash"
+	"io"
+	"strings"
+)
+
+// CriticalHeader lists the extensions a recipient must understand to process the token
+const CriticalHeader = "crit"
+
+// SupportedCriticalHeaders are the extensions this service understands when they are marked critical
+var SupportedCriticalHeaders = map[string]bool{
+	ServerKidHeader:     true,
+	ServerKidHashHeader: true,
+	StreamIDHeader:      true,
+	ChunkIndexHeader:    true,
+	LastChunkHeader:     true,
+}
+
+// ErrUnsupportedCritical is returned for tokens with a critical extension this service does not understand
+var ErrUnsupportedCritical = errors.New("unsupported critical header")
+
+// registeredHeaders are defined by RFC 7515 and 7516, which forbid listing them in crit
+var registeredHeaders = map[string]bool{
+	"alg": true, "enc": true, "zip": true, "jku": true, "jwk": true, "kid": true,
+	"x5u": true, "x5c": true, "x5t": true, "x5t#S256": true, "typ": true, "cty": true,
+	"crit": true, "epk": true, "apu": true, "apv": true, "iv": true, "tag": true,
+	"p2s": true, "p2c": true,
+}
+
+// ValidateCriticalHeaders checks the names a client marks critical are custom headers it also sets
+func ValidateCriticalHeaders(names []string, headers map[string]string) error {
+	for _, name := range names {
+		if registeredHeaders[name] {
+			return fmt.Errorf("header %q is defined by the JWE specification and cannot be marked critical", name)
+		}
+		if _, ok := headers[name]; !ok {
+			return fmt.Errorf("critical header %q is not among the protected headers", name)
+		}
+	}
+	return nil
+}
+
+// CheckCriticalHeaders returns the critical extensions of the header, failing with ErrUnsupportedCritical for unknown ones
+func CheckCriticalHeaders(header jose.Header) ([]string, error) {
+	value, ok := header.ExtraHeaders[CriticalHeader]
+	if !ok {
+		return nil, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, errors.New("crit header must be a non-empty list of header names")
+	}
+	names := make([]string, len(list))
+	for i, item := range list {
+		name, ok := item.(string)
+		if !ok || name == "" || registeredHeaders[name] {
+			return nil, fmt.Errorf("crit header lists an invalid name %v", item)
+		}
+		if _, present := header.ExtraHeaders[jose.HeaderKey(name)]; !present {
+			return nil, fmt.Errorf("critical header %q is missing from the token", name)
+		}
+		if !SupportedCriticalHeaders[name] {
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedCritical, name)
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+// jweParts are the segments of a JWE, the protected header kept as received since it is authenticated
+type jweParts struct {
+	protected  string
+	recipients []jweRecipient
+	iv         []byte
+	ciphertext []byte
+	tag        []byte
+	aad        string
+}
+
+// jweRecipient is the header of a recipient, merged with the protected and shared unprotected headers, and its encrypted key
+type jweRecipient struct {
+	header       map[string]json.RawMessage
+	encryptedKey []byte
+}
+
+// decryptSerialized decrypts the token for the first recipient the key opens, like go-jose it returns the index
+// and the merged header of that recipient
+func decryptSerialized(serialized string, key interface{}) (int, map[string]json.RawMessage, []byte, error) {
+	parts, err := splitJWE(serialized)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	for index, recipient := range parts.recipients {
+		var plaintext []byte
+		if plaintext, err = decryptRecipient(parts, recipient, key); err == nil {
+			return index, recipient.header, plaintext, nil
+		}
+	}
+	return 0, nil, nil, err
+}
+
+// decryptRecipient unwraps the content key of the recipient and opens the content with it
+func decryptRecipient(parts jweParts, recipient jweRecipient, key interface{}) ([]byte, error) {
+	var alg jose.KeyAlgorithm
+	var enc jose.ContentEncryption
+	var zip string
+	if err := headerMember(recipient.header, "alg", &alg); err != nil {
+		return nil, err
+	}
+	if err := headerMember(recipient.header, "enc", &enc); err != nil {
+		return nil, err
+	}
+	if err := headerMember(recipient.header, "zip", &zip); err != nil {
+		return nil, err
+	}
+
+	cek, err := unwrapContentKey(alg, enc, recipient, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(cek) != contentEncryptionKeySizes[enc] {
+		return nil, errors.New("content encryption key has the wrong length")
+	}
+
+	aead, tagSize, err := newContentCipher(enc, cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts.iv) != aead.NonceSize() || len(parts.tag) != tagSize {
+		return nil, errors.New("invalid IV or authentication tag length")
+	}
+
+	authData := parts.protected
+	if parts.aad != "" {
+		authData += "." + parts.aad
+	}
+	plaintext, err := aead.Open(nil, parts.iv, append(parts.ciphertext, parts.tag...), []byte(authData))
+	if err != nil {
+		return nil, errors.New("failed to decrypt the content")
+	}
+
+	switch zip {
+	case "":
+		return plaintext, nil
+	case string(jose.DEFLATE):
+		return inflate(plaintext)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", zip)
+	}
+}
+
+// encodedRecipient is a recipient of the general JSON serialization
+type encodedRecipient struct {
+	Header       map[string]json.RawMessage `json:"header"`
+	EncryptedKey string                     `json:"encrypted_key"`
+}
+
+// splitJWE reads the compact, flattened or general JSON serialization
+func splitJWE(serialized string) (jweParts, error) {
+	var parts jweParts
+	var encoded struct {
+		Protected    string                     `json:"protected"`
+		Unprotected  map[string]json.RawMessage `json:"unprotected"`
+		Header       map[string]json.RawMessage `json:"header"`
+		EncryptedKey string                     `json:"encrypted_key"`
+		Recipients   []encodedRecipient         `json:"recipients"`
+		IV           string                     `json:"iv"`
+		Ciphertext   string                     `json:"ciphertext"`
+		Tag          string                     `json:"tag"`
+		AAD          string                     `json:"aad"`
+	}
+
+	if serialized = strings.TrimSpace(serialized); strings.HasPrefix(serialized, "{") {
+		if err := json.Unmarshal([]byte(serialized), &encoded); err != nil {
+			return parts, fmt.Errorf("failed to parse JWE: %v", err)
+		}
+	} else {
+		segments := strings.Split(serialized, ".")
+		if len(segments) != 5 {
+			return parts, errors.New("compact JWE must have 5 segments")
+		}
+		encoded.Protected, encoded.EncryptedKey, encoded.IV, encoded.Ciphertext, encoded.Tag = segments[0], segments[1], segments[2], segments[3], segments[4]
+	}
+	// The compact and flattened serializations hold their single recipient at the top level
+	if len(encoded.Recipients) == 0 {
+		encoded.Recipients = []encodedRecipient{{Header: encoded.Header, EncryptedKey: encoded.EncryptedKey}}
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(encoded.Protected)
+	if err != nil {
+		return parts, fmt.Errorf("invalid protected header: %v", err)
+	}
+	var protectedHeader map[string]json.RawMessage
+	if err := json.Unmarshal(protected, &protectedHeader); err != nil || protectedHeader == nil {
+		return parts, fmt.Errorf("protected header must be a JSON object")
+	}
+
+	for _, encodedRecipient := range encoded.Recipients {
+		recipient := jweRecipient{header: make(map[string]json.RawMessage, len(protectedHeader))}
+		for name, value := range protectedHeader {
+			recipient.header[name] = value
+		}
+		// Unprotected members only fill in what the protected header leaves out
+		for _, extra := range []map[string]json.RawMessage{encoded.Unprotected, encodedRecipient.Header} {
+			for name, value := range extra {
+				if _, ok := recipient.header[name]; !ok {
+					recipient.header[name] = value
+				}
+			}
+		}
+		if recipient.encryptedKey, err = base64.RawURLEncoding.DecodeString(encodedRecipient.EncryptedKey); err != nil {
+			return parts, fmt.Errorf("invalid JWE segment: %v", err)
+		}
+		parts.recipients = append(parts.recipients, recipient)
+	}
+
+	parts.protected, parts.aad = encoded.Protected, encoded.AAD
+	for _, segment := range []struct {
+		encoded string
+		decoded *[]byte
+	}{
+		{encoded.IV, &parts.iv},
+		{encoded.Ciphertext, &parts.ciphertext},
+		{encoded.Tag, &parts.tag},
+	} {
+		if *segment.decoded, err = base64.RawURLEncoding.DecodeString(segment.encoded); err != nil {
+			return parts, fmt.Errorf("invalid JWE segment: %v", err)
+		}
+	}
+	return parts, nil
+}
+
+// unwrapContentKey recovers the content encryption key for the key management algorithms the decrypt endpoint accepts
+func unwrapContentKey(alg jose.KeyAlgorithm, enc jose.ContentEncryption, recipient jweRecipient, key interface{}) ([]byte, error) {
+	switch alg {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256, RSA_OAEP_384, RSA_OAEP_512:
+		privateKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key algorithm %s requires an RSA private key", alg)
+		}
+		var digest hash.Hash = sha1.New()
+		switch alg {
+		case jose.RSA_OAEP_256:
+			digest = sha256.New()
+		case RSA_OAEP_384:
+			digest = sha512.New384()
+		case RSA_OAEP_512:
+			digest = sha512.New()
+		}
+		// rand.Reader like go-jose, never a nil or custom source. Go ignores it since 1.20 as decryption became
+		// constant time, older versions blinded the private key operation with it.
+		return rsa.DecryptOAEP(digest, rand.Reader, privateKey, recipient.encryptedKey, nil)
+	case jose.ECDH_ES_A256KW:
+		return unwrapECDHESKey(recipient, key)
+	case jose.A128KW, jose.A192KW, jose.A256KW:
+		secret, ok := key.([]byte)
+		if !ok || len(secret) != map[jose.KeyAlgorithm]int{jose.A128KW: 16, jose.A192KW: 24, jose.A256KW: 32}[alg] {
+			return nil, fmt.Errorf("key algorithm %s requires a shared secret of the matching size", alg)
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, err
+		}
+		return keyUnwrap(block, recipient.encryptedKey)
+	case jose.A128GCMKW, jose.A192GCMKW, jose.A256GCMKW:
+		return unwrapGCMKey(recipient, key)
+	case jose.PBES2_HS256_A128KW, jose.PBES2_HS512_A256KW:
+		return unwrapPBES2Key(alg, recipient, key)
+	case jose.DIRECT:
+		secret, ok := key.([]byte)
+		if !ok || len(recipient.encryptedKey) != 0 {
+			return nil, errors.New("key algorithm dir requires a shared secret and no encrypted key")
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("key algorithm %s is not supported", alg)
+	}
+}
+
+// unwrapECDHESKey agrees on the key encryption key with the epk header, for EC and X25519 recipient keys
+func unwrapECDHESKey(recipient jweRecipient, key interface{}) ([]byte, error) {
+	var privateKey *ecdh.PrivateKey
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		var err error
+		if privateKey, err = key.ECDH(); err != nil {
+			return nil, err
+		}
+	case *ecdh.PrivateKey:
+		privateKey = key
+	default:
+		return nil, errors.New("key algorithm ECDH-ES+A256KW requires an EC or X25519 private key")
+	}
+
+	var ephemeral *ecdh.PublicKey
+	var members okpMembers
+	if err := headerMember(recipient.header, "epk", &members); err != nil {
+		return nil, err
+	}
+	if members.KeyType == "OKP" {
+		var err error
+		if ephemeral, err = importX25519JWK(members); err != nil {
+			return nil, err
+		}
+	} else {
+		var jwk jose.JSONWebKey
+		if err := jwk.UnmarshalJSON(recipient.header["epk"]); err != nil {
+			return nil, fmt.Errorf("invalid epk header: %v", err)
+		}
+		ecKey, ok := jwk.Key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.New("epk header must hold an EC or X25519 public key")
+		}
+		var err error
+		if ephemeral, err = ecKey.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid epk header: %v", err)
+		}
+	}
+
+	// ECDH fails when the ephemeral key is on another curve than the recipient key
+	sharedSecret, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	var apu, apv string
+	if err := headerMember(recipient.header, "apu", &apu); err != nil {
+		return nil, err
+	}
+	if err := headerMember(recipient.header, "apv", &apv); err != nil {
+		return nil, err
+	}
+	partyUInfo, err := base64.RawURLEncoding.DecodeString(apu)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apu header: %v", err)
+	}
+	partyVInfo, err := base64.RawURLEncoding.DecodeString(apv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apv header: %v", err)
+	}
+
+	block, err := aes.NewCipher(deriveECDHESKeyEncryptionKey(sharedSecret, partyUInfo, partyVInfo))
+	if err != nil {
+		return nil, err
+	}
+	return keyUnwrap(block, recipient.encryptedKey)
+}
+
+// unwrapGCMKey opens the encrypted key with AES-GCM under the shared secret, the iv and tag headers complete it.
+// Any AES key size is accepted like go-jose, the decrypt endpoint checks it against the key algorithm afterwards.
+func unwrapGCMKey(recipient jweRecipient, key interface{}) ([]byte, error) {
+	secret, ok := key.([]byte)
+	if !ok {
+		return nil, errors.New("the AES-GCM key wrap algorithms require a shared secret")
+	}
+	var encodedIV, encodedTag string
+	if err := headerMember(recipient.header, "iv", &encodedIV); err != nil {
+		return nil, err
+	}
+	if err := headerMember(recipient.header, "tag", &encodedTag); err != nil {
+		return nil, err
+	}
+	iv, err := base64.RawURLEncoding.DecodeString(encodedIV)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iv header: %v", err)
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(encodedTag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag header: %v", err)
+	}
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aead.NonceSize() || len(tag) != aead.Overhead() {
+		return nil, errors.New("invalid iv or tag header length")
+	}
+	return aead.Open(nil, iv, append(recipient.encryptedKey, tag...), nil)
+}
+
+// unwrapPBES2Key derives the key encryption key from the password with the p2s salt and p2c count,
+// refusing the counts above MaxPBES2Iterations go-jose refuses too
+func unwrapPBES2Key(alg jose.KeyAlgorithm, recipient jweRecipient, key interface{}) ([]byte, error) {
+	password, ok := key.([]byte)
+	if !ok {
+		return nil, errors.New("the PBES2 key algorithms require a password")
+	}
+	var encodedSalt string
+	var iterations int
+	if err := headerMember(recipient.header, "p2s", &encodedSalt); err != nil {
+		return nil, err
+	}
+	if err := headerMember(recipient.header, "p2c", &iterations); err != nil {
+		return nil, err
+	}
+	saltInput, err := base64.RawURLEncoding.DecodeString(encodedSalt)
+	if err != nil || len(saltInput) == 0 {
+		return nil, errors.New("invalid p2s header")
+	}
+	if iterations <= 0 || iterations > MaxPBES2Iterations {
+		return nil, fmt.Errorf("p2c header must be between 1 and %d", MaxPBES2Iterations)
+	}
+
+	// The salt is the algorithm name, a zero byte and the salt input
+	salt := append(append([]byte(alg), 0), saltInput...)
+	derived := pbkdf2.Key(password, salt, iterations, 16, sha256.New)
+	if alg == jose.PBES2_HS512_A256KW {
+		derived = pbkdf2.Key(password, salt, iterations, 32, sha512.New)
+	}
+	defer Zero(derived)
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return keyUnwrap(block, recipient.encryptedKey)
+}
+
+// keyUnwrap rejects encrypted keys shorter than the integrity block and one key block, go-jose panics on them
+func keyUnwrap(block cipher.Block, encryptedKey []byte) ([]byte, error) {
+	if len(encryptedKey) < 16 {
+		return nil, errors.New("encrypted key is too short")
+	}
+	return josecipher.KeyUnwrap(block, encryptedKey)
+}
+
+// headerMember decodes a header member into destination, leaving it untouched when the member is absent
+func headerMember(header map[string]json.RawMessage, name string, destination interface{}) error {
+	value, ok := header[name]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal(value, destination); err != nil {
+		return fmt.Errorf("invalid %s header: %v", name, err)
+	}
+	return nil
+}
+
+// inflate decompresses a zip=DEF plaintext, reading at most one byte past MaxInflatedSize so a bomb
+// is refused before it is inflated in memory
+func inflate(input []byte) ([]byte, error) {
+	limit := int64(MaxInflatedSize)
+	var output bytes.Buffer
+	n, err := output.ReadFrom(io.LimitReader(flate.NewReader(bytes.NewReader(input)), limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress plaintext: %v", err)
+	}
+	if n > limit {
+		return nil, ErrInflatedTooLarge
+	}
+	return output.Bytes(), nil
+}
@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+// encryptCritical encrypts to the recipient with server_kid and extra listed in crit and returns the compact token
+func encryptCritical(t *testing.T, recipient jose.Recipient, contentEncryption jose.ContentEncryption, compression jose.CompressionAlgorithm, extra string) string {
+	t.Helper()
+
+	options := (&jose.EncrypterOptions{Compression: compression}).WithHeader(ServerKidHeader, "test-kid")
+	critical := []string{ServerKidHeader}
+	if extra != "" {
+		options.WithHeader(jose.HeaderKey(extra), "value")
+		critical = append(critical, extra)
+	}
+	options.WithHeader(CriticalHeader, critical)
+
+	encrypter, err := NewEncrypter(contentEncryption, recipient, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("critical plaintext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serialized
+}
+
+func TestDecryptHonorsSupportedCriticalHeaders(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name              string
+		recipient         jose.Recipient
+		contentEncryption jose.ContentEncryption
+		compression       jose.CompressionAlgorithm
+		key               interface{}
+	}{
+		{"RSA-OAEP-256", jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &rsaKey.PublicKey}, jose.A256GCM, jose.NONE, rsaKey},
+		{"ECDH-ES P-256", jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: &ecKey.PublicKey}, jose.A128CBC_HS256, jose.NONE, ecKey},
+		{"A256KW", jose.Recipient{Algorithm: jose.A256KW, Key: secret}, jose.A256GCM, jose.NONE, secret},
+		{"dir", jose.Recipient{Algorithm: jose.DIRECT, Key: secret}, jose.A256GCM, jose.NONE, secret},
+		{"zip", jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &rsaKey.PublicKey}, jose.A256GCM, jose.DEFLATE, rsaKey},
+		{"X25519", jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: x25519Key.PublicKey()}, jose.A256GCM, jose.NONE, x25519Key},
+	}
+
+	for _, tc := range cases {
+		serialized := encryptCritical(t, tc.recipient, tc.contentEncryption, tc.compression, "")
+		parsed, err := jose.ParseEncrypted(serialized, []jose.KeyAlgorithm{tc.recipient.Algorithm}, SupportedContentEncryptions)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		plaintext, err := Decrypt(serialized, parsed, tc.key)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(plaintext) != "critical plaintext" {
+			t.Fatalf("%s: round trip mismatch: %q", tc.name, plaintext)
+		}
+	}
+}
+
+func TestDecryptRejectsUnknownCriticalHeaders(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serialized := encryptCritical(t, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, jose.A256GCM, jose.NONE, "x-unknown")
+	parsed, err := jose.ParseEncrypted(serialized, []jose.KeyAlgorithm{jose.RSA_OAEP_256}, SupportedContentEncryptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decrypt(serialized, parsed, privateKey); !errors.Is(err, ErrUnsupportedCritical) {
+		t.Fatalf("expected ErrUnsupportedCritical, got %v", err)
+	}
+}
+
+func TestValidateCriticalHeadersRequiresProtectedCustomHeaders(t *testing.T) {
+	headers := map[string]string{"x-tenant": "acme"}
+	if err := ValidateCriticalHeaders([]string{"x-tenant"}, headers); err != nil {
+		t.Fatalf("expected a set custom header to be accepted, got %v", err)
+	}
+	if err := ValidateCriticalHeaders([]string{"x-missing"}, headers); err == nil {
+		t.Fatalf("expected a critical header that is not set to be rejected")
+	}
+	if err := ValidateCriticalHeaders([]string{"enc"}, headers); err == nil {
+		t.Fatalf("expected a registered header to be rejected")
+	}
+}
@@ -0,0 +1,56 @@
+package crypto
+
+import (
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// DecryptedRecipient is the outcome of decrypting a JWE, Header merges the shared headers with those of the recipient
+type DecryptedRecipient struct {
+	Index     int
+	Header    jose.Header
+	Plaintext []byte
+}
+
+// Decrypt decrypts the parsed JWE with the key, see DecryptRecipient
+func Decrypt(serialized string, encryptedObject *jose.JSONWebEncryption, key interface{}) ([]byte, error) {
+	decrypted, err := DecryptRecipient(serialized, encryptedObject, key)
+	return decrypted.Plaintext, err
+}
+
+// DecryptRecipient decrypts the compact or JSON serialized JWE with the key and reports which recipient it opened.
+// go-jose refuses every token carrying crit, knows none of the non-standard key algorithms and inflates zip tokens
+// to a bound of its own, so those tokens are decrypted from their serialized form by this package.
+func DecryptRecipient(serialized string, encryptedObject *jose.JSONWebEncryption, key interface{}) (DecryptedRecipient, error) {
+	critical, err := CheckCriticalHeaders(encryptedObject.Header)
+	if err != nil {
+		return DecryptedRecipient{}, err
+	}
+	_, compressed := encryptedObject.Header.ExtraHeaders["zip"]
+	if critical == nil && !compressed && !IsNonStandardKeyAlgorithm(jose.KeyAlgorithm(encryptedObject.Header.Algorithm)) {
+		return decryptMulti(encryptedObject, key)
+	}
+
+	index, recipientHeader, plaintext, err := decryptSerialized(serialized, key)
+	if err != nil {
+		return DecryptedRecipient{}, err
+	}
+	// The alg and kid of a general serialization sit in the header of the recipient
+	header := encryptedObject.Header
+	headerMember(recipientHeader, "alg", &header.Algorithm)
+	headerMember(recipientHeader, "kid", &header.KeyID)
+	return DecryptedRecipient{Index: index, Header: header, Plaintext: plaintext}, nil
+}
+
+// decryptMulti calls go-jose, whose key unwrap panics on an empty encrypted key with the key wrap algorithms.
+// The panic is turned into an error, the token is attacker controlled and must not take the process down.
+func decryptMulti(encryptedObject *jose.JSONWebEncryption, key interface{}) (decrypted DecryptedRecipient, err error) {
+	defer func() {
+		if recover() != nil {
+			decrypted, err = DecryptedRecipient{}, errors.New("malformed encrypted key")
+		}
+	}()
+
+	index, header, plaintext, err := encryptedObject.DecryptMulti(key)
+	return DecryptedRecipient{Index: index, Header: header, Plaintext: plaintext}, err
+}
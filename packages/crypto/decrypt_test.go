@@ -0,0 +1,147 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"github.com/go-jose/go-jose/v4"
+	"hash"
+	"strings"
+	"testing"
+)
+
+func parseSerializedJWE(t *testing.T, serialized string) *jose.JSONWebEncryption {
+	t.Helper()
+
+	parsed, err := jose.ParseEncrypted(serialized, []jose.KeyAlgorithm{jose.RSA_OAEP_256, jose.ECDH_ES_A256KW}, SupportedContentEncryptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestDecryptRecipientReadsSingleRecipientJSON(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("single recipient"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized := jwe.FullSerialize()
+
+	decrypted, err := DecryptRecipient(serialized, parseSerializedJWE(t, serialized), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Index != 0 || string(decrypted.Plaintext) != "single recipient" {
+		t.Fatalf("expected recipient 0 and the plaintext, got %d, %q", decrypted.Index, decrypted.Plaintext)
+	}
+}
+
+func TestDecryptRecipientFindsMatchingRecipient(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypter, err := jose.NewMultiEncrypter(jose.A256GCM, []jose.Recipient{
+		{Algorithm: jose.RSA_OAEP_256, Key: &rsaKey.PublicKey},
+		{Algorithm: jose.ECDH_ES_A256KW, Key: &otherKey.PublicKey},
+		{Algorithm: jose.ECDH_ES_A256KW, Key: &ecKey.PublicKey},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("multi recipient"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized := jwe.FullSerialize()
+
+	decrypted, err := DecryptRecipient(serialized, parseSerializedJWE(t, serialized), ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Index != 2 || decrypted.Header.Algorithm != string(jose.ECDH_ES_A256KW) || string(decrypted.Plaintext) != "multi recipient" {
+		t.Fatalf("expected recipient 2 with ECDH-ES+A256KW, got %d, %q, %q", decrypted.Index, decrypted.Header.Algorithm, decrypted.Plaintext)
+	}
+
+	// Decrypt only reports the plaintext, it must open multi-recipient messages as well
+	if plaintext, err := Decrypt(serialized, parseSerializedJWE(t, serialized), rsaKey); err != nil || string(plaintext) != "multi recipient" {
+		t.Fatalf("expected the RSA recipient to decrypt, got %q, %v", plaintext, err)
+	}
+
+	wrongKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptRecipient(serialized, parseSerializedJWE(t, serialized), wrongKey); err == nil {
+		t.Fatalf("expected a key of no recipient to fail")
+	}
+}
+
+func TestNonStandardRSAOAEPRoundTrips(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for keyAlgorithm, digest := range map[jose.KeyAlgorithm]func() hash.Hash{RSA_OAEP_384: sha512.New384, RSA_OAEP_512: sha512.New} {
+		encrypter, err := NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: keyAlgorithm, Key: &privateKey.PublicKey}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", keyAlgorithm, err)
+		}
+		jwe, err := encrypter.Encrypt([]byte("partner payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := jwe.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := jose.ParseEncrypted(compact, DecryptionKeyAlgorithms, SupportedContentEncryptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Header.Algorithm != string(keyAlgorithm) {
+			t.Fatalf("expected alg %s, got %s", keyAlgorithm, parsed.Header.Algorithm)
+		}
+		plaintext, err := Decrypt(compact, parsed, privateKey)
+		if err != nil || string(plaintext) != "partner payload" {
+			t.Fatalf("%s: expected the plaintext back, got %q %v", keyAlgorithm, plaintext, err)
+		}
+
+		// crypto/rsa unwraps the key apart from this package, with the hash for OAEP and MGF1 and nothing weaker
+		encryptedKey, _ := base64.RawURLEncoding.DecodeString(strings.Split(compact, ".")[1])
+		if _, err := rsa.DecryptOAEP(digest(), nil, privateKey, encryptedKey, nil); err != nil {
+			t.Fatalf("%s: expected the key to unwrap: %v", keyAlgorithm, err)
+		}
+		if _, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, encryptedKey, nil); err == nil {
+			t.Fatalf("%s: expected the key to be wrapped with another hash than SHA-256", keyAlgorithm)
+		}
+	}
+
+	if !IsNonStandardKeyAlgorithm(RSA_OAEP_512) || IsNonStandardKeyAlgorithm(jose.RSA_OAEP_256) {
+		t.Fatal("expected only the SHA-384 and SHA-512 variants to be non-standard")
+	}
+}
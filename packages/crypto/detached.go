@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// DetachContent splits the ciphertext out of a serialized JWE for protocols carrying it out of band.
+// The compact serialization keeps its five segments with the fourth left empty, header.key.iv..tag,
+// and the JSON serialization drops its ciphertext member. The ciphertext is returned base64url encoded,
+// exactly as it appeared in the token, AttachContent puts it back in place.
+func DetachContent(serialized string) (string, string, error) {
+	if serialized = strings.TrimSpace(serialized); strings.HasPrefix(serialized, "{") {
+		members, err := jweMembers(serialized)
+		if err != nil {
+			return "", "", err
+		}
+		var ciphertext string
+		if err := json.Unmarshal(members["ciphertext"], &ciphertext); err != nil || ciphertext == "" {
+			return "", "", errors.New("JWE has no ciphertext to detach")
+		}
+		delete(members, "ciphertext")
+		detached, err := json.Marshal(members)
+		if err != nil {
+			return "", "", err
+		}
+		return string(detached), ciphertext, nil
+	}
+
+	segments := strings.Split(serialized, ".")
+	if len(segments) != 5 {
+		return "", "", errors.New("compact JWE must have 5 segments")
+	}
+	if segments[3] == "" {
+		return "", "", errors.New("JWE has no ciphertext to detach")
+	}
+	ciphertext := segments[3]
+	segments[3] = ""
+	return strings.Join(segments, "."), ciphertext, nil
+}
+
+// AttachContent puts a base64url ciphertext back into a JWE detached by DetachContent.
+// The token must have no ciphertext of its own, decrypting the result checks the tag covers it.
+func AttachContent(detached, ciphertext string) (string, error) {
+	if _, err := base64.RawURLEncoding.DecodeString(ciphertext); err != nil || ciphertext == "" {
+		return "", errors.New("detached ciphertext must be non-empty base64url")
+	}
+
+	if detached = strings.TrimSpace(detached); strings.HasPrefix(detached, "{") {
+		members, err := jweMembers(detached)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := members["ciphertext"]; ok {
+			return "", errors.New("JWE already has a ciphertext, it is not detached")
+		}
+		if members["ciphertext"], err = json.Marshal(ciphertext); err != nil {
+			return "", err
+		}
+		attached, err := json.Marshal(members)
+		if err != nil {
+			return "", err
+		}
+		return string(attached), nil
+	}
+
+	segments := strings.Split(detached, ".")
+	if len(segments) != 5 {
+		return "", errors.New("compact JWE must have 5 segments")
+	}
+	if segments[3] != "" {
+		return "", errors.New("JWE already has a ciphertext, it is not detached")
+	}
+	segments[3] = ciphertext
+	return strings.Join(segments, "."), nil
+}
+
+// jweMembers decodes the top level members of a JSON serialized JWE
+func jweMembers(serialized string) (map[string]json.RawMessage, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(serialized), &members); err != nil || members == nil {
+		return nil, errors.New("failed to parse JWE: the JSON serialization must be an object")
+	}
+	return members, nil
+}
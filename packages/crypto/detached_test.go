@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v4"
+	"strings"
+	"testing"
+)
+
+func TestDetachedContentRoundTrips(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("out of band"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, serialized := range []string{compact, jwe.FullSerialize()} {
+		detached, ciphertext, err := DetachContent(serialized)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(detached, ciphertext) {
+			t.Fatalf("expected the ciphertext to be left out of %q", detached)
+		}
+		if _, err := AttachContent(serialized, ciphertext); err == nil {
+			t.Fatalf("expected a token with its ciphertext to be refused")
+		}
+
+		attached, err := AttachContent(detached, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext, err := Decrypt(attached, parseSerializedJWE(t, attached), privateKey); err != nil || string(plaintext) != "out of band" {
+			t.Fatalf("expected the reassembled token to decrypt, got %q, %v", plaintext, err)
+		}
+
+		// Another ciphertext of the same length parses but fails the tag check
+		forged, err := AttachContent(detached, strings.Repeat("A", len(ciphertext)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Decrypt(forged, parseSerializedJWE(t, forged), privateKey); err == nil {
+			t.Fatalf("expected a swapped ciphertext to fail the tag check")
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package crypto
+
+import "github.com/go-jose/go-jose/v4"
+
+// BuildEncrypterOptions returns options emitting the headers in the protected header, compress adds zip=DEF
+func BuildEncrypterOptions(headers map[string]interface{}, compress bool) *jose.EncrypterOptions {
+	options := &jose.EncrypterOptions{}
+	for name, value := range headers {
+		options.WithHeader(jose.HeaderKey(name), value)
+	}
+	if compress {
+		options.Compression = jose.DEFLATE
+	}
+	return options
+}
@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func TestBuildEncrypterOptionsSetsHeadersAndCompression(t *testing.T) {
+	options := BuildEncrypterOptions(map[string]interface{}{
+		ServerKidHeader: "test-kid",
+		"x-tenant":      "acme",
+		CriticalHeader:  []string{"x-tenant"},
+	}, true)
+
+	if options.Compression != jose.DEFLATE {
+		t.Fatalf("expected DEFLATE compression, got %q", options.Compression)
+	}
+	if options.ExtraHeaders[ServerKidHeader] != "test-kid" || options.ExtraHeaders["x-tenant"] != "acme" {
+		t.Fatalf("expected the headers to be set, got %v", options.ExtraHeaders)
+	}
+
+	if options := BuildEncrypterOptions(nil, false); options.Compression != jose.NONE || len(options.ExtraHeaders) != 0 {
+		t.Fatalf("expected empty options, got %+v", options)
+	}
+}
+
+func TestBuildEncrypterOptionsHeadersReachTheToken(t *testing.T) {
+	secret := make([]byte, 32)
+	options := BuildEncrypterOptions(map[string]interface{}{"x-tenant": "acme", "cty": JWTContentType}, true)
+	encrypter, err := NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: secret}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("headers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := jose.ParseEncrypted(serialized, []jose.KeyAlgorithm{jose.DIRECT}, SupportedContentEncryptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header.ExtraHeaders["x-tenant"] != "acme" || parsed.Header.ExtraHeaders["cty"] != string(JWTContentType) || parsed.Header.ExtraHeaders["zip"] != string(jose.DEFLATE) {
+		t.Fatalf("expected the headers in the protected header, got %v", parsed.Header.ExtraHeaders)
+	}
+	if plaintext, err := parsed.Decrypt(secret); err != nil || string(plaintext) != "headers" {
+		t.Fatalf("round trip failed: %q, %v", plaintext, err)
+	}
+}
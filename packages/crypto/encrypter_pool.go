@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"crypto"
+	"github.com/go-jose/go-jose/v4"
+	"sync"
+)
+
+// EncrypterKey identifies a reusable encrypter, Thumbprint is the server_kid computed with ServerKidHash
+type EncrypterKey struct {
+	Thumbprint        string
+	ServerKidHash     crypto.Hash
+	KeyAlgorithm      jose.KeyAlgorithm
+	ContentEncryption jose.ContentEncryption
+	Compress          bool
+	KeyID             string
+	ContentType       jose.ContentType
+	Type              jose.ContentType
+}
+
+// EncrypterPool caches go-jose encrypters, which hold no per-message state and are safe to share
+type EncrypterPool struct {
+	mutex      sync.RWMutex
+	capacity   int
+	encrypters map[EncrypterKey]jose.Encrypter
+}
+
+// NewEncrypterPool creates a pool holding up to capacity encrypters
+func NewEncrypterPool(capacity int) *EncrypterPool {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &EncrypterPool{
+		capacity:   capacity,
+		encrypters: make(map[EncrypterKey]jose.Encrypter),
+	}
+}
+
+// Encrypters is the pool used by the encrypt endpoints
+var Encrypters = NewEncrypterPool(1024)
+
+// Get returns the pooled encrypter for the key, creating it for the recipient public key on a miss.
+// The encrypter stamps the thumbprint as the server_kid header with its hash and the key ID and type, if any, as kid and typ.
+func (pool *EncrypterPool) Get(key EncrypterKey, publicKey interface{}) (jose.Encrypter, error) {
+	pool.mutex.RLock()
+	encrypter, ok := pool.encrypters[key]
+	pool.mutex.RUnlock()
+	if ok {
+		return encrypter, nil
+	}
+
+	headers := ServerKidHeaders(key.Thumbprint, key.ServerKidHash)
+	if key.ContentType != "" {
+		headers["cty"] = key.ContentType
+	}
+	options := BuildEncrypterOptions(headers, key.Compress)
+	if key.Type != "" {
+		options.WithType(key.Type)
+	}
+
+	encrypter, err := NewEncrypter(
+		key.ContentEncryption,
+		jose.Recipient{
+			Algorithm: key.KeyAlgorithm,
+			Key:       publicKey,
+			KeyID:     key.KeyID,
+		},
+		options,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	// Another request may have built the same encrypter meanwhile, keep the first one
+	if existing, ok := pool.encrypters[key]; ok {
+		return existing, nil
+	}
+
+	// Drop an arbitrary entry when full, the pool is a cache and any entry can be rebuilt
+	if len(pool.encrypters) >= pool.capacity {
+		for evicted := range pool.encrypters {
+			delete(pool.encrypters, evicted)
+			break
+		}
+	}
+	pool.encrypters[key] = encrypter
+	return encrypter, nil
+}
+
+// Len returns the number of pooled encrypters
+func (pool *EncrypterPool) Len() int {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	return len(pool.encrypters)
+}
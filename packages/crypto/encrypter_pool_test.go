@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"sync"
+	"testing"
+)
+
+func TestEncrypterPoolConcurrentReuse(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewEncrypterPool(4)
+	key := EncrypterKey{
+		Thumbprint:        "test-kid",
+		KeyAlgorithm:      jose.RSA_OAEP_256,
+		ContentEncryption: jose.A256GCM,
+	}
+
+	first, err := pool.Get(key, &privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			encrypter, err := pool.Get(key, &privateKey.PublicKey)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if encrypter != first {
+				errs <- fmt.Errorf("goroutine %d got a different encrypter", i)
+				return
+			}
+
+			plaintext := fmt.Sprintf("message %d", i)
+			jwe, err := encrypter.Encrypt([]byte(plaintext))
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			decrypted, err := jwe.Decrypt(privateKey)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if string(decrypted) != plaintext {
+				errs <- fmt.Errorf("goroutine %d decrypted %q, want %q", i, decrypted, plaintext)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if pool.Len() != 1 {
+		t.Errorf("pool holds %d encrypters, want 1", pool.Len())
+	}
+}
@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+	"time"
+)
+
+func FuzzParseCompact(f *testing.F) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		f.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		f.Fatal(err)
+	}
+	symmetricKey := make([]byte, 32)
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, BuildEncrypterOptions(map[string]interface{}{
+		CriticalHeader:  []string{ServerKidHeader},
+		ServerKidHeader: "seed",
+		IssuedAtHeader:  1700000000,
+	}, true))
+	if err != nil {
+		f.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("fuzz seed"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{
+		compact,
+		jwe.FullSerialize(),
+		"", ".", "....", "e30....",
+		`{"recipients":[{},{}]}`,
+		`{"protected":"e30"}`,
+		// A null protected header with unprotected members
+		`{"protected":"bnVsbA","unprotected":{"alg":"A256KW"},"iv":"","ciphertext":"","tag":""}`,
+		// A key wrap token without an encrypted key
+		"eyJhbGciOiJBMjU2S1ciLCJlbmMiOiJBMjU2R0NNIn0..AAAAAAAAAAAAAAAA.AA.AAAAAAAAAAAAAAAAAAAAAA",
+	} {
+		f.Add(seed)
+	}
+
+	// Every parser sees the input before a key proves it authentic, none of them may panic
+	f.Fuzz(func(t *testing.T, serialized string) {
+		parsed, err := jose.ParseEncrypted(serialized, append([]jose.KeyAlgorithm{jose.RSA_OAEP_256, jose.ECDH_ES_A256KW}, SymmetricKeyAlgorithms...), SupportedContentEncryptions)
+		for _, key := range []interface{}{privateKey, ecKey, symmetricKey} {
+			if err == nil {
+				CheckCriticalHeaders(parsed.Header)
+				DecryptRecipient(serialized, parsed, key)
+			}
+			decryptSerialized(serialized, key)
+		}
+		splitJWE(serialized)
+		ReplayDigest(serialized)
+		ValidateTimeHeaders(serialized, time.Minute, time.Minute)
+	})
+}
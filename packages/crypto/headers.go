@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// ServerKidHeader is the protected header carrying the recipient key thumbprint
+const ServerKidHeader = "server_kid"
+
+// ServerKidHashHeader names the hash server_kid was computed with, so recipients know how to recompute it
+const ServerKidHashHeader = "server_kid_hash"
+
+// Protected headers binding the chunks of a streamed plaintext: the stream ID, the chunk index and the final chunk marker
+const (
+	StreamIDHeader   = "sid"
+	ChunkIndexHeader = "chunk"
+	LastChunkHeader  = "last"
+)
+
+// NonceHeader is the anti-replay nonce of RFC 8555, reserved so a client can't pass one off as server issued
+const NonceHeader = "nonce"
+
+// Headers set by this service, from the request fields or on streamed chunks, on top of the registered ones
+var serviceHeaders = []string{
+	ServerKidHeader, ServerKidHashHeader,
+	CertificateChainHeader, CertificateThumbprintHeader,
+	HKDFInfoHeader,
+	StreamIDHeader, ChunkIndexHeader, LastChunkHeader,
+	TokenIDHeader,
+	IssuedAtHeader, NotBeforeHeader,
+	NonceHeader,
+}
+
+// Headers that are managed by go-jose or by this service and must not be supplied by clients
+var reservedHeaders = func() map[string]bool {
+	reserved := make(map[string]bool, len(registeredHeaders)+len(serviceHeaders))
+	for name := range registeredHeaders {
+		reserved[name] = true
+	}
+	for _, name := range serviceHeaders {
+		reserved[name] = true
+	}
+	return reserved
+}()
+
+// ServerKidHeaders returns the server_kid header with the name of its hash, SHA-256 when none is given
+func ServerKidHeaders(serverKid string, hash crypto.Hash) map[string]interface{} {
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	return map[string]interface{}{ServerKidHeader: serverKid, ServerKidHashHeader: hash.String()}
+}
+
+// ValidateProtectedHeaders rejects client supplied headers that would corrupt the JOSE structure
+func ValidateProtectedHeaders(headers map[string]string) error {
+	for name := range headers {
+		if reservedHeaders[name] {
+			return fmt.Errorf("protected header %q is reserved and cannot be set", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package crypto
+
+import "testing"
+
+func TestValidateProtectedHeadersRejectsEveryReservedName(t *testing.T) {
+	tests := []string{
+		"alg", "enc", "zip", "jku", "jwk", "kid", "x5u", "x5c", "x5t", "x5t#S256", "typ", "cty",
+		"crit", "epk", "apu", "apv", "iv", "tag", "p2s", "p2c", "nonce",
+		ServerKidHeader, ServerKidHashHeader, HKDFInfoHeader, StreamIDHeader, ChunkIndexHeader, LastChunkHeader,
+		TokenIDHeader, IssuedAtHeader, NotBeforeHeader,
+	}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := ValidateProtectedHeaders(map[string]string{name: "client"}); err == nil {
+				t.Fatalf("expected the %q header to be reserved", name)
+			}
+		})
+	}
+	// Every registered header is covered, including ones added to registeredHeaders later
+	for name := range registeredHeaders {
+		if !reservedHeaders[name] {
+			t.Fatalf("expected the registered %q header to be reserved", name)
+		}
+	}
+
+	if err := ValidateProtectedHeaders(map[string]string{"app": "billing"}); err != nil {
+		t.Fatalf("expected a custom header to be accepted, got %v", err)
+	}
+}
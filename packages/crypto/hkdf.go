@@ -0,0 +1,27 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"io"
+)
+
+// HKDFInfoHeader is the protected header carrying the info label a key was derived from the master secret with
+const HKDFInfoHeader = "hkdf_info"
+
+// MinMasterSecretSize is the smallest master secret keys are derived from, the 32 bytes of an HKDF-SHA256 output
+const MinMasterSecretSize = 32
+
+// DeriveKey derives length bytes from the master secret with HKDF-SHA256, without a salt.
+// Each info label gives an independent key, so one master secret serves every label.
+func DeriveKey(master []byte, info string, length int) ([]byte, error) {
+	if length < 1 || length > 255*sha256.Size {
+		return nil, fmt.Errorf("HKDF-SHA256 derives between 1 and %d bytes, not %d", 255*sha256.Size, length)
+	}
+	key := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,36 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKeyMatchesHKDFVectors(t *testing.T) {
+	sequence := make([]byte, 32)
+	for i := range sequence {
+		sequence[i] = byte(i)
+	}
+	for _, test := range []struct {
+		master []byte
+		info   string
+		length int
+		okm    string
+	}{
+		// RFC 5869 A.3, SHA-256 without salt nor info
+		{bytes.Repeat([]byte{0x0b}, 22), "", 42, "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8"},
+		{sequence, "tenant-a/invoices", 32, "6ac3c6ebbb7092e50cce57ae3630ba1930c90b8e82f077dc67d71c508a9ad5f1"},
+	} {
+		key, err := DeriveKey(test.master, test.info, test.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(key) != test.okm {
+			t.Fatalf("expected %s for info %q, got %x", test.okm, test.info, key)
+		}
+	}
+
+	if _, err := DeriveKey(sequence, "too long", 255*32+1); err == nil {
+		t.Fatal("expected a length HKDF-SHA256 can't produce to be refused")
+	}
+}
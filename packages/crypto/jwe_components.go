@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"strings"
+)
+
+// ErrMalformedCompactJWE is returned for a token that isn't five base64url segments under a JSON object header
+var ErrMalformedCompactJWE = errors.New("malformed compact JWE")
+
+// ErrInvalidJWEStructure is returned for a token whose IV, ciphertext or tag length doesn't fit its enc
+var ErrInvalidJWEStructure = errors.New("invalid JWE structure")
+
+// JWEComponents are the segments of a compact JWE, for debugging and custom transports.
+// The binary segments stay base64url encoded as in the token, only the length of the ciphertext is kept.
+type JWEComponents struct {
+	ProtectedHeader map[string]interface{}
+	// EncryptedKey is empty for dir and ECDH-ES, which wrap no key
+	EncryptedKey     string
+	IV               string
+	CiphertextLength int
+	Tag              string
+}
+
+// DecomposeCompactJWE splits a compact JWE into its five segments and decodes them, nothing is decrypted
+func DecomposeCompactJWE(token string) (JWEComponents, error) {
+	segments := strings.Split(strings.TrimSpace(token), ".")
+	if len(segments) != 5 {
+		return JWEComponents{}, fmt.Errorf("%w: expected 5 segments, got %d", ErrMalformedCompactJWE, len(segments))
+	}
+
+	names := []string{"protected header", "encrypted key", "IV", "ciphertext", "tag"}
+	decoded := make([][]byte, len(segments))
+	for i, segment := range segments {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(segment); err != nil {
+			return JWEComponents{}, fmt.Errorf("%w: the %s is not base64url", ErrMalformedCompactJWE, names[i])
+		}
+	}
+
+	var header map[string]interface{}
+	if err := json.Unmarshal(decoded[0], &header); err != nil || header == nil {
+		return JWEComponents{}, fmt.Errorf("%w: the protected header is not a JSON object", ErrMalformedCompactJWE)
+	}
+	return JWEComponents{
+		ProtectedHeader:  header,
+		EncryptedKey:     segments[1],
+		IV:               segments[2],
+		CiphertextLength: len(decoded[3]),
+		Tag:              segments[4],
+	}, nil
+}
+
+// ValidateJWEStructure checks the IV and the tag have the lengths the enc of the token requires, nothing is decrypted:
+// a 12 byte IV and a 16 byte tag for AES-GCM, a 16 byte IV, whole blocks of ciphertext and a tag of half the key
+// for AES-CBC with HMAC. Both serializations are accepted, the enc of a JSON one may be in its shared unprotected header.
+func ValidateJWEStructure(token string) error {
+	token = strings.TrimSpace(token)
+	var enc string
+	var protected, iv, ciphertext, tag []byte
+	if strings.HasPrefix(token, "{") {
+		members, err := jweMembers(token)
+		if err != nil {
+			return err
+		}
+		for name, field := range map[string]*[]byte{"protected": &protected, "iv": &iv, "ciphertext": &ciphertext, "tag": &tag} {
+			var encoded string
+			if member, ok := members[name]; ok && json.Unmarshal(member, &encoded) != nil {
+				return fmt.Errorf("%w: the %s member is not a string", ErrInvalidJWEStructure, name)
+			}
+			if *field, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+				return fmt.Errorf("%w: the %s member is not base64url", ErrInvalidJWEStructure, name)
+			}
+		}
+		var header struct {
+			Enc string `json:"enc"`
+		}
+		if len(protected) > 0 && json.Unmarshal(protected, &header) != nil {
+			return fmt.Errorf("%w: the protected header is not a JSON object", ErrInvalidJWEStructure)
+		}
+		if header.Enc == "" && members["unprotected"] != nil {
+			json.Unmarshal(members["unprotected"], &header)
+		}
+		enc = header.Enc
+	} else {
+		components, err := DecomposeCompactJWE(token)
+		if err != nil {
+			return err
+		}
+		enc, _ = components.ProtectedHeader["enc"].(string)
+		segments := strings.Split(token, ".")
+		iv, _ = base64.RawURLEncoding.DecodeString(segments[2])
+		ciphertext, _ = base64.RawURLEncoding.DecodeString(segments[3])
+		tag, _ = base64.RawURLEncoding.DecodeString(segments[4])
+	}
+
+	keySize, ok := contentEncryptionKeySizes[jose.ContentEncryption(enc)]
+	if !ok {
+		return fmt.Errorf("%w: unsupported enc %q", ErrInvalidJWEStructure, enc)
+	}
+	ivSize, tagSize := gcmIVSize, gcmTagSize
+	switch jose.ContentEncryption(enc) {
+	case jose.A128CBC_HS256, jose.A256CBC_HS512:
+		ivSize, tagSize = 16, keySize/2
+		if len(ciphertext) == 0 || len(ciphertext)%16 != 0 {
+			return fmt.Errorf("%w: %s ciphertext must be whole 16 byte blocks, got %d bytes", ErrInvalidJWEStructure, enc, len(ciphertext))
+		}
+	}
+	if len(iv) != ivSize {
+		return fmt.Errorf("%w: %s requires a %d byte IV, got %d bytes", ErrInvalidJWEStructure, enc, ivSize, len(iv))
+	}
+	if len(tag) != tagSize {
+		return fmt.Errorf("%w: %s requires a %d byte authentication tag, got %d bytes", ErrInvalidJWEStructure, enc, tagSize, len(tag))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"strings"
+	"testing"
+)
+
+func TestDecomposeCompactJWE(t *testing.T) {
+	encrypter, err := jose.NewEncrypter(jose.A128GCM, jose.Recipient{Algorithm: jose.A128KW, Key: make([]byte, 16)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("twenty byte payload!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	components, err := DecomposeCompactJWE(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := strings.Split(token, ".")
+	if components.ProtectedHeader["alg"] != "A128KW" || components.ProtectedHeader["enc"] != "A128GCM" {
+		t.Fatalf("expected the decoded protected header, got %v", components.ProtectedHeader)
+	}
+	if components.EncryptedKey != segments[1] || components.IV != segments[2] || components.Tag != segments[4] || components.CiphertextLength != 20 {
+		t.Fatalf("expected the segments of the token and a 20 byte ciphertext, got %+v", components)
+	}
+
+	for _, malformed := range []string{
+		"",
+		"eyJhbGciOiJkaXIifQ",
+		"eyJhbGciOiJSUzI1NiJ9.e30.c2ln",
+		"eyJhbGciOiJkaXIifQ...",
+		"eyJhbGciOiJkaXIifQ......",
+		"eyJhbGciOiJkaXIifQ..aXY.Y3Q.dGFn.",
+		// A segment that isn't base64url and headers that aren't a JSON object
+		"eyJhbGciOiJkaXIifQ..aXY.Y3Q=.dGFn",
+		"bnVsbA..aXY.Y3Q.dGFn",
+		"W10..aXY.Y3Q.dGFn",
+	} {
+		if _, err := DecomposeCompactJWE(malformed); !errors.Is(err, ErrMalformedCompactJWE) {
+			t.Fatalf("expected %q to be malformed, got %v", malformed, err)
+		}
+	}
+}
+
+func TestValidateJWEStructure(t *testing.T) {
+	for _, enc := range []jose.ContentEncryption{jose.A128GCM, jose.A256GCM, jose.A128CBC_HS256, jose.A256CBC_HS512} {
+		encrypter, err := jose.NewEncrypter(enc, jose.Recipient{Algorithm: jose.A128KW, Key: make([]byte, 16)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwe, err := encrypter.Encrypt([]byte("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := jwe.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateJWEStructure(compact); err != nil {
+			t.Fatalf("expected a %s token to be valid, got %v", enc, err)
+		}
+		if err := ValidateJWEStructure(jwe.FullSerialize()); err != nil {
+			t.Fatalf("expected a JSON %s token to be valid, got %v", enc, err)
+		}
+
+		// One byte less of tag or IV
+		segments := strings.Split(compact, ".")
+		truncate := func(segment string) string {
+			decoded, _ := base64.RawURLEncoding.DecodeString(segment)
+			return base64.RawURLEncoding.EncodeToString(decoded[:len(decoded)-1])
+		}
+		truncatedTag := strings.Join([]string{segments[0], segments[1], segments[2], segments[3], truncate(segments[4])}, ".")
+		if err := ValidateJWEStructure(truncatedTag); !errors.Is(err, ErrInvalidJWEStructure) || !strings.Contains(err.Error(), "tag") {
+			t.Fatalf("expected a truncated %s tag to be refused, got %v", enc, err)
+		}
+		truncatedIV := strings.Join([]string{segments[0], segments[1], truncate(segments[2]), segments[3], segments[4]}, ".")
+		if err := ValidateJWEStructure(truncatedIV); !errors.Is(err, ErrInvalidJWEStructure) || !strings.Contains(err.Error(), "IV") {
+			t.Fatalf("expected a truncated %s IV to be refused, got %v", enc, err)
+		}
+	}
+
+	// The enc of a JSON token may come from its unprotected header only
+	unprotected := `{"unprotected":{"alg":"dir","enc":"A128GCM"},"iv":"AAAAAAAAAAAAAAAA","ciphertext":"AAAAAAA","tag":"AAAAAAAAAAAAAAAAAAAA"}`
+	if err := ValidateJWEStructure(unprotected); !errors.Is(err, ErrInvalidJWEStructure) || !strings.Contains(err.Error(), "16 byte authentication tag, got 15") {
+		t.Fatalf("expected the truncated tag of the JSON token to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotConvertible is returned for a JSON serialized JWE the compact serialization has no room for
+var ErrNotConvertible = errors.New("the JWE cannot be represented in the compact serialization")
+
+// flattenedJWE is the flattened JSON serialization of a JWE with only the members a compact one has
+type flattenedJWE struct {
+	Protected    string `json:"protected"`
+	EncryptedKey string `json:"encrypted_key,omitempty"`
+	IV           string `json:"iv"`
+	Ciphertext   string `json:"ciphertext"`
+	Tag          string `json:"tag"`
+}
+
+// CompactToJSON rewrites a compact JWE in the flattened JSON serialization. The segments are copied as they are:
+// the protected header is authenticated byte for byte, so it must never be decoded and encoded again.
+func CompactToJSON(token string) (string, error) {
+	segments := strings.Split(strings.TrimSpace(token), ".")
+	if len(segments) != 5 {
+		return "", fmt.Errorf("%w: expected 5 segments, got %d", ErrMalformedCompactJWE, len(segments))
+	}
+	serialized, err := json.Marshal(flattenedJWE{
+		Protected:    segments[0],
+		EncryptedKey: segments[1],
+		IV:           segments[2],
+		Ciphertext:   segments[3],
+		Tag:          segments[4],
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(serialized), nil
+}
+
+// JSONToCompact rewrites a JSON serialized JWE in the compact serialization, which carries a single recipient
+// and the protected header only. A token with unprotected or recipient headers, aad or several recipients
+// is ErrNotConvertible, converting it would drop what it holds.
+func JSONToCompact(token string) (string, error) {
+	members, err := jweMembers(token)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"unprotected", "header", "aad"} {
+		if _, ok := members[name]; ok {
+			return "", fmt.Errorf("%w: it has a %s member", ErrNotConvertible, name)
+		}
+	}
+
+	// A general serialization with one recipient converts like a flattened one
+	encryptedKey := members["encrypted_key"]
+	if rawRecipients, ok := members["recipients"]; ok {
+		var recipients []map[string]json.RawMessage
+		if err := json.Unmarshal(rawRecipients, &recipients); err != nil {
+			return "", errors.New("failed to parse JWE: recipients must be an array of objects")
+		}
+		if len(recipients) != 1 {
+			return "", fmt.Errorf("%w: it has %d recipients", ErrNotConvertible, len(recipients))
+		}
+		if _, ok := recipients[0]["header"]; ok {
+			return "", fmt.Errorf("%w: its recipient has a header member", ErrNotConvertible)
+		}
+		encryptedKey = recipients[0]["encrypted_key"]
+	}
+
+	var segments [5]string
+	for i, member := range []json.RawMessage{members["protected"], encryptedKey, members["iv"], members["ciphertext"], members["tag"]} {
+		if member == nil {
+			continue
+		}
+		if err := json.Unmarshal(member, &segments[i]); err != nil {
+			return "", errors.New("failed to parse JWE: its members must be base64url strings")
+		}
+	}
+	if segments[0] == "" {
+		return "", fmt.Errorf("%w: it has no protected header", ErrNotConvertible)
+	}
+	return strings.Join(segments[:], "."), nil
+}
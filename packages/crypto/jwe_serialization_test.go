@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func TestJWESerializationConversionRoundTrips(t *testing.T) {
+	key := make([]byte, 16)
+	encrypter, err := jose.NewEncrypter(jose.A128GCM, jose.Recipient{Algorithm: jose.A128KW, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flattened, err := CompactToJSON(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jose.ParseEncrypted(flattened, []jose.KeyAlgorithm{jose.A128KW}, []jose.ContentEncryption{jose.A128GCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := parsed.Decrypt(key); err != nil || string(plaintext) != "payload" {
+		t.Fatalf("expected the JSON token to decrypt, got %q: %v", plaintext, err)
+	}
+	if back, err := JSONToCompact(flattened); err != nil || back != compact {
+		t.Fatalf("expected the compact token back unchanged, got %q: %v", back, err)
+	}
+
+	// A general serialization with a single recipient converts too
+	general := `{"protected":"eyJhbGciOiJkaXIiLCJlbmMiOiJBMTI4R0NNIn0","recipients":[{}],"iv":"aXY","ciphertext":"Y3Q","tag":"dGFn"}`
+	if converted, err := JSONToCompact(general); err != nil || converted != "eyJhbGciOiJkaXIiLCJlbmMiOiJBMTI4R0NNIn0..aXY.Y3Q.dGFn" {
+		t.Fatalf("expected the single recipient converted, got %q: %v", converted, err)
+	}
+}
+
+func TestJSONToCompactRefusesWhatTheCompactSerializationCannotHold(t *testing.T) {
+	for _, token := range []string{
+		`{"protected":"eyJlbmMiOiJBMTI4R0NNIn0","unprotected":{"alg":"dir"},"iv":"aXY","ciphertext":"Y3Q","tag":"dGFn"}`,
+		`{"protected":"eyJhbGciOiJkaXIiLCJlbmMiOiJBMTI4R0NNIn0","aad":"YWFk","iv":"aXY","ciphertext":"Y3Q","tag":"dGFn"}`,
+		`{"protected":"eyJlbmMiOiJBMTI4R0NNIn0","header":{"alg":"dir"},"iv":"aXY","ciphertext":"Y3Q","tag":"dGFn"}`,
+		`{"protected":"eyJlbmMiOiJBMTI4R0NNIn0","recipients":[{"header":{"alg":"A128KW"},"encrypted_key":"a2V5"}],"iv":"aXY","ciphertext":"Y3Q","tag":"dGFn"}`,
+		`{"protected":"eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4R0NNIn0","recipients":[{"encrypted_key":"a2V5"},{"encrypted_key":"a2V5"}],"iv":"aXY","ciphertext":"Y3Q","tag":"dGFn"}`,
+	} {
+		if _, err := JSONToCompact(token); !errors.Is(err, ErrNotConvertible) {
+			t.Fatalf("expected %s not to be convertible, got %v", token, err)
+		}
+	}
+}
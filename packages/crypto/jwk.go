@@ -1,7 +1,13 @@
 package crypto
 
 import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-jose/go-jose/v4"
 )
 
@@ -15,3 +21,276 @@ func ConvertRSAPublicKeyToJWK(pubKey *rsa.PublicKey) (jose.JSONWebKey, error) {
 
 	return jwk, nil
 }
+
+// ConvertECPublicKeyToJWK converts the EC public key to a JWK (JSON Web Key)
+func ConvertECPublicKeyToJWK(pubKey *ecdsa.PublicKey) (jose.JSONWebKey, error) {
+	jwk := jose.JSONWebKey{
+		Key:       pubKey,
+		Algorithm: string(jose.ECDH_ES_A256KW),
+		Use:       "enc",
+	}
+
+	return jwk, nil
+}
+
+// ConvertOKPPublicKeyToJWK converts an Ed25519 or X25519 public key to a JWK (JSON Web Key).
+// go-jose can't serialize X25519 JWKs, the thumbprint functions of this package still handle them.
+func ConvertOKPPublicKeyToJWK(pubKey interface{}) (jose.JSONWebKey, error) {
+	switch keyType, _ := okpKeyType(pubKey); keyType {
+	case KeyTypeEd25519:
+		return jose.JSONWebKey{Key: pubKey, Algorithm: string(jose.EdDSA), Use: "sig"}, nil
+	case KeyTypeX25519:
+		return jose.JSONWebKey{Key: pubKey, Algorithm: string(jose.ECDH_ES_A256KW), Use: "enc"}, nil
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+}
+
+// ConvertPublicKeyToJWK converts an RSA, EC or OKP public key to a JWK (JSON Web Key)
+func ConvertPublicKeyToJWK(pubKey interface{}) (jose.JSONWebKey, error) {
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		return ConvertRSAPublicKeyToJWK(key)
+	case *ecdsa.PublicKey:
+		return ConvertECPublicKeyToJWK(key)
+	case ed25519.PublicKey, *ecdh.PublicKey:
+		return ConvertOKPPublicKeyToJWK(key)
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+}
+
+// ConvertRSAPrivateKeyToJWK converts the RSA private key to a JWK (JSON Web Key)
+func ConvertRSAPrivateKeyToJWK(privKey *rsa.PrivateKey) (jose.JSONWebKey, error) {
+	jwk := jose.JSONWebKey{
+		Key:       privKey,
+		Algorithm: string(jose.RSA_OAEP_256),
+		Use:       "enc",
+	}
+
+	return jwk, nil
+}
+
+// ConvertECPrivateKeyToJWK converts the EC private key to a JWK (JSON Web Key)
+func ConvertECPrivateKeyToJWK(privKey *ecdsa.PrivateKey) (jose.JSONWebKey, error) {
+	jwk := jose.JSONWebKey{
+		Key:       privKey,
+		Algorithm: string(jose.ECDH_ES_A256KW),
+		Use:       "enc",
+	}
+
+	return jwk, nil
+}
+
+// ConvertPrivateKeyToJWK converts an RSA or EC private key to a JWK (JSON Web Key)
+func ConvertPrivateKeyToJWK(privKey interface{}) (jose.JSONWebKey, error) {
+	switch key := privKey.(type) {
+	case *rsa.PrivateKey:
+		return ConvertRSAPrivateKeyToJWK(key)
+	case *ecdsa.PrivateKey:
+		return ConvertECPrivateKeyToJWK(key)
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("unsupported private key type %T", privKey)
+	}
+}
+
+// KeyOperation is what a JWK is about to be used for, checked against its use and key_ops members
+type KeyOperation string
+
+// The operations ValidateKeyUsage checks for
+const (
+	KeyOperationEncrypt KeyOperation = "encrypt"
+	KeyOperationDecrypt KeyOperation = "decrypt"
+)
+
+// ErrKeyUsage is returned for a JWK whose use or key_ops does not permit the operation
+var ErrKeyUsage = errors.New("JWK usage does not permit the operation")
+
+// jwkUsage holds the JWK members restricting what the key may be used for, go-jose drops key_ops
+type jwkUsage struct {
+	Use    string   `json:"use"`
+	KeyOps []string `json:"key_ops"`
+}
+
+// allowsOperation reports whether key_ops lists one of the operations
+func (usage jwkUsage) allowsOperation(operations ...string) bool {
+	for _, operation := range usage.KeyOps {
+		for _, allowed := range operations {
+			if operation == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateKeyUsage checks the use and key_ops members of the JWK permit the operation.
+// Encrypting only needs a key not restricted to other uses, while decrypting requires the key
+// to be marked with use "enc" or key_ops containing "decrypt" or "unwrapKey".
+func ValidateKeyUsage(data []byte, operation KeyOperation) error {
+	var usage jwkUsage
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return fmt.Errorf("failed to parse JWK: %v", err)
+	}
+
+	switch operation {
+	case KeyOperationEncrypt:
+		if usage.Use != "" && usage.Use != "enc" {
+			return fmt.Errorf("%w, the key has use %q and encrypting needs \"enc\"", ErrKeyUsage, usage.Use)
+		}
+		if usage.KeyOps != nil && !usage.allowsOperation("encrypt", "wrapKey") {
+			return fmt.Errorf("%w, key_ops must contain \"encrypt\" or \"wrapKey\" to encrypt", ErrKeyUsage)
+		}
+		return nil
+	case KeyOperationDecrypt:
+		if usage.Use == "enc" || (usage.Use == "" && usage.allowsOperation("decrypt", "unwrapKey")) {
+			return nil
+		}
+		return fmt.Errorf("JWK must be marked with use \"enc\" or key_ops containing \"decrypt\"")
+	default:
+		return fmt.Errorf("unknown key operation %q", operation)
+	}
+}
+
+// ImportPrivateKeyFromJWK parses a private JWK for decryption and returns its RSA or EC private key and key type
+func ImportPrivateKeyFromJWK(data []byte) (interface{}, KeyType, error) {
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON(data); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JWK: %v", err)
+	}
+	if jwk.IsPublic() {
+		return nil, 0, fmt.Errorf("JWK only holds a public key, the private key is required to decrypt")
+	}
+	if err := ValidateKeyUsage(data, KeyOperationDecrypt); err != nil {
+		return nil, 0, err
+	}
+
+	switch key := jwk.Key.(type) {
+	case *rsa.PrivateKey:
+		if err := checkRSAKeySize(&key.PublicKey); err != nil {
+			return nil, 0, err
+		}
+		return precomputeRSAKey(key), KeyTypeRSA, nil
+	case *ecdsa.PrivateKey:
+		return key, KeyTypeEC, nil
+	case []byte:
+		return nil, 0, fmt.Errorf("oct JWKs are shared secrets, send them as secretKeyBase64")
+	default:
+		return nil, 0, fmt.Errorf("unsupported JWK key type %T for decryption", jwk.Key)
+	}
+}
+
+// ImportPublicKeyFromJWK parses a JWK and returns its RSA, EC or OKP public key and key type
+func ImportPublicKeyFromJWK(data []byte) (interface{}, KeyType, error) {
+	// go-jose only knows Ed25519 OKP keys, X25519 ones are parsed here
+	var members okpMembers
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JWK: %v", err)
+	}
+	if members.KeyType == "OKP" && members.Curve == X25519Curve {
+		key, err := importX25519JWK(members)
+		if err != nil {
+			return nil, 0, err
+		}
+		return key, KeyTypeX25519, nil
+	}
+
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON(data); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JWK: %v", err)
+	}
+
+	// Only the public half is needed, private members are dropped
+	public := jwk.Public()
+	if !public.Valid() {
+		return nil, 0, fmt.Errorf("JWK does not contain a valid public key")
+	}
+
+	switch key := public.Key.(type) {
+	case *rsa.PublicKey:
+		if err := checkRSAKeySize(key); err != nil {
+			return nil, 0, err
+		}
+		return key, KeyTypeRSA, nil
+	case *ecdsa.PublicKey:
+		return key, KeyTypeEC, nil
+	case ed25519.PublicKey:
+		if jwk.Use != "" && jwk.Use != "sig" {
+			return nil, 0, fmt.Errorf("Ed25519 keys are only used for signing, got use %q", jwk.Use)
+		}
+		return key, KeyTypeEd25519, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported JWK key type %T", public.Key)
+	}
+}
+
+// ImportKeyFromJWK parses a single RSA or EC JWK, public or private, for format conversion
+func ImportKeyFromJWK(data []byte) (jose.JSONWebKey, error) {
+	// A set holds several keys, which one to convert would be a guess
+	var set struct {
+		Keys json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("failed to parse JWK: %v", err)
+	}
+	if set.Keys != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("expected a single JWK, got a JWK set")
+	}
+
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON(data); err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("failed to parse JWK: %v", err)
+	}
+
+	switch key := jwk.Key.(type) {
+	case *rsa.PublicKey:
+		return jwk, checkRSAKeySize(key)
+	case *rsa.PrivateKey:
+		return jwk, checkRSAKeySize(&key.PublicKey)
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return jwk, nil
+	case []byte:
+		return jose.JSONWebKey{}, fmt.Errorf("oct JWKs are shared secrets and have no PEM form")
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("unsupported JWK key type %T, only RSA and EC keys can be converted", jwk.Key)
+	}
+}
+
+// ErrKidNotFound is returned when no key of a JWK set carries the requested kid
+var ErrKidNotFound = errors.New("no key in the JWK set has the kid")
+
+// SelectKeyFromJWKS picks the encryption key with the kid out of a JWK set and imports its public key.
+// Keys sharing the kid whose use or key_ops rule out encryption are skipped, two encryption keys with the same kid are ambiguous.
+func SelectKeyFromJWKS(jwks []byte, kid string) (interface{}, KeyType, error) {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JWK set: %v", err)
+	}
+	if set.Keys == nil {
+		return nil, 0, fmt.Errorf("JWK set must have a keys member")
+	}
+
+	var selected json.RawMessage
+	for i, key := range set.Keys {
+		var members struct {
+			Kid string `json:"kid"`
+		}
+		if err := json.Unmarshal(key, &members); err != nil {
+			return nil, 0, fmt.Errorf("key %d: failed to parse JWK: %v", i, err)
+		}
+		if members.Kid != kid || ValidateKeyUsage(key, KeyOperationEncrypt) != nil {
+			continue
+		}
+		if selected != nil {
+			return nil, 0, fmt.Errorf("JWK set has several encryption keys with kid %q", kid)
+		}
+		selected = key
+	}
+	if selected == nil {
+		return nil, 0, fmt.Errorf("%w %q", ErrKidNotFound, kid)
+	}
+
+	return ImportPublicKeyFromJWK(selected)
+}
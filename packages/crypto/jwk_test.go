@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func TestPrivateKeyConvertsBetweenPEMAndJWK(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePem, err := ExportPrivateKeyAsPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, private, err := ImportKeyFromPEM(privatePem)
+	if err != nil || !private {
+		t.Fatalf("expected a private key, got %v, %v", private, err)
+	}
+	jwk, err := ConvertPrivateKeyToJWK(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := jwk.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := ImportKeyFromJWK(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !privateKey.Equal(imported.Key) {
+		t.Fatalf("expected the JWK to hold the original private key")
+	}
+
+	// A private key followed by its public key is ambiguous
+	publicPem, err := ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ImportKeyFromPEM(privatePem + publicPem); err == nil {
+		t.Fatalf("expected a bundle of PEM blocks to be rejected")
+	}
+	if _, err := ImportKeyFromJWK([]byte(`{"keys":[]}`)); err == nil {
+		t.Fatalf("expected a JWK set to be rejected")
+	}
+}
+
+func TestSelectKeyFromJWKS(t *testing.T) {
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptionKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &signingKey.PublicKey, KeyID: "current", Use: "sig"},
+		{Key: &encryptionKey.PublicKey, KeyID: "current", Use: "enc"},
+		{Key: &signingKey.PublicKey, KeyID: "twice"},
+		{Key: &encryptionKey.PublicKey, KeyID: "twice"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, keyType, err := SelectKeyFromJWKS(jwks, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicKey, ok := key.(*ecdsa.PublicKey); !ok || keyType != KeyTypeEC || !publicKey.Equal(&encryptionKey.PublicKey) {
+		t.Fatalf("expected the encryption key, not the signing key sharing its kid")
+	}
+
+	if _, _, err := SelectKeyFromJWKS(jwks, "missing"); !errors.Is(err, ErrKidNotFound) {
+		t.Fatalf("expected ErrKidNotFound, got %v", err)
+	}
+	if _, _, err := SelectKeyFromJWKS(jwks, "twice"); err == nil || errors.Is(err, ErrKidNotFound) {
+		t.Fatalf("expected two keys with the same kid to be ambiguous, got %v", err)
+	}
+	if _, _, err := SelectKeyFromJWKS([]byte(`{"kid":"current"}`), "current"); err == nil {
+		t.Fatalf("expected a set without keys to be rejected")
+	}
+}
+
+func TestValidateKeyUsage(t *testing.T) {
+	for _, test := range []struct {
+		jwk       string
+		operation KeyOperation
+		allowed   bool
+	}{
+		{`{"kty":"EC"}`, KeyOperationEncrypt, true},
+		{`{"kty":"EC","use":"enc"}`, KeyOperationEncrypt, true},
+		{`{"kty":"EC","key_ops":["wrapKey"]}`, KeyOperationEncrypt, true},
+		{`{"kty":"EC","use":"enc","key_ops":["encrypt"]}`, KeyOperationEncrypt, true},
+		{`{"kty":"EC","use":"sig"}`, KeyOperationEncrypt, false},
+		{`{"kty":"EC","key_ops":["sign","verify"]}`, KeyOperationEncrypt, false},
+		{`{"kty":"EC","use":"enc","key_ops":["verify"]}`, KeyOperationEncrypt, false},
+		// Decryption keys must be marked, an unmarked key is refused
+		{`{"kty":"EC"}`, KeyOperationDecrypt, false},
+		{`{"kty":"EC","use":"enc"}`, KeyOperationDecrypt, true},
+		{`{"kty":"EC","key_ops":["unwrapKey"]}`, KeyOperationDecrypt, true},
+		{`{"kty":"EC","use":"sig","key_ops":["decrypt"]}`, KeyOperationDecrypt, false},
+	} {
+		err := ValidateKeyUsage([]byte(test.jwk), test.operation)
+		if (err == nil) != test.allowed {
+			t.Errorf("%s for %s: expected allowed %v, got %v", test.jwk, test.operation, test.allowed, err)
+		}
+		if test.operation == KeyOperationEncrypt && err != nil && !errors.Is(err, ErrKeyUsage) {
+			t.Errorf("%s: expected ErrKeyUsage, got %v", test.jwk, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package crypto
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"sync"
+)
+
+// PublicKeyEntry holds an imported public key together with its JWK and thumbprint
+type PublicKeyEntry struct {
+	PublicKey  interface{}
+	KeyType    KeyType
+	JWK        jose.JSONWebKey
+	Thumbprint string
+}
+
+// KeyCache is a fixed size LRU cache of imported public keys keyed by a hash of their PEM
+type KeyCache struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[[sha256.Size]byte]*list.Element
+	hits     uint64
+	misses   uint64
+	// imports holds the imports in flight, concurrent misses for the same PEM wait for the first one
+	imports map[[sha256.Size]byte]*keyImport
+}
+
+// KeyCacheStats describes the content of a KeyCache and counts its lookups since it was created
+type KeyCacheStats struct {
+	Size     int
+	Capacity int
+	Hits     uint64
+	Misses   uint64
+}
+
+type keyCacheItem struct {
+	key   [sha256.Size]byte
+	entry PublicKeyEntry
+}
+
+// errImportPanicked is returned to the requests waiting on an import that panicked
+var errImportPanicked = errors.New("the key import panicked")
+
+// keyImport is an import in flight, entry and err are set before done is closed
+type keyImport struct {
+	done  chan struct{}
+	entry PublicKeyEntry
+	err   error
+}
+
+// NewKeyCache creates an LRU cache holding up to capacity keys
+func NewKeyCache(capacity int) *KeyCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &KeyCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[[sha256.Size]byte]*list.Element),
+		imports:  make(map[[sha256.Size]byte]*keyImport),
+	}
+}
+
+// PublicKeys is the cache used by GetOrImportPublicKey
+var PublicKeys = NewKeyCache(1024)
+
+// Get returns the cached entry for the PEM, marking it as recently used
+func (cache *KeyCache) Get(publicKeyPEM string) (PublicKeyEntry, bool) {
+	key := sha256.Sum256([]byte(publicKeyPEM))
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		cache.misses++
+		return PublicKeyEntry{}, false
+	}
+	cache.hits++
+	cache.order.MoveToFront(element)
+	return element.Value.(*keyCacheItem).entry, true
+}
+
+// Contains reports whether the PEM is cached, without marking it as recently used
+func (cache *KeyCache) Contains(publicKeyPEM string) bool {
+	key := sha256.Sum256([]byte(publicKeyPEM))
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	_, ok := cache.entries[key]
+	return ok
+}
+
+// Add stores the entry for the PEM, evicting the least recently used one when full
+func (cache *KeyCache) Add(publicKeyPEM string, entry PublicKeyEntry) {
+	key := sha256.Sum256([]byte(publicKeyPEM))
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		element.Value.(*keyCacheItem).entry = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.entries[key] = cache.order.PushFront(&keyCacheItem{key: key, entry: entry})
+	for cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*keyCacheItem).key)
+	}
+}
+
+// Len returns the number of cached keys
+func (cache *KeyCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.order.Len()
+}
+
+// Stats returns the size, capacity and lookup counts of the cache
+func (cache *KeyCache) Stats() KeyCacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return KeyCacheStats{Size: cache.order.Len(), Capacity: cache.capacity, Hits: cache.hits, Misses: cache.misses}
+}
+
+// Thumbprints lists the thumbprints of the cached keys, the most recently used first
+func (cache *KeyCache) Thumbprints() []string {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	thumbprints := make([]string, 0, cache.order.Len())
+	for element := cache.order.Front(); element != nil; element = element.Next() {
+		thumbprints = append(thumbprints, element.Value.(*keyCacheItem).entry.Thumbprint)
+	}
+	return thumbprints
+}
+
+// Evict removes the cached entries of the key with the thumbprint and returns how many there were,
+// each PEM encoding of the same key is cached apart
+func (cache *KeyCache) Evict(thumbprint string) int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	evicted := 0
+	for element := cache.order.Front(); element != nil; {
+		next := element.Next()
+		if item := element.Value.(*keyCacheItem); item.entry.Thumbprint == thumbprint {
+			cache.order.Remove(element)
+			delete(cache.entries, item.key)
+			evicted++
+		}
+		element = next
+	}
+	return evicted
+}
+
+// getOrImport returns the cached entry for the PEM, importing it on a miss. Concurrent misses for the same PEM
+// share a single import instead of all redoing it, a failed import is shared too but not cached.
+func (cache *KeyCache) getOrImport(publicKeyPEM string, importKey func(string) (PublicKeyEntry, error)) (PublicKeyEntry, error) {
+	if entry, ok := cache.Get(publicKeyPEM); ok {
+		return entry, nil
+	}
+	key := sha256.Sum256([]byte(publicKeyPEM))
+
+	cache.mutex.Lock()
+	// The import may have finished between the miss and here
+	if element, ok := cache.entries[key]; ok {
+		entry := element.Value.(*keyCacheItem).entry
+		cache.mutex.Unlock()
+		return entry, nil
+	}
+	if pending, ok := cache.imports[key]; ok {
+		cache.mutex.Unlock()
+		<-pending.done
+		return pending.entry, pending.err
+	}
+	pending := &keyImport{done: make(chan struct{})}
+	cache.imports[key] = pending
+	cache.mutex.Unlock()
+
+	// The waiters are released even if the import panics, the entry is cached first so late misses find it
+	defer func() {
+		cache.mutex.Lock()
+		delete(cache.imports, key)
+		cache.mutex.Unlock()
+		close(pending.done)
+	}()
+	// Waiters of an import that panics get this error instead of an empty entry
+	pending.err = errImportPanicked
+	pending.entry, pending.err = importKey(publicKeyPEM)
+	if pending.err != nil {
+		return PublicKeyEntry{}, pending.err
+	}
+	cache.Add(publicKeyPEM, pending.entry)
+	return pending.entry, nil
+}
+
+// GetOrImportPublicKey returns the imported key, JWK and thumbprint for the PEM, importing it on a cache miss
+func GetOrImportPublicKey(publicKeyPEM string) (PublicKeyEntry, error) {
+	return PublicKeys.getOrImport(publicKeyPEM, importPublicKeyEntry)
+}
+
+// WarmCache imports the public keys into PublicKeys ahead of the first requests naming them and returns how many
+// it imported, keys already cached are skipped
+func WarmCache(publicKeyPEMs []string) (int, error) {
+	warmed := 0
+	for i, publicKeyPEM := range publicKeyPEMs {
+		if PublicKeys.Contains(publicKeyPEM) {
+			continue
+		}
+		entry, err := importPublicKeyEntry(publicKeyPEM)
+		if err != nil {
+			return warmed, fmt.Errorf("key %d: %v", i, err)
+		}
+		PublicKeys.Add(publicKeyPEM, entry)
+		warmed++
+	}
+	return warmed, nil
+}
+
+func importPublicKeyEntry(publicKeyPEM string) (PublicKeyEntry, error) {
+	publicKey, _, err := ImportPublicKeyFromPEM(publicKeyPEM)
+	if err != nil {
+		return PublicKeyEntry{}, err
+	}
+
+	return NewPublicKeyEntry(publicKey)
+}
+
+// NewPublicKeyEntry converts an RSA, EC or OKP public key to its JWK and computes the thumbprint
+func NewPublicKeyEntry(publicKey interface{}) (PublicKeyEntry, error) {
+	jwk, err := ConvertPublicKeyToJWK(publicKey)
+	if err != nil {
+		return PublicKeyEntry{}, err
+	}
+
+	thumbprint, err := GetJWKThumbprintSHA256(jwk)
+	if err != nil {
+		return PublicKeyEntry{}, err
+	}
+
+	keyType := KeyTypeRSA
+	if _, ok := publicKey.(*ecdsa.PublicKey); ok {
+		keyType = KeyTypeEC
+	} else if okpType, ok := okpKeyType(publicKey); ok {
+		keyType = okpType
+	}
+
+	return PublicKeyEntry{
+		PublicKey:  publicKey,
+		KeyType:    keyType,
+		JWK:        jwk,
+		Thumbprint: thumbprint,
+	}, nil
+}
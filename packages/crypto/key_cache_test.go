@@ -0,0 +1,195 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmCachePopulatesTheCache(t *testing.T) {
+	defer func(cache *KeyCache) { PublicKeys = cache }(PublicKeys)
+	PublicKeys = NewKeyCache(8)
+
+	store := NewKeyStore()
+	for range 2 {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Register(privateKey, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publicKeyPEMs, err := store.PublicKeyPEMs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warmed, err := WarmCache(publicKeyPEMs)
+	if err != nil || warmed != 2 || PublicKeys.Len() != 2 {
+		t.Fatalf("expected 2 keys warmed, got %d with %d cached: %v", warmed, PublicKeys.Len(), err)
+	}
+	thumbprints, _ := store.Thumbprints()
+	for i, publicKeyPEM := range publicKeyPEMs {
+		entry, ok := PublicKeys.Get(publicKeyPEM)
+		if !ok || entry.Thumbprint != thumbprints[i] {
+			t.Fatalf("expected key %d cached with thumbprint %s, got %+v", i, thumbprints[i], entry)
+		}
+	}
+
+	// Keys already cached are not imported again
+	if warmed, err := WarmCache(publicKeyPEMs); err != nil || warmed != 0 {
+		t.Fatalf("expected nothing warmed the second time, got %d: %v", warmed, err)
+	}
+	if _, err := WarmCache([]string{"not a PEM"}); err == nil {
+		t.Fatal("expected an invalid key to fail the warmup")
+	}
+}
+
+func TestKeyCacheEvictsByThumbprint(t *testing.T) {
+	cache := NewKeyCache(8)
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := NewPublicKeyEntry(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM, err := ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same key with CRLF line endings is another PEM, cached apart under the same thumbprint
+	cache.Add(publicKeyPEM, entry)
+	cache.Add(strings.ReplaceAll(publicKeyPEM, "\n", "\r\n"), entry)
+	cache.Add("other", PublicKeyEntry{Thumbprint: "other"})
+	cache.Get(publicKeyPEM)
+	cache.Get("missing")
+	if stats := cache.Stats(); stats.Size != 3 || stats.Capacity != 8 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("expected 3 keys with a hit and a miss, got %+v", stats)
+	}
+	if thumbprints := cache.Thumbprints(); len(thumbprints) != 3 || thumbprints[0] != entry.Thumbprint || thumbprints[1] != "other" {
+		t.Fatalf("expected the most recently used key first, got %v", thumbprints)
+	}
+
+	if evicted := cache.Evict(entry.Thumbprint); evicted != 2 {
+		t.Fatalf("expected both encodings evicted, got %d", evicted)
+	}
+	if cache.Contains(publicKeyPEM) || !cache.Contains("other") || cache.Len() != 1 {
+		t.Fatalf("expected only the other key to stay, got %v", cache.Thumbprints())
+	}
+	if evicted := cache.Evict(entry.Thumbprint); evicted != 0 {
+		t.Fatalf("expected nothing left to evict, got %d", evicted)
+	}
+}
+
+func TestKeyCacheImportsAKeyOnceForConcurrentMisses(t *testing.T) {
+	cache := NewKeyCache(8)
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM, err := ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The import blocks until every goroutine has started, so they all miss while it is in flight
+	var imports atomic.Int32
+	release := make(chan struct{})
+	importKey := func(publicKeyPEM string) (PublicKeyEntry, error) {
+		imports.Add(1)
+		<-release
+		return importPublicKeyEntry(publicKeyPEM)
+	}
+
+	const goroutines = 32
+	var started, finished sync.WaitGroup
+	started.Add(goroutines)
+	finished.Add(goroutines)
+	thumbprints := make([]string, goroutines)
+	errs := make([]error, goroutines)
+	for i := range goroutines {
+		go func() {
+			defer finished.Done()
+			started.Done()
+			entry, err := cache.getOrImport(publicKeyPEM, importKey)
+			thumbprints[i], errs[i] = entry.Thumbprint, err
+		}()
+	}
+	started.Wait()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	finished.Wait()
+
+	if count := imports.Load(); count != 1 {
+		t.Fatalf("expected the key imported once, got %d imports", count)
+	}
+	for i := range goroutines {
+		if errs[i] != nil || thumbprints[i] == "" || thumbprints[i] != thumbprints[0] {
+			t.Fatalf("expected every goroutine to share the import, goroutine %d got %q: %v", i, thumbprints[i], errs[i])
+		}
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("expected the key cached once, got %d", cache.Len())
+	}
+
+	// A failed import is not cached, the next miss imports again
+	failing := func(string) (PublicKeyEntry, error) {
+		imports.Add(1)
+		return PublicKeyEntry{}, errors.New("import failed")
+	}
+	for range 2 {
+		if _, err := cache.getOrImport("not a key", failing); err == nil {
+			t.Fatal("expected the import error")
+		}
+	}
+	if count := imports.Load(); count != 3 {
+		t.Fatalf("expected a failed import to be retried, got %d imports", count)
+	}
+}
+
+func TestKeyCacheFailsTheWaitersOfAPanickedImport(t *testing.T) {
+	cache := NewKeyCache(8)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	importKey := func(string) (PublicKeyEntry, error) {
+		close(started)
+		<-release
+		panic("import failed")
+	}
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		cache.getOrImport("panicking key", importKey)
+	}()
+	<-started
+
+	// The waiter joins the import in flight and is released by the panic with an error
+	waited := make(chan error)
+	go func() {
+		_, err := cache.getOrImport("panicking key", importKey)
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if recovered := <-panicked; recovered == nil {
+		t.Fatal("expected the import to panic")
+	}
+	if err := <-waited; !errors.Is(err, errImportPanicked) {
+		t.Fatalf("expected the waiter to get errImportPanicked, got %v", err)
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("expected nothing cached, got %d", cache.Len())
+	}
+}
@@ -0,0 +1,132 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"io"
+	"strings"
+)
+
+// KeyMaterial supplies the content encryption key and IV of each message the encrypters of this package build
+type KeyMaterial interface {
+	ContentKey(size int) ([]byte, error)
+	IV(size int) ([]byte, error)
+}
+
+// RandomKeyMaterial draws from jose.RandReader, every encrypter uses it outside the test vectors
+var RandomKeyMaterial KeyMaterial = randomKeyMaterial{}
+
+type randomKeyMaterial struct{}
+
+func (randomKeyMaterial) ContentKey(size int) ([]byte, error) {
+	return randomBytes(size)
+}
+
+func (randomKeyMaterial) IV(size int) ([]byte, error) {
+	return randomBytes(size)
+}
+
+func randomBytes(size int) ([]byte, error) {
+	out := make([]byte, size)
+	if _, err := io.ReadFull(jose.RandReader, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FixedKeyMaterial hands out the same CEK and IV for every message, reusing them is only safe for known-answer tests
+type FixedKeyMaterial struct {
+	ContentEncryptionKey []byte
+	InitializationVector []byte
+}
+
+func (material FixedKeyMaterial) ContentKey(size int) ([]byte, error) {
+	if len(material.ContentEncryptionKey) != size {
+		return nil, fmt.Errorf("content encryption key must be %d bytes", size)
+	}
+	return material.ContentEncryptionKey, nil
+}
+
+func (material FixedKeyMaterial) IV(size int) ([]byte, error) {
+	if len(material.InitializationVector) != size {
+		return nil, fmt.Errorf("IV must be %d bytes", size)
+	}
+	return material.InitializationVector, nil
+}
+
+// protectedHeader starts the protected header of a message with the client headers from the options
+func protectedHeader(keyAlgorithm jose.KeyAlgorithm, contentEncryption jose.ContentEncryption, keyID string, options jose.EncrypterOptions) map[string]interface{} {
+	header := make(map[string]interface{}, len(options.ExtraHeaders)+5)
+	for name, value := range options.ExtraHeaders {
+		header[string(name)] = value
+	}
+	header["alg"] = keyAlgorithm
+	header["enc"] = contentEncryption
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	if options.Compression == jose.DEFLATE {
+		header["zip"] = jose.DEFLATE
+	}
+	return header
+}
+
+// sealJWE encrypts the content under cek, then builds the serialized JWE and parses it back, so callers get
+// the same object go-jose returns. Without aad that is the compact serialization, aad needs the JSON one.
+func sealJWE(header map[string]interface{}, encryptedKey []byte, contentEncryption jose.ContentEncryption, cek []byte, material KeyMaterial, plaintext, aad []byte) (*jose.JSONWebEncryption, error) {
+	if header["zip"] == jose.DEFLATE {
+		var err error
+		if plaintext, err = deflate(plaintext); err != nil {
+			return nil, err
+		}
+	}
+
+	serializedHeader, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize protected header: %v", err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString(serializedHeader)
+
+	// The encoded protected header, followed by the encoded aad when there is one, is authenticated with the content
+	authData := protected
+	if len(aad) > 0 {
+		authData += "." + base64.RawURLEncoding.EncodeToString(aad)
+	}
+	aead, tagSize, err := newContentCipher(contentEncryption, cek)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := material.IV(aead.NonceSize())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %v", err)
+	}
+	sealed := aead.Seal(nil, iv, plaintext, []byte(authData))
+	ciphertext, tag := sealed[:len(sealed)-tagSize], sealed[len(sealed)-tagSize:]
+
+	keyAlgorithms, contentEncryptions := []jose.KeyAlgorithm{header["alg"].(jose.KeyAlgorithm)}, []jose.ContentEncryption{contentEncryption}
+	if len(aad) > 0 {
+		serialized, err := json.Marshal(map[string]string{
+			"protected":     protected,
+			"encrypted_key": base64.RawURLEncoding.EncodeToString(encryptedKey),
+			"iv":            base64.RawURLEncoding.EncodeToString(iv),
+			"ciphertext":    base64.RawURLEncoding.EncodeToString(ciphertext),
+			"tag":           base64.RawURLEncoding.EncodeToString(tag),
+			"aad":           base64.RawURLEncoding.EncodeToString(aad),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize JWE: %v", err)
+		}
+		return jose.ParseEncryptedJSON(string(serialized), keyAlgorithms, contentEncryptions)
+	}
+
+	compact := strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, ".")
+	return jose.ParseEncrypted(compact, keyAlgorithms, contentEncryptions)
+}
@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// ErrKeyPairMismatch is returned when the private key does not belong to the public key
+var ErrKeyPairMismatch = errors.New("private key does not match the public key")
+
+// How CheckKeyPair exercises a key pair
+const (
+	KeyPairCheckEncrypt   = "encrypt-decrypt"
+	KeyPairCheckSign      = "sign-verify"
+	KeyPairCheckAgreement = "key-agreement"
+)
+
+// CheckKeyPair proves the private key belongs to the public key by using both on a random challenge.
+// RSA and EC keys encrypt it to the public key and decrypt it with the private one, Ed25519 keys sign and
+// verify it, X25519 keys agree on a secret with an ephemeral key from both sides. It returns the method used.
+func CheckKeyPair(publicKey, privateKey interface{}) (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if _, ok := publicKey.(*rsa.PublicKey); !ok {
+			return KeyPairCheckEncrypt, fmt.Errorf("%w: the public key is not an RSA key", ErrKeyPairMismatch)
+		}
+		return KeyPairCheckEncrypt, checkEncryptionKeyPair(publicKey, key, DefaultKeyAlgorithm(KeyTypeRSA), challenge)
+	case *ecdsa.PrivateKey:
+		if _, ok := publicKey.(*ecdsa.PublicKey); !ok {
+			return KeyPairCheckEncrypt, fmt.Errorf("%w: the public key is not an EC key", ErrKeyPairMismatch)
+		}
+		return KeyPairCheckEncrypt, checkEncryptionKeyPair(publicKey, key, DefaultKeyAlgorithm(KeyTypeEC), challenge)
+	case ed25519.PrivateKey:
+		if _, ok := publicKey.(ed25519.PublicKey); !ok {
+			return KeyPairCheckSign, fmt.Errorf("%w: the public key is not an Ed25519 key", ErrKeyPairMismatch)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: key}, nil)
+		if err != nil {
+			return KeyPairCheckSign, err
+		}
+		signature, err := signer.Sign(challenge)
+		if err != nil {
+			return KeyPairCheckSign, err
+		}
+		if _, err := signature.Verify(publicKey); err != nil {
+			return KeyPairCheckSign, ErrKeyPairMismatch
+		}
+		return KeyPairCheckSign, nil
+	case *ecdh.PrivateKey:
+		peer, ok := publicKey.(*ecdh.PublicKey)
+		if !ok || peer.Curve() != key.Curve() {
+			return KeyPairCheckAgreement, fmt.Errorf("%w: the public key is not an X25519 key", ErrKeyPairMismatch)
+		}
+		ephemeral, err := key.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return KeyPairCheckAgreement, err
+		}
+		sent, err := ephemeral.ECDH(peer)
+		if err != nil {
+			return KeyPairCheckAgreement, ErrKeyPairMismatch
+		}
+		received, err := key.ECDH(ephemeral.PublicKey())
+		if err != nil || subtle.ConstantTimeCompare(sent, received) != 1 {
+			return KeyPairCheckAgreement, ErrKeyPairMismatch
+		}
+		return KeyPairCheckAgreement, nil
+	}
+	return "", fmt.Errorf("unsupported private key type %T", privateKey)
+}
+
+// checkEncryptionKeyPair encrypts the challenge to the public key and checks the private key decrypts it
+func checkEncryptionKeyPair(publicKey, privateKey interface{}, keyAlgorithm jose.KeyAlgorithm, challenge []byte) error {
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: keyAlgorithm, Key: publicKey}, nil)
+	if err != nil {
+		return err
+	}
+	jwe, err := encrypter.Encrypt(challenge)
+	if err != nil {
+		return err
+	}
+	decrypted, err := jwe.Decrypt(privateKey)
+	if err != nil || subtle.ConstantTimeCompare(decrypted, challenge) != 1 {
+		return ErrKeyPairMismatch
+	}
+	return nil
+}
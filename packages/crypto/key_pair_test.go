@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestCheckKeyPair(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherECKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEdPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherX25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name       string
+		publicKey  interface{}
+		privateKey interface{}
+		method     string
+		match      bool
+	}{
+		{"RSA", &rsaKey.PublicKey, rsaKey, KeyPairCheckEncrypt, true},
+		{"RSA mismatch", &otherRSAKey.PublicKey, rsaKey, KeyPairCheckEncrypt, false},
+		{"EC", &ecKey.PublicKey, ecKey, KeyPairCheckEncrypt, true},
+		{"EC other curve", &otherECKey.PublicKey, ecKey, KeyPairCheckEncrypt, false},
+		{"EC public key for RSA", &ecKey.PublicKey, rsaKey, KeyPairCheckEncrypt, false},
+		{"Ed25519", edPublicKey, edKey, KeyPairCheckSign, true},
+		{"Ed25519 mismatch", otherEdPublicKey, edKey, KeyPairCheckSign, false},
+		{"X25519", x25519Key.PublicKey(), x25519Key, KeyPairCheckAgreement, true},
+		{"X25519 mismatch", otherX25519Key.PublicKey(), x25519Key, KeyPairCheckAgreement, false},
+	} {
+		method, err := CheckKeyPair(test.publicKey, test.privateKey)
+		if method != test.method {
+			t.Fatalf("%s: expected the %s check, got %q", test.name, test.method, method)
+		}
+		if test.match && err != nil {
+			t.Fatalf("%s: expected the keys to match, got %v", test.name, err)
+		}
+		if !test.match && !errors.Is(err, ErrKeyPairMismatch) {
+			t.Fatalf("%s: expected a mismatch, got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Key is a server private key as a provider loaded it, Certificate is nil when none came with it
+type Key struct {
+	PrivateKey  interface{}
+	Certificate *x509.Certificate
+	// Algorithms restricts the key to these algorithms, empty allows any
+	Algorithms []string
+	// NotAfter is when the key stops encrypting and being published, zero never
+	NotAfter time.Time
+}
+
+// AlgorithmsPEMHeader is the PEM header a key file restricts its key with, a comma separated list of algorithms
+const AlgorithmsPEMHeader = "Algorithms"
+
+// NotAfterPEMHeader is the PEM header a key file sets the expiry of its key with, an RFC 3339 timestamp
+const NotAfterPEMHeader = "Not-After"
+
+// KeyProvider loads the server private keys from wherever they are kept. The filesystem is the only backend
+// for now, a secrets manager or a KMS can implement it later without the server or the routes changing.
+type KeyProvider interface {
+	// LoadKeys returns every key of the provider, or an error and none of them
+	LoadKeys(ctx context.Context) ([]Key, error)
+	// Tenant returns the provider of the keys of the tenant, ErrNoTenantKeys when the backend holds none
+	Tenant(tenant string) (KeyProvider, error)
+	// Tenants lists the tenants the backend holds keys for
+	Tenants(ctx context.Context) ([]string, error)
+}
+
+// ErrNoTenantKeys is returned for a tenant a key provider holds no keys for
+var ErrNoTenantKeys = errors.New("no keys for the tenant")
+
+// FileKeyProvider loads the *.pem private keys of a directory, each subdirectory named after a tenant
+// holds the keys of that tenant
+type FileKeyProvider struct {
+	dir string
+}
+
+// NewFileKeyProvider creates a provider reading the keys of dir
+func NewFileKeyProvider(dir string) *FileKeyProvider {
+	return &FileKeyProvider{dir: dir}
+}
+
+// LoadKeys imports the keys in file name order, so the first one able to sign becomes the primary.
+// A key file restricts its key with an Algorithms header in its PEM block and expires it with a Not-After one.
+func (provider *FileKeyProvider) LoadKeys(ctx context.Context) ([]Key, error) {
+	paths, err := filepath.Glob(filepath.Join(provider.dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key directory: %v", err)
+	}
+	sort.Strings(paths)
+
+	keys := make([]Key, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		privateKey, _, err := ImportPrivateKeyFromPEM(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %v", path, err)
+		}
+		notAfter, err := pemNotAfter(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %v", path, err)
+		}
+		keys = append(keys, Key{PrivateKey: privateKey, Algorithms: pemAlgorithms(data), NotAfter: notAfter})
+	}
+	return keys, nil
+}
+
+// Tenant returns the provider of the tenant subdirectory, which has to exist:
+// a missing directory would load no keys and drop every key of the tenant
+func (provider *FileKeyProvider) Tenant(tenant string) (KeyProvider, error) {
+	if err := ValidateTenantID(tenant); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(provider.dir, tenant)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%w: no key directory for tenant %q", ErrNoTenantKeys, tenant)
+	}
+	return NewFileKeyProvider(dir), nil
+}
+
+// pemAlgorithms reads the Algorithms header of the first PEM block, nil when it has none
+func pemAlgorithms(data []byte) []string {
+	block, _ := pem.Decode([]byte(NormalizePEM(string(data))))
+	if block == nil || block.Headers[AlgorithmsPEMHeader] == "" {
+		return nil
+	}
+	algorithms := strings.Split(block.Headers[AlgorithmsPEMHeader], ",")
+	for i, algorithm := range algorithms {
+		algorithms[i] = strings.TrimSpace(algorithm)
+	}
+	return algorithms
+}
+
+// pemNotAfter reads the Not-After header of the first PEM block, the zero time when it has none
+func pemNotAfter(data []byte) (time.Time, error) {
+	block, _ := pem.Decode([]byte(NormalizePEM(string(data))))
+	if block == nil || block.Headers[NotAfterPEMHeader] == "" {
+		return time.Time{}, nil
+	}
+	notAfter, err := time.Parse(time.RFC3339, strings.TrimSpace(block.Headers[NotAfterPEMHeader]))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("the %s header must be an RFC 3339 timestamp", NotAfterPEMHeader)
+	}
+	return notAfter, nil
+}
+
+func (provider *FileKeyProvider) Tenants(ctx context.Context) ([]string, error) {
+	dirs, err := TenantDirs(provider.dir)
+	if err != nil {
+		return nil, err
+	}
+	tenants := make([]string, 0, len(dirs))
+	for tenant := range dirs {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// LoadKeyStore registers the keys of the provider in a new store, the first one able to sign becomes the primary
+func LoadKeyStore(ctx context.Context, provider KeyProvider) (*KeyStore, error) {
+	keys, err := provider.LoadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	store := NewKeyStore()
+	for i, key := range keys {
+		if _, err := store.RegisterKey(key); err != nil {
+			return nil, fmt.Errorf("failed to register key %d: %v", i, err)
+		}
+	}
+	return store, nil
+}
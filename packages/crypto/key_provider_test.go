@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileKeyProviderLoadsTheDirectoryAndItsTenants(t *testing.T) {
+	dir := t.TempDir()
+	write := func(dir, name string) {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKeyPem, err := ExportPrivateKeyAsPEM(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(privateKeyPem), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(dir, "a.pem")
+	write(dir, "b.pem")
+	write(filepath.Join(dir, "tenant-a"), "a.pem")
+	// Directories that can't be a tenant ID are no tenant
+	write(filepath.Join(dir, ".hidden"), "a.pem")
+
+	provider := NewFileKeyProvider(dir)
+	keys, err := provider.LoadKeys(context.Background())
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("expected the two keys of the directory, got %d: %v", len(keys), err)
+	}
+	tenants, err := provider.Tenants(context.Background())
+	if err != nil || len(tenants) != 1 || tenants[0] != "tenant-a" {
+		t.Fatalf("expected tenant-a only, got %v: %v", tenants, err)
+	}
+	tenantProvider, err := provider.Tenant("tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store, err := LoadKeyStore(context.Background(), tenantProvider); err != nil {
+		t.Fatal(err)
+	} else if thumbprints, primary := store.Thumbprints(); len(thumbprints) != 1 || primary == "" {
+		t.Fatalf("expected the key of the tenant as primary, got %d", len(thumbprints))
+	}
+
+	if _, err := provider.Tenant("tenant-b"); !errors.Is(err, ErrNoTenantKeys) {
+		t.Fatalf("expected a tenant without a directory to have no keys, got %v", err)
+	}
+	if _, err := provider.Tenant("../tenant-a"); err == nil {
+		t.Fatal("expected a tenant ID leaving the directory to be refused")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := provider.LoadKeys(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled load to stop, got %v", err)
+	}
+}
+
+func TestFileKeyProviderReadsTheAlgorithmsHeader(t *testing.T) {
+	dir := t.TempDir()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Headers: map[string]string{AlgorithmsPEMHeader: "ECDH-ES+A256KW, ES256"}, Bytes: der}
+	if err := os.WriteFile(filepath.Join(dir, "restricted.pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewFileKeyProvider(dir).LoadKeys(context.Background())
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected the key of the directory, got %d: %v", len(keys), err)
+	}
+	if algorithms := keys[0].Algorithms; len(algorithms) != 2 || algorithms[0] != "ECDH-ES+A256KW" || algorithms[1] != "ES256" {
+		t.Fatalf("expected the algorithms of the header, got %q", algorithms)
+	}
+}
+
+func TestNotAfterHeaderExpiresTheKey(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(dir, name, blockType, notAfter string, der []byte) {
+		block := &pem.Block{Type: blockType, Headers: map[string]string{NotAfterPEMHeader: notAfter}, Bytes: der}
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	privateDir := t.TempDir()
+	write(privateDir, "expiring.pem", "PRIVATE KEY", "2030-01-02T03:04:05Z", privateDER)
+	keys, err := NewFileKeyProvider(privateDir).LoadKeys(context.Background())
+	if err != nil || len(keys) != 1 || !keys[0].NotAfter.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("expected the expiry of the header, got %v: %v", keys, err)
+	}
+	write(privateDir, "expiring.pem", "PRIVATE KEY", "next year", privateDER)
+	if _, err := NewFileKeyProvider(privateDir).LoadKeys(context.Background()); err == nil {
+		t.Fatal("expected a Not-After that isn't a timestamp to be refused")
+	}
+
+	// Both public keys load with their expiry, the expired one is no longer published
+	publicDir := t.TempDir()
+	write(publicDir, "a.pem", "PUBLIC KEY", "2000-01-01T00:00:00Z", publicDER)
+	write(publicDir, "b.pem", "PUBLIC KEY", "2999-01-01T00:00:00Z", publicDER)
+	publicKeys, err := LoadPublicKeysFromDir(publicDir)
+	if err != nil || len(publicKeys) != 2 {
+		t.Fatalf("expected both keys loaded, got %d: %v", len(publicKeys), err)
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !publicKeys[0].Expired(now) || publicKeys[1].Expired(now) {
+		t.Fatalf("expected only the first key expired, got %v and %v", publicKeys[0].NotAfter, publicKeys[1].NotAfter)
+	}
+
+	entry := PrivateKeyEntry{NotAfter: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := entry.CheckExpiry(entry.NotAfter.Add(-time.Second)); err != nil {
+		t.Fatalf("expected the key to encrypt before its expiry, got %v", err)
+	}
+	if err := entry.CheckExpiry(entry.NotAfter.Add(time.Second)); !errors.Is(err, ErrKeyExpired) {
+		t.Fatalf("expected the key expired, got %v", err)
+	}
+	if !entry.Decrypts(entry.NotAfter.Add(DecryptionGracePeriod)) || entry.Decrypts(entry.NotAfter.Add(DecryptionGracePeriod+time.Second)) {
+		t.Fatal("expected the key to decrypt until the grace period ends")
+	}
+}
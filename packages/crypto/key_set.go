@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PublishedKey is a public key of the JWKS, clients must no longer encrypt to it once NotAfter has passed.
+// A zero NotAfter never expires.
+type PublishedKey struct {
+	JWK      jose.JSONWebKey
+	NotAfter time.Time
+}
+
+// Expired reports whether the key is no longer published at now
+func (key PublishedKey) Expired(now time.Time) bool {
+	return !key.NotAfter.IsZero() && now.After(key.NotAfter)
+}
+
+// LoadPublicKeysFromDir reads every *.pem public key in the directory as a JWK keyed by thumbprint,
+// along with the expiry of its Not-After header. Expired keys are kept, the JWKS leaves them out when served.
+func LoadPublicKeysFromDir(dir string) ([]PublishedKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key directory: %v", err)
+	}
+
+	// Keep the key order stable so the set always serializes the same way
+	sort.Strings(paths)
+
+	entries := []PublishedKey{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		notAfter, err := pemNotAfter(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %v", path, err)
+		}
+
+		publicKey, keyType, err := ImportPublicKeyFromPEM(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import %s: %v", path, err)
+		}
+
+		// go-jose can't serialize X25519 JWKs, so they can't be published in the set
+		if keyType == KeyTypeX25519 {
+			return nil, fmt.Errorf("failed to import %s: X25519 keys cannot be served in the JWKS", path)
+		}
+
+		jwk, err := ConvertPublicKeyToJWK(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s: %v", path, err)
+		}
+
+		// Annotate the key with its thumbprint so it matches the server_kid header
+		jwk.KeyID, err = GetJWKThumbprintSHA256(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, PublishedKey{JWK: jwk, NotAfter: notAfter})
+	}
+
+	return entries, nil
+}
+
+// ReadPEMFiles returns the contents of every *.pem file in the directory in file name order
+func ReadPEMFiles(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key directory: %v", err)
+	}
+	sort.Strings(paths)
+
+	contents := make([]string, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		contents[i] = string(data)
+	}
+	return contents, nil
+}
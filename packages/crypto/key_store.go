@@ -0,0 +1,276 @@
+package crypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrivateKeyEntry holds a registered server private key with its certificate and thumbprint
+type PrivateKeyEntry struct {
+	PrivateKey  interface{}
+	PublicKey   interface{}
+	KeyType     KeyType
+	Certificate *x509.Certificate
+	Thumbprint  string
+	// Signer signs JWTs with Algorithm, nil when the key has no supported signature algorithm
+	Signer    jose.Signer
+	Algorithm jose.SignatureAlgorithm
+	// Algorithms restricts the key to these key management and signature algorithms, empty allows any
+	Algorithms []string
+	// NotAfter is when the key stops encrypting, it decrypts for DecryptionGracePeriod longer. Zero never expires.
+	NotAfter time.Time
+}
+
+// KeyStore holds registered private keys keyed by the thumbprint of their public key.
+// One key is the primary, it signs new tokens while the others stay available for decryption during rotation.
+type KeyStore struct {
+	mutex   sync.RWMutex
+	entries map[string]PrivateKeyEntry
+	primary string
+}
+
+// NewKeyStore creates an empty key store
+func NewKeyStore() *KeyStore {
+	return &KeyStore{entries: make(map[string]PrivateKeyEntry)}
+}
+
+// Errors returned by the key store, so callers can map them to a response
+var (
+	ErrKeyNotFound = errors.New("no registered key with that thumbprint")
+	ErrPrimaryKey  = errors.New("the primary key cannot be retired")
+	// ErrAlgorithmNotAllowed is returned for an algorithm outside the ones a key was registered for
+	ErrAlgorithmNotAllowed = errors.New("the key is not allowed to be used with that algorithm")
+	// ErrKeyExpired is returned for encrypting to a key past its expiry
+	ErrKeyExpired = errors.New("the key is expired")
+)
+
+// DecryptionGracePeriod is how long after its expiry a key still decrypts the tokens encrypted to it
+var DecryptionGracePeriod = 7 * 24 * time.Hour
+
+// PrivateKeys is the store the decrypt endpoint looks server_kid up in
+var PrivateKeys = NewKeyStore()
+
+// Register stores the private key under its thumbprint and returns the entry.
+// The first key able to sign becomes the primary.
+func (store *KeyStore) Register(privateKey interface{}, certificate *x509.Certificate) (PrivateKeyEntry, error) {
+	return store.RegisterKey(Key{PrivateKey: privateKey, Certificate: certificate})
+}
+
+// RegisterKey stores the key like Register, restricted to the algorithms it declares
+func (store *KeyStore) RegisterKey(key Key) (PrivateKeyEntry, error) {
+	privateKey, certificate := key.PrivateKey, key.Certificate
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return PrivateKeyEntry{}, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	if err := validateKeyAlgorithms(key.Algorithms); err != nil {
+		return PrivateKeyEntry{}, err
+	}
+
+	publicEntry, err := NewPublicKeyEntry(signer.Public())
+	if err != nil {
+		return PrivateKeyEntry{}, err
+	}
+
+	entry := PrivateKeyEntry{
+		PrivateKey:  privateKey,
+		PublicKey:   publicEntry.PublicKey,
+		KeyType:     publicEntry.KeyType,
+		Certificate: certificate,
+		Thumbprint:  publicEntry.Thumbprint,
+		Algorithms:  key.Algorithms,
+		NotAfter:    key.NotAfter,
+	}
+
+	// Keys that can't be used with the default algorithm, or are restricted to others, simply can't become primary
+	algorithm := DefaultSignatureAlgorithm(entry.KeyType)
+	if jwtSigner, err := NewSigner(algorithm, privateKey, (&jose.SignerOptions{}).WithType("JWT")); err == nil && entry.CheckAlgorithm(string(algorithm)) == nil {
+		entry.Signer, entry.Algorithm = jwtSigner, algorithm
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.entries[entry.Thumbprint] = entry
+	if store.primary == "" && entry.Signer != nil {
+		store.primary = entry.Thumbprint
+	}
+	return entry, nil
+}
+
+// CheckAlgorithm returns ErrAlgorithmNotAllowed unless the key may be used with the algorithm
+func (entry PrivateKeyEntry) CheckAlgorithm(algorithm string) error {
+	if len(entry.Algorithms) == 0 {
+		return nil
+	}
+	for _, allowed := range entry.Algorithms {
+		if allowed == algorithm {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: key %q only allows %s, not %s", ErrAlgorithmNotAllowed, entry.Thumbprint, strings.Join(entry.Algorithms, ", "), algorithm)
+}
+
+// CheckExpiry returns ErrKeyExpired once the key is past its expiry, it must no longer be encrypted to
+func (entry PrivateKeyEntry) CheckExpiry(now time.Time) error {
+	if !entry.NotAfter.IsZero() && now.After(entry.NotAfter) {
+		return fmt.Errorf("%w: key %q expired at %s", ErrKeyExpired, entry.Thumbprint, entry.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Decrypts reports whether the key may still decrypt, which it does until the grace period after its expiry ends
+func (entry PrivateKeyEntry) Decrypts(now time.Time) bool {
+	return entry.NotAfter.IsZero() || !now.After(entry.NotAfter.Add(DecryptionGracePeriod))
+}
+
+// validateKeyAlgorithms checks that a key restriction only names key management and signature algorithms
+// a private key can be used with, a typo would otherwise lock the key out of everything
+func validateKeyAlgorithms(algorithms []string) error {
+	for _, algorithm := range algorithms {
+		known := false
+		for _, keyAlgorithm := range SupportedKeyAlgorithms {
+			known = known || string(keyAlgorithm) == algorithm
+		}
+		for _, signatureAlgorithm := range SupportedSignatureAlgorithms {
+			known = known || string(signatureAlgorithm) == algorithm
+		}
+		if !known {
+			return fmt.Errorf("unsupported key algorithm restriction %q", algorithm)
+		}
+	}
+	return nil
+}
+
+// Get returns the registered key for the thumbprint
+func (store *KeyStore) Get(thumbprint string) (PrivateKeyEntry, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	entry, ok := store.entries[thumbprint]
+	return entry, ok
+}
+
+// Primary returns the key new tokens are signed with
+func (store *KeyStore) Primary() (PrivateKeyEntry, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	entry, ok := store.entries[store.primary]
+	return entry, ok
+}
+
+// SetPrimary promotes a registered key to primary
+func (store *KeyStore) SetPrimary(thumbprint string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	entry, ok := store.entries[thumbprint]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, thumbprint)
+	}
+	if entry.Signer == nil {
+		return fmt.Errorf("key %q cannot sign and cannot be primary", thumbprint)
+	}
+
+	store.primary = thumbprint
+	return nil
+}
+
+// Retire removes a key from the store, the primary has to be replaced first
+func (store *KeyStore) Retire(thumbprint string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.entries[thumbprint]; !ok {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, thumbprint)
+	}
+	if thumbprint == store.primary {
+		return fmt.Errorf("%w, promote another key before retiring %q", ErrPrimaryKey, thumbprint)
+	}
+
+	delete(store.entries, thumbprint)
+	return nil
+}
+
+// Candidates returns the keys to try for a token: the one matching the kid first, then every other key
+func (store *KeyStore) Candidates(kid string) []PrivateKeyEntry {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	// Every thumbprint is compared with kid in constant time instead of looking kid up in the map
+	candidates := make([]PrivateKeyEntry, 0, len(store.entries))
+	others := make([]PrivateKeyEntry, 0, len(store.entries))
+	for _, thumbprint := range store.thumbprints() {
+		if ThumbprintsEqual(thumbprint, kid) {
+			candidates = append(candidates, store.entries[thumbprint])
+		} else {
+			others = append(others, store.entries[thumbprint])
+		}
+	}
+	return append(candidates, others...)
+}
+
+// Thumbprints lists the registered keys in a stable order and names the primary
+func (store *KeyStore) Thumbprints() ([]string, string) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.thumbprints(), store.primary
+}
+
+// PublicKeyPEMs exports the public keys of the registered keys as PEM, in the order of their thumbprints
+func (store *KeyStore) PublicKeyPEMs() ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	thumbprints := store.thumbprints()
+	publicKeyPEMs := make([]string, len(thumbprints))
+	for i, thumbprint := range thumbprints {
+		publicKeyPEM, err := ExportPublicKeyAsPEM(store.entries[thumbprint].PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		publicKeyPEMs[i] = publicKeyPEM
+	}
+	return publicKeyPEMs, nil
+}
+
+func (store *KeyStore) thumbprints() []string {
+	thumbprints := make([]string, 0, len(store.entries))
+	for thumbprint := range store.entries {
+		thumbprints = append(thumbprints, thumbprint)
+	}
+	sort.Strings(thumbprints)
+	return thumbprints
+}
+
+// LoadKeyStoreFromDir registers every *.pem private key in the directory in a new store,
+// the first one able to sign in file name order becomes the primary
+func LoadKeyStoreFromDir(dir string) (*KeyStore, error) {
+	return LoadKeyStore(context.Background(), NewFileKeyProvider(dir))
+}
+
+// Replace swaps in the keys of the loaded store at once, replacing every registered key.
+// Requests already holding entries keep using them, lookups after the swap only see the new keys.
+// The primary stays when it is still among the loaded keys, otherwise the loaded primary takes over.
+func (store *KeyStore) Replace(loaded *KeyStore) {
+	loaded.mutex.RLock()
+	entries := make(map[string]PrivateKeyEntry, len(loaded.entries))
+	for thumbprint, entry := range loaded.entries {
+		entries[thumbprint] = entry
+	}
+	primary := loaded.primary
+	loaded.mutex.RUnlock()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if entry, ok := entries[store.primary]; ok && entry.Signer != nil {
+		primary = store.primary
+	}
+	store.entries, store.primary = entries, primary
+}
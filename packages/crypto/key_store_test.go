@@ -0,0 +1,248 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestKeyStoreDecryptsDuringOverlapWindow(t *testing.T) {
+	store := NewKeyStore()
+
+	register := func() PrivateKeyEntry {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := store.Register(privateKey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	oldKey := register()
+	if primary, _ := store.Primary(); primary.Thumbprint != oldKey.Thumbprint {
+		t.Fatalf("expected the first key to become primary")
+	}
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: oldKey.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("issued before rotation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate: the new key becomes primary while the old one stays registered
+	newKey := register()
+	if err := store.SetPrimary(newKey.Thumbprint); err != nil {
+		t.Fatal(err)
+	}
+
+	decrypt := func(kid string) error {
+		parsed, err := jose.ParseEncrypted(token, []jose.KeyAlgorithm{jose.RSA_OAEP_256}, []jose.ContentEncryption{jose.A256GCM})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, candidate := range store.Candidates(kid) {
+			if _, err := parsed.Decrypt(candidate.PrivateKey); err == nil {
+				return nil
+			}
+		}
+		return errors.New("no candidate decrypted the token")
+	}
+
+	// The new primary comes first for its own kid, the old key still decrypts the token
+	if candidates := store.Candidates(newKey.Thumbprint); len(candidates) != 2 || candidates[0].Thumbprint != newKey.Thumbprint {
+		t.Fatalf("expected the matching key first among both candidates, got %d", len(candidates))
+	}
+	if err := decrypt(newKey.Thumbprint); err != nil {
+		t.Fatalf("expected the old key to decrypt during the overlap window: %v", err)
+	}
+
+	if err := store.Retire(newKey.Thumbprint); !errors.Is(err, ErrPrimaryKey) {
+		t.Fatalf("expected retiring the primary to fail, got %v", err)
+	}
+
+	// Once retired the old key is gone and its tokens no longer decrypt
+	if err := store.Retire(oldKey.Thumbprint); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get(oldKey.Thumbprint); ok {
+		t.Fatalf("expected the retired key to be removed")
+	}
+	if err := decrypt(oldKey.Thumbprint); err == nil {
+		t.Fatalf("expected the token to stop decrypting after the old key was retired")
+	}
+}
+
+func TestKeyStoreReplaceSwapsAtomically(t *testing.T) {
+	// Two directories of two keys each, the store is reloaded from one then the other
+	load := func(name string) (*KeyStore, map[string]bool) {
+		dir := filepath.Join(t.TempDir(), name)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("key%d.pem", i)), data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		loaded, err := LoadKeyStoreFromDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		thumbprints, primary := loaded.Thumbprints()
+		if len(thumbprints) != 2 || primary == "" {
+			t.Fatalf("expected both keys loaded with a primary, got %d", len(thumbprints))
+		}
+		set := make(map[string]bool)
+		for _, thumbprint := range thumbprints {
+			set[thumbprint] = true
+		}
+		return loaded, set
+	}
+	first, firstSet := load("first")
+	second, secondSet := load("second")
+
+	store := NewKeyStore()
+	store.Replace(first)
+
+	// An entry taken before a swap stays usable, as it would for a request in flight
+	inFlight, _ := store.Primary()
+
+	// Readers must always see one whole set, never a mix of both or an empty store
+	stop := make(chan struct{})
+	failures := make(chan string, 1)
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				candidates := store.Candidates("")
+				inFirst, inSecond := 0, 0
+				for _, candidate := range candidates {
+					if firstSet[candidate.Thumbprint] {
+						inFirst++
+					}
+					if secondSet[candidate.Thumbprint] {
+						inSecond++
+					}
+				}
+				if len(candidates) != 2 || (inFirst != 2 && inSecond != 2) {
+					select {
+					case failures <- fmt.Sprintf("saw %d keys, %d from the first set and %d from the second", len(candidates), inFirst, inSecond):
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		if i%2 == 0 {
+			store.Replace(second)
+		} else {
+			store.Replace(first)
+		}
+	}
+	close(stop)
+	readers.Wait()
+	select {
+	case failure := <-failures:
+		t.Fatal(failure)
+	default:
+	}
+
+	// The last swap installed the first set, so its primary is back, the second set is gone
+	if primary, ok := store.Primary(); !ok || !firstSet[primary.Thumbprint] {
+		t.Fatalf("expected a primary from the first set after the last reload")
+	}
+	store.Replace(second)
+	for thumbprint := range firstSet {
+		if _, ok := store.Get(thumbprint); ok {
+			t.Fatalf("expected the reload to drop keys missing from the directory")
+		}
+	}
+	if _, err := inFlight.Signer.Sign([]byte("still in flight")); err != nil {
+		t.Fatalf("expected an entry held across the swap to keep working: %v", err)
+	}
+}
+
+func TestKeyStoreRestrictsKeysToTheirAlgorithms(t *testing.T) {
+	store := NewKeyStore()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.RegisterKey(Key{PrivateKey: privateKey, Algorithms: []string{"RSA-OAEP-999"}}); err == nil {
+		t.Fatal("expected an unknown algorithm restriction to be refused")
+	}
+
+	entry, err := store.RegisterKey(Key{PrivateKey: privateKey, Algorithms: []string{"RSA-OAEP-256"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entry.CheckAlgorithm("RSA-OAEP-256"); err != nil {
+		t.Fatalf("expected the declared algorithm to be allowed, got %v", err)
+	}
+	for _, algorithm := range []string{"RSA-OAEP", "RS256"} {
+		if err := entry.CheckAlgorithm(algorithm); !errors.Is(err, ErrAlgorithmNotAllowed) {
+			t.Fatalf("expected %s to be refused, got %v", algorithm, err)
+		}
+	}
+	// An encryption only key cannot sign, so it never becomes the primary
+	if entry.Signer != nil {
+		t.Fatal("expected a key restricted to RSA-OAEP-256 to have no signer")
+	}
+	if _, ok := store.Primary(); ok {
+		t.Fatal("expected no primary without a key able to sign")
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrestricted, err := store.Register(otherKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, algorithm := range []string{"ECDH-ES+A256KW", "ES256"} {
+		if err := unrestricted.CheckAlgorithm(algorithm); err != nil {
+			t.Fatalf("expected a key without restriction to allow %s, got %v", algorithm, err)
+		}
+	}
+}
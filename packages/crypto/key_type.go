@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+)
+
+// KeyType identifies the kind of public key that was imported
+type KeyType int
+
+const (
+	KeyTypeRSA KeyType = iota
+	KeyTypeEC
+	// Ed25519 and X25519 are both OKP keys, one only signs and the other only does key agreement
+	KeyTypeEd25519
+	KeyTypeX25519
+)
+
+// String returns the JWK "kty" name of the key type
+func (keyType KeyType) String() string {
+	switch keyType {
+	case KeyTypeRSA:
+		return "RSA"
+	case KeyTypeEC:
+		return "EC"
+	case KeyTypeEd25519, KeyTypeX25519:
+		return "OKP"
+	default:
+		return "unknown"
+	}
+}
+
+// KeySize returns the size in bits of an asymmetric key, the RSA modulus or the curve, 0 for anything else
+func KeySize(key interface{}) int {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *rsa.PrivateKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	case *ecdsa.PrivateKey:
+		return key.Curve.Params().BitSize
+	case *ecdh.PublicKey:
+		return ecdhKeySize(key.Curve())
+	case *ecdh.PrivateKey:
+		return ecdhKeySize(key.Curve())
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		return 256
+	}
+	return 0
+}
+
+func ecdhKeySize(curve ecdh.Curve) int {
+	switch curve {
+	case ecdh.P384():
+		return 384
+	case ecdh.P521():
+		return 521
+	}
+	return 256 // P-256 and X25519
+}
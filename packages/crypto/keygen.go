@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+)
+
+// KeyPair holds a freshly generated key pair and its PEM encodings
+type KeyPair struct {
+	PublicKey     interface{}
+	PublicKeyPem  string
+	PrivateKeyPem string
+}
+
+// Allowed RSA modulus sizes, anything below 2048 bits is considered weak
+var allowedRSAKeySizes = map[int]bool{
+	2048: true,
+	3072: true,
+	4096: true,
+}
+
+// Supported EC curves by their JWK "crv" name
+var allowedECCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// SupportedCurves lists the JWK "crv" names of the EC and OKP keys the endpoints accept
+var SupportedCurves = []string{"P-256", "P-384", "P-521", X25519Curve, Ed25519Curve}
+
+// GenerateRSAKeyPair generates an RSA key pair and encodes it as PKIX PEM and the private key format, PKCS#8 when empty
+func GenerateRSAKeyPair(bits int, privateKeyFormat string) (KeyPair, error) {
+	if !allowedRSAKeySizes[bits] {
+		return KeyPair{}, fmt.Errorf("unsupported RSA key size %d, allowed sizes are 2048, 3072 and 4096", bits)
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to generate RSA key: %v", err)
+	}
+
+	publicKeyPem, err := ExportRSAPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	privateKeyPem, err := ExportPrivateKeyAsPEMFormat(privateKey, privateKeyFormat)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{
+		PublicKey:     &privateKey.PublicKey,
+		PublicKeyPem:  publicKeyPem,
+		PrivateKeyPem: privateKeyPem,
+	}, nil
+}
+
+// GenerateECKeyPair generates an EC key pair on the named curve and encodes it as PKIX/PKCS#8 PEM
+func GenerateECKeyPair(curve string) (KeyPair, error) {
+	ellipticCurve, ok := allowedECCurves[curve]
+	if !ok {
+		return KeyPair{}, fmt.Errorf("unsupported EC curve %q, allowed curves are P-256, P-384 and P-521", curve)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(ellipticCurve, rand.Reader)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to generate EC key: %v", err)
+	}
+
+	publicKeyPem, err := ExportECPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	privateKeyPem, err := ExportECPrivateKeyAsPEM(privateKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{
+		PublicKey:     &privateKey.PublicKey,
+		PublicKeyPem:  publicKeyPem,
+		PrivateKeyPem: privateKeyPem,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// JWK curve names of the OKP keys
+const (
+	Ed25519Curve = "Ed25519"
+	X25519Curve  = "X25519"
+)
+
+// ImportOKPPublicKeyFromPEM imports an Ed25519 or X25519 public key from PEM format and reports which type it is
+func ImportOKPPublicKeyFromPEM(publicKeyPEM string) (interface{}, KeyType, error) {
+	pub, err := parsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keyType, ok := okpKeyType(pub)
+	if !ok {
+		return nil, 0, fmt.Errorf("not an Ed25519 or X25519 public key")
+	}
+	return pub, keyType, nil
+}
+
+// okpKeyType reports whether the public key is an Ed25519 or X25519 key
+func okpKeyType(publicKey interface{}) (KeyType, bool) {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return KeyTypeEd25519, true
+	case *ecdh.PublicKey:
+		// crypto/ecdh also covers the NIST curves, those are handled as EC keys through crypto/ecdsa
+		return KeyTypeX25519, key.Curve() == ecdh.X25519()
+	default:
+		return 0, false
+	}
+}
+
+// okpMembers holds the JWK members needed to tell OKP keys apart before go-jose parses them
+type okpMembers struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Use     string `json:"use"`
+}
+
+// importX25519JWK parses an X25519 JWK, which go-jose rejects as an unknown curve
+func importX25519JWK(members okpMembers) (*ecdh.PublicKey, error) {
+	if members.Use != "" && members.Use != "enc" {
+		return nil, fmt.Errorf("X25519 keys are only used for key agreement, got use %q", members.Use)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(members.X)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the X25519 public key: %v", err)
+	}
+
+	publicKey, err := ecdh.X25519().NewPublicKey(x)
+	if err != nil {
+		return nil, fmt.Errorf("invalid X25519 public key: %v", err)
+	}
+	return publicKey, nil
+}
+
+// x25519ThumbprintInput returns the RFC 7638 thumbprint input of an X25519 key, go-jose only covers Ed25519
+func x25519ThumbprintInput(publicKey *ecdh.PublicKey) string {
+	input, _ := json.Marshal(map[string]string{
+		"crv": X25519Curve,
+		"kty": "OKP",
+		"x":   base64.RawURLEncoding.EncodeToString(publicKey.Bytes()),
+	})
+	return string(input)
+}
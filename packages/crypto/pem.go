@@ -1,6 +1,9 @@
 package crypto
 
 import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -8,6 +11,15 @@ import (
 	"strings"
 )
 
+// MinRSAKeyBits is the smallest RSA modulus accepted when importing a key
+var MinRSAKeyBits = 2048
+
+// Encodings of exported private keys, PKCS#8 by default, PKCS#1 for older tooling that only reads RSA PRIVATE KEY blocks
+const (
+	PrivateKeyFormatPKCS8 = "pkcs8"
+	PrivateKeyFormatPKCS1 = "pkcs1"
+)
+
 // Export the RSA public key to PEM format
 func ExportRSAPublicKeyAsPEM(publicKey *rsa.PublicKey) (string, error) {
 	pubASN1, err := x509.MarshalPKIXPublicKey(publicKey)
@@ -21,18 +33,105 @@ func ExportRSAPublicKeyAsPEM(publicKey *rsa.PublicKey) (string, error) {
 	return string(pubPEM), nil
 }
 
-// ImportRSAPublicKeyFromCertificatePEM extracts the RSA public key from a PEM-encoded certificate.
-func ImportRSAPublicKeyFromCertificatePEM(certificatePEM string) (*rsa.PublicKey, error) {
-	// Decode the PEM block
-	block, _ := pem.Decode([]byte(addPEMHeaders(certificatePEM, "CERTIFICATE")))
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block")
+// Export an RSA, EC or OKP public key to PEM format
+func ExportPublicKeyAsPEM(publicKey interface{}) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return ExportRSAPublicKeyAsPEM(key)
+	case *ecdsa.PublicKey:
+		return ExportECPublicKeyAsPEM(key)
+	case ed25519.PublicKey, *ecdh.PublicKey:
+		pubASN1, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return "", fmt.Errorf("error marshalling public key to ASN.1: %v", err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubASN1})), nil
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// Export the RSA private key to PKCS#8 PEM format
+func ExportRSAPrivateKeyAsPEM(privateKey *rsa.PrivateKey) (string, error) {
+	privDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling private key to PKCS#8: %v", err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privDER,
+	})
+	return string(privPEM), nil
+}
+
+// Export the RSA private key to PKCS#1 PEM format
+func ExportRSAPrivateKeyAsPKCS1PEM(privateKey *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}))
+}
+
+// Export the EC public key to PEM format
+func ExportECPublicKeyAsPEM(publicKey *ecdsa.PublicKey) (string, error) {
+	pubASN1, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling public key to ASN.1: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubASN1,
+	})
+	return string(pubPEM), nil
+}
+
+// Export the EC private key to PKCS#8 PEM format
+func ExportECPrivateKeyAsPEM(privateKey *ecdsa.PrivateKey) (string, error) {
+	privDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling private key to PKCS#8: %v", err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privDER,
+	})
+	return string(privPEM), nil
+}
+
+// Export an RSA or EC private key to PKCS#8 PEM format
+func ExportPrivateKeyAsPEM(privateKey interface{}) (string, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return ExportRSAPrivateKeyAsPEM(key)
+	case *ecdsa.PrivateKey:
+		return ExportECPrivateKeyAsPEM(key)
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+}
+
+// ExportPrivateKeyAsPEMFormat exports an RSA or EC private key in the named format, an empty one is PKCS#8.
+// PKCS#1 only holds RSA keys.
+func ExportPrivateKeyAsPEMFormat(privateKey interface{}, format string) (string, error) {
+	switch format {
+	case "", PrivateKeyFormatPKCS8:
+		return ExportPrivateKeyAsPEM(privateKey)
+	case PrivateKeyFormatPKCS1:
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("PKCS#1 only holds RSA keys, got %T", privateKey)
+		}
+		return ExportRSAPrivateKeyAsPKCS1PEM(rsaKey), nil
+	default:
+		return "", fmt.Errorf("unsupported private key format %q, use pkcs8 or pkcs1", format)
 	}
+}
 
-	// Parse the certificate from the decoded block
-	cert, err := x509.ParseCertificate(block.Bytes)
+// ImportRSAPublicKeyFromCertificatePEM extracts the RSA public key from a PEM-encoded certificate.
+func ImportRSAPublicKeyFromCertificatePEM(certificatePEM string) (*rsa.PublicKey, error) {
+	cert, err := ParseCertificatePEM(certificatePEM)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		return nil, err
 	}
 
 	// Extract the public key from the certificate and assert it as RSA
@@ -41,19 +140,18 @@ func ImportRSAPublicKeyFromCertificatePEM(certificatePEM string) (*rsa.PublicKey
 		return nil, fmt.Errorf("certificate does not contain an RSA public key")
 	}
 
+	if err := checkRSAKeySize(pubKey); err != nil {
+		return nil, err
+	}
+
 	return pubKey, nil
 }
 
 // Import the RSA public key from PEM format
 func ImportRSAPublicKeyFromPEM(publicKeyPEM string) (*rsa.PublicKey, error) {
-	block, _ := pem.Decode([]byte(addPEMHeaders(publicKeyPEM, "PUBLIC KEY")))
-	if block == nil || block.Type != "PUBLIC KEY" {
-		return nil, fmt.Errorf("failed to decode PEM block")
-	}
-
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	pub, err := parsePublicKeyPEM(publicKeyPEM)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %v", err)
+		return nil, err
 	}
 
 	// Verify that the key is an RSA public key
@@ -62,9 +160,228 @@ func ImportRSAPublicKeyFromPEM(publicKeyPEM string) (*rsa.PublicKey, error) {
 		return nil, fmt.Errorf("not an RSA public key")
 	}
 
+	if err := checkRSAKeySize(rsaPub); err != nil {
+		return nil, err
+	}
+
 	return rsaPub, nil
 }
 
+// Import the EC public key from PEM format
+func ImportECPublicKeyFromPEM(publicKeyPEM string) (*ecdsa.PublicKey, error) {
+	pub, err := parsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify that the key is an EC public key
+	ecPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an EC public key")
+	}
+
+	return ecPub, nil
+}
+
+// ImportPublicKeyFromPEM imports an RSA, EC or OKP public key from PEM format and reports which type it is
+func ImportPublicKeyFromPEM(publicKeyPEM string) (interface{}, KeyType, error) {
+	pub, err := parsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if err := checkRSAKeySize(key); err != nil {
+			return nil, 0, err
+		}
+		return key, KeyTypeRSA, nil
+	case *ecdsa.PublicKey:
+		return key, KeyTypeEC, nil
+	}
+
+	if keyType, ok := okpKeyType(pub); ok {
+		return pub, keyType, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+func parsePublicKeyPEM(publicKeyPEM string) (interface{}, error) {
+	block, err := decodePEMBlock(publicKeyPEM, "PUBLIC KEY", "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil && isBarePEM(publicKeyPEM) {
+		// Without a block type PKIX can't be told from the PKCS#1 older RSA tooling writes, both are tried
+		if rsaPub, pkcs1Err := x509.ParsePKCS1PublicKey(block.Bytes); pkcs1Err == nil {
+			return rsaPub, nil
+		}
+		return nil, fmt.Errorf("failed to parse public key, the base64 DER is neither a PKIX nor a PKCS#1 public key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	return pub, nil
+}
+
+// Import the RSA private key from PEM format (PKCS#1 or PKCS#8)
+func ImportRSAPrivateKeyFromPEM(privateKeyPEM string) (*rsa.PrivateKey, error) {
+	priv, _, err := ImportPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify that the key is an RSA private key
+	rsaPriv, ok := priv.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA private key")
+	}
+	return rsaPriv, nil
+}
+
+// ImportPrivateKeyFromPEM imports an RSA, EC or OKP private key (PKCS#1, SEC 1 or PKCS#8) and reports which type it is
+func ImportPrivateKeyFromPEM(privateKeyPEM string) (interface{}, KeyType, error) {
+	block, err := decodePEMBlock(privateKeyPEM, "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY")
+	if err != nil {
+		return nil, 0, err
+	}
+	return importPrivateKeyBlock(block)
+}
+
+// importPrivateKeyBlock parses the DER of a private key block and zeroes it, the parsed key holds its own copy
+func importPrivateKeyBlock(block *pem.Block) (interface{}, KeyType, error) {
+	defer Zero(block.Bytes)
+
+	var priv interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		if priv, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, 0, fmt.Errorf("failed to parse PKCS#1 private key: %v", err)
+		}
+	case "EC PRIVATE KEY":
+		if priv, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, 0, fmt.Errorf("failed to parse SEC 1 private key: %v", err)
+		}
+	case "PRIVATE KEY":
+		if priv, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			return nil, 0, fmt.Errorf("failed to parse PKCS#8 private key: %v", err)
+		}
+	}
+
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		return precomputeRSAKey(key), KeyTypeRSA, nil
+	case *ecdsa.PrivateKey:
+		return key, KeyTypeEC, nil
+	case ed25519.PrivateKey:
+		return key, KeyTypeEd25519, nil
+	case *ecdh.PrivateKey:
+		if key.Curve() == ecdh.X25519() {
+			return key, KeyTypeX25519, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("unsupported private key type %T", priv)
+}
+
+// ImportKeyFromPEM imports a single RSA or EC key, public or private, for format conversion.
+// The block type decides which one it is, so bare base64 and bundles of several blocks are rejected.
+func ImportKeyFromPEM(keyPEM string) (key interface{}, private bool, err error) {
+	keyPEM = NormalizePEM(keyPEM)
+	block, rest := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, false, fmt.Errorf("failed to decode PEM block, the BEGIN and END lines are required")
+	}
+	if next, _ := pem.Decode(rest); next != nil {
+		return nil, false, fmt.Errorf("expected a single PEM block, got %s followed by %s", block.Type, next.Type)
+	}
+
+	var keyType KeyType
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, keyType, err = ImportPublicKeyFromPEM(keyPEM)
+	case "RSA PRIVATE KEY", "EC PRIVATE KEY", "PRIVATE KEY":
+		private = true
+		if key, keyType, err = ImportPrivateKeyFromPEM(keyPEM); err == nil && keyType == KeyTypeRSA {
+			err = checkRSAKeySize(&key.(*rsa.PrivateKey).PublicKey)
+		}
+	default:
+		return nil, false, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if keyType != KeyTypeRSA && keyType != KeyTypeEC {
+		return nil, false, fmt.Errorf("only RSA and EC keys can be converted, got %s", keyType)
+	}
+	return key, private, nil
+}
+
+// checkRSAKeySize rejects RSA keys with a modulus smaller than MinRSAKeyBits
+func checkRSAKeySize(publicKey *rsa.PublicKey) error {
+	if bits := publicKey.N.BitLen(); bits < MinRSAKeyBits {
+		return fmt.Errorf("RSA key is %d bits, at least %d bits are required", bits, MinRSAKeyBits)
+	}
+	return nil
+}
+
+// decodePEMBlock returns the first block of one of the types, skipping unrelated blocks such as a certificate
+// bundled with a key. Input without any BEGIN line is taken as bare base64 of defaultType.
+func decodePEMBlock(input, defaultType string, types ...string) (*pem.Block, error) {
+	input = NormalizePEM(input)
+	bare := isBarePEM(input)
+	if bare {
+		input = addPEMHeaders(input, defaultType)
+	}
+
+	var skipped []string
+	for rest := []byte(input); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		for _, blockType := range types {
+			if block.Type == blockType {
+				return block, nil
+			}
+		}
+		skipped = append(skipped, block.Type)
+	}
+
+	if len(skipped) == 0 && bare {
+		return nil, fmt.Errorf("failed to decode PEM block, the input has no BEGIN line and is not base64 DER either")
+	}
+	if len(skipped) == 0 {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+	wanted := types[len(types)-1]
+	if len(types) > 1 {
+		wanted = strings.Join(types[:len(types)-1], ", ") + " or " + wanted
+	}
+	return nil, fmt.Errorf("no %s block found, the PEM only holds %s", wanted, strings.Join(skipped, ", "))
+}
+
+// isBarePEM reports whether the input is base64 DER without the BEGIN and END lines
+func isBarePEM(input string) bool {
+	return !strings.Contains(input, "-----BEGIN")
+}
+
+// NormalizePEM turns CRLF and lone CR line endings into LF and trims the whitespace around the input and
+// each of its lines. pem.Decode wants the BEGIN line at the start of a line, so keys pasted from Windows tools,
+// indented in YAML or preceded by a blank line would not decode otherwise.
+func NormalizePEM(input string) string {
+	input = strings.ReplaceAll(input, "\r\n", "\n")
+	input = strings.ReplaceAll(input, "\r", "\n")
+	lines := strings.Split(strings.TrimSpace(input), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
 func addPEMHeaders(pem, pemType string) string {
 	beginHeader := fmt.Sprintf("-----BEGIN %s-----", pemType)
 	endHeader := fmt.Sprintf("-----END %s-----", pemType)
@@ -0,0 +1,38 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ImportFromPKCS12 decodes a password protected PKCS#12 file into its private key and certificate.
+// Both the modern PBES2/AES and the legacy RC2/3DES encryption schemes are accepted.
+func ImportFromPKCS12(data []byte, password string) (interface{}, *x509.Certificate, error) {
+	privateKey, certificate, _, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode PKCS#12 file: %v", err)
+	}
+
+	// The certificate must belong to the private key, a mismatched bundle is rejected
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if err := checkRSAKeySize(&key.PublicKey); err != nil {
+			return nil, nil, err
+		}
+		if !key.PublicKey.Equal(certificate.PublicKey) {
+			return nil, nil, fmt.Errorf("certificate does not match the private key")
+		}
+		precomputeRSAKey(key)
+	case *ecdsa.PrivateKey:
+		if !key.PublicKey.Equal(certificate.PublicKey) {
+			return nil, nil, fmt.Errorf("certificate does not match the private key")
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	return privateKey, certificate, nil
+}
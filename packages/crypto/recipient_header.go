@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidateRecipientHeaders rejects per-recipient headers that are reserved or already protected, the header
+// names of a JWE must be disjoint. kid is allowed, it replaces the thumbprint the recipient is tagged with.
+func ValidateRecipientHeaders(headers map[string]string, protected map[string]interface{}) error {
+	for name := range headers {
+		switch {
+		case name == "kid":
+		case name == CriticalHeader:
+			return errors.New("crit must be a protected header")
+		case reservedHeaders[name]:
+			return fmt.Errorf("recipient header %q is reserved and cannot be set", name)
+		case protected[name] != nil:
+			return fmt.Errorf("recipient header %q is already a protected header", name)
+		}
+	}
+	return nil
+}
+
+// AddRecipientHeaders merges the headers into the unprotected header of each recipient of a JSON serialized JWE,
+// the flattened serialization holds its single recipient header at the top level. Unprotected headers are not
+// covered by the tag, so they can be added once the token is encrypted.
+func AddRecipientHeaders(serialized string, headers []map[string]string) (string, error) {
+	members, err := jweMembers(serialized)
+	if err != nil {
+		return "", err
+	}
+
+	var recipients []map[string]json.RawMessage
+	if raw, ok := members["recipients"]; ok {
+		if err := json.Unmarshal(raw, &recipients); err != nil {
+			return "", fmt.Errorf("failed to parse JWE recipients: %v", err)
+		}
+	} else {
+		recipients = []map[string]json.RawMessage{members}
+	}
+	if len(recipients) != len(headers) {
+		return "", fmt.Errorf("JWE has %d recipients, got headers for %d", len(recipients), len(headers))
+	}
+
+	for i, recipient := range recipients {
+		if len(headers[i]) == 0 {
+			continue
+		}
+		header := map[string]interface{}{}
+		if raw, ok := recipient["header"]; ok {
+			if err := json.Unmarshal(raw, &header); err != nil {
+				return "", fmt.Errorf("failed to parse recipient %d header: %v", i, err)
+			}
+		}
+		for name, value := range headers[i] {
+			header[name] = value
+		}
+		if recipient["header"], err = json.Marshal(header); err != nil {
+			return "", err
+		}
+	}
+	if _, ok := members["recipients"]; ok {
+		if members["recipients"], err = json.Marshal(recipients); err != nil {
+			return "", err
+		}
+	}
+
+	merged, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+// RecipientHeader returns the unprotected header of the recipient at index, nil for compact tokens which have none
+func RecipientHeader(serialized string, index int) (map[string]interface{}, error) {
+	if serialized = strings.TrimSpace(serialized); !strings.HasPrefix(serialized, "{") {
+		return nil, nil
+	}
+	members, err := jweMembers(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	var header map[string]interface{}
+	if raw, ok := members["recipients"]; ok {
+		var recipients []struct {
+			Header map[string]interface{} `json:"header"`
+		}
+		if err := json.Unmarshal(raw, &recipients); err != nil {
+			return nil, fmt.Errorf("failed to parse JWE recipients: %v", err)
+		}
+		if index < 0 || index >= len(recipients) {
+			return nil, fmt.Errorf("JWE has no recipient %d", index)
+		}
+		return recipients[index].Header, nil
+	}
+	if raw, ok := members["header"]; ok {
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return nil, fmt.Errorf("failed to parse recipient header: %v", err)
+		}
+	}
+	return header, nil
+}
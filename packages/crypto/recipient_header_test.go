@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func TestAddRecipientHeaders(t *testing.T) {
+	var keys [2]*rsa.PrivateKey
+	var recipients []jose.Recipient
+	for i := range keys {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = privateKey
+		recipients = append(recipients, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey, KeyID: "key-" + string(rune('a'+i))})
+	}
+	encrypter, err := jose.NewMultiEncrypter(jose.A256GCM, recipients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("to both"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serialized, err := AddRecipientHeaders(jwe.FullSerialize(), []map[string]string{nil, {"x-route": "eu"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The headers sit outside the tag, the token still decrypts
+	parsed, err := jose.ParseEncryptedJSON(serialized, []jose.KeyAlgorithm{jose.RSA_OAEP_256}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := DecryptRecipient(serialized, parsed, keys[1])
+	if err != nil || string(recipient.Plaintext) != "to both" {
+		t.Fatalf("expected the token to decrypt, got %q %v", recipient.Plaintext, err)
+	}
+
+	header, err := RecipientHeader(serialized, recipient.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header["x-route"] != "eu" || header["kid"] != "key-b" || header["alg"] != string(jose.RSA_OAEP_256) {
+		t.Fatalf("unexpected recipient header %v", header)
+	}
+	if header, _ := RecipientHeader(serialized, 0); header["x-route"] != nil {
+		t.Fatalf("expected the first recipient to keep its header, got %v", header)
+	}
+
+	protected := map[string]interface{}{"cty": "JWT"}
+	for name, allowed := range map[string]bool{"kid": true, "x-route": true, "cty": false, "alg": false, "crit": false} {
+		if err := ValidateRecipientHeaders(map[string]string{name: "value"}, protected); (err == nil) != allowed {
+			t.Fatalf("recipient header %q: expected allowed=%v, got %v", name, allowed, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jwe-go/packages/clock"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayCache remembers the tokens already decrypted. The memory cache serves a single instance,
+// a shared store such as Redis can implement the interface to catch replays across instances.
+type ReplayCache interface {
+	// Seen records the digest for ttl and reports whether it was already recorded within its ttl
+	Seen(digest string, ttl time.Duration) bool
+}
+
+// ReplayDigest identifies a token by its IV, ciphertext and tag, which the tag authenticates.
+// Both serializations of a token give the same digest, so switching between them is still a replay.
+func ReplayDigest(serialized string) (string, error) {
+	var segments [3]string
+	if serialized = strings.TrimSpace(serialized); strings.HasPrefix(serialized, "{") {
+		var members struct {
+			IV         string `json:"iv"`
+			Ciphertext string `json:"ciphertext"`
+			Tag        string `json:"tag"`
+		}
+		if err := json.Unmarshal([]byte(serialized), &members); err != nil {
+			return "", fmt.Errorf("failed to parse JWE: %v", err)
+		}
+		segments = [3]string{members.IV, members.Ciphertext, members.Tag}
+	} else {
+		parts := strings.Split(serialized, ".")
+		if len(parts) != 5 {
+			return "", errors.New("compact JWE must have 5 segments")
+		}
+		segments = [3]string{parts[2], parts[3], parts[4]}
+	}
+
+	// The decoded bytes are hashed, base64 variants of the same segment decode alike
+	digest := sha256.New()
+	for _, segment := range segments {
+		decoded, err := base64.RawURLEncoding.DecodeString(segment)
+		if err != nil {
+			return "", fmt.Errorf("invalid JWE segment: %v", err)
+		}
+		fmt.Fprintf(digest, "%d:", len(decoded))
+		digest.Write(decoded)
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// MemoryReplayCache keeps the digests in process memory, expired ones are dropped periodically
+type MemoryReplayCache struct {
+	mutex     sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryReplayCache creates an empty in-memory cache
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{expires: make(map[string]time.Time), lastSweep: clock.Now()}
+}
+
+// Replays is the cache used by the decrypt endpoints
+var Replays ReplayCache = NewMemoryReplayCache()
+
+// replaySweepInterval is how often expired digests are removed
+const replaySweepInterval = time.Minute
+
+func (cache *MemoryReplayCache) Seen(digest string, ttl time.Duration) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := clock.Now()
+	if now.Sub(cache.lastSweep) >= replaySweepInterval {
+		for key, expires := range cache.expires {
+			if !now.Before(expires) {
+				delete(cache.expires, key)
+			}
+		}
+		cache.lastSweep = now
+	}
+
+	if expires, ok := cache.expires[digest]; ok && now.Before(expires) {
+		return true
+	}
+	cache.expires[digest] = now.Add(ttl)
+	return false
+}
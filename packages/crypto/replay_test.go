@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/clock"
+	"testing"
+	"time"
+)
+
+func TestReplayDigestIgnoresSerialization(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwe, err := encrypter.Encrypt([]byte("one time"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compactDigest, err := ReplayDigest(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonDigest, err := ReplayDigest(jwe.FullSerialize()); err != nil || jsonDigest != compactDigest {
+		t.Fatalf("expected both serializations to give the same digest, got %q and %q, %v", compactDigest, jsonDigest, err)
+	}
+
+	other, err := encrypter.Encrypt([]byte("one time"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherDigest, err := ReplayDigest(other.FullSerialize()); err != nil || otherDigest == compactDigest {
+		t.Fatalf("expected a new encryption of the same plaintext to differ, got %v", err)
+	}
+
+	if _, err := ReplayDigest("a.b.c"); err == nil {
+		t.Fatalf("expected a malformed token to be rejected")
+	}
+}
+
+func TestMemoryReplayCacheExpires(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	defer func(previous clock.Clock) { clock.Current = previous }(clock.Current)
+	fake := clock.NewFake(start)
+	clock.Current = fake
+
+	cache := NewMemoryReplayCache()
+	if cache.Seen("token", time.Minute) {
+		t.Fatalf("expected the first use to pass")
+	}
+	if !cache.Seen("token", time.Minute) {
+		t.Fatalf("expected the second use to be a replay")
+	}
+
+	// Past the window the digest is forgotten and swept
+	fake.Set(start.Add(2 * time.Minute))
+	if cache.Seen("token", time.Minute) {
+		t.Fatalf("expected the token to be accepted after the window")
+	}
+	if len(cache.expires) != 1 {
+		t.Fatalf("expected the expired digest to be swept, %d left", len(cache.expires))
+	}
+}
@@ -0,0 +1,11 @@
+package crypto
+
+import "crypto/rsa"
+
+// precomputeRSAKey fills in the CRT values of an imported RSA private key. x509 parsing already does, but go-jose
+// leaves a JWK without dp, dq and qi as it is, and every decryption with it would redo the work from scratch.
+// Precompute is a no-op on a key that is already consistent.
+func precomputeRSAKey(key *rsa.PrivateKey) *rsa.PrivateKey {
+	key.Precompute()
+	return key
+}
@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func TestImportedRSAKeysArePrecomputed(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(value []byte) string { return base64.RawURLEncoding.EncodeToString(value) }
+
+	// A JWK may leave out dp, dq and qi, go-jose then returns a key without its CRT values
+	members, _ := json.Marshal(map[string]string{
+		"kty": "RSA",
+		"use": "enc",
+		"n":   encode(privateKey.N.Bytes()),
+		"e":   encode([]byte{1, 0, 1}),
+		"d":   encode(privateKey.D.Bytes()),
+		"p":   encode(privateKey.Primes[0].Bytes()),
+		"q":   encode(privateKey.Primes[1].Bytes()),
+	})
+	pkcs1PEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+	pkcs8PEM, err := ExportPrivateKeyAsPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported := map[string]func() (interface{}, KeyType, error){
+		"JWK without CRT values": func() (interface{}, KeyType, error) { return ImportPrivateKeyFromJWK(members) },
+		"PKCS#1 PEM":             func() (interface{}, KeyType, error) { return ImportPrivateKeyFromPEM(pkcs1PEM) },
+		"PKCS#8 PEM":             func() (interface{}, KeyType, error) { return ImportPrivateKeyFromPEM(pkcs8PEM) },
+	}
+	for name, importKey := range imported {
+		key, _, err := importKey()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		rsaKey := key.(*rsa.PrivateKey)
+		if rsaKey.Precomputed.Dp == nil || rsaKey.Precomputed.Dq == nil || rsaKey.Precomputed.Qinv == nil {
+			t.Fatalf("%s: expected the CRT values to be precomputed", name)
+		}
+		if err := rsaKey.Validate(); err != nil {
+			t.Fatalf("%s: expected a consistent key: %v", name, err)
+		}
+
+		// The critical header path unwraps the CEK itself, it has to work with the imported key
+		cek := bytes.Repeat([]byte{7}, 32)
+		encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &privateKey.PublicKey, cek, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unwrapped, err := unwrapContentKey(jose.RSA_OAEP_256, jose.A256GCM, jweRecipient{encryptedKey: encryptedKey}, rsaKey)
+		if err != nil || !bytes.Equal(unwrapped, cek) {
+			t.Fatalf("%s: expected the CEK back, got %x: %v", name, unwrapped, err)
+		}
+	}
+}
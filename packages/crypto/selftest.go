@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// Fixed plaintext round-tripped by SelfTest
+var selfTestPlaintext = []byte("jwe-go self-test")
+
+// SelfTest encrypts a fixed plaintext to an ephemeral key and decrypts it again, checking the round trip
+func SelfTest() error {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+
+	encrypter, err := jose.NewEncrypter(
+		DefaultContentEncryption,
+		jose.Recipient{Algorithm: DefaultKeyAlgorithm(KeyTypeEC), Key: &privateKey.PublicKey},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create encrypter: %v", err)
+	}
+
+	jwe, err := encrypter.Encrypt(selfTestPlaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt: %v", err)
+	}
+
+	serialized, err := jwe.CompactSerialize()
+	if err != nil {
+		return fmt.Errorf("failed to serialize: %v", err)
+	}
+
+	parsed, err := jose.ParseEncrypted(serialized, SupportedKeyAlgorithms, SupportedContentEncryptions)
+	if err != nil {
+		return fmt.Errorf("failed to parse: %v", err)
+	}
+
+	decrypted, err := parsed.Decrypt(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %v", err)
+	}
+
+	if !bytes.Equal(decrypted, selfTestPlaintext) {
+		return fmt.Errorf("decrypted plaintext does not match")
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"slices"
+	"strings"
+)
+
+// SupportedSignatureAlgorithms lists the JWS algorithms accepted by the sign endpoint
+var SupportedSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256,
+	jose.RS384,
+	jose.RS512,
+	jose.PS256,
+	jose.PS384,
+	jose.PS512,
+	jose.ES256,
+	jose.EdDSA,
+}
+
+// RegisteredSignatureAlgorithms lists every JWS algorithm go-jose parses, including those never verified here,
+// so a token naming one can be rejected for its algorithm rather than as malformed
+var RegisteredSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.HS256, jose.HS384, jose.HS512, jose.RS256, jose.RS384, jose.RS512,
+	jose.ES256, jose.ES384, jose.ES512, jose.PS256, jose.PS384, jose.PS512, jose.EdDSA,
+}
+
+// IsSignatureAlgorithm reports whether alg names a JWS algorithm from the registry, supported here or not
+func IsSignatureAlgorithm(alg string) bool {
+	switch jose.SignatureAlgorithm(alg) {
+	case jose.HS256, jose.HS384, jose.HS512, jose.RS256, jose.RS384, jose.RS512,
+		jose.ES256, jose.ES384, jose.ES512, jose.PS256, jose.PS384, jose.PS512, jose.EdDSA, "none":
+		return true
+	}
+	return false
+}
+
+// DefaultSignatureAlgorithm returns the JWS algorithm used for a key type when a request does not pick one
+func DefaultSignatureAlgorithm(keyType KeyType) jose.SignatureAlgorithm {
+	switch keyType {
+	case KeyTypeEC:
+		return jose.ES256
+	case KeyTypeEd25519:
+		return jose.EdDSA
+	default:
+		return jose.RS256
+	}
+}
+
+// ParseSignatureAlgorithm maps a JWS algorithm name to its jose value and checks it fits the key type
+func ParseSignatureAlgorithm(name string, keyType KeyType) (jose.SignatureAlgorithm, error) {
+	if keyType == KeyTypeX25519 {
+		return "", fmt.Errorf("X25519 keys can only be used for key agreement, use an Ed25519 key for EdDSA")
+	}
+
+	if name == "" {
+		return DefaultSignatureAlgorithm(keyType), nil
+	}
+
+	var signatureAlgorithm jose.SignatureAlgorithm
+	for _, alg := range SupportedSignatureAlgorithms {
+		if string(alg) == name {
+			signatureAlgorithm = alg
+		}
+	}
+	if signatureAlgorithm == "" {
+		supported := make([]string, len(SupportedSignatureAlgorithms))
+		for i, alg := range SupportedSignatureAlgorithms {
+			supported[i] = string(alg)
+		}
+		return "", fmt.Errorf("unsupported signature algorithm %q, supported values are: %s", name, strings.Join(supported, ", "))
+	}
+
+	switch signatureAlgorithm {
+	case jose.ES256:
+		if keyType != KeyTypeEC {
+			return "", fmt.Errorf("signature algorithm %s requires an EC key", signatureAlgorithm)
+		}
+	case jose.EdDSA:
+		if keyType != KeyTypeEd25519 {
+			return "", fmt.Errorf("signature algorithm %s requires an Ed25519 key", signatureAlgorithm)
+		}
+	default:
+		if keyType != KeyTypeRSA {
+			return "", fmt.Errorf("signature algorithm %s requires an RSA key", signatureAlgorithm)
+		}
+	}
+
+	return signatureAlgorithm, nil
+}
+
+// NewSigner creates a JWS signer for the private key, tagged with the public key thumbprint as kid
+func NewSigner(algorithm jose.SignatureAlgorithm, privateKey interface{}, options *jose.SignerOptions) (jose.Signer, error) {
+	signingKey, err := NewSigningKey(algorithm, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := jose.NewSigner(signingKey, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer: %v", err)
+	}
+
+	return signer, nil
+}
+
+// NewMultiSigner creates a JWS signer producing one signature per key over the same payload,
+// which only the JSON serialization can carry
+func NewMultiSigner(signingKeys []jose.SigningKey, options *jose.SignerOptions) (jose.Signer, error) {
+	signer, err := jose.NewMultiSigner(signingKeys, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer: %v", err)
+	}
+	return signer, nil
+}
+
+// NewSigningKey checks the private key fits the algorithm and tags it with the public key thumbprint as kid
+func NewSigningKey(algorithm jose.SignatureAlgorithm, privateKey interface{}) (jose.SigningKey, error) {
+	var publicKey interface{}
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if err := checkRSAKeySize(&key.PublicKey); err != nil {
+			return jose.SigningKey{}, err
+		}
+		publicKey = &key.PublicKey
+	case *ecdsa.PrivateKey:
+		// ES256 is only defined over P-256
+		if algorithm == jose.ES256 && key.Curve != elliptic.P256() {
+			return jose.SigningKey{}, fmt.Errorf("signature algorithm %s requires a P-256 key", algorithm)
+		}
+		publicKey = &key.PublicKey
+	case ed25519.PrivateKey:
+		if algorithm != jose.EdDSA {
+			return jose.SigningKey{}, fmt.Errorf("signature algorithm %s cannot be used with an Ed25519 key", algorithm)
+		}
+		publicKey = key.Public()
+	default:
+		return jose.SigningKey{}, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	entry, err := NewPublicKeyEntry(publicKey)
+	if err != nil {
+		return jose.SigningKey{}, err
+	}
+
+	return jose.SigningKey{Algorithm: algorithm, Key: jose.JSONWebKey{Key: privateKey, KeyID: entry.Thumbprint}}, nil
+}
+
+// PSSSaltLengthHash makes the PSS salt as long as the hash, the RFC 7518 choice and what go-jose signs with
+const PSSSaltLengthHash = rsa.PSSSaltLengthEqualsHash
+
+// pssHashes maps the PSS algorithms to their hash, MGF1 uses the same hash as RFC 7518 requires
+var pssHashes = map[jose.SignatureAlgorithm]crypto.Hash{
+	jose.PS256: crypto.SHA256,
+	jose.PS384: crypto.SHA384,
+	jose.PS512: crypto.SHA512,
+}
+
+// ValidatePSSSaltLength checks an explicit salt length fits the algorithm and key, from 1 byte to what the
+// modulus leaves after the hash. Zero is refused, crypto/rsa reads it as the largest salt.
+func ValidatePSSSaltLength(algorithm jose.SignatureAlgorithm, publicKey *rsa.PublicKey, saltLength int) error {
+	hash, ok := pssHashes[algorithm]
+	if !ok {
+		return fmt.Errorf("salt length only applies to the PSS algorithms, not %s", algorithm)
+	}
+	if saltLength == PSSSaltLengthHash {
+		return nil
+	}
+	maxSaltLength := (publicKey.N.BitLen()-1+7)/8 - hash.Size() - 2
+	if saltLength < 1 || saltLength > maxSaltLength {
+		return fmt.Errorf("salt length for %s with this key must be between 1 and %d bytes", algorithm, maxSaltLength)
+	}
+	return nil
+}
+
+// NewPSSSigner creates a JWS signer for the PSS algorithms with the given salt length, tagged with the public key
+// thumbprint as kid. go-jose always uses the hash length, so the signature is computed by this package.
+func NewPSSSigner(algorithm jose.SignatureAlgorithm, privateKey *rsa.PrivateKey, saltLength int, options *jose.SignerOptions) (jose.Signer, error) {
+	signingKey, err := NewPSSSigningKey(algorithm, privateKey, saltLength)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := jose.NewSigner(signingKey, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer: %v", err)
+	}
+	return signer, nil
+}
+
+// NewPSSSigningKey is NewSigningKey for the PSS algorithms with the given salt length
+func NewPSSSigningKey(algorithm jose.SignatureAlgorithm, privateKey *rsa.PrivateKey, saltLength int) (jose.SigningKey, error) {
+	if err := checkRSAKeySize(&privateKey.PublicKey); err != nil {
+		return jose.SigningKey{}, err
+	}
+	if err := ValidatePSSSaltLength(algorithm, &privateKey.PublicKey, saltLength); err != nil {
+		return jose.SigningKey{}, err
+	}
+
+	entry, err := NewPublicKeyEntry(&privateKey.PublicKey)
+	if err != nil {
+		return jose.SigningKey{}, err
+	}
+
+	return jose.SigningKey{Algorithm: algorithm, Key: &pssSigner{
+		privateKey: privateKey,
+		publicKey:  &jose.JSONWebKey{Key: &privateKey.PublicKey, KeyID: entry.Thumbprint, Algorithm: string(algorithm)},
+		algorithm:  algorithm,
+		saltLength: saltLength,
+	}}, nil
+}
+
+// ErrNotAsymmetric is returned for a signature that would be checked with something else than a public key
+var ErrNotAsymmetric = errors.New("signatures are only verified with an asymmetric public key")
+
+// VerifySignature checks the signature at index of a JWS on its own, go-jose refuses to verify several at once.
+// HMAC algorithms and byte keys are refused, a public key must never stand in for an HMAC secret.
+func VerifySignature(signature *jose.JSONWebSignature, index int, publicKey interface{}) ([]byte, error) {
+	if !slices.Contains(SupportedSignatureAlgorithms, jose.SignatureAlgorithm(signature.Signatures[index].Protected.Algorithm)) {
+		return nil, fmt.Errorf("%w, not with %s", ErrNotAsymmetric, signature.Signatures[index].Protected.Algorithm)
+	}
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("%w, not a %T", ErrNotAsymmetric, publicKey)
+	}
+
+	single := *signature
+	single.Signatures = []jose.Signature{signature.Signatures[index]}
+	return single.Verify(publicKey)
+}
+
+// pssSigner is the go-jose opaque signer for PSS with a chosen salt length
+type pssSigner struct {
+	privateKey *rsa.PrivateKey
+	publicKey  *jose.JSONWebKey
+	algorithm  jose.SignatureAlgorithm
+	saltLength int
+}
+
+func (signer *pssSigner) Public() *jose.JSONWebKey {
+	return signer.publicKey
+}
+
+func (signer *pssSigner) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{signer.algorithm}
+}
+
+func (signer *pssSigner) SignPayload(payload []byte, algorithm jose.SignatureAlgorithm) ([]byte, error) {
+	hash := pssHashes[algorithm]
+	hasher := hash.New()
+	hasher.Write(payload)
+	return rsa.SignPSS(jose.RandReader, signer.privateKey, hash, hasher.Sum(nil), &rsa.PSSOptions{SaltLength: signer.saltLength, Hash: hash})
+}
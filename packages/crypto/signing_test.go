@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"strings"
+	"testing"
+)
+
+func TestPSSSignerUsesTheSaltLength(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		algorithm  jose.SignatureAlgorithm
+		hash       crypto.Hash
+		saltLength int
+	}{
+		{jose.PS256, crypto.SHA256, PSSSaltLengthHash},
+		{jose.PS256, crypto.SHA256, 20},
+		{jose.PS384, crypto.SHA384, 0x30},
+		{jose.PS512, crypto.SHA512, 190},
+	} {
+		signer, err := NewPSSSigner(test.algorithm, privateKey, test.saltLength, nil)
+		if err != nil {
+			t.Fatalf("%s salt %d: %v", test.algorithm, test.saltLength, err)
+		}
+		signed, err := signer.Sign([]byte("strict verifier"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, err := signed.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// crypto/rsa checks the signature apart from go-jose, with the salt length fixed rather than detected
+		parts := strings.Split(compact, ".")
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		hasher := test.hash.New()
+		hasher.Write([]byte(parts[0] + "." + parts[1]))
+		expected := test.saltLength
+		if expected == PSSSaltLengthHash {
+			expected = test.hash.Size()
+		}
+		if err := rsa.VerifyPSS(&privateKey.PublicKey, test.hash, hasher.Sum(nil), signature, &rsa.PSSOptions{SaltLength: expected}); err != nil {
+			t.Fatalf("%s salt %d: expected the signature to verify: %v", test.algorithm, test.saltLength, err)
+		}
+		if err := rsa.VerifyPSS(&privateKey.PublicKey, test.hash, hasher.Sum(nil), signature, &rsa.PSSOptions{SaltLength: expected + 1}); err == nil {
+			t.Fatalf("%s salt %d: expected another salt length to be refused", test.algorithm, test.saltLength)
+		}
+
+		parsed, err := jose.ParseSigned(compact, []jose.SignatureAlgorithm{test.algorithm})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parsed.Verify(&privateKey.PublicKey); err != nil {
+			t.Fatalf("%s salt %d: expected go-jose to verify the signature: %v", test.algorithm, test.saltLength, err)
+		}
+		if parsed.Signatures[0].Protected.KeyID == "" {
+			t.Fatalf("%s salt %d: expected the thumbprint as kid", test.algorithm, test.saltLength)
+		}
+	}
+
+	// 2048 bit keys leave 256 - 32 - 2 bytes for the salt of PS256
+	for saltLength, valid := range map[int]bool{1: true, 222: true, 0: false, 223: false, -5: false} {
+		if err := ValidatePSSSaltLength(jose.PS256, &privateKey.PublicKey, saltLength); (err == nil) != valid {
+			t.Fatalf("salt length %d: expected valid=%v, got %v", saltLength, valid, err)
+		}
+	}
+	if err := ValidatePSSSaltLength(jose.RS256, &privateKey.PublicKey, 32); err == nil {
+		t.Fatal("expected a salt length to be refused for RS256")
+	}
+}
+
+func TestVerifySignatureChecksOneSignature(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := NewSigningKey(jose.RS256, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewPSSSigningKey(jose.PS384, otherKey, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewMultiSigner([]jose.SigningKey{first, second}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.Sign([]byte("countersigned"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jose.ParseSigned(signed.FullSerialize(), []jose.SignatureAlgorithm{jose.RS256, jose.PS384})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Signatures) != 2 {
+		t.Fatalf("expected 2 signatures, got %d", len(parsed.Signatures))
+	}
+
+	if payload, err := VerifySignature(parsed, 0, &rsaKey.PublicKey); err != nil || string(payload) != "countersigned" {
+		t.Fatalf("expected the first signature to verify, got %q %v", payload, err)
+	}
+	if _, err := VerifySignature(parsed, 1, &otherKey.PublicKey); err != nil {
+		t.Fatalf("expected the second signature to verify: %v", err)
+	}
+	if _, err := VerifySignature(parsed, 1, &rsaKey.PublicKey); err == nil {
+		t.Fatal("expected the second signature to be refused with the first key")
+	}
+	if len(parsed.Signatures) != 2 {
+		t.Fatal("expected the JWS to keep both signatures")
+	}
+}
+
+// The classic confusion: a token signed with HS256 using the RSA public key PEM as the HMAC secret
+func TestVerifySignatureRefusesAPublicKeyAsHMACSecret(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, err := ExportPublicKeyAsPEM(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forger, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte(publicKeyPem)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := forger.Sign([]byte(`{"sub":"admin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jose.ParseSigned(forged.FullSerialize(), RegisteredSignatureAlgorithms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []interface{}{&rsaKey.PublicKey, []byte(publicKeyPem)} {
+		if _, err := VerifySignature(parsed, 0, key); !errors.Is(err, ErrNotAsymmetric) {
+			t.Fatalf("expected the HS256 token to be refused with a %T, got %v", key, err)
+		}
+	}
+
+	// An asymmetric algorithm is refused with a byte key as well
+	signer, err := NewSigner(jose.RS256, rsaKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.Sign([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err = jose.ParseSigned(signed.FullSerialize(), RegisteredSignatureAlgorithms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySignature(parsed, 0, []byte(publicKeyPem)); !errors.Is(err, ErrNotAsymmetric) {
+		t.Fatalf("expected a byte key to be refused, got %v", err)
+	}
+	if _, err := VerifySignature(parsed, 0, &rsaKey.PublicKey); err != nil {
+		t.Fatalf("expected the RS256 signature to verify: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"math"
+	"strings"
+)
+
+// JWESizeParameters describe the compact JWE EstimateJWESize measures, none of them is secret
+type JWESizeParameters struct {
+	PlaintextLength   int
+	KeyAlgorithm      jose.KeyAlgorithm
+	ContentEncryption jose.ContentEncryption
+	// KeySize is the RSA modulus in bits, Curve the curve of an ECDH-ES key: P-256, P-384, P-521 or X25519
+	KeySize int
+	Curve   string
+	// ServerKidHash is the hash of the server_kid header, 0 leaves server_kid out
+	ServerKidHash crypto.Hash
+	KeyID         string
+	// PBES2Iterations is the p2c of the PBES2 algorithms, DefaultPBES2Iterations when 0
+	PBES2Iterations int
+	// Compress adds zip=DEF. CompressionRatio is the expected compressed size over the plaintext size,
+	// 0 assumes incompressible data, which DEFLATE still grows by its block headers.
+	Compress         bool
+	CompressionRatio float64
+}
+
+// Sizes in bytes of the values the protected header carries, as go-jose and this package generate them
+var ephemeralCoordinateSizes = map[string]int{"P-256": 32, "P-384": 48, "P-521": 66, "X25519": 32}
+
+const (
+	gcmIVSize          = 12
+	gcmTagSize         = 16
+	pbes2SaltSize      = 16
+	keyWrapOverhead    = 8
+	deflateStoredBlock = 65535
+	deflateBlockHeader = 5
+)
+
+// EstimateJWESize returns the length of the compact JWE the parameters describe without encrypting anything.
+// Without compression the length is exact, with it the ciphertext is estimated from CompressionRatio.
+func EstimateJWESize(parameters JWESizeParameters) (int, error) {
+	if parameters.PlaintextLength < 0 {
+		return 0, fmt.Errorf("plaintext length must not be negative")
+	}
+	cekSize, ok := contentEncryptionKeySizes[parameters.ContentEncryption]
+	if !ok {
+		return 0, fmt.Errorf("unsupported content encryption %q", parameters.ContentEncryption)
+	}
+
+	header := map[string]interface{}{"alg": parameters.KeyAlgorithm, "enc": parameters.ContentEncryption}
+	if parameters.KeyID != "" {
+		header["kid"] = parameters.KeyID
+	}
+	if parameters.ServerKidHash != 0 {
+		header[ServerKidHeader] = placeholder(parameters.ServerKidHash.Size())
+		header[ServerKidHashHeader] = parameters.ServerKidHash.String()
+	}
+	if parameters.Compress {
+		header["zip"] = jose.DEFLATE
+	}
+
+	var encryptedKeySize int
+	switch alg := parameters.KeyAlgorithm; alg {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256, RSA_OAEP_384, RSA_OAEP_512, jose.RSA1_5:
+		if parameters.KeySize <= 0 {
+			return 0, fmt.Errorf("key algorithm %s needs the RSA key size", alg)
+		}
+		encryptedKeySize = (parameters.KeySize + 7) / 8
+	case jose.ECDH_ES_A256KW:
+		coordinateSize, ok := ephemeralCoordinateSizes[parameters.Curve]
+		if !ok {
+			return 0, fmt.Errorf("key algorithm %s needs the curve, one of P-256, P-384, P-521 or X25519", alg)
+		}
+		epk := map[string]string{"kty": "EC", "crv": parameters.Curve, "x": placeholder(coordinateSize), "y": placeholder(coordinateSize)}
+		if parameters.Curve == "X25519" {
+			epk = map[string]string{"kty": "OKP", "crv": parameters.Curve, "x": placeholder(coordinateSize)}
+		}
+		header["epk"] = epk
+		encryptedKeySize = cekSize + keyWrapOverhead
+	case jose.A128KW, jose.A192KW, jose.A256KW:
+		encryptedKeySize = cekSize + keyWrapOverhead
+	case jose.A128GCMKW, jose.A192GCMKW, jose.A256GCMKW:
+		header["iv"], header["tag"] = placeholder(gcmIVSize), placeholder(gcmTagSize)
+		encryptedKeySize = cekSize
+	case jose.PBES2_HS256_A128KW, jose.PBES2_HS512_A256KW:
+		iterations := parameters.PBES2Iterations
+		if iterations == 0 {
+			iterations = DefaultPBES2Iterations
+		}
+		header["p2c"], header["p2s"] = iterations, placeholder(pbes2SaltSize)
+		encryptedKeySize = cekSize + keyWrapOverhead
+	case jose.DIRECT:
+	default:
+		return 0, fmt.Errorf("unsupported key algorithm %q", alg)
+	}
+
+	// The header length only depends on the length of its values, placeholders stand in for the random ones
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return 0, err
+	}
+
+	contentSize := parameters.PlaintextLength
+	if parameters.Compress {
+		contentSize = estimateDeflateSize(parameters.PlaintextLength, parameters.CompressionRatio)
+	}
+	ivSize, tagSize := gcmIVSize, gcmTagSize
+	switch parameters.ContentEncryption {
+	case jose.A128CBC_HS256, jose.A256CBC_HS512:
+		// PKCS#7 always pads, a full block when the length is already a multiple of the block size
+		ivSize, tagSize = 16, cekSize/2
+		contentSize = (contentSize/16 + 1) * 16
+	}
+
+	return base64Length(len(encodedHeader)) + base64Length(encryptedKeySize) + base64Length(ivSize) +
+		base64Length(contentSize) + base64Length(tagSize) + 4, nil
+}
+
+// estimateDeflateSize scales the length by the ratio, without one it bounds the stored blocks DEFLATE falls back to
+func estimateDeflateSize(length int, ratio float64) int {
+	if ratio > 0 {
+		return int(math.Ceil(float64(length) * ratio))
+	}
+	return length + deflateBlockHeader*(length/deflateStoredBlock+2)
+}
+
+// base64Length is the unpadded base64url length of size bytes
+func base64Length(size int) int {
+	return (size*8 + 5) / 6
+}
+
+// placeholder is a base64url value as long as the encoding of size bytes
+func placeholder(size int) string {
+	return strings.Repeat("A", base64Length(size))
+}
@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func TestEstimateJWESizeMatchesRealTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint, err := GetJWKThumbprintSHA256(jose.JSONWebKey{Key: &rsaKey.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		parameters JWESizeParameters
+		key        interface{}
+	}{
+		{JWESizeParameters{KeyAlgorithm: jose.RSA_OAEP_256, KeySize: 3072, ServerKidHash: crypto.SHA256, KeyID: "key-1"}, &rsaKey.PublicKey},
+		{JWESizeParameters{KeyAlgorithm: RSA_OAEP_512, KeySize: 3072}, &rsaKey.PublicKey},
+		{JWESizeParameters{KeyAlgorithm: jose.ECDH_ES_A256KW, Curve: "P-384", ServerKidHash: crypto.SHA256}, &p384Key.PublicKey},
+		{JWESizeParameters{KeyAlgorithm: jose.ECDH_ES_A256KW, Curve: "X25519", ServerKidHash: crypto.SHA256}, x25519Key.PublicKey()},
+		{JWESizeParameters{KeyAlgorithm: jose.A192KW}, make([]byte, 24)},
+		{JWESizeParameters{KeyAlgorithm: jose.A256GCMKW}, make([]byte, 32)},
+		{JWESizeParameters{KeyAlgorithm: jose.PBES2_HS256_A128KW, PBES2Iterations: 1000}, []byte("correct horse")},
+		{JWESizeParameters{KeyAlgorithm: jose.DIRECT}, nil},
+	} {
+		for _, contentEncryption := range []jose.ContentEncryption{jose.A256GCM, jose.A128CBC_HS256, jose.A256CBC_HS512} {
+			for _, length := range []int{0, 1, 15, 16, 17, 1000} {
+				parameters := test.parameters
+				parameters.ContentEncryption, parameters.PlaintextLength = contentEncryption, length
+
+				key := test.key
+				if parameters.KeyAlgorithm == jose.DIRECT {
+					key = make([]byte, contentEncryptionKeySizes[contentEncryption])
+				}
+				headers := map[string]interface{}{}
+				if parameters.ServerKidHash != 0 {
+					headers = ServerKidHeaders(thumbprint, parameters.ServerKidHash)
+				}
+				encrypter, err := NewEncrypter(contentEncryption, jose.Recipient{Algorithm: parameters.KeyAlgorithm, Key: key, KeyID: parameters.KeyID, PBES2Count: parameters.PBES2Iterations}, BuildEncrypterOptions(headers, false))
+				if err != nil {
+					t.Fatal(err)
+				}
+				jwe, err := encrypter.Encrypt(make([]byte, length))
+				if err != nil {
+					t.Fatal(err)
+				}
+				compact, err := jwe.CompactSerialize()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				estimate, err := EstimateJWESize(parameters)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if estimate != len(compact) {
+					t.Fatalf("%s %s %d bytes: estimated %d, got %d", parameters.KeyAlgorithm, contentEncryption, length, estimate, len(compact))
+				}
+			}
+		}
+	}
+
+	// Random data does not compress, the estimate without a ratio still holds the DEFLATE output
+	encrypter, err := NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &rsaKey.PublicKey}, BuildEncrypterOptions(nil, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, length := range []int{0, 100, 70000, 200000} {
+		plaintext := make([]byte, length)
+		rand.Read(plaintext)
+		jwe, err := encrypter.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, _ := jwe.CompactSerialize()
+		estimate, err := EstimateJWESize(JWESizeParameters{PlaintextLength: length, KeyAlgorithm: jose.RSA_OAEP_256, ContentEncryption: jose.A256GCM, KeySize: 3072, Compress: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estimate < len(compact) || estimate > len(compact)+64 {
+			t.Fatalf("%d random bytes: estimated %d, got %d", length, estimate, len(compact))
+		}
+	}
+
+	if _, err := EstimateJWESize(JWESizeParameters{KeyAlgorithm: jose.RSA_OAEP_256, ContentEncryption: jose.A256GCM}); err == nil {
+		t.Fatal("expected RSA without a key size to be refused")
+	}
+}
@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// DefaultTenant is the tenant of requests naming none, its keys are PrivateKeys
+const DefaultTenant = ""
+
+// tenantIDPattern keeps tenant IDs usable as a directory name, no dots or separators can reach another directory
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ValidateTenantID checks the tenant ID is 1 to 64 letters, digits, - or _, starting with a letter or digit
+func ValidateTenantID(tenant string) error {
+	if !tenantIDPattern.MatchString(tenant) {
+		return fmt.Errorf("tenant ID %q must be 1 to 64 letters, digits, - or _, starting with a letter or digit", tenant)
+	}
+	return nil
+}
+
+// KeyNamespaces holds a key store per tenant. A tenant only ever gets its own store,
+// so keys registered for one tenant can't decrypt, sign or be listed for another.
+type KeyNamespaces struct {
+	mutex  sync.RWMutex
+	stores map[string]*KeyStore
+}
+
+// NewKeyNamespaces creates namespaces holding only the default tenant
+func NewKeyNamespaces() *KeyNamespaces {
+	return &KeyNamespaces{stores: make(map[string]*KeyStore)}
+}
+
+// TenantKeys is the namespaces the endpoints pick the key store of the calling tenant from
+var TenantKeys = NewKeyNamespaces()
+
+// Store returns the key store of the tenant, creating it empty on first use
+func (namespaces *KeyNamespaces) Store(tenant string) *KeyStore {
+	if tenant == DefaultTenant {
+		return PrivateKeys
+	}
+
+	namespaces.mutex.Lock()
+	defer namespaces.mutex.Unlock()
+	store, ok := namespaces.stores[tenant]
+	if !ok {
+		store = NewKeyStore()
+		namespaces.stores[tenant] = store
+	}
+	return store
+}
+
+// Lookup returns the key store of the tenant, an empty one for a tenant without keys.
+// Lookups don't create stores, so requests naming random tenants don't grow the namespaces.
+func (namespaces *KeyNamespaces) Lookup(tenant string) *KeyStore {
+	if tenant == DefaultTenant {
+		return PrivateKeys
+	}
+
+	namespaces.mutex.RLock()
+	defer namespaces.mutex.RUnlock()
+	if store, ok := namespaces.stores[tenant]; ok {
+		return store
+	}
+	return NewKeyStore()
+}
+
+// Tenants lists the tenants that have a key store, the default tenant apart
+func (namespaces *KeyNamespaces) Tenants() []string {
+	namespaces.mutex.RLock()
+	defer namespaces.mutex.RUnlock()
+
+	tenants := make([]string, 0, len(namespaces.stores))
+	for tenant := range namespaces.stores {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// TenantDirs lists the subdirectories of dir named after a valid tenant ID, each holding the keys of that tenant
+func TenantDirs(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key directory: %v", err)
+	}
+
+	dirs := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() && ValidateTenantID(entry.Name()) == nil {
+			dirs[entry.Name()] = filepath.Join(dir, entry.Name())
+		}
+	}
+	return dirs, nil
+}
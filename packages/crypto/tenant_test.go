@@ -0,0 +1,43 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestKeyNamespacesIsolateTenants(t *testing.T) {
+	namespaces := NewKeyNamespaces()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := namespaces.Store("tenant-a").Register(privateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := namespaces.Lookup("tenant-a").Get(entry.Thumbprint); !ok {
+		t.Fatal("expected tenant-a to reach its own key")
+	}
+	for _, tenant := range []string{"tenant-b", DefaultTenant} {
+		store := namespaces.Lookup(tenant)
+		if _, ok := store.Get(entry.Thumbprint); ok {
+			t.Fatalf("expected tenant %q not to reach the key of tenant-a", tenant)
+		}
+		if candidates := store.Candidates(entry.Thumbprint); len(candidates) != 0 {
+			t.Fatalf("expected tenant %q to have no decryption candidates, got %d", tenant, len(candidates))
+		}
+	}
+
+	// Lookups don't create stores, registering does
+	if tenants := namespaces.Tenants(); len(tenants) != 1 || tenants[0] != "tenant-a" {
+		t.Fatalf("expected only tenant-a to have a store, got %v", tenants)
+	}
+
+	for _, tenant := range []string{"..", "a/b", "-a", "", string(make([]byte, 65))} {
+		if ValidateTenantID(tenant) == nil {
+			t.Fatalf("expected tenant ID %q to be refused", tenant)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	josecipher "github.com/go-jose/go-jose/v4/cipher"
+)
+
+// TestVectorKeyAlgorithms are the key management algorithms whose output only depends on the key, CEK and IV
+var TestVectorKeyAlgorithms = []jose.KeyAlgorithm{jose.DIRECT, jose.A128KW, jose.A192KW, jose.A256KW}
+
+// testVectorEncrypter is a symmetric encrypter drawing its CEK and IV from the given key material
+type testVectorEncrypter struct {
+	contentEncryption jose.ContentEncryption
+	keyAlgorithm      jose.KeyAlgorithm
+	key               []byte
+	keyID             string
+	options           jose.EncrypterOptions
+	keyMaterial       KeyMaterial
+}
+
+// NewTestVectorEncrypter creates an encrypter for reproducible JWEs, with FixedKeyMaterial the same inputs
+// always give the same token. It must only be used for known-answer tests, a reused IV breaks AES-GCM.
+func NewTestVectorEncrypter(contentEncryption jose.ContentEncryption, recipient jose.Recipient, options *jose.EncrypterOptions, material KeyMaterial) (jose.Encrypter, error) {
+	key, ok := recipient.Key.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("test vectors require a symmetric key")
+	}
+	supported := false
+	for _, alg := range TestVectorKeyAlgorithms {
+		supported = supported || alg == recipient.Algorithm
+	}
+	if !supported {
+		return nil, fmt.Errorf("key algorithm %s is not supported for test vectors", recipient.Algorithm)
+	}
+	if _, err := ParseSymmetricKeyAlgorithm(string(recipient.Algorithm), contentEncryption, key); err != nil {
+		return nil, err
+	}
+
+	encrypter := &testVectorEncrypter{
+		contentEncryption: contentEncryption,
+		keyAlgorithm:      recipient.Algorithm,
+		key:               key,
+		keyID:             recipient.KeyID,
+		keyMaterial:       material,
+	}
+	if options != nil {
+		encrypter.options = *options
+	}
+	if encrypter.options.Compression != "" && encrypter.options.Compression != jose.DEFLATE {
+		return nil, fmt.Errorf("unsupported compression %q", encrypter.options.Compression)
+	}
+	return encrypter, nil
+}
+
+func (encrypter *testVectorEncrypter) Encrypt(plaintext []byte) (*jose.JSONWebEncryption, error) {
+	return encrypter.EncryptWithAuthData(plaintext, nil)
+}
+
+// EncryptWithAuthData uses the key directly for dir, the other algorithms wrap the CEK of the key material
+func (encrypter *testVectorEncrypter) EncryptWithAuthData(plaintext []byte, aad []byte) (*jose.JSONWebEncryption, error) {
+	cek, encryptedKey := encrypter.key, []byte(nil)
+	if encrypter.keyAlgorithm != jose.DIRECT {
+		var err error
+		if cek, err = encrypter.keyMaterial.ContentKey(contentEncryptionKeySizes[encrypter.contentEncryption]); err != nil {
+			return nil, fmt.Errorf("failed to generate content encryption key: %v", err)
+		}
+		block, err := aes.NewCipher(encrypter.key)
+		if err != nil {
+			return nil, err
+		}
+		if encryptedKey, err = josecipher.KeyWrap(block, cek); err != nil {
+			return nil, fmt.Errorf("failed to wrap content encryption key: %v", err)
+		}
+	}
+
+	header := protectedHeader(encrypter.keyAlgorithm, encrypter.contentEncryption, encrypter.keyID, encrypter.options)
+	return sealJWE(header, encryptedKey, encrypter.contentEncryption, cek, encrypter.keyMaterial, plaintext, aad)
+}
+
+func (encrypter *testVectorEncrypter) Options() jose.EncrypterOptions {
+	return encrypter.options
+}
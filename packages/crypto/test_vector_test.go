@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+// RFC 7516 appendix A.3, A128KW with A128CBC-HS256
+func TestTestVectorEncrypterReproducesRFC7516(t *testing.T) {
+	decode := func(encoded string) []byte {
+		decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decoded
+	}
+	key := decode("GawgguFyGrWKav7AX4VKUg")
+	material := FixedKeyMaterial{
+		ContentEncryptionKey: []byte{4, 211, 31, 197, 84, 157, 252, 254, 11, 100, 157, 250, 63, 170, 106, 206, 107, 124, 212, 45, 111, 107, 9, 219, 200, 177, 0, 240, 143, 156, 44, 207},
+		InitializationVector: []byte{3, 22, 60, 12, 43, 67, 104, 105, 108, 108, 105, 99, 111, 116, 104, 101},
+	}
+
+	encrypter, err := NewTestVectorEncrypter(jose.A128CBC_HS256, jose.Recipient{Algorithm: jose.A128KW, Key: key}, nil, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("Live long and prosper."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0." +
+		"6KB707dM9YTIgHtLvtgWQ8mKwboJW3of9locizkDTHzBC2IlrT1oOQ." +
+		"AxY8DCtDaGlsbGljb3RoZQ." +
+		"KDlTtXchhZTGufMYmOYGS4HffxPSUrfmqCHXaI9wOGY." +
+		"U0m_YmjN04DJvceFICbCVQ"
+	if serialized != expected {
+		t.Fatalf("expected the RFC 7516 token, got %s", serialized)
+	}
+
+	plaintext, err := jwe.Decrypt(key)
+	if err != nil || string(plaintext) != "Live long and prosper." {
+		t.Fatalf("round trip failed: %q, %v", plaintext, err)
+	}
+}
+
+func TestTestVectorEncrypterRejectsRandomizedAlgorithms(t *testing.T) {
+	material := FixedKeyMaterial{ContentEncryptionKey: make([]byte, 32), InitializationVector: make([]byte, 12)}
+	if _, err := NewTestVectorEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.A256GCMKW, Key: make([]byte, 32)}, nil, material); err == nil {
+		t.Fatalf("expected A256GCMKW to be rejected, its key wrap draws its own IV")
+	}
+	if _, err := NewTestVectorEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: make([]byte, 16)}, nil, material); err == nil {
+		t.Fatalf("expected a dir key of the wrong size to be rejected")
+	}
+}
@@ -2,17 +2,99 @@ package crypto
 
 import (
 	"crypto"
+	"crypto/ecdh"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"github.com/go-jose/go-jose/v4"
 	"strings"
 )
 
-// GetJWKThumbprint calculates the thumbprint of the JWK using SHA-256
-func GetJWKThumbprint(jwk jose.JSONWebKey) (string, error) {
-	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
-	if err != nil {
-		return "", fmt.Errorf("failed to calculate JWK thumbprint: %v", err)
+// Thumbprint hashes accepted by name
+var thumbprintHashes = map[string]crypto.Hash{
+	"SHA-1":   crypto.SHA1,
+	"SHA-256": crypto.SHA256,
+	"SHA-384": crypto.SHA384,
+	"SHA-512": crypto.SHA512,
+}
+
+// Names of the hashes in the IANA Named Information Hash Algorithm registry, the ones a thumbprint URI can use
+var thumbprintURIHashes = map[crypto.Hash]string{
+	crypto.SHA256: "sha-256",
+	crypto.SHA384: "sha-384",
+	crypto.SHA512: "sha-512",
+}
+
+// ThumbprintURIPrefix starts every RFC 9278 JWK thumbprint URI, the hash name and the thumbprint follow it
+const ThumbprintURIPrefix = "urn:ietf:params:oauth:jwk-thumbprint:"
+
+// Members of each key type that make up the RFC 7638 thumbprint input
+var thumbprintMembers = map[string][]string{
+	"RSA": {"e", "kty", "n"},
+	"EC":  {"crv", "kty", "x", "y"},
+	"OKP": {"crv", "kty", "x"},
+}
+
+// ParseThumbprintHash maps a hash name to its crypto.Hash, defaulting to SHA-256 when empty
+func ParseThumbprintHash(name string) (crypto.Hash, error) {
+	if name == "" {
+		return crypto.SHA256, nil
+	}
+
+	hash, ok := thumbprintHashes[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported thumbprint hash %q, supported values are: SHA-256, SHA-1, SHA-384, SHA-512", name)
+	}
+	return hash, nil
+}
+
+// ThumbprintsEqual compares two base64url thumbprints in constant time, values that don't decode never match.
+// Strict decoding rejects unused trailing bits, or two different strings would decode to the same thumbprint.
+func ThumbprintsEqual(a, b string) bool {
+	decodedA, errA := base64.RawURLEncoding.Strict().DecodeString(a)
+	decodedB, errB := base64.RawURLEncoding.Strict().DecodeString(b)
+	if errA != nil || errB != nil || len(decodedA) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(decodedA, decodedB) == 1
+}
+
+// ServerKidHash is the thumbprint hash server_kid is computed with unless a request picks another
+var ServerKidHash = crypto.SHA256
+
+// ServerKid computes the server_kid thumbprint of the key with the hash, reusing the cached SHA-256 thumbprint
+func (entry PublicKeyEntry) ServerKid(hash crypto.Hash) (string, error) {
+	if hash == crypto.SHA256 && entry.Thumbprint != "" {
+		return entry.Thumbprint, nil
+	}
+	return GetJWKThumbprint(entry.JWK, hash)
+}
+
+// GetJWKThumbprintSHA256 calculates the RFC 7638 thumbprint of the JWK using SHA-256, the one used as kid and server_kid
+func GetJWKThumbprintSHA256(jwk jose.JSONWebKey) (string, error) {
+	return GetJWKThumbprint(jwk, crypto.SHA256)
+}
+
+// GetJWKThumbprint calculates the RFC 7638 thumbprint of the JWK using the given hash
+func GetJWKThumbprint(jwk jose.JSONWebKey, hash crypto.Hash) (string, error) {
+	if !hash.Available() {
+		return "", fmt.Errorf("thumbprint hash %v is not available", hash)
+	}
+
+	var thumbprint []byte
+	if x25519Key, ok := jwk.Key.(*ecdh.PublicKey); ok {
+		digest := hash.New()
+		digest.Write([]byte(x25519ThumbprintInput(x25519Key)))
+		thumbprint = digest.Sum(nil)
+	} else {
+		var err error
+		if thumbprint, err = jwk.Thumbprint(hash); err != nil {
+			return "", fmt.Errorf("failed to calculate JWK thumbprint: %v", err)
+		}
 	}
 
 	// Encode the thumbprint as Base64 (URL encoding, no padding)
@@ -21,3 +103,57 @@ func GetJWKThumbprint(jwk jose.JSONWebKey) (string, error) {
 	// Replace all occurrences of "=" with an empty string ""
 	return strings.Replace(thumbprintBase64, "=", "", -1), nil
 }
+
+// GetJWKThumbprintURI calculates the RFC 9278 thumbprint URI of the JWK using the given hash,
+// SHA-1 has no name in the registry the URI takes it from
+func GetJWKThumbprintURI(jwk jose.JSONWebKey, hash crypto.Hash) (string, error) {
+	name, ok := thumbprintURIHashes[hash]
+	if !ok {
+		return "", fmt.Errorf("thumbprint hash %v has no thumbprint URI form", hash)
+	}
+	thumbprint, err := GetJWKThumbprint(jwk, hash)
+	if err != nil {
+		return "", err
+	}
+	return ThumbprintURIPrefix + name + ":" + thumbprint, nil
+}
+
+// GetJWKThumbprintInput returns the canonical JWK JSON that the thumbprint is computed over
+func GetJWKThumbprintInput(jwk jose.JSONWebKey) (string, error) {
+	if x25519Key, ok := jwk.Key.(*ecdh.PublicKey); ok {
+		return x25519ThumbprintInput(x25519Key), nil
+	}
+
+	public := jwk.Public()
+	if !public.Valid() {
+		return "", fmt.Errorf("failed to derive public JWK")
+	}
+
+	serialized, err := public.MarshalJSON()
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize JWK: %v", err)
+	}
+
+	var members map[string]interface{}
+	if err := json.Unmarshal(serialized, &members); err != nil {
+		return "", fmt.Errorf("failed to parse JWK: %v", err)
+	}
+
+	keyType, _ := members["kty"].(string)
+	required, ok := thumbprintMembers[keyType]
+	if !ok {
+		return "", fmt.Errorf("unsupported key type %q", keyType)
+	}
+
+	// encoding/json writes map keys sorted, which is the lexicographic order RFC 7638 asks for
+	canonical := make(map[string]interface{}, len(required))
+	for _, name := range required {
+		canonical[name] = members[name]
+	}
+
+	input, err := json.Marshal(canonical)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize thumbprint input: %v", err)
+	}
+	return string(input), nil
+}
@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"crypto"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+// rfc7638Modulus and rfc7638Key are the example RSA key of RFC 7638 section 3.1
+const rfc7638Modulus = "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+
+const rfc7638Key = `{"kty":"RSA","n":"` + rfc7638Modulus + `","e":"AQAB","alg":"RS256","kid":"2011-04-29"}`
+
+func TestGetJWKThumbprintMatchesRFC7638(t *testing.T) {
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON([]byte(rfc7638Key)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hashed input is the one spelled out in section 3.1, alg and kid are not part of it
+	input, err := GetJWKThumbprintInput(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"e":"AQAB","kty":"RSA","n":"` + rfc7638Modulus + `"}`; input != want {
+		t.Fatalf("unexpected thumbprint input %s", input)
+	}
+
+	// SHA-256 is the RFC value, the others hash the same canonical input
+	expected := map[crypto.Hash]string{
+		crypto.SHA256: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		crypto.SHA384: "R9_OfJjSjaw8Fuum86UzK5ixTdN9bo9BaqPSiseq89DWfmqCdpSgUHus-cxDUNc8",
+		crypto.SHA512: "DpvEwocfn3FjeWWQjcJHzWrpKTIymKwgoL1xVgQcud48-qZDSRCr1zfWZQdHAJn_ciqXqPTSARyg-L-NyNGpVA",
+	}
+	for hash, thumbprint := range expected {
+		got, err := GetJWKThumbprint(jwk, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != thumbprint {
+			t.Fatalf("%v: expected thumbprint %q, got %q", hash, thumbprint, got)
+		}
+	}
+
+	if got, err := GetJWKThumbprintSHA256(jwk); err != nil || got != expected[crypto.SHA256] {
+		t.Fatalf("expected the SHA-256 wrapper to match, got %q, %v", got, err)
+	}
+}
+
+func TestGetJWKThumbprintURIMatchesRFC9278(t *testing.T) {
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON([]byte(rfc7638Key)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The SHA-256 URI is the example of RFC 9278 section 3
+	expected := map[crypto.Hash]string{
+		crypto.SHA256: "urn:ietf:params:oauth:jwk-thumbprint:sha-256:NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		crypto.SHA384: "urn:ietf:params:oauth:jwk-thumbprint:sha-384:R9_OfJjSjaw8Fuum86UzK5ixTdN9bo9BaqPSiseq89DWfmqCdpSgUHus-cxDUNc8",
+	}
+	for hash, uri := range expected {
+		if got, err := GetJWKThumbprintURI(jwk, hash); err != nil || got != uri {
+			t.Fatalf("%v: expected thumbprint URI %q, got %q: %v", hash, uri, got, err)
+		}
+	}
+
+	if _, err := GetJWKThumbprintURI(jwk, crypto.SHA1); err == nil {
+		t.Fatal("expected SHA-1 to have no thumbprint URI")
+	}
+}
+
+func TestThumbprintsEqual(t *testing.T) {
+	thumbprint := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	if !ThumbprintsEqual(thumbprint, thumbprint) {
+		t.Fatalf("expected a thumbprint to equal itself")
+	}
+	if ThumbprintsEqual(thumbprint, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xt") {
+		t.Fatalf("expected thumbprints differing in the last character to differ")
+	}
+	if ThumbprintsEqual(thumbprint, thumbprint[:20]) {
+		t.Fatalf("expected a truncated thumbprint to differ")
+	}
+	if ThumbprintsEqual("not base64url!", "not base64url!") || ThumbprintsEqual("", "") {
+		t.Fatalf("expected malformed and empty thumbprints never to match")
+	}
+}
+
+func TestPublicKeyEntryServerKid(t *testing.T) {
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON([]byte(rfc7638Key)); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := NewPublicKeyEntry(jwk.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SHA-256 is the cached thumbprint, other hashes are computed and named in the header
+	if kid, err := entry.ServerKid(crypto.SHA256); err != nil || kid != entry.Thumbprint {
+		t.Fatalf("expected the SHA-256 server_kid to be the thumbprint, got %s %v", kid, err)
+	}
+	legacy, err := entry.ServerKid(crypto.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := GetJWKThumbprint(jwk, crypto.SHA1); legacy != want || legacy == entry.Thumbprint {
+		t.Fatalf("unexpected SHA-1 server_kid %s", legacy)
+	}
+	if headers := ServerKidHeaders(legacy, crypto.SHA1); headers[ServerKidHashHeader] != "SHA-1" || headers[ServerKidHeader] != legacy {
+		t.Fatalf("unexpected server_kid headers %v", headers)
+	}
+}
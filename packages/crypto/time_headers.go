@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"jwe-go/packages/clock"
+	"strings"
+	"time"
+)
+
+// Protected headers bounding when a JWE is accepted, they work for any payload unlike the JWT claims
+const (
+	IssuedAtHeader  = "iat"
+	NotBeforeHeader = "nbf"
+)
+
+// Errors returned when validating the time headers, so callers can map them to a response
+var (
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrTokenTooOld      = errors.New("token is older than the maximum age")
+)
+
+// TimeHeaders returns the iat header when issuedAt is set and nbf when notBefore is, nbf is the clock plus the delay
+func TimeHeaders(issuedAt bool, notBefore *time.Duration) map[string]interface{} {
+	headers := make(map[string]interface{}, 2)
+	now := clock.Now()
+	if issuedAt {
+		headers[IssuedAtHeader] = now.Unix()
+	}
+	if notBefore != nil {
+		headers[NotBeforeHeader] = now.Add(*notBefore).Unix()
+	}
+	return headers
+}
+
+// ValidateTimeHeaders checks the iat and nbf headers against the clock with the leeway, and the token age when maxAge is set.
+// Only the protected header is read, unprotected members of the JSON serialization are not authenticated.
+func ValidateTimeHeaders(serialized string, maxAge, leeway time.Duration) error {
+	header, err := readProtectedHeader(serialized)
+	if err != nil {
+		return err
+	}
+
+	var issuedAt, notBefore *jwt.NumericDate
+	if err := headerMember(header, IssuedAtHeader, &issuedAt); err != nil {
+		return err
+	}
+	if err := headerMember(header, NotBeforeHeader, &notBefore); err != nil {
+		return err
+	}
+
+	now := clock.Now()
+	if notBefore != nil && now.Add(leeway).Before(notBefore.Time()) {
+		return fmt.Errorf("%w, nbf is %s", ErrTokenNotYetValid, notBefore.Time().UTC().Format(time.RFC3339))
+	}
+	if issuedAt != nil && now.Add(leeway).Before(issuedAt.Time()) {
+		return errors.New("token was issued in the future")
+	}
+	if maxAge > 0 {
+		if issuedAt == nil {
+			return fmt.Errorf("%w, it has no iat header", ErrTokenTooOld)
+		}
+		if now.Add(-maxAge - leeway).After(issuedAt.Time()) {
+			return fmt.Errorf("%w of %s", ErrTokenTooOld, maxAge)
+		}
+	}
+	return nil
+}
+
+// readProtectedHeader decodes the protected header of the compact or JSON serialization
+func readProtectedHeader(serialized string) (map[string]json.RawMessage, error) {
+	serialized = strings.TrimSpace(serialized)
+	encoded, _, _ := strings.Cut(serialized, ".")
+	if strings.HasPrefix(serialized, "{") {
+		var members struct {
+			Protected string `json:"protected"`
+		}
+		if err := json.Unmarshal([]byte(serialized), &members); err != nil {
+			return nil, fmt.Errorf("failed to parse JWE: %v", err)
+		}
+		encoded = members.Protected
+	}
+
+	header := map[string]json.RawMessage{}
+	if encoded == "" {
+		return header, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protected header: %v", err)
+	}
+	if err := json.Unmarshal(decoded, &header); err != nil {
+		return nil, fmt.Errorf("invalid protected header: %v", err)
+	}
+	return header, nil
+}
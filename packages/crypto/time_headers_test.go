@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/clock"
+	"testing"
+	"time"
+)
+
+func TestValidateTimeHeaders(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	defer func(previous clock.Clock) { clock.Current = previous }(clock.Current)
+	fake := clock.NewFake(issued)
+	clock.Current = fake
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delay := 5 * time.Minute
+	options := BuildEncrypterOptions(TimeHeaders(true, &delay), false)
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("replay protected"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateTimeHeaders(compact, 0, time.Minute); !errors.Is(err, ErrTokenNotYetValid) {
+		t.Fatalf("expected the token to be refused before nbf, got %v", err)
+	}
+
+	// Once nbf passed the token is accepted until it outgrows the maximum age, the leeway covering small skew
+	fake.Set(issued.Add(10 * time.Minute))
+	if err := ValidateTimeHeaders(compact, 0, 0); err != nil {
+		t.Fatalf("expected no maximum age to accept the token, got %v", err)
+	}
+	if err := ValidateTimeHeaders(jwe.FullSerialize(), 9*time.Minute, 2*time.Minute); err != nil {
+		t.Fatalf("expected the leeway to cover the age, got %v", err)
+	}
+	if err := ValidateTimeHeaders(compact, 9*time.Minute, 0); !errors.Is(err, ErrTokenTooOld) {
+		t.Fatalf("expected the token to be too old, got %v", err)
+	}
+
+	// Without iat the age is unknown, a maximum age refuses the token
+	encrypter, err = jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwe, err = encrypter.Encrypt([]byte("no time headers")); err != nil {
+		t.Fatal(err)
+	}
+	if compact, err = jwe.CompactSerialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateTimeHeaders(compact, 0, 0); err != nil {
+		t.Fatalf("expected a token without time headers to pass, got %v", err)
+	}
+	if err := ValidateTimeHeaders(compact, time.Minute, 0); !errors.Is(err, ErrTokenTooOld) {
+		t.Fatalf("expected a maximum age to require iat, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"jwe-go/packages/tracing"
+)
+
+// ErrTimeout is returned when a crypto operation does not finish before its context is done
+var ErrTimeout = errors.New("the crypto operation did not finish in time")
+
+// RunWithContext runs the operation in its own goroutine and returns ErrTimeout once ctx is done.
+// Key operations can't be interrupted, an abandoned one finishes in the background and its result is dropped.
+func RunWithContext[T any](ctx context.Context, operation func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1) // Buffered so the goroutine never blocks after a timeout
+	go func() {
+		value, err := operation()
+		done <- result{value, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-ctx.Done():
+		return zero, fmt.Errorf("%w: %v", ErrTimeout, ctx.Err())
+	}
+}
+
+// EncryptWithContext encrypts the plaintext with optional additional authenticated data, giving up with ErrTimeout when ctx is done first.
+// The plaintext is zeroed once go-jose is done with it, even after a timeout, so callers hand over a buffer they no longer need.
+func EncryptWithContext(ctx context.Context, encrypter jose.Encrypter, plaintext, aad []byte) (*jose.JSONWebEncryption, error) {
+	// go-jose leaves the header of the JWE it builds empty, the alg and enc are on the request span
+	_, span := tracing.Start(ctx, "encrypt", attribute.Int("jwe.plaintext.size", len(plaintext)))
+	jwe, err := RunWithContext(ctx, func() (*jose.JSONWebEncryption, error) {
+		defer Zero(plaintext)
+		return encrypter.EncryptWithAuthData(plaintext, aad)
+	})
+	tracing.End(span, err)
+	return jwe, err
+}
+
+// DecryptWithContext decrypts the JWE with the key, giving up with ErrTimeout when ctx is done first
+func DecryptWithContext(ctx context.Context, serialized string, encryptedObject *jose.JSONWebEncryption, key interface{}) ([]byte, error) {
+	_, span := StartDecryptSpan(ctx, encryptedObject)
+	plaintext, err := RunWithContext(ctx, func() ([]byte, error) {
+		return Decrypt(serialized, encryptedObject, key)
+	})
+	tracing.End(span, err)
+	return plaintext, err
+}
+
+// StartDecryptSpan starts the span of decrypting the JWE, labelled with the alg and enc of its header
+func StartDecryptSpan(ctx context.Context, encryptedObject *jose.JSONWebEncryption) (context.Context, trace.Span) {
+	enc, _ := encryptedObject.Header.ExtraHeaders["enc"].(string)
+	return tracing.Start(ctx, "decrypt", tracing.AttributeKeyAlgorithm.String(encryptedObject.Header.Algorithm), tracing.AttributeContentEncryption.String(enc))
+}
@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+	"time"
+)
+
+func TestEncryptWithContextStopsOnCancelledContext(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypter, err := jose.NewEncrypter(DefaultContentEncryption, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := EncryptWithContext(ctx, encrypter, []byte("late"), nil); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout for a cancelled context, got %v", err)
+	}
+
+	jwe, err := EncryptWithContext(context.Background(), encrypter, []byte("on time"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := DecryptWithContext(context.Background(), compact, jwe, privateKey); err != nil || string(plaintext) != "on time" {
+		t.Fatalf("expected the round trip to succeed, got %q, %v", plaintext, err)
+	}
+}
+
+func TestRunWithContextGivesUpOnSlowOperations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	release := make(chan struct{})
+	defer close(release)
+	_, err := RunWithContext(ctx, func() (int, error) {
+		<-release
+		return 0, nil
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout once the deadline elapsed, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// TokenIDHeader is the protected header carrying the random ID of a token, recorded on encrypt and on decrypt
+// so the two events of a token can be matched in the logs
+const TokenIDHeader = "jti"
+
+// maxTokenIDLength bounds the token IDs read back from a header, a longer value is not recorded
+const maxTokenIDLength = 256
+
+// NewTokenID draws a random 128 bit token ID, base64url encoded
+func NewTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate a token ID: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+// TokenID returns the token ID of the header, empty when it has none or one that isn't a short string
+func TokenID(header jose.Header) string {
+	id, _ := header.ExtraHeaders[TokenIDHeader].(string)
+	if len(id) > maxTokenIDLength {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,230 @@
+package crypto
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	josecipher "github.com/go-jose/go-jose/v4/cipher"
+)
+
+// Agreement party info headers of ECDH-ES, base64url values bound into the key derivation
+const (
+	PartyUInfoHeader = "apu"
+	PartyVInfoHeader = "apv"
+)
+
+// NIST curve names used in the epk header, X25519 keys use X25519Curve
+var ecdhCurveNames = map[ecdh.Curve]string{
+	ecdh.P256(): "P-256",
+	ecdh.P384(): "P-384",
+	ecdh.P521(): "P-521",
+}
+
+// NewEncrypter creates a JWE encrypter for the recipient.
+// go-jose only does ECDH-ES over the NIST curves and leaves apu and apv out of the key derivation,
+// so X25519 recipients and EC recipients with agreement party info get the encrypter of this package,
+// as do RSA recipients of the non-standard RSA-OAEP variants.
+func NewEncrypter(contentEncryption jose.ContentEncryption, recipient jose.Recipient, options *jose.EncrypterOptions) (jose.Encrypter, error) {
+	switch publicKey := recipient.Key.(type) {
+	case *rsa.PublicKey:
+		if IsNonStandardKeyAlgorithm(recipient.Algorithm) {
+			return newRSAEncrypter(contentEncryption, recipient, publicKey, options, RandomKeyMaterial)
+		}
+	case *ecdh.PublicKey:
+		return newECDHESEncrypter(contentEncryption, recipient, publicKey, options, RandomKeyMaterial)
+	case *ecdsa.PublicKey:
+		if options != nil && (options.ExtraHeaders[PartyUInfoHeader] != nil || options.ExtraHeaders[PartyVInfoHeader] != nil) {
+			ecdhKey, err := publicKey.ECDH()
+			if err != nil {
+				return nil, fmt.Errorf("unsupported EC key: %v", err)
+			}
+			return newECDHESEncrypter(contentEncryption, recipient, ecdhKey, options, RandomKeyMaterial)
+		}
+	}
+	return jose.NewEncrypter(contentEncryption, recipient, options)
+}
+
+// ecdhESEncrypter implements ECDH-ES+A256KW to an X25519 or NIST curve key, like go-jose encrypters it holds no per-message state
+type ecdhESEncrypter struct {
+	contentEncryption jose.ContentEncryption
+	publicKey         *ecdh.PublicKey
+	keyID             string
+	options           jose.EncrypterOptions
+	keyMaterial       KeyMaterial
+	// partyUInfo and partyVInfo are the decoded apu and apv headers, empty when not set
+	partyUInfo []byte
+	partyVInfo []byte
+}
+
+func newECDHESEncrypter(contentEncryption jose.ContentEncryption, recipient jose.Recipient, publicKey *ecdh.PublicKey, options *jose.EncrypterOptions, material KeyMaterial) (jose.Encrypter, error) {
+	if _, ok := ecdhCurveNames[publicKey.Curve()]; !ok && publicKey.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("unsupported ECDH curve, only X25519 and NIST curve keys are supported")
+	}
+	if recipient.Algorithm != jose.ECDH_ES_A256KW {
+		return nil, fmt.Errorf("key algorithm %s cannot be used with an ECDH key", recipient.Algorithm)
+	}
+	if _, ok := contentEncryptionKeySizes[contentEncryption]; !ok {
+		return nil, fmt.Errorf("unsupported content encryption %q", contentEncryption)
+	}
+
+	encrypter := &ecdhESEncrypter{
+		contentEncryption: contentEncryption,
+		publicKey:         publicKey,
+		keyID:             recipient.KeyID,
+		keyMaterial:       material,
+	}
+	if options != nil {
+		encrypter.options = *options
+	}
+	if encrypter.options.Compression != "" && encrypter.options.Compression != jose.DEFLATE {
+		return nil, fmt.Errorf("unsupported compression %q", encrypter.options.Compression)
+	}
+
+	var err error
+	if encrypter.partyUInfo, err = partyInfoHeader(encrypter.options, PartyUInfoHeader); err != nil {
+		return nil, err
+	}
+	if encrypter.partyVInfo, err = partyInfoHeader(encrypter.options, PartyVInfoHeader); err != nil {
+		return nil, err
+	}
+	return encrypter, nil
+}
+
+// partyInfoHeader decodes the apu or apv header of the options, nil when it is not set
+func partyInfoHeader(options jose.EncrypterOptions, name string) ([]byte, error) {
+	value, ok := options.ExtraHeaders[jose.HeaderKey(name)]
+	if !ok {
+		return nil, nil
+	}
+	encoded, isString := value.(string)
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if !isString || err != nil {
+		return nil, fmt.Errorf("%s header must be a base64url string", name)
+	}
+	return decoded, nil
+}
+
+func (encrypter *ecdhESEncrypter) Encrypt(plaintext []byte) (*jose.JSONWebEncryption, error) {
+	return encrypter.EncryptWithAuthData(plaintext, nil)
+}
+
+// EncryptWithAuthData wraps a fresh content key for the recipient key, sealJWE assembles the message
+func (encrypter *ecdhESEncrypter) EncryptWithAuthData(plaintext []byte, aad []byte) (*jose.JSONWebEncryption, error) {
+	// A fresh ephemeral key per message on the recipient curve, its shared secret derives the key encryption key
+	ephemeral, err := encrypter.publicKey.Curve().GenerateKey(jose.RandReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %v", err)
+	}
+	sharedSecret, err := ephemeral.ECDH(encrypter.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %v", err)
+	}
+
+	cek, err := encrypter.keyMaterial.ContentKey(contentEncryptionKeySizes[encrypter.contentEncryption])
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content encryption key: %v", err)
+	}
+	kek, err := aes.NewCipher(deriveECDHESKeyEncryptionKey(sharedSecret, encrypter.partyUInfo, encrypter.partyVInfo))
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := josecipher.KeyWrap(kek, cek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap content encryption key: %v", err)
+	}
+
+	header := protectedHeader(jose.ECDH_ES_A256KW, encrypter.contentEncryption, encrypter.keyID, encrypter.options)
+	header["epk"] = ephemeralPublicKeyHeader(ephemeral.PublicKey())
+	return sealJWE(header, encryptedKey, encrypter.contentEncryption, cek, encrypter.keyMaterial, plaintext, aad)
+}
+
+func (encrypter *ecdhESEncrypter) Options() jose.EncrypterOptions {
+	return encrypter.options
+}
+
+// ephemeralPublicKeyHeader renders the ephemeral key as the epk JWK, OKP for X25519 and EC for the NIST curves
+func ephemeralPublicKeyHeader(publicKey *ecdh.PublicKey) map[string]string {
+	encoded := publicKey.Bytes()
+	curveName, ok := ecdhCurveNames[publicKey.Curve()]
+	if !ok {
+		return map[string]string{
+			"kty": "OKP",
+			"crv": X25519Curve,
+			"x":   base64.RawURLEncoding.EncodeToString(encoded),
+		}
+	}
+
+	// NIST keys encode as the uncompressed point, 0x04 followed by X and Y of equal size
+	coordinates := encoded[1:]
+	return map[string]string{
+		"kty": "EC",
+		"crv": curveName,
+		"x":   base64.RawURLEncoding.EncodeToString(coordinates[:len(coordinates)/2]),
+		"y":   base64.RawURLEncoding.EncodeToString(coordinates[len(coordinates)/2:]),
+	}
+}
+
+// deriveECDHESKeyEncryptionKey runs the RFC 7518 Concat KDF for ECDH-ES+A256KW, apu and apv may be empty
+func deriveECDHESKeyEncryptionKey(sharedSecret, apu, apv []byte) []byte {
+	lengthPrefixed := func(data []byte) []byte {
+		out := make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(out, uint32(len(data)))
+		copy(out[4:], data)
+		return out
+	}
+
+	keySize := 32
+	supPubInfo := make([]byte, 4)
+	binary.BigEndian.PutUint32(supPubInfo, uint32(keySize)*8)
+
+	reader := josecipher.NewConcatKDF(crypto.SHA256, sharedSecret, lengthPrefixed([]byte(jose.ECDH_ES_A256KW)), lengthPrefixed(apu), lengthPrefixed(apv), supPubInfo, nil)
+	key := make([]byte, keySize)
+	_, _ = reader.Read(key) // Read on the KDF never fails
+	return key
+}
+
+// newContentCipher returns the AEAD for the content encryption algorithm and the length of its tag
+func newContentCipher(contentEncryption jose.ContentEncryption, cek []byte) (cipher.AEAD, int, error) {
+	switch contentEncryption {
+	case jose.A128GCM, jose.A192GCM, jose.A256GCM:
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, 0, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, 0, err
+		}
+		return aead, aead.Overhead(), nil
+	case jose.A128CBC_HS256, jose.A256CBC_HS512:
+		// The CBC-HMAC tag is half the key, Overhead also counts the padding
+		aead, err := josecipher.NewCBCHMAC(cek, aes.NewCipher)
+		if err != nil {
+			return nil, 0, err
+		}
+		return aead, len(cek) / 2, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported content encryption %q", contentEncryption)
+	}
+}
+
+func deflate(input []byte) ([]byte, error) {
+	var output bytes.Buffer
+	writer, _ := flate.NewWriter(&output, flate.BestSpeed)
+	if _, err := writer.Write(input); err != nil {
+		return nil, fmt.Errorf("failed to compress plaintext: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress plaintext: %v", err)
+	}
+	return output.Bytes(), nil
+}
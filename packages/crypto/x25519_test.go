@@ -0,0 +1,241 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-jose/go-jose/v4"
+	josecipher "github.com/go-jose/go-jose/v4/cipher"
+	"strings"
+	"testing"
+)
+
+// decryptX25519 reverses the compact JWE by hand, go-jose can't decrypt to X25519 keys.
+// aad is the encoded JWE AAD of a JSON serialization, empty for compact tokens.
+func decryptX25519(t *testing.T, compact, aad string, privateKey *ecdh.PrivateKey) []byte {
+	t.Helper()
+
+	parts := strings.Split(compact, ".")
+	if len(parts) != 5 {
+		t.Fatalf("expected 5 compact segments, got %d", len(parts))
+	}
+	decode := func(segment string) []byte {
+		decoded, err := base64.RawURLEncoding.DecodeString(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decoded
+	}
+
+	var header struct {
+		Enc jose.ContentEncryption `json:"enc"`
+		Epk okpMembers             `json:"epk"`
+	}
+	if err := json.Unmarshal(decode(parts[0]), &header); err != nil {
+		t.Fatal(err)
+	}
+
+	ephemeral, err := importX25519JWK(header.Epk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedSecret, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := aes.NewCipher(deriveECDHESKeyEncryptionKey(sharedSecret, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, err := josecipher.KeyUnwrap(kek, decode(parts[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aead, _, err := newContentCipher(header.Enc, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authData := parts[0]
+	if aad != "" {
+		authData += "." + aad
+	}
+	plaintext, err := aead.Open(nil, decode(parts[2]), append(decode(parts[3]), decode(parts[4])...), []byte(authData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plaintext
+}
+
+func TestX25519EncryptRoundTrips(t *testing.T) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := NewPublicKeyEntry(privateKey.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.KeyType != KeyTypeX25519 {
+		t.Fatalf("expected an X25519 key type, got %v", entry.KeyType)
+	}
+
+	keyAlgorithm, err := ParseKeyAlgorithm("", entry.KeyType, false, false)
+	if err != nil || keyAlgorithm != jose.ECDH_ES_A256KW {
+		t.Fatalf("expected ECDH-ES+A256KW as the X25519 default, got %q, %v", keyAlgorithm, err)
+	}
+
+	for _, contentEncryption := range SupportedContentEncryptions {
+		encrypter, err := NewEncrypterPool(1).Get(EncrypterKey{
+			Thumbprint:        entry.Thumbprint,
+			KeyAlgorithm:      keyAlgorithm,
+			ContentEncryption: contentEncryption,
+		}, entry.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jwe, err := encrypter.Encrypt([]byte("hello curve25519"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if jwe.Header.ExtraHeaders[ServerKidHeader] != entry.Thumbprint {
+			t.Fatalf("expected server_kid %q, got %v", entry.Thumbprint, jwe.Header.ExtraHeaders[ServerKidHeader])
+		}
+
+		compact, err := jwe.CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext := decryptX25519(t, compact, "", privateKey); string(plaintext) != "hello curve25519" {
+			t.Fatalf("%s: unexpected plaintext %q", contentEncryption, plaintext)
+		}
+	}
+}
+
+func TestX25519EncryptAuthenticatesAdditionalData(t *testing.T) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypter, err := NewEncrypter(DefaultContentEncryption, jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: privateKey.PublicKey()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwe, err := encrypter.EncryptWithAuthData([]byte("hello aad"), []byte("context"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(jwe.GetAuthData()) != "context" {
+		t.Fatalf("expected the aad to be kept, got %q", jwe.GetAuthData())
+	}
+
+	var serialized map[string]string
+	if err := json.Unmarshal([]byte(jwe.FullSerialize()), &serialized); err != nil {
+		t.Fatal(err)
+	}
+	compact := strings.Join([]string{serialized["protected"], serialized["encrypted_key"], serialized["iv"], serialized["ciphertext"], serialized["tag"]}, ".")
+	if plaintext := decryptX25519(t, compact, serialized["aad"], privateKey); string(plaintext) != "hello aad" {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+}
+
+func TestOKPKeysRejectMismatchedUse(t *testing.T) {
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Public, ed25519Private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseKeyAlgorithm("ECDH-ES+A256KW", KeyTypeEd25519, false, false); err == nil {
+		t.Fatalf("expected Ed25519 keys to be rejected for ECDH-ES")
+	}
+	if _, err := ParseSignatureAlgorithm("EdDSA", KeyTypeX25519); err == nil {
+		t.Fatalf("expected X25519 keys to be rejected for EdDSA")
+	}
+	if _, err := ParseSignatureAlgorithm("ES256", KeyTypeEd25519); err == nil {
+		t.Fatalf("expected ES256 to be rejected for an Ed25519 key")
+	}
+
+	x := base64.RawURLEncoding.EncodeToString(x25519Key.PublicKey().Bytes())
+	if _, _, err := ImportPublicKeyFromJWK([]byte(`{"kty":"OKP","crv":"X25519","use":"sig","x":"` + x + `"}`)); err == nil {
+		t.Fatalf("expected an X25519 JWK with use sig to be rejected")
+	}
+	if _, keyType, err := ImportPublicKeyFromJWK([]byte(`{"kty":"OKP","crv":"X25519","x":"` + x + `"}`)); err != nil || keyType != KeyTypeX25519 {
+		t.Fatalf("expected an X25519 JWK to import, got %v, %v", keyType, err)
+	}
+
+	x = base64.RawURLEncoding.EncodeToString(ed25519Public)
+	if _, _, err := ImportPublicKeyFromJWK([]byte(`{"kty":"OKP","crv":"Ed25519","use":"enc","x":"` + x + `"}`)); err == nil {
+		t.Fatalf("expected an Ed25519 JWK with use enc to be rejected")
+	}
+
+	// EdDSA signatures verify with the Ed25519 public key
+	signer, err := NewSigner(jose.EdDSA, ed25519Private, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signer.Sign([]byte("signed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := signature.Verify(ed25519Public); err != nil || string(payload) != "signed" {
+		t.Fatalf("expected the EdDSA signature to verify, got %q, %v", payload, err)
+	}
+}
+
+func TestEncrypterBindsPartyInfo(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: &privateKey.PublicKey}
+	options := BuildEncrypterOptions(map[string]interface{}{
+		PartyUInfoHeader: base64.RawURLEncoding.EncodeToString([]byte("Alice")),
+		PartyVInfoHeader: base64.RawURLEncoding.EncodeToString([]byte("Bob")),
+	}, false)
+
+	encrypter, err := NewEncrypter(jose.A256GCM, recipient, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("bound to the parties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// go-jose derives the key with apu and apv on decrypt, so it only opens the token if they went into the derivation
+	parsed, err := jose.ParseEncrypted(compact, []jose.KeyAlgorithm{jose.ECDH_ES_A256KW}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epk := parsed.Header.ExtraHeaders["epk"]; epk == nil || parsed.Header.ExtraHeaders[PartyUInfoHeader] != "QWxpY2U" {
+		t.Fatalf("expected the epk and apu headers, got %v", parsed.Header.ExtraHeaders)
+	}
+	plaintext, err := parsed.Decrypt(privateKey)
+	if err != nil {
+		t.Fatalf("expected go-jose to decrypt the token: %v", err)
+	}
+	if string(plaintext) != "bound to the parties" {
+		t.Fatalf("unexpected plaintext %q", plaintext)
+	}
+
+	options = BuildEncrypterOptions(map[string]interface{}{PartyUInfoHeader: "not base64url!"}, false)
+	if _, err := NewEncrypter(jose.A256GCM, recipient, options); err == nil {
+		t.Fatalf("expected an invalid apu header to be rejected")
+	}
+}
@@ -0,0 +1,9 @@
+package crypto
+
+// Zero overwrites a buffer holding a plaintext or key material once it is no longer needed.
+// Only buffers this service owns can be cleared: go-jose keeps its own copies of the CEK and of
+// the plaintext while sealing, parsed keys live on in big.Int values, and Go strings are immutable,
+// so anything that passed through a request string stays in memory until it is collected.
+func Zero(buffer []byte) {
+	clear(buffer)
+}
@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/go-jose/go-jose/v4"
+	"testing"
+)
+
+func isZeroed(buffer []byte) bool {
+	return len(buffer) > 0 && bytes.Count(buffer, []byte{0}) == len(buffer)
+}
+
+func TestEncryptWithContextZeroesPlaintext(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypter, err := jose.NewEncrypter(DefaultContentEncryption, jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: &privateKey.PublicKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("cleared after sealing")
+	jwe, err := EncryptWithContext(context.Background(), encrypter, plaintext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isZeroed(plaintext) {
+		t.Fatalf("expected the plaintext buffer to be zeroed, got %q", plaintext)
+	}
+
+	// The token was sealed before the buffer was cleared
+	decrypted, err := jwe.Decrypt(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != "cleared after sealing" {
+		t.Fatalf("unexpected plaintext %q", decrypted)
+	}
+}
+
+func TestImportPrivateKeyBlockZeroesDER(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	imported, keyType, err := importPrivateKeyBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isZeroed(der) {
+		t.Fatalf("expected the private key DER to be zeroed")
+	}
+
+	// The parsed key holds its own copy and still matches the original
+	if keyType != KeyTypeEC || !imported.(*ecdsa.PrivateKey).Equal(privateKey) {
+		t.Fatalf("expected the imported key to survive zeroing the DER")
+	}
+}
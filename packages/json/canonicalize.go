@@ -0,0 +1,197 @@
+package json
+
+import (
+	"bytes"
+	encodingjson "encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Canonicalize rewrites the JSON text in the JSON Canonicalization Scheme of RFC 8785: no whitespace,
+// object members sorted by their UTF-16 code units, numbers as ECMAScript prints them and strings with
+// the minimal escaping. Signatures over the result don't depend on how the producer formatted the JSON.
+// Duplicate member names and numbers outside the IEEE 754 double range are rejected, as I-JSON requires.
+func Canonicalize(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, errors.New("JSON text is not valid UTF-8")
+	}
+	decoder := encodingjson.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var out bytes.Buffer
+	if err := canonicalizeValue(decoder, &out); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return out.Bytes(), nil
+}
+
+func canonicalizeValue(decoder *encodingjson.Decoder, out *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return invalidJSON(err)
+	}
+
+	switch value := token.(type) {
+	case encodingjson.Delim:
+		if value == '{' {
+			return canonicalizeObject(decoder, out)
+		}
+		if value == '[' {
+			return canonicalizeArray(decoder, out)
+		}
+		return fmt.Errorf("invalid JSON: unexpected %q", rune(value))
+	case string:
+		writeCanonicalString(out, value)
+	case encodingjson.Number:
+		number, err := canonicalNumber(value)
+		if err != nil {
+			return err
+		}
+		out.WriteString(number)
+	case bool:
+		out.WriteString(strconv.FormatBool(value))
+	case nil:
+		out.WriteString("null")
+	}
+	return nil
+}
+
+func canonicalizeObject(decoder *encodingjson.Decoder, out *bytes.Buffer) error {
+	members := make(map[string][]byte)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return invalidJSON(err)
+		}
+		name := token.(string)
+		if _, ok := members[name]; ok {
+			return fmt.Errorf("duplicate member name %q", name)
+		}
+		var member bytes.Buffer
+		if err := canonicalizeValue(decoder, &member); err != nil {
+			return err
+		}
+		members[name] = member.Bytes()
+	}
+	if _, err := decoder.Token(); err != nil {
+		return invalidJSON(err)
+	}
+
+	// Members are sorted by the UTF-16 code units of their names, not by their UTF-8 bytes
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return compareUTF16(names[i], names[j]) < 0
+	})
+
+	out.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		writeCanonicalString(out, name)
+		out.WriteByte(':')
+		out.Write(members[name])
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+func canonicalizeArray(decoder *encodingjson.Decoder, out *bytes.Buffer) error {
+	out.WriteByte('[')
+	for i := 0; decoder.More(); i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if err := canonicalizeValue(decoder, out); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return invalidJSON(err)
+	}
+	out.WriteByte(']')
+	return nil
+}
+
+// canonicalNumber prints the number as ECMAScript Number.prototype.toString does for the closest double
+func canonicalNumber(number encodingjson.Number) (string, error) {
+	value, err := strconv.ParseFloat(string(number), 64)
+	if err != nil || math.IsInf(value, 0) {
+		return "", fmt.Errorf("number %s is outside the range of an IEEE 754 double", number)
+	}
+	if value == 0 {
+		// -0 prints as 0 too
+		return "0", nil
+	}
+
+	magnitude := math.Abs(value)
+	if magnitude >= 1e-6 && magnitude < 1e21 {
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	}
+	// Go writes the exponent with at least two digits, ECMAScript without padding
+	formatted := strconv.FormatFloat(value, 'e', -1, 64)
+	mantissa, exponent, _ := strings.Cut(formatted, "e")
+	sign, digits := exponent[:1], strings.TrimLeft(exponent[1:], "0")
+	return mantissa + "e" + sign + digits, nil
+}
+
+// writeCanonicalString escapes only the quote, the backslash and the control characters,
+// those with a short escape use it and the others \u00xx in lowercase hex
+func writeCanonicalString(out *bytes.Buffer, value string) {
+	out.WriteByte('"')
+	for _, character := range value {
+		switch character {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\b':
+			out.WriteString(`\b`)
+		case '\f':
+			out.WriteString(`\f`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if character < 0x20 {
+				fmt.Fprintf(out, `\u%04x`, character)
+			} else {
+				out.WriteRune(character)
+			}
+		}
+	}
+	out.WriteByte('"')
+}
+
+func compareUTF16(a, b string) int {
+	unitsA, unitsB := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(unitsA) && i < len(unitsB); i++ {
+		if unitsA[i] != unitsB[i] {
+			return int(unitsA[i]) - int(unitsB[i])
+		}
+	}
+	return len(unitsA) - len(unitsB)
+}
+
+func invalidJSON(err error) error {
+	if err == io.EOF {
+		return errors.New("invalid JSON: unexpected end of input")
+	}
+	return fmt.Errorf("invalid JSON: %v", err)
+}
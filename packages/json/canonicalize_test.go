@@ -0,0 +1,103 @@
+package json
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// The examples of RFC 8785 sections 3.2.2 and 3.2.3
+func TestCanonicalizeMatchesTheRFCExamples(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{
+			`{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`,
+			`{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			`{
+  "\u20ac": "Euro Sign",
+  "\r": "Carriage Return",
+  "\ufb33": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "\ud83d\ude00": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "\u00f6": "Latin Small Letter O With Diaeresis"
+}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\"," +
+				"\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+	} {
+		canonical, err := Canonicalize([]byte(test.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(canonical) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, canonical)
+		}
+	}
+}
+
+// The number serialization samples of RFC 8785 appendix B, by the bits of the double
+func TestCanonicalizeNumbers(t *testing.T) {
+	for _, test := range []struct {
+		bits     uint64
+		expected string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	} {
+		input := strconv.FormatFloat(math.Float64frombits(test.bits), 'e', -1, 64)
+		canonical, err := Canonicalize([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(canonical) != test.expected {
+			t.Fatalf("expected %s for %016x, got %s", test.expected, test.bits, canonical)
+		}
+	}
+}
+
+func TestCanonicalizeRejectsInvalidJSON(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`{"a":1,}`,
+		`{"a":1}{"b":2}`,
+		`{"a":1,"a":2}`,
+		`[1e400]`,
+		`{"a" 1}`,
+		"\"\xff\"",
+	} {
+		if _, err := Canonicalize([]byte(input)); err == nil {
+			t.Fatalf("expected %q to be rejected", input)
+		}
+	}
+}
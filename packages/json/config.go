@@ -3,3 +3,11 @@ package json
 import jsoniter "github.com/json-iterator/go"
 
 var CONFIG = jsoniter.ConfigFastest
+
+// strictConfig is CONFIG rejecting unknown fields, frozen once so StrictUnmarshal reuses its pooled iterators
+var strictConfig = jsoniter.Config{
+	EscapeHTML:                    false,
+	MarshalFloatWith6Digits:       true,
+	ObjectFieldMustBeSimpleString: true,
+	DisallowUnknownFields:         true,
+}.Froze()
@@ -0,0 +1,84 @@
+package json
+
+import (
+	"bytes"
+	encodingjson "encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// RejectDuplicateKeys makes StrictUnmarshal refuse objects repeating a key. RFC 8259 lets the last one win,
+// which lets a body mean one thing here and another to a proxy or a logger reading the first one.
+// It is off by default, clients that repeat a key keep working until the mode is turned on.
+var RejectDuplicateKeys = false
+
+// DuplicateKeyError reports a key an object of the payload holds twice
+type DuplicateKeyError struct {
+	Key  string
+	Path string
+}
+
+func (err *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %q at %s", err.Key, err.Path)
+}
+
+// findDuplicateKey tokenizes the payload along the target type and returns the first repeated key.
+// Keys of a struct are compared case-insensitively, the decoder would fill the same field with both.
+func findDuplicateKey(data []byte, target reflect.Type) (*DuplicateKeyError, error) {
+	decoder := encodingjson.NewDecoder(bytes.NewReader(data))
+	return duplicateKeyIn(decoder, target, "")
+}
+
+func duplicateKeyIn(decoder *encodingjson.Decoder, target reflect.Type, path string) (*DuplicateKeyError, error) {
+	for target != nil && target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case encodingjson.Delim('{'):
+		seen := make(map[string]bool)
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			name := token.(string)
+			key, valueType := name, elementType(target)
+			if target != nil && target.Kind() == reflect.Struct {
+				key, valueType = strings.ToLower(name), nil
+				if field, ok := lookupField(target, name); ok {
+					valueType = field.Type
+				}
+			}
+			if seen[key] {
+				return &DuplicateKeyError{Key: name, Path: joinPath(path, name)}, nil
+			}
+			seen[key] = true
+			if duplicate, err := duplicateKeyIn(decoder, valueType, joinPath(path, name)); duplicate != nil || err != nil {
+				return duplicate, err
+			}
+		}
+		_, err = decoder.Token()
+	case encodingjson.Delim('['):
+		for i := 0; decoder.More(); i++ {
+			if duplicate, err := duplicateKeyIn(decoder, elementType(target), fmt.Sprintf("%s[%d]", path, i)); duplicate != nil || err != nil {
+				return duplicate, err
+			}
+		}
+		_, err = decoder.Token()
+	}
+	return nil, err
+}
+
+// elementType is the type of the values of a map or the items of a slice, nil when the target is neither
+func elementType(target reflect.Type) reflect.Type {
+	if target != nil && (target.Kind() == reflect.Map || target.Kind() == reflect.Slice || target.Kind() == reflect.Array) {
+		return target.Elem()
+	}
+	return nil
+}
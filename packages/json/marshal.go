@@ -0,0 +1,6 @@
+package json
+
+// Marshal encodes the value with CONFIG, the same instance that decodes the requests
+func Marshal(value interface{}) ([]byte, error) {
+	return CONFIG.Marshal(value)
+}
@@ -0,0 +1,103 @@
+package json
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownFieldError reports a field in the payload that the target structure does not declare
+type UnknownFieldError struct {
+	Field string
+	Path  string
+}
+
+func (err *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q at %s", err.Field, err.Path)
+}
+
+// findUnknownField walks the decoded payload along the target type and returns the first undeclared field.
+// Fields are matched case-insensitively, like the jsoniter decoder does.
+func findUnknownField(value interface{}, target reflect.Type, path string) *UnknownFieldError {
+	for target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+
+	switch target.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, name := range sortedKeys(object) {
+			field, ok := lookupField(target, name)
+			if !ok {
+				return &UnknownFieldError{Field: name, Path: joinPath(path, name)}
+			}
+			if err := findUnknownField(object[name], field.Type, joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			if err := findUnknownField(item, target.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, name := range sortedKeys(object) {
+			if err := findUnknownField(object[name], target.Elem(), joinPath(path, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func lookupField(target reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		jsonName := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tagName, _, _ := strings.Cut(tag, ","); tagName != "" {
+				jsonName = tagName
+			}
+		}
+		if strings.EqualFold(jsonName, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
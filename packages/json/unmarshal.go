@@ -1,11 +1,31 @@
 package json
 
-import "bytes"
+import (
+	"reflect"
+	"strings"
+)
 
 // Custom unmarshaler that rejects extra fields
 func StrictUnmarshal(data []byte, structure interface{}) error {
-	// Unmarshal into the actual struct
-	decoder := CONFIG.NewDecoder(bytes.NewBuffer(data))
-	decoder.DisallowUnknownFields() // Reject unknown fields
-	return decoder.Decode(structure)
+	// Unmarshal into the actual struct, rejecting unknown fields
+	err := strictConfig.Unmarshal(data, structure)
+	if err == nil && RejectDuplicateKeys {
+		// jsoniter accepted the payload, a tokenizer error on it is left to that verdict
+		if duplicate, _ := findDuplicateKey(data, reflect.TypeOf(structure)); duplicate != nil {
+			return duplicate
+		}
+	}
+	if err == nil || !strings.Contains(err.Error(), "found unknown field") {
+		return err
+	}
+
+	// jsoniter only names the field, decode again loosely to find where it sits
+	var payload interface{}
+	if CONFIG.Unmarshal(data, &payload) != nil {
+		return err
+	}
+	if unknownField := findUnknownField(payload, reflect.TypeOf(structure), ""); unknownField != nil {
+		return unknownField
+	}
+	return err
 }
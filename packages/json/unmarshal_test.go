@@ -0,0 +1,71 @@
+package json
+
+import (
+	"errors"
+	"jwe-go/model"
+	"strings"
+	"testing"
+)
+
+func TestStrictUnmarshalReportsUnknownField(t *testing.T) {
+	var encryption model.EncryptRequest
+	err := StrictUnmarshal([]byte(`{"plaintext":"x","bogus":1}`), &encryption)
+
+	var unknownField *UnknownFieldError
+	if !errors.As(err, &unknownField) {
+		t.Fatalf("expected an UnknownFieldError, got %v", err)
+	}
+	if unknownField.Field != "bogus" || unknownField.Path != "bogus" {
+		t.Fatalf("unexpected field %q at %q", unknownField.Field, unknownField.Path)
+	}
+	if !strings.Contains(err.Error(), "bogus") {
+		t.Fatalf("error message %q does not name the field", err.Error())
+	}
+}
+
+func TestStrictUnmarshalReportsNestedUnknownFieldPath(t *testing.T) {
+	var encryption model.EncryptRequest
+	err := StrictUnmarshal([]byte(`{"plaintext":"x","recipients":[{"publicKeyPem":"a"},{"bad":2}]}`), &encryption)
+
+	var unknownField *UnknownFieldError
+	if !errors.As(err, &unknownField) {
+		t.Fatalf("expected an UnknownFieldError, got %v", err)
+	}
+	if unknownField.Path != "recipients[1].bad" {
+		t.Fatalf("unexpected path %q", unknownField.Path)
+	}
+}
+
+func TestStrictUnmarshalRejectsDuplicateKeys(t *testing.T) {
+	// By default the last value wins, as RFC 8259 parsers usually do
+	var encryption model.EncryptRequest
+	if err := StrictUnmarshal([]byte(`{"plaintext":"benign","plaintext":"smuggled"}`), &encryption); err != nil || encryption.Plaintext != "smuggled" {
+		t.Fatalf("expected the last value without the mode, got %q: %v", encryption.Plaintext, err)
+	}
+
+	defer func(reject bool) { RejectDuplicateKeys = reject }(RejectDuplicateKeys)
+	RejectDuplicateKeys = true
+	for _, test := range []struct {
+		body string
+		key  string
+		path string
+	}{
+		{`{"plaintext":"benign","plaintext":"smuggled"}`, "plaintext", "plaintext"},
+		// The decoder matches fields case-insensitively, so both spellings fill Plaintext
+		{`{"plaintext":"benign","Plaintext":"smuggled"}`, "Plaintext", "Plaintext"},
+		{`{"plaintext":"x","recipients":[{"publicKeyPem":"a"},{"publicKeyPem":"a","publicKeyPem":"b"}]}`, "publicKeyPem", "recipients[1].publicKeyPem"},
+		{`{"plaintext":"x","protectedHeaders":{"app":"a","app":"b"}}`, "app", "protectedHeaders.app"},
+	} {
+		var encryption model.EncryptRequest
+		err := StrictUnmarshal([]byte(test.body), &encryption)
+		var duplicateKey *DuplicateKeyError
+		if !errors.As(err, &duplicateKey) || duplicateKey.Key != test.key || duplicateKey.Path != test.path {
+			t.Fatalf("expected %q repeated at %s in %s, got %v", test.key, test.path, test.body, err)
+		}
+	}
+
+	// Map keys differing in case are distinct keys
+	if err := StrictUnmarshal([]byte(`{"plaintext":"x","protectedHeaders":{"app":"a","App":"b"}}`), &encryption); err != nil {
+		t.Fatalf("expected map keys differing in case to be accepted, got %v", err)
+	}
+}
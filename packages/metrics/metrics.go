@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"jwe-go/packages/crypto"
+	"time"
+)
+
+// Operation names used as the operation label
+const (
+	OperationEncrypt = "encrypt"
+	OperationDecrypt = "decrypt"
+)
+
+// otherLabel replaces any alg or enc value outside the supported lists, which keeps the label sets bounded
+const otherLabel = "other"
+
+var (
+	operations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jwe_operations_total",
+		Help: "Encrypt and decrypt operations by result, key algorithm and content encryption.",
+	}, []string{"operation", "result", "alg", "enc"})
+
+	latency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jwe_crypto_duration_seconds",
+		Help:    "Time spent in the encrypt and decrypt calls.",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 2, 14),
+	}, []string{"operation", "alg"})
+
+	panics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jwe_panics_total",
+		Help: "Requests whose handler panicked, by route.",
+	}, []string{"route"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "jwe_key_cache_size",
+		Help: "Number of imported public keys held in the key cache.",
+	}, func() float64 {
+		return float64(crypto.PublicKeys.Len())
+	})
+)
+
+var knownAlgorithms = func() map[string]bool {
+	known := make(map[string]bool)
+	for _, alg := range crypto.SupportedKeyAlgorithms {
+		known[string(alg)] = true
+	}
+	for _, alg := range crypto.SymmetricKeyAlgorithms {
+		known[string(alg)] = true
+	}
+	for _, alg := range crypto.PasswordKeyAlgorithms {
+		known[string(alg)] = true
+	}
+	return known
+}()
+
+var knownContentEncryptions = func() map[string]bool {
+	known := make(map[string]bool)
+	for _, enc := range crypto.SupportedContentEncryptions {
+		known[string(enc)] = true
+	}
+	return known
+}()
+
+// Record counts one crypto operation and observes how long it took
+func Record(operation, alg, enc string, err error, elapsed time.Duration) {
+	if !knownAlgorithms[alg] {
+		alg = otherLabel
+	}
+	if !knownContentEncryptions[enc] {
+		enc = otherLabel
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	operations.WithLabelValues(operation, result, alg, enc).Inc()
+	latency.WithLabelValues(operation, alg).Observe(elapsed.Seconds())
+}
+
+// RecordPanic counts a request whose handler panicked, route is the route pattern so the label set stays bounded
+func RecordPanic(route string) {
+	panics.WithLabelValues(route).Inc()
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+	"strings"
+)
+
+// CodeForbidden is the error code returned for an API key that matches none of the configured ones
+const CodeForbidden = "FORBIDDEN"
+
+// APIKeyHash is a configured API key as its salt and the SHA-256 of the salt followed by the key,
+// the key itself is never stored. Tenant is the only tenant the key may use, empty for the default keys.
+type APIKeyHash struct {
+	salt   []byte
+	hash   []byte
+	tenant string
+}
+
+// apiKeySaltSize is the length of the salts HashAPIKey draws
+const apiKeySaltSize = 16
+
+// ParseAPIKeyHashes reads API key hashes written as salt:hash, both in hex, or salt:hash:tenant for a key
+// bound to the keys of a tenant
+func ParseAPIKeyHashes(entries []string) ([]APIKeyHash, error) {
+	hashes := make([]APIKeyHash, 0, len(entries))
+	for i, entry := range entries {
+		encodedSalt, rest, found := strings.Cut(entry, ":")
+		encodedHash, tenant, bound := strings.Cut(rest, ":")
+		salt, saltErr := hex.DecodeString(encodedSalt)
+		hash, hashErr := hex.DecodeString(encodedHash)
+		if !found || saltErr != nil || hashErr != nil || len(salt) == 0 || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("API key hash %d must be a hex salt and a hex SHA-256 separated by a colon", i)
+		}
+		if bound {
+			if err := crypto.ValidateTenantID(tenant); err != nil {
+				return nil, fmt.Errorf("API key hash %d: %v", i, err)
+			}
+		}
+		hashes = append(hashes, APIKeyHash{salt: salt, hash: hash, tenant: tenant})
+	}
+	return hashes, nil
+}
+
+// HashAPIKey hashes the key under a new random salt, in the salt:hash form ParseAPIKeyHashes reads
+func HashAPIKey(key string) (string, error) {
+	salt := make([]byte, apiKeySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(hashAPIKey(salt, key)), nil
+}
+
+func hashAPIKey(salt []byte, key string) []byte {
+	hasher := sha256.New()
+	hasher.Write(salt)
+	hasher.Write([]byte(key))
+	return hasher.Sum(nil)
+}
+
+// APIKeyAuth lets through requests carrying one of the keys as a bearer Authorization header or in X-API-Key,
+// X-API-Key first so admin requests can send the admin token as their bearer token next to it.
+// A request without a key gets a 401, one with a key matching none a 403. Every hash is compared,
+// in constant time, so the response time tells nothing about which key came close.
+// The tenant of the matching key is set under APIKeyTenantKey, the only tenant the request may then use,
+// and its stored hash under APIKeyIdentityKey, which names the client to the rate limiter.
+func APIKeyAuth(keys []APIKeyHash) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		presented := context.GetHeader(APIKeyHeader)
+		if bearer, ok := strings.CutPrefix(context.GetHeader("Authorization"), "Bearer "); ok && presented == "" {
+			presented = bearer
+		}
+		if presented == "" {
+			context.Set(ErrorCodeKey, CodeUnauthorized)
+			context.Header("WWW-Authenticate", "Bearer")
+			abortWithJSON(context, http.StatusUnauthorized, model.ErrorResponse{
+				Code:    CodeUnauthorized,
+				Message: "an API key is required, as a bearer token or in the X-API-Key header",
+			})
+			return
+		}
+
+		matched, tenant, identity := 0, "", ""
+		for _, key := range keys {
+			if subtle.ConstantTimeCompare(hashAPIKey(key.salt, presented), key.hash) == 1 {
+				matched, tenant, identity = 1, key.tenant, hex.EncodeToString(key.hash[:16])
+			}
+		}
+		if matched != 1 {
+			context.Set(ErrorCodeKey, CodeForbidden)
+			abortWithJSON(context, http.StatusForbidden, model.ErrorResponse{
+				Code:    CodeForbidden,
+				Message: "the API key is not valid",
+			})
+			return
+		}
+		context.Set(APIKeyTenantKey, tenant)
+		context.Set(APIKeyIdentityKey, identity)
+		context.Next()
+	}
+}
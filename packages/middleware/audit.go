@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/audit"
+	"jwe-go/packages/clock"
+	"net/http"
+)
+
+// Audit records an audit event for every request to the routes, keyed by full path with the event type as value.
+// The event holds what the handlers set with SetAlgorithms, SetKeyThumbprint and SetTokenID, never anything from the body.
+// A handler that panics is recorded as a failure before Recovery answers it.
+func Audit(routes map[string]string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		eventType, ok := routes[context.FullPath()]
+		if !ok {
+			context.Next()
+			return
+		}
+
+		start := clock.Now()
+		completed := false
+		defer func() {
+			event := audit.AuditEvent{
+				Type:              eventType,
+				Time:              start.UTC(),
+				RequestID:         context.GetString(RequestIDKey),
+				KeyThumbprint:     context.GetString(KeyThumbprintKey),
+				Algorithm:         context.GetString(KeyAlgorithmKey),
+				ContentEncryption: context.GetString(ContentEncryptionKey),
+				Outcome:           audit.OutcomeSuccess,
+				ErrorCode:         context.GetString(ErrorCodeKey),
+				TokenID:           context.GetString(TokenIDKey),
+			}
+			switch {
+			case !completed:
+				event.Outcome, event.ErrorCode = audit.OutcomeFailure, CodeInternal
+			case context.Writer.Status() >= http.StatusBadRequest:
+				event.Outcome = audit.OutcomeFailure
+			}
+			audit.Record(event)
+		}()
+
+		context.Next()
+		completed = true
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/audit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memorySink keeps the recorded events for the assertions
+type memorySink struct {
+	mutex  sync.Mutex
+	events []audit.AuditEvent
+}
+
+func (sink *memorySink) Record(event audit.AuditEvent) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.events = append(sink.events, event)
+}
+
+func TestAuditRecordsSuccessAndFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &memorySink{}
+	audit.SetSink(sink)
+	defer audit.SetSink(mustSink(t, audit.SinkNone))
+
+	router := gin.New()
+	router.Use(RequestID(), Recovery("text"), Audit(map[string]string{
+		"/v1/encrypt": audit.EventEncrypt,
+		"/v1/decrypt": audit.EventDecrypt,
+		"/v1/sign":    audit.EventSign,
+	}))
+	router.POST("/v1/encrypt", func(context *gin.Context) {
+		SetAlgorithms(context, "RSA-OAEP-256", "A256GCM")
+		SetKeyThumbprint(context, "thumbprint")
+		context.String(http.StatusOK, "the secret plaintext went in here")
+	})
+	router.POST("/v1/decrypt", func(context *gin.Context) {
+		SetAlgorithms(context, "ECDH-ES+A256KW", "A128GCM")
+		context.Set(ErrorCodeKey, "DECRYPTION_FAILED")
+		abortWithJSON(context, http.StatusUnprocessableEntity, errors.New("failed"))
+	})
+	router.POST("/v1/sign", func(context *gin.Context) {
+		panic("signing key unavailable")
+	})
+	router.GET("/v1/algorithms", func(context *gin.Context) {
+		context.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/v1/encrypt", "/v1/decrypt", "/v1/sign"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader("the secret plaintext")))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/algorithms", nil))
+
+	if len(sink.events) != 3 {
+		t.Fatalf("expected an event for each audited route only, got %+v", sink.events)
+	}
+	for _, test := range []struct {
+		event      audit.AuditEvent
+		outcome    string
+		code       string
+		thumbprint string
+		alg        string
+	}{
+		{sink.events[0], audit.OutcomeSuccess, "", "thumbprint", "RSA-OAEP-256"},
+		{sink.events[1], audit.OutcomeFailure, "DECRYPTION_FAILED", "", "ECDH-ES+A256KW"},
+		{sink.events[2], audit.OutcomeFailure, CodeInternal, "", ""},
+	} {
+		if test.event.Outcome != test.outcome || test.event.ErrorCode != test.code || test.event.KeyThumbprint != test.thumbprint || test.event.Algorithm != test.alg {
+			t.Fatalf("expected %s %s, got %+v", test.outcome, test.code, test.event)
+		}
+		if test.event.RequestID == "" || test.event.Time.IsZero() {
+			t.Fatalf("expected the request ID and time, got %+v", test.event)
+		}
+		if strings.Contains(fmt.Sprintf("%+v", test.event), "secret") {
+			t.Fatalf("expected nothing from the request or response body, got %+v", test.event)
+		}
+	}
+	if sink.events[0].Type != audit.EventEncrypt || sink.events[1].Type != audit.EventDecrypt || sink.events[2].Type != audit.EventSign {
+		t.Fatalf("expected the event types of the routes, got %+v", sink.events)
+	}
+}
+
+func mustSink(t *testing.T, name string) audit.Sink {
+	sink, err := audit.NewSink(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
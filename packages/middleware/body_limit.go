@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"net/http"
+)
+
+// CodeBodyTooLarge is the error code returned when a request body exceeds its limit
+const CodeBodyTooLarge = "BODY_TOO_LARGE"
+
+// BodyLimit caps request bodies at the limit for the matched route, or at defaultLimit for other routes.
+// Bodies with a known length are rejected up front, others fail while the handler reads them.
+func BodyLimit(defaultLimit int64, routeLimits map[string]int64) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		limit, ok := routeLimits[context.FullPath()]
+		if !ok {
+			limit = defaultLimit
+		}
+
+		if context.Request.ContentLength > limit {
+			abortWithJSON(context, http.StatusRequestEntityTooLarge, model.ErrorResponse{
+				Code:    CodeBodyTooLarge,
+				Message: fmt.Sprintf("request body exceeds the limit of %d bytes", limit),
+			})
+			return
+		}
+
+		context.Request.Body = http.MaxBytesReader(context.Writer, context.Request.Body, limit)
+		context.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CodeUnsupportedMediaType is the error code returned for a body whose Content-Type the route does not accept
+const CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+
+// ContentType requires request bodies to declare one of the accepted media types, or of the types of the matched route.
+// Parameters like charset are ignored, requests without a body are left to the handler.
+func ContentType(accepted []string, routeTypes map[string][]string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if context.Request.ContentLength == 0 && len(context.Request.TransferEncoding) == 0 {
+			context.Next()
+			return
+		}
+
+		types, ok := routeTypes[context.FullPath()]
+		if !ok {
+			types = accepted
+		}
+		mediaType, _, err := mime.ParseMediaType(context.GetHeader("Content-Type"))
+		if err != nil || !slices.Contains(types, mediaType) {
+			abortWithJSON(context, http.StatusUnsupportedMediaType, model.ErrorResponse{
+				Code:    CodeUnsupportedMediaType,
+				Message: fmt.Sprintf("request body must be %s", strings.Join(types, " or ")),
+			})
+			return
+		}
+		context.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentTypeRequiresAnAcceptedMediaType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ContentType([]string{"application/json"}, map[string][]string{"/v1/encrypt/file": {"multipart/form-data"}}))
+	router.POST("/v1/encrypt", func(context *gin.Context) { context.Status(http.StatusOK) })
+	router.POST("/v1/encrypt/file", func(context *gin.Context) { context.Status(http.StatusOK) })
+
+	for _, test := range []struct {
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"/v1/encrypt", "application/json", "{}", http.StatusOK},
+		{"/v1/encrypt", "Application/JSON; charset=utf-8", "{}", http.StatusOK},
+		{"/v1/encrypt", "application/x-www-form-urlencoded", "plaintext=a", http.StatusUnsupportedMediaType},
+		{"/v1/encrypt", "text/plain", "{}", http.StatusUnsupportedMediaType},
+		{"/v1/encrypt", "", "{}", http.StatusUnsupportedMediaType},
+		{"/v1/encrypt", "application/json;;", "{}", http.StatusUnsupportedMediaType},
+		// Without a body the handler answers, with its own empty body error
+		{"/v1/encrypt", "", "", http.StatusOK},
+		{"/v1/encrypt/file", "multipart/form-data; boundary=x", "--x--", http.StatusOK},
+		{"/v1/encrypt/file", "application/json", "{}", http.StatusUnsupportedMediaType},
+	} {
+		request := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+		if test.contentType != "" {
+			request.Header.Set("Content-Type", test.contentType)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.status {
+			t.Fatalf("%s %q: expected %d, got %d %q", test.path, test.contentType, test.status, recorder.Code, recorder.Body.String())
+		}
+		if test.status == http.StatusUnsupportedMediaType && !strings.Contains(recorder.Body.String(), CodeUnsupportedMediaType) {
+			t.Fatalf("%s %q: expected UNSUPPORTED_MEDIA_TYPE, got %q", test.path, test.contentType, recorder.Body.String())
+		}
+	}
+}
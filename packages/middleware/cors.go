@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CodeOriginNotAllowed is the error code returned to preflight requests from an origin outside the allowlist
+const CodeOriginNotAllowed = "ORIGIN_NOT_ALLOWED"
+
+// CORSConfig is the cross-origin policy for browser clients, without AllowedOrigins no origin is allowed
+type CORSConfig struct {
+	// Origins as scheme://host[:port], or "*" for any origin when credentials are not allowed
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// How long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// Validate rejects origins that can never match a browser Origin header and a wildcard with credentials
+func (config CORSConfig) Validate() error {
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			if config.AllowCredentials {
+				return errors.New("the * origin cannot be combined with credentials")
+			}
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path != "" || parsed.RawQuery != "" || parsed.User != nil {
+			return fmt.Errorf("origin %q must be of the form scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// CORS applies the policy, the Origin of each request is checked against the allowlist.
+// Preflight requests are answered here, so they never reach the rate limiter or the handlers.
+func CORS(config CORSConfig) gin.HandlerFunc {
+	allowedOrigins := make(map[string]bool, len(config.AllowedOrigins))
+	for _, origin := range config.AllowedOrigins {
+		allowedOrigins[strings.ToLower(origin)] = true
+	}
+	allowedMethods := strings.Join(config.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(config.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge / time.Second))
+
+	return func(context *gin.Context) {
+		origin := context.GetHeader("Origin")
+		if origin == "" || len(allowedOrigins) == 0 {
+			context.Next()
+			return
+		}
+
+		// The response depends on the Origin, caches must not hand it to another one
+		context.Writer.Header().Add("Vary", "Origin")
+		preflight := context.Request.Method == http.MethodOptions && context.GetHeader("Access-Control-Request-Method") != ""
+
+		allowed := allowedOrigins[strings.ToLower(origin)]
+		if !allowed && !allowedOrigins["*"] {
+			if preflight {
+				context.Set(ErrorCodeKey, CodeOriginNotAllowed)
+				abortWithJSON(context, http.StatusForbidden, model.ErrorResponse{
+					Code:    CodeOriginNotAllowed,
+					Message: fmt.Sprintf("origin %s is not allowed", origin),
+				})
+				return
+			}
+			// Without the CORS headers the browser keeps the response from the page
+			context.Next()
+			return
+		}
+
+		if allowed {
+			context.Header("Access-Control-Allow-Origin", origin)
+		} else {
+			context.Header("Access-Control-Allow-Origin", "*")
+		}
+		if config.AllowCredentials {
+			context.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			context.Header("Access-Control-Allow-Methods", allowedMethods)
+			context.Header("Access-Control-Allow-Headers", allowedHeaders)
+			context.Header("Access-Control-Max-Age", maxAge)
+			context.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if exposedHeaders != "" {
+			context.Header("Access-Control-Expose-Headers", exposedHeaders)
+		}
+		context.Next()
+	}
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// incompressibleTypes are the media types sent as they are: JWE payloads, whose ciphertext doesn't compress,
+// and content that is compressed already
+var incompressibleTypes = []string{
+	"application/jose",
+	"application/octet-stream",
+	"application/gzip",
+	"application/zip",
+	"image/",
+	"video/",
+	"audio/",
+}
+
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+
+// Gzip compresses the responses of clients accepting gzip once they reach minSize bytes.
+// Smaller responses, like most compact JWEs, and incompressible media types are sent uncompressed.
+// This is transport compression only, unrelated to the zip header of a JWE.
+func Gzip(minSize int) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !acceptsGzip(context.GetHeader("Accept-Encoding")) {
+			context.Next()
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: context.Writer, minSize: minSize}
+		context.Writer = writer
+		defer func() {
+			writer.finish()
+			context.Writer = writer.ResponseWriter
+		}()
+		context.Writer.Header().Add("Vary", "Accept-Encoding")
+		context.Next()
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip, directly or through *, with a non-zero q
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "gzip" && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds the body back until it reaches minSize, then decides whether to compress it
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	minSize int
+	pending bytes.Buffer
+	decided bool
+	gzip    *gzip.Writer
+}
+
+func (writer *gzipResponseWriter) Write(data []byte) (int, error) {
+	if writer.decided {
+		if writer.gzip != nil {
+			return writer.gzip.Write(data)
+		}
+		return writer.ResponseWriter.Write(data)
+	}
+
+	writer.pending.Write(data)
+	if writer.pending.Len() >= writer.minSize || !writer.compressible() {
+		if err := writer.decide(writer.compressible() && writer.pending.Len() >= writer.minSize); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (writer *gzipResponseWriter) WriteString(data string) (int, error) {
+	return writer.Write([]byte(data))
+}
+
+// Flush sends what is held back, a streamed response flushing early is compressed only if it already reached minSize
+func (writer *gzipResponseWriter) Flush() {
+	if !writer.decided {
+		writer.decide(writer.compressible() && writer.pending.Len() >= writer.minSize)
+	}
+	if writer.gzip != nil {
+		writer.gzip.Flush()
+	}
+	writer.ResponseWriter.Flush()
+}
+
+// compressible reports whether the response type and encoding allow compressing it
+func (writer *gzipResponseWriter) compressible() bool {
+	if writer.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(writer.Header().Get("Content-Type"))
+	for _, incompressible := range incompressibleTypes {
+		if strings.HasPrefix(contentType, incompressible) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide starts the compressed or the plain response and writes the held back bytes to it
+func (writer *gzipResponseWriter) decide(compress bool) error {
+	writer.decided = true
+	if compress {
+		writer.Header().Set("Content-Encoding", "gzip")
+		writer.Header().Del("Content-Length")
+		writer.gzip = gzipWriters.Get().(*gzip.Writer)
+		writer.gzip.Reset(writer.ResponseWriter)
+		_, err := writer.gzip.Write(writer.pending.Bytes())
+		writer.pending.Reset()
+		return err
+	}
+	_, err := writer.ResponseWriter.Write(writer.pending.Bytes())
+	writer.pending.Reset()
+	return err
+}
+
+// finish sends a body that stayed below minSize as it is, or ends the gzip stream
+func (writer *gzipResponseWriter) finish() {
+	if !writer.decided {
+		if writer.pending.Len() == 0 {
+			return
+		}
+		writer.decide(false)
+	}
+	if writer.gzip != nil {
+		writer.gzip.Close()
+		writer.gzip.Reset(io.Discard)
+		gzipWriters.Put(writer.gzip)
+		writer.gzip = nil
+	}
+}
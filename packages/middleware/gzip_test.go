@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipCompressesLargeCompressibleResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Gzip(1024))
+	large := strings.Repeat(`{"kid":"key"},`, 200)
+	router.GET("/json", func(context *gin.Context) {
+		context.Data(http.StatusOK, gin.MIMEJSON, []byte(large))
+	})
+	router.GET("/small", func(context *gin.Context) {
+		context.String(http.StatusOK, "eyJhbGciOiJSU0EtT0FFUC0yNTYifQ.a.b.c.d")
+	})
+	router.GET("/jose", func(context *gin.Context) {
+		context.Data(http.StatusOK, "application/jose; charset=utf-8", []byte(large))
+	})
+
+	send := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			request.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	compressed := send("/json", "br, gzip")
+	if compressed.Header().Get("Content-Encoding") != "gzip" || compressed.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected a gzip response, got headers %v", compressed.Header())
+	}
+	reader, err := gzip.NewReader(compressed.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil || string(body) != large {
+		t.Fatalf("expected the body to decompress to the response, got %d bytes %v", len(body), err)
+	}
+
+	for _, test := range []struct {
+		name, path, acceptEncoding string
+	}{
+		{"no Accept-Encoding", "/json", ""},
+		{"gzip refused", "/json", "gzip;q=0, identity"},
+		{"below the threshold", "/small", "gzip"},
+		{"JWE media type", "/jose", "gzip"},
+	} {
+		recorder := send(test.path, test.acceptEncoding)
+		if recorder.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("%s: expected an uncompressed response, got %v", test.name, recorder.Header())
+		}
+		if recorder.Code != http.StatusOK || recorder.Body.Len() == 0 {
+			t.Fatalf("%s: expected the response body, got %d %q", test.name, recorder.Code, recorder.Body.String())
+		}
+	}
+}
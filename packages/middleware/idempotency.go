@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"hash/fnv"
+	"io"
+	"jwe-go/model"
+	"jwe-go/packages/clock"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Idempotency headers, a replayed response carries IdempotentReplayedHeader
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Error codes returned for idempotent requests
+const (
+	CodeInvalidIdempotencyKey = "INVALID_IDEMPOTENCY_KEY"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+)
+
+// MaxIdempotencyKeyLength bounds the keys clients may send
+const MaxIdempotencyKeyLength = 255
+
+// IdempotentResponse is a successful response kept for the retries of the request that produced it,
+// Header holds the headers the handler set such as the response signature
+type IdempotentResponse struct {
+	BodyHash string
+	Status   int
+	Header   http.Header
+	Body     []byte
+}
+
+// unrecordedHeaders describe how the response is encoded on the wire, the replay is encoded again
+var unrecordedHeaders = []string{"Content-Encoding", "Content-Length"}
+
+// IdempotencyStore keeps the responses. The memory store serves a single instance,
+// a shared store such as Redis can implement the interface to answer retries across instances.
+type IdempotencyStore interface {
+	// Get returns the response stored under key if it has not expired
+	Get(key string) (IdempotentResponse, bool)
+	// Put stores the response under key for ttl
+	Put(key string, response IdempotentResponse, ttl time.Duration)
+}
+
+// Idempotency answers a retried request carrying the same Idempotency-Key and body with the stored response,
+// so a retry gets the token already produced rather than a new one. Reusing a key with another body is a 409.
+// Only successful responses are stored, a failed request can be retried with its key.
+func Idempotency(store IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	var locks idempotencyLocks
+	return func(context *gin.Context) {
+		idempotencyKey := context.GetHeader(IdempotencyKeyHeader)
+		if idempotencyKey == "" {
+			context.Next()
+			return
+		}
+		if len(idempotencyKey) > MaxIdempotencyKeyLength {
+			abortIdempotency(context, http.StatusBadRequest, CodeInvalidIdempotencyKey,
+				fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, MaxIdempotencyKeyLength))
+			return
+		}
+
+		// A body that fails to read is handed to the handler as it is, which reports the error
+		body, err := io.ReadAll(context.Request.Body)
+		if err != nil {
+			context.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), failingReader{err}))
+			context.Next()
+			return
+		}
+		context.Request.Body = io.NopCloser(bytes.NewReader(body))
+		bodyDigest := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(bodyDigest[:])
+
+		// Keys are scoped to the route and the client, two clients picking the same key don't collide
+		keyDigest := sha256.Sum256([]byte(context.FullPath() + "|" + clientIdentity(context) + "|" + idempotencyKey))
+		key := hex.EncodeToString(keyDigest[:])
+
+		// Concurrent retries wait for the first one rather than encrypting again
+		unlock := locks.lock(key)
+		defer unlock()
+
+		if stored, ok := store.Get(key); ok {
+			if stored.BodyHash != bodyHash {
+				abortIdempotency(context, http.StatusConflict, CodeIdempotencyKeyReused,
+					fmt.Sprintf("%s was already used with a different request body", IdempotencyKeyHeader))
+				return
+			}
+			for name, values := range stored.Header {
+				context.Writer.Header()[name] = slices.Clone(values)
+			}
+			context.Header(IdempotentReplayedHeader, "true")
+			context.Data(stored.Status, stored.Header.Get("Content-Type"), stored.Body)
+			context.Abort()
+			return
+		}
+
+		// The headers set before, such as the request ID, belong to the request and are not replayed
+		before := context.Writer.Header().Clone()
+		recorder := &responseRecorder{ResponseWriter: context.Writer}
+		context.Writer = recorder
+		context.Next()
+		context.Writer = recorder.ResponseWriter
+
+		if status := recorder.Status(); status >= 200 && status < 300 {
+			header := http.Header{}
+			for name, values := range recorder.Header() {
+				if !slices.Equal(before[name], values) && !slices.Contains(unrecordedHeaders, name) {
+					header[name] = slices.Clone(values)
+				}
+			}
+			store.Put(key, IdempotentResponse{
+				BodyHash: bodyHash,
+				Status:   status,
+				Header:   header,
+				Body:     recorder.body.Bytes(),
+			}, ttl)
+		}
+	}
+}
+
+func abortIdempotency(context *gin.Context, status int, code, message string) {
+	context.Set(ErrorCodeKey, code)
+	abortWithJSON(context, status, model.ErrorResponse{Code: code, Message: message})
+}
+
+// failingReader returns err once the body read before it is consumed
+type failingReader struct {
+	err error
+}
+
+func (reader failingReader) Read([]byte) (int, error) {
+	return 0, reader.err
+}
+
+// responseRecorder copies the response body while it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *responseRecorder) WriteString(data string) (int, error) {
+	recorder.body.WriteString(data)
+	return recorder.ResponseWriter.WriteString(data)
+}
+
+// idempotencyLocks serializes the requests of a key, keys share a fixed set of mutexes so none is ever freed
+type idempotencyLocks [64]sync.Mutex
+
+func (locks *idempotencyLocks) lock(key string) func() {
+	stripe := fnv.New32a()
+	stripe.Write([]byte(key))
+	mutex := &locks[stripe.Sum32()%uint32(len(locks))]
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// MemoryIdempotencyStore keeps the responses in process memory, expired ones are dropped periodically
+type MemoryIdempotencyStore struct {
+	mutex     sync.Mutex
+	responses map[string]storedResponse
+	lastSweep time.Time
+}
+
+type storedResponse struct {
+	response IdempotentResponse
+	expires  time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{responses: make(map[string]storedResponse), lastSweep: clock.Now()}
+}
+
+func (store *MemoryIdempotencyStore) Get(key string) (IdempotentResponse, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	stored, ok := store.responses[key]
+	if !ok || !clock.Now().Before(stored.expires) {
+		return IdempotentResponse{}, false
+	}
+	return stored.response, true
+}
+
+func (store *MemoryIdempotencyStore) Put(key string, response IdempotentResponse, ttl time.Duration) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := clock.Now()
+	if now.Sub(store.lastSweep) >= sweepInterval {
+		for key, stored := range store.responses {
+			if !now.Before(stored.expires) {
+				delete(store.responses, key)
+			}
+		}
+		store.lastSweep = now
+	}
+	store.responses[key] = storedResponse{response: response, expires: now.Add(ttl)}
+}
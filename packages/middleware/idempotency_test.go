@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"io"
+	"jwe-go/packages/clock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyReplaysTheStoredResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(previous clock.Clock) { clock.Current = previous }(clock.Current)
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	clock.Current = fake
+	router := gin.New()
+	router.Use(RequestID())
+	calls := 0
+	router.POST("/v1/encrypt", Idempotency(NewMemoryIdempotencyStore(), time.Minute), func(context *gin.Context) {
+		calls++
+		body, _ := io.ReadAll(context.Request.Body)
+		nonce := make([]byte, 8)
+		rand.Read(nonce)
+		context.Header("X-Response-Signature", "signature-"+hex.EncodeToString(nonce))
+		context.String(http.StatusOK, string(body)+"|"+hex.EncodeToString(nonce))
+	})
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/v1/encrypt", strings.NewReader(body))
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	first := send("retry-1", "plaintext")
+	retry := send("retry-1", "plaintext")
+	if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() || calls != 1 {
+		t.Fatalf("expected the retry to get the first response, got %d %q after %d calls", retry.Code, retry.Body.String(), calls)
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" || first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatal("expected only the replayed response to be marked")
+	}
+	if signature := retry.Header().Get("X-Response-Signature"); signature == "" || signature != first.Header().Get("X-Response-Signature") {
+		t.Fatalf("expected the retry to carry the signature of the first response, got %q", signature)
+	}
+	if retry.Header().Get(RequestIDHeader) == first.Header().Get(RequestIDHeader) {
+		t.Fatal("expected the retry to keep its own request ID")
+	}
+
+	if reused := send("retry-1", "other plaintext"); reused.Code != http.StatusConflict || !strings.Contains(reused.Body.String(), CodeIdempotencyKeyReused) {
+		t.Fatalf("expected a reused key to conflict, got %d %q", reused.Code, reused.Body.String())
+	}
+	if send("", "plaintext"); calls != 2 {
+		t.Fatal("expected a request without a key to reach the handler")
+	}
+	if tooLong := send(strings.Repeat("k", MaxIdempotencyKeyLength+1), "plaintext"); tooLong.Code != http.StatusBadRequest {
+		t.Fatalf("expected an oversized key to be refused, got %d", tooLong.Code)
+	}
+
+	// Past the TTL the stored response is forgotten and the handler runs again
+	fake.Advance(time.Minute)
+	if send("retry-1", "plaintext"); calls != 3 {
+		t.Fatal("expected an expired key to reach the handler")
+	}
+}
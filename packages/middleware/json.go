@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/json"
+	"log"
+	"net/http"
+)
+
+// mimeJSON is the content type gin gives JSON responses
+const mimeJSON = "application/json; charset=utf-8"
+
+// abortWithJSON stops the chain and sends the value encoded by packages/json rather than encoding/json
+func abortWithJSON(context *gin.Context, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("failed to encode %T response: %v", value, err)
+		context.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	context.Abort()
+	context.Data(status, mimeJSON, body)
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Logger logs one line per request in the given format, "json" or "text".
+// Only metadata is logged, never request bodies, so plaintexts and keys stay out of the logs.
+func Logger(format string) gin.HandlerFunc {
+	logger := newLogger(format)
+
+	return func(context *gin.Context) {
+		start := time.Now()
+		context.Next()
+
+		attributes := []slog.Attr{
+			slog.String("method", context.Request.Method),
+			slog.String("path", context.Request.URL.Path),
+			slog.Int("status", context.Writer.Status()),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("request_id", context.GetString(RequestIDKey)),
+		}
+		if keyAlgorithm := context.GetString(KeyAlgorithmKey); keyAlgorithm != "" {
+			attributes = append(attributes, slog.String("alg", keyAlgorithm))
+		}
+		if contentEncryption := context.GetString(ContentEncryptionKey); contentEncryption != "" {
+			attributes = append(attributes, slog.String("enc", contentEncryption))
+		}
+		if tokenID := context.GetString(TokenIDKey); tokenID != "" {
+			attributes = append(attributes, slog.String("token_id", tokenID))
+		}
+		if errorCode := context.GetString(ErrorCodeKey); errorCode != "" {
+			attributes = append(attributes, slog.String("error_code", errorCode))
+		}
+
+		level := slog.LevelInfo
+		if context.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(context.Request.Context(), level, "request", attributes...)
+	}
+}
+
+// newLogger returns a logger writing to stdout in the given format, "json" or "text"
+func newLogger(format string) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	}
+	return slog.New(slog.NewTextHandler(os.Stdout, nil))
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/clock"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CodeRateLimited is the error code returned when a client exceeds its request rate
+const CodeRateLimited = "RATE_LIMITED"
+
+// APIKeyHeader carries the API key APIKeyAuth checks
+const APIKeyHeader = "X-API-Key"
+
+// RateLimit is a token bucket refilled with Rate tokens per second up to Burst, a zero Rate disables limiting
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiterStore keeps the buckets. The memory store serves a single instance,
+// a shared store such as Redis can implement the interface to limit across instances.
+type RateLimiterStore interface {
+	// Allow takes a token from the bucket of key, when it is empty it returns false and the wait for the next token
+	Allow(key string, limit RateLimit) (bool, time.Duration)
+}
+
+// RateLimiter limits every client per route with the limit of the matched route, or defaultLimit for other routes
+func RateLimiter(store RateLimiterStore, defaultLimit RateLimit, routeLimits map[string]RateLimit) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		limit, ok := routeLimits[context.FullPath()]
+		if !ok {
+			limit = defaultLimit
+		}
+		if limit.Rate <= 0 {
+			context.Next()
+			return
+		}
+
+		allowed, retryAfter := store.Allow(context.FullPath()+"|"+clientIdentity(context), limit)
+		if !allowed {
+			context.Set(ErrorCodeKey, CodeRateLimited)
+			context.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			abortWithJSON(context, http.StatusTooManyRequests, model.ErrorResponse{
+				Code:    CodeRateLimited,
+				Message: fmt.Sprintf("rate limit of %g requests per second exceeded", limit.Rate),
+			})
+			return
+		}
+		context.Next()
+	}
+}
+
+// clientIdentity names the client by the API key APIKeyAuth accepted, and by IP without one. A key nobody checked
+// is ignored, a new key on every request would otherwise get a new bucket every time.
+func clientIdentity(context *gin.Context) string {
+	if identity := context.GetString(APIKeyIdentityKey); identity != "" {
+		return "key:" + identity
+	}
+	return "ip:" + context.ClientIP()
+}
+
+// tokenBucket holds the tokens left at the time of the last update and the limit refilling it
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   RateLimit
+}
+
+// MemoryRateLimiterStore keeps the buckets in process memory, idle buckets are dropped once they are full again
+type MemoryRateLimiterStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimiterStore creates an empty in-memory store
+func NewMemoryRateLimiterStore() *MemoryRateLimiterStore {
+	return &MemoryRateLimiterStore{buckets: make(map[string]*tokenBucket), lastSweep: clock.Now()}
+}
+
+// sweepInterval is how often buckets that refilled completely are removed
+const sweepInterval = time.Minute
+
+func (store *MemoryRateLimiterStore) Allow(key string, limit RateLimit) (bool, time.Duration) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := clock.Now()
+	burst := math.Max(float64(limit.Burst), 1)
+	if now.Sub(store.lastSweep) >= sweepInterval {
+		store.sweep(now)
+	}
+
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, updated: now}
+		store.buckets[key] = bucket
+	}
+
+	// Refill for the time since the last request, never above the burst
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*limit.Rate)
+	bucket.updated, bucket.limit = now, limit
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets idle long enough to be full, a new request starts from a full bucket anyway
+func (store *MemoryRateLimiterStore) sweep(now time.Time) {
+	for key, bucket := range store.buckets {
+		missing := math.Max(float64(bucket.limit.Burst), 1) - bucket.tokens
+		if now.Sub(bucket.updated).Seconds()*bucket.limit.Rate >= missing {
+			delete(store.buckets, key)
+		}
+	}
+	store.lastSweep = now
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimiterCountsUncheckedKeysAgainstTheIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := HashAPIKey("checked-api-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseAPIKeyHashes([]string{hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := RateLimit{Rate: 0.001, Burst: 1}
+	handler := func(context *gin.Context) { context.String(http.StatusOK, "encrypted") }
+	router := gin.New()
+	router.POST("/open", RateLimiter(NewMemoryRateLimiterStore(), limit, nil), handler)
+	router.POST("/checked", APIKeyAuth(keys), RateLimiter(NewMemoryRateLimiterStore(), limit, nil), handler)
+	send := func(path, apiKey string) int {
+		request := httptest.NewRequest(http.MethodPost, path, nil)
+		request.Header.Set(APIKeyHeader, apiKey)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// Without API keys configured a new key per request still shares the bucket of the IP
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		if status := send("/open", fmt.Sprintf("random-key-%d", i)); status != expected {
+			t.Fatalf("request %d with an unchecked key: expected %d, got %d", i, expected, status)
+		}
+	}
+
+	// A checked key is limited in the bucket of the key
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		if status := send("/checked", "checked-api-key"); status != expected {
+			t.Fatalf("request %d with a checked key: expected %d, got %d", i, expected, status)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/metrics"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// CodeInternal is the error code returned when a handler panics
+const CodeInternal = "INTERNAL"
+
+// Recovery turns a panic in a later handler into a 500 INTERNAL response and counts it.
+// The stack is logged with the request ID, the panic value only by type: it may hold plaintext or key
+// material, and neither reaches the client.
+func Recovery(format string) gin.HandlerFunc {
+	logger := newLogger(format)
+
+	return func(context *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// net/http aborts the connection quietly on this one, it is not a bug
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			metrics.RecordPanic(context.FullPath())
+			logger.LogAttrs(context.Request.Context(), slog.LevelError, "panic",
+				slog.String("method", context.Request.Method),
+				slog.String("path", context.Request.URL.Path),
+				slog.String("request_id", context.GetString(RequestIDKey)),
+				slog.String("panic_type", fmt.Sprintf("%T", recovered)),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			context.Set(ErrorCodeKey, CodeInternal)
+			if context.Writer.Written() {
+				context.Abort()
+				return
+			}
+			abortWithJSON(context, http.StatusInternalServerError, model.ErrorResponse{
+				Code:    CodeInternal,
+				Message: "internal server error",
+			})
+		}()
+		context.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryAnswersPanicsWithASanitizedError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), Recovery("text"))
+	router.POST("/v1/decrypt", func(context *gin.Context) {
+		panic("unwrap failed for key 3q2+7w==")
+	})
+
+	before := panicCount(t, "/v1/decrypt")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/decrypt", nil))
+
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), `"code":"INTERNAL"`) {
+		t.Fatalf("expected a 500 INTERNAL error, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if strings.Contains(recorder.Body.String(), "3q2+7w") || strings.Contains(recorder.Body.String(), "unwrap") {
+		t.Fatalf("expected the panic message to stay out of the response, got %q", recorder.Body.String())
+	}
+	if recorder.Header().Get(RequestIDHeader) == "" {
+		t.Fatal("expected the request ID on the error response")
+	}
+	if after := panicCount(t, "/v1/decrypt"); after != before+1 {
+		t.Fatalf("expected the panic to be counted, got %v then %v", before, after)
+	}
+}
+
+// panicCount reads the jwe_panics_total counter of the route from the default registry
+func panicCount(t *testing.T, route string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "jwe_panics_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "route" && label.GetValue() == route {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
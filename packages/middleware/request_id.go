@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader is the response header echoing the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// Context keys set by the middleware and the handlers
+const (
+	RequestIDKey         = "requestID"
+	KeyAlgorithmKey      = "keyAlgorithm"
+	ContentEncryptionKey = "contentEncryption"
+	ErrorCodeKey         = "errorCode"
+	KeyThumbprintKey     = "keyThumbprint"
+	TokenIDKey           = "tokenID"
+	APIKeyTenantKey      = "apiKeyTenant"
+	AdminKey             = "admin"
+	APIKeyIdentityKey    = "apiKeyIdentity"
+)
+
+// RequestID attaches a random request ID to the context and the response headers
+func RequestID() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		requestID := newRequestID()
+		context.Set(RequestIDKey, requestID)
+		context.Header(RequestIDHeader, requestID)
+		context.Next()
+	}
+}
+
+// SetAlgorithms records the algorithms used by a crypto endpoint so they can be logged
+func SetAlgorithms(context *gin.Context, keyAlgorithm, contentEncryption string) {
+	context.Set(KeyAlgorithmKey, keyAlgorithm)
+	context.Set(ContentEncryptionKey, contentEncryption)
+}
+
+// SetKeyThumbprint records the thumbprint of the key a crypto endpoint used so it can be audited
+func SetKeyThumbprint(context *gin.Context, thumbprint string) {
+	context.Set(KeyThumbprintKey, thumbprint)
+}
+
+// SetTokenID records the ID of the token a crypto endpoint encrypted or decrypted so it can be logged and audited
+func SetTokenID(context *gin.Context, tokenID string) {
+	context.Set(TokenIDKey, tokenID)
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
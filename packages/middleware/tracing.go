@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"jwe-go/packages/tracing"
+	"net/http"
+)
+
+// Tracing starts a server span for every request, continuing the trace of an incoming traceparent header.
+// Handlers and crypto functions start their spans under it through the request context.
+func Tracing() gin.HandlerFunc {
+	propagator := propagation.TraceContext{}
+	return func(context *gin.Context) {
+		route := context.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx := propagator.Extract(context.Request.Context(), propagation.HeaderCarrier(context.Request.Header))
+		ctx, span := tracing.StartServer(ctx, context.Request.Method+" "+route,
+			attribute.String("http.request.method", context.Request.Method),
+			attribute.String("http.route", route),
+		)
+		defer span.End()
+		context.Request = context.Request.WithContext(ctx)
+
+		context.Next()
+
+		status := context.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if requestID := context.GetString(RequestIDKey); requestID != "" {
+			span.SetAttributes(attribute.String("request_id", requestID))
+		}
+		if alg := context.GetString(KeyAlgorithmKey); alg != "" {
+			span.SetAttributes(tracing.AttributeKeyAlgorithm.String(alg))
+		}
+		if enc := context.GetString(ContentEncryptionKey); enc != "" {
+			span.SetAttributes(tracing.AttributeContentEncryption.String(enc))
+		}
+		code := context.GetString(ErrorCodeKey)
+		if code != "" {
+			span.SetAttributes(tracing.AttributeErrorCode.String(code))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, code)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	stdcontext "context"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"jwe-go/packages/tracing"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracingContinuesTheIncomingTrace(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	exporter := tracetest.NewInMemoryExporter()
+	defer tracing.SetExporter(exporter)(stdcontext.Background())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), Tracing())
+	router.POST("/v1/encrypt", func(context *gin.Context) {
+		_, span := tracing.Start(context.Request.Context(), "encrypt")
+		span.End()
+		SetAlgorithms(context, "RSA-OAEP-256", "A256GCM")
+		context.Status(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/encrypt", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	// The in-memory exporter forgets its spans on shutdown, flushing hands them over
+	if err := otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(stdcontext.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected the handler and server spans, got %d", len(spans))
+	}
+	child, server := spans[0], spans[1]
+	if server.Name != "POST /v1/encrypt" || server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the server span in the incoming trace, got %q in %s", server.Name, server.SpanContext.TraceID())
+	}
+	if !server.Parent.IsRemote() || server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the caller span as parent, got %s", server.Parent.SpanID())
+	}
+	if child.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Fatal("expected the handler span under the server span")
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range server.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	if attributes[tracing.AttributeKeyAlgorithm].AsString() != "RSA-OAEP-256" || attributes["http.response.status_code"].AsInt64() != http.StatusOK {
+		t.Fatalf("expected the algorithms and status on the server span, got %v", server.Attributes)
+	}
+}
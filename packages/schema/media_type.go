@@ -0,0 +1,17 @@
+package schema
+
+import (
+	"github.com/go-playground/validator/v10"
+	"mime"
+	"strings"
+)
+
+// validateMediaType checks the field is a media type like application/jose, or the short form without application/ that typ and cty allow
+func validateMediaType(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if value != strings.TrimSpace(value) {
+		return false
+	}
+	_, _, err := mime.ParseMediaType(value)
+	return err == nil
+}
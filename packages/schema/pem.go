@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"encoding/pem"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"jwe-go/packages/crypto"
+	"strings"
+)
+
+// pemKind describes a pem=<kind> rule: the block types it accepts and the type assumed for bare base64
+type pemKind struct {
+	defaultType string
+	types       []string
+}
+
+var pemKinds = map[string]pemKind{
+	"public":      {defaultType: "PUBLIC KEY", types: []string{"PUBLIC KEY"}},
+	"private":     {defaultType: "PRIVATE KEY", types: []string{"PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY"}},
+	"certificate": {defaultType: "CERTIFICATE", types: []string{"CERTIFICATE"}},
+}
+
+// validatePEM checks the field holds a well formed PEM block of the kind named by the param.
+// Like the crypto import functions it accepts bare base64 and adds the missing headers.
+func validatePEM(fl validator.FieldLevel) bool {
+	kind, ok := pemKinds[fl.Param()]
+	if !ok {
+		return false
+	}
+
+	value := fl.Field().String()
+	// A cached public key was imported from this exact PEM, decoding it again would only repeat the work
+	if fl.Param() == "public" && crypto.PublicKeys.Contains(value) {
+		return true
+	}
+	value = crypto.NormalizePEM(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		value = fmt.Sprintf("-----BEGIN %s-----\n%s\n-----END %s-----", kind.defaultType, value, kind.defaultType)
+	}
+
+	// Bundles are accepted when any block is of the kind, the import functions skip the others
+	for rest := []byte(value); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return false
+		}
+		for _, blockType := range kind.types {
+			if block.Type == blockType {
+				return true
+			}
+		}
+	}
+}
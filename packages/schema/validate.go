@@ -1,6 +1,77 @@
 package schema
 
-import "github.com/go-playground/validator/v10"
+import (
+	"github.com/go-playground/validator/v10"
+	"jwe-go/packages/crypto"
+	"reflect"
+	"strings"
+)
 
 // use a single instance of Validate, it caches struct info
 var Validate *validator.Validate
+
+// New builds a validator with the custom rules used by the request models
+func New() *validator.Validate {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+
+	// mutex=A B rejects the field when any of the listed sibling fields is also set
+	validate.RegisterValidation("mutex", validateMutex)
+	// nonempty=A B rejects an empty field unless one of the sibling fields is set, a bool one true
+	validate.RegisterValidation("nonempty", validateNonEmpty)
+	// pem=public|private|certificate checks the field is a PEM block of that kind
+	validate.RegisterValidation("pem", validatePEM)
+	// mediatype checks the field is a media type, as the typ and cty headers carry
+	validate.RegisterValidation("mediatype", validateMediaType)
+	// flexbase64=A checks the field is base64 or base64url, only unpadded base64url when the bool sibling field A is true
+	validate.RegisterValidation("flexbase64", validateFlexibleBase64)
+
+	return validate
+}
+
+func validateMutex(fl validator.FieldLevel) bool {
+	if fl.Field().IsZero() {
+		return true
+	}
+
+	parent := fl.Parent()
+	if parent.Kind() == reflect.Ptr {
+		parent = parent.Elem()
+	}
+
+	for _, name := range strings.Fields(fl.Param()) {
+		sibling := parent.FieldByName(name)
+		if sibling.IsValid() && !sibling.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+func validateNonEmpty(fl validator.FieldLevel) bool {
+	if !fl.Field().IsZero() {
+		return true
+	}
+
+	parent := fl.Parent()
+	if parent.Kind() == reflect.Ptr {
+		parent = parent.Elem()
+	}
+
+	for _, name := range strings.Fields(fl.Param()) {
+		if override := parent.FieldByName(name); override.IsValid() && !override.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func validateFlexibleBase64(fl validator.FieldLevel) bool {
+	parent := fl.Parent()
+	if parent.Kind() == reflect.Ptr {
+		parent = parent.Elem()
+	}
+
+	strict := parent.FieldByName(fl.Param())
+	_, err := crypto.DecodeBase64(fl.Field().String(), strict.IsValid() && strict.Kind() == reflect.Bool && strict.Bool())
+	return err == nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Options tune the HTTP server. ReadHeaderTimeout bounds how long a client may take to send its headers,
+// so slow clients can't hold connections open, the other timeouts are those of http.Server.
+type Options struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is the time in-flight requests get to finish
+	ShutdownTimeout time.Duration
+	// H2C serves HTTP/2 without TLS to clients asking for it, as proxies terminating TLS do
+	H2C bool
+}
+
+// New creates the server serving the handler with the options
+func New(handler http.Handler, options Options) *http.Server {
+	if options.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: options.IdleTimeout})
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		ReadTimeout:       options.ReadTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+	}
+}
+
+// Run serves the handler on the address until SIGINT or SIGTERM, then drains in-flight requests for up to the shutdown timeout
+func Run(address string, handler http.Handler, options Options) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, listener, handler, options)
+}
+
+// Serve serves the handler on the listener until ctx is done. The listener is closed right away so new
+// connections are refused, requests already being handled get up to the shutdown timeout to finish.
+func Serve(ctx context.Context, listener net.Listener, handler http.Handler, options Options) error {
+	server := New(handler, options)
+	timeout := options.ShutdownTimeout
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("in-flight requests did not finish within %s: %w", timeout, err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(writer, "finished")
+	})
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, listener, handler, Options{ShutdownTimeout: 5 * time.Second})
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		responses <- result{string(body), err}
+	}()
+
+	// Shut down while the request is being handled, it must still get its response
+	<-started
+	shutdown()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-served:
+		t.Fatalf("expected Serve to wait for the in-flight request, returned %v", err)
+	default:
+	}
+	if _, err := net.DialTimeout("tcp", listener.Addr().String(), time.Second); err == nil {
+		t.Fatalf("expected new connections to be refused during shutdown")
+	}
+
+	close(release)
+	if response := <-responses; response.err != nil || response.body != "finished" {
+		t.Fatalf("expected the in-flight request to complete, got %q, %v", response.body, response.err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestServeGivesUpAfterTheTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, listener, handler, Options{ShutdownTimeout: 100 * time.Millisecond})
+	}()
+	go http.Get("http://" + listener.Addr().String())
+
+	<-started
+	shutdown()
+	if err := <-served; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the shutdown to time out, got %v", err)
+	}
+}
+
+func TestNewAppliesTheTimeoutsAndServesH2C(t *testing.T) {
+	options := Options{
+		ReadHeaderTimeout: 100 * time.Millisecond,
+		ReadTimeout:       2 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		IdleTimeout:       4 * time.Second,
+		ShutdownTimeout:   time.Second,
+		H2C:               true,
+	}
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, request.Proto)
+	})
+	server := New(handler, options)
+	if server.ReadHeaderTimeout != options.ReadHeaderTimeout || server.ReadTimeout != options.ReadTimeout ||
+		server.WriteTimeout != options.WriteTimeout || server.IdleTimeout != options.IdleTimeout {
+		t.Fatalf("expected the timeouts of the options, got %+v", server)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	go Serve(ctx, listener, handler, options)
+
+	// A client that never finishes its headers is dropped after ReadHeaderTimeout
+	connection, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	io.WriteString(connection, "POST /v1/decrypt HTTP/1.1\r\nHost: localhost\r\n")
+	connection.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(connection); err != nil {
+		t.Fatalf("expected the server to close the slow connection, got %v", err)
+	}
+
+	// Clients with prior knowledge speak HTTP/2 over cleartext
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, address string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	}}
+	response, err := client.Get("http://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if body, _ := io.ReadAll(response.Body); string(body) != "HTTP/2.0" {
+		t.Fatalf("expected the request served over HTTP/2, got %q", body)
+	}
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+// ScopeName is the instrumentation scope of every span of the service
+const ScopeName = "jwe-go"
+
+// Exporters TRACING_EXPORTER can name, none keeps the no-op tracer
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+)
+
+// Span attributes, they describe the algorithms and keys of a request and never carry key material or plaintexts
+const (
+	AttributeKeyAlgorithm      = attribute.Key("jwe.alg")
+	AttributeContentEncryption = attribute.Key("jwe.enc")
+	AttributeKeyType           = attribute.Key("jwe.key.type")
+	AttributeKeySize           = attribute.Key("jwe.key.size")
+	AttributeSerialization     = attribute.Key("jwe.serialization")
+	AttributeErrorCode         = attribute.Key("jwe.error_code")
+)
+
+// Start starts a span under the one in ctx, spans are dropped by the global no-op provider until SetExporter installs one
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(ScopeName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// StartServer starts the span of an incoming request, ctx carries the remote parent extracted from traceparent, if any
+func StartServer(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(ScopeName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+}
+
+// End marks the span failed when err is set and ends it, the message of crypto errors never holds secrets
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// NewExporter creates the exporter TRACING_EXPORTER names, nil for none
+func NewExporter(name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	return nil, fmt.Errorf("unsupported exporter %q, supported values are: %s, %s", name, ExporterNone, ExporterStdout)
+}
+
+// SetExporter sends the spans to the exporter in batches and returns the function flushing them at shutdown.
+// Any sdktrace.SpanExporter plugs in, such as an OTLP one built by an embedding program.
+func SetExporter(exporter sdktrace.SpanExporter) func(context.Context) error {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown
+}
@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+// KeyCacheEndpoint lists the thumbprints of the imported public keys the server keeps, with the cache hit and miss counts
+func KeyCacheEndpoint(context *gin.Context) {
+	stats := crypto.PublicKeys.Stats()
+	writeJSON(context, http.StatusOK, model.KeyCacheResponse{
+		Size:        stats.Size,
+		Capacity:    stats.Capacity,
+		Hits:        stats.Hits,
+		Misses:      stats.Misses,
+		Thumbprints: crypto.PublicKeys.Thumbprints(),
+	})
+}
+
+// EvictCachedKeyEndpoint drops a key from the cache, e.g. once it is compromised.
+// A later request sending the key imports it again, eviction only drops what the server derived from it.
+func EvictCachedKeyEndpoint(context *gin.Context) {
+	thumbprint := context.Param("kid")
+	if crypto.PublicKeys.Evict(thumbprint) == 0 {
+		writeError(context, http.StatusNotFound, CodeKeyNotFound, fmt.Errorf("no cached key with thumbprint %q", thumbprint))
+		return
+	}
+
+	KeyCacheEndpoint(context)
+}
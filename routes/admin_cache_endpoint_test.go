@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEvictedKeysAreImportedAgain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.GET("/v1/admin/cache", KeyCacheEndpoint)
+	router.DELETE("/v1/admin/cache/:kid", EvictCachedKeyEndpoint)
+	defer func(cache *crypto.KeyCache) { crypto.PublicKeys = cache }(crypto.PublicKeys)
+	crypto.PublicKeys = crypto.NewKeyCache(8)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, _ := crypto.ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	entry, _ := crypto.NewPublicKeyEntry(&privateKey.PublicKey)
+	encrypt := func() {
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "cached", PublicKeyPem: publicKeyPem})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected the token, got %d %q", recorder.Code, recorder.Body.String())
+		}
+	}
+	listing := func(method, path string, status int) model.KeyCacheResponse {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		var response model.KeyCacheResponse
+		if recorder.Code != status {
+			t.Fatalf("expected %d from %s %s, got %d %q", status, method, path, recorder.Code, recorder.Body.String())
+		}
+		encodingjson.Unmarshal(recorder.Body.Bytes(), &response)
+		return response
+	}
+
+	encrypt()
+	encrypt()
+	if response := listing(http.MethodGet, "/v1/admin/cache", http.StatusOK); len(response.Thumbprints) != 1 || response.Thumbprints[0] != entry.Thumbprint || response.Hits != 1 || response.Misses != 1 {
+		t.Fatalf("expected the key cached after one miss and one hit, got %+v", response)
+	}
+
+	if response := listing(http.MethodDelete, "/v1/admin/cache/"+entry.Thumbprint, http.StatusOK); len(response.Thumbprints) != 0 {
+		t.Fatalf("expected the key evicted, got %+v", response)
+	}
+	listing(http.MethodDelete, "/v1/admin/cache/"+entry.Thumbprint, http.StatusNotFound)
+
+	// The next request sending the key imports it again
+	encrypt()
+	if response := listing(http.MethodGet, "/v1/admin/cache", http.StatusOK); len(response.Thumbprints) != 1 || response.Misses != 2 {
+		t.Fatalf("expected the key cached again after a second miss, got %+v", response)
+	}
+}
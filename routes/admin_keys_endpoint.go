@@ -0,0 +1,150 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+	"time"
+)
+
+func ListKeysEndpoint(context *gin.Context) {
+	tenant, ok := requestTenant(context)
+	if !ok {
+		return
+	}
+	store := crypto.TenantKeys.Lookup(tenant)
+	thumbprints, primary := store.Thumbprints()
+
+	keys := make([]model.KeySummary, 0, len(thumbprints))
+	for _, thumbprint := range thumbprints {
+		entry, ok := store.Get(thumbprint)
+		if !ok {
+			continue // retired since the listing
+		}
+		summary := model.KeySummary{
+			Thumbprint: thumbprint,
+			KeyType:    entry.KeyType.String(),
+			Primary:    thumbprint == primary,
+			Algorithms: entry.Algorithms,
+		}
+		if !entry.NotAfter.IsZero() {
+			summary.NotAfter = entry.NotAfter.UTC().Format(time.RFC3339)
+		}
+		keys = append(keys, summary)
+	}
+
+	writeJSON(context, http.StatusOK, model.ListKeysResponse{
+		Tenant:  tenant,
+		Primary: primary,
+		Keys:    keys,
+	})
+}
+
+func PromoteKeyEndpoint(context *gin.Context) {
+	var request model.KeyThumbprintRequest
+	if !readKeyThumbprintRequest(context, &request) {
+		return
+	}
+
+	keys, ok := tenantKeys(context)
+	if !ok {
+		return
+	}
+	if err := keys.SetPrimary(request.Thumbprint); err != nil {
+		writeKeyStoreError(context, err)
+		return
+	}
+
+	ListKeysEndpoint(context)
+}
+
+func RetireKeyEndpoint(context *gin.Context) {
+	var request model.KeyThumbprintRequest
+	if !readKeyThumbprintRequest(context, &request) {
+		return
+	}
+
+	keys, ok := tenantKeys(context)
+	if !ok {
+		return
+	}
+	if err := keys.Retire(request.Thumbprint); err != nil {
+		writeKeyStoreError(context, err)
+		return
+	}
+
+	ListKeysEndpoint(context)
+}
+
+// keyProvider is where the reload route loads the keys from, the route is only registered once it is set
+var keyProvider crypto.KeyProvider
+
+// SetKeyProvider sets the backend ReloadKeysEndpoint loads the private keys from
+func SetKeyProvider(provider crypto.KeyProvider) {
+	keyProvider = provider
+}
+
+// ReloadKeysEndpoint loads the keys of the tenant from the key provider again and swaps its registered keys for them at once.
+// The default tenant gets the keys of the provider itself, other tenants those the provider holds for them.
+// Keys that fail to load leave the current keys in place.
+func ReloadKeysEndpoint(context *gin.Context) {
+	tenant, ok := requestTenant(context)
+	if !ok {
+		return
+	}
+
+	provider := keyProvider
+	if tenant != crypto.DefaultTenant {
+		var err error
+		if provider, err = keyProvider.Tenant(tenant); errors.Is(err, crypto.ErrNoTenantKeys) {
+			writeError(context, http.StatusNotFound, CodeKeyNotFound, err)
+			return
+		} else if err != nil {
+			writeError(context, http.StatusInternalServerError, CodeKeyReloadFailed, err)
+			return
+		}
+	}
+
+	loaded, err := crypto.LoadKeyStore(context.Request.Context(), provider)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeKeyReloadFailed, err)
+		return
+	}
+	store := crypto.TenantKeys.Store(tenant)
+	store.Replace(loaded)
+
+	thumbprints, primary := store.Thumbprints()
+	writeJSON(context, http.StatusOK, model.ReloadKeysResponse{
+		Tenant:      tenant,
+		Count:       len(thumbprints),
+		Primary:     primary,
+		Thumbprints: thumbprints,
+	})
+}
+
+func readKeyThumbprintRequest(context *gin.Context, request *model.KeyThumbprintRequest) bool {
+	// Read and strictly unmarshal the request body
+	if !readBody(context, request) {
+		return false
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, request) {
+		return false
+	}
+	return true
+}
+
+// writeKeyStoreError maps key store failures, unknown keys are a 404 and retiring the primary a 409
+func writeKeyStoreError(context *gin.Context, err error) {
+	switch {
+	case errors.Is(err, crypto.ErrKeyNotFound):
+		writeError(context, http.StatusNotFound, CodeKeyNotFound, err)
+	case errors.Is(err, crypto.ErrPrimaryKey):
+		writeError(context, http.StatusConflict, CodeKeyInUse, err)
+	default:
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+	}
+}
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	encodingjson "encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeKeyProvider serves keys from memory, as a secrets manager backend would
+type fakeKeyProvider struct {
+	keys    []crypto.Key
+	err     error
+	tenants map[string]*fakeKeyProvider
+}
+
+func (provider *fakeKeyProvider) LoadKeys(ctx context.Context) ([]crypto.Key, error) {
+	return provider.keys, provider.err
+}
+
+func (provider *fakeKeyProvider) Tenant(tenant string) (crypto.KeyProvider, error) {
+	if tenantProvider, ok := provider.tenants[tenant]; ok {
+		return tenantProvider, nil
+	}
+	return nil, crypto.ErrNoTenantKeys
+}
+
+func (provider *fakeKeyProvider) Tenants(ctx context.Context) ([]string, error) {
+	tenants := make([]string, 0, len(provider.tenants))
+	for tenant := range provider.tenants {
+		tenants = append(tenants, tenant)
+	}
+	return tenants, nil
+}
+
+func TestReloadKeysEndpointLoadsFromTheKeyProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/admin/reload-keys", middleware.AdminAuth("admin-token"), ReloadKeysEndpoint)
+	defer SetKeyProvider(keyProvider)
+	defer func(store *crypto.KeyStore) { crypto.PrivateKeys = store }(crypto.PrivateKeys)
+	crypto.PrivateKeys = crypto.NewKeyStore()
+
+	newKey := func() crypto.Key {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crypto.Key{PrivateKey: privateKey}
+	}
+	provider := &fakeKeyProvider{
+		keys:    []crypto.Key{newKey(), newKey()},
+		tenants: map[string]*fakeKeyProvider{"reload-tenant": {keys: []crypto.Key{newKey()}}},
+	}
+	SetKeyProvider(provider)
+	reload := func(tenant string, status int) model.ReloadKeysResponse {
+		request := httptest.NewRequest(http.MethodPost, "/v1/admin/reload-keys", nil)
+		request.Header.Set(TenantHeader, tenant)
+		request.Header.Set("Authorization", "Bearer admin-token")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != status {
+			t.Fatalf("expected %d reloading tenant %q, got %d %q", status, tenant, recorder.Code, recorder.Body.String())
+		}
+		var response model.ReloadKeysResponse
+		encodingjson.Unmarshal(recorder.Body.Bytes(), &response)
+		return response
+	}
+
+	if response := reload("", http.StatusOK); response.Count != 2 || response.Primary == "" {
+		t.Fatalf("expected both keys of the provider registered, got %+v", response)
+	}
+	if response := reload("reload-tenant", http.StatusOK); response.Count != 1 {
+		t.Fatalf("expected the key of the tenant registered, got %+v", response)
+	}
+	if thumbprints, _ := crypto.PrivateKeys.Thumbprints(); len(thumbprints) != 2 {
+		t.Fatalf("expected the tenant keys to stay apart from the default ones, got %d default keys", len(thumbprints))
+	}
+	reload("other-tenant", http.StatusNotFound)
+
+	// A provider failing to load leaves the registered keys in place
+	provider.err = errors.New("backend unavailable")
+	reload("", http.StatusInternalServerError)
+	if thumbprints, _ := crypto.PrivateKeys.Thumbprints(); len(thumbprints) != 2 {
+		t.Fatalf("expected the keys kept after a failed reload, got %d", len(thumbprints))
+	}
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+// Server-wide algorithm allowlists set by SetAlgorithmPolicy, nil allows every supported algorithm
+var (
+	allowedKeyAlgorithms       map[string]bool
+	allowedContentEncryptions  map[string]bool
+	allowedSignatureAlgorithms map[string]bool
+)
+
+// SetAlgorithmPolicy restricts the algorithms the endpoints accept regardless of the request, empty lists allow everything
+func SetAlgorithmPolicy(keyAlgorithms, contentEncryptions, signatureAlgorithms []string) error {
+	supportedKeyAlgorithms := make([]string, 0, len(crypto.SupportedKeyAlgorithms)+len(crypto.SymmetricKeyAlgorithms)+len(crypto.PasswordKeyAlgorithms))
+	for _, alg := range append(append(crypto.SupportedKeyAlgorithms, crypto.SymmetricKeyAlgorithms...), crypto.PasswordKeyAlgorithms...) {
+		supportedKeyAlgorithms = append(supportedKeyAlgorithms, string(alg))
+	}
+	supportedContentEncryptions := make([]string, len(crypto.SupportedContentEncryptions))
+	for i, enc := range crypto.SupportedContentEncryptions {
+		supportedContentEncryptions[i] = string(enc)
+	}
+	supportedSignatureAlgorithms := make([]string, len(crypto.SupportedSignatureAlgorithms))
+	for i, alg := range crypto.SupportedSignatureAlgorithms {
+		supportedSignatureAlgorithms[i] = string(alg)
+	}
+
+	var err error
+	if allowedKeyAlgorithms, err = allowlist("key algorithm", keyAlgorithms, supportedKeyAlgorithms); err != nil {
+		return err
+	}
+	if allowedContentEncryptions, err = allowlist("content encryption", contentEncryptions, supportedContentEncryptions); err != nil {
+		return err
+	}
+	allowedSignatureAlgorithms, err = allowlist("signature algorithm", signatureAlgorithms, supportedSignatureAlgorithms)
+	return err
+}
+
+// allowlist builds the lookup for the names, rejecting names that aren't supported so typos don't go unnoticed
+func allowlist(kind string, names, supported []string) (map[string]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(supported))
+	for _, name := range supported {
+		known[name] = true
+	}
+
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("unsupported %s %q in the allowlist", kind, name)
+		}
+		allowed[name] = true
+	}
+	return allowed, nil
+}
+
+// checkEncryptionAllowed rejects key management and content encryption algorithms forbidden by the server policy
+func checkEncryptionAllowed(context *gin.Context, keyAlgorithm jose.KeyAlgorithm, contentEncryption jose.ContentEncryption) bool {
+	if failure := encryptionPolicyError(keyAlgorithm, contentEncryption); failure != nil {
+		writeStatusError(context, failure)
+		return false
+	}
+	return true
+}
+
+// encryptionPolicyError is the failure checkEncryptionAllowed reports, nil when the policy allows both algorithms
+func encryptionPolicyError(keyAlgorithm jose.KeyAlgorithm, contentEncryption jose.ContentEncryption) *statusError {
+	if allowedKeyAlgorithms != nil && !allowedKeyAlgorithms[string(keyAlgorithm)] {
+		return &statusError{http.StatusBadRequest, CodeAlgorithmNotAllowed, fmt.Errorf("key algorithm %s is not allowed by the server policy", keyAlgorithm)}
+	}
+	if allowedContentEncryptions != nil && !allowedContentEncryptions[string(contentEncryption)] {
+		return &statusError{http.StatusBadRequest, CodeAlgorithmNotAllowed, fmt.Errorf("content encryption %s is not allowed by the server policy", contentEncryption)}
+	}
+	return nil
+}
+
+// signatureAllowed reports whether the server policy permits the JWS algorithm
+func signatureAllowed(algorithm jose.SignatureAlgorithm) bool {
+	return allowedSignatureAlgorithms == nil || allowedSignatureAlgorithms[string(algorithm)]
+}
+
+// checkSignatureAllowed rejects JWS algorithms forbidden by the server policy
+func checkSignatureAllowed(context *gin.Context, algorithm jose.SignatureAlgorithm) bool {
+	if !signatureAllowed(algorithm) {
+		writeError(context, http.StatusBadRequest, CodeAlgorithmNotAllowed, fmt.Errorf("signature algorithm %s is not allowed by the server policy", algorithm))
+		return false
+	}
+	return true
+}
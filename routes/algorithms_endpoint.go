@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+// AlgorithmsEndpoint reports what the server accepts, the supported lists narrowed by the algorithm policy
+func AlgorithmsEndpoint(context *gin.Context) {
+	// Empty lists rather than null, so clients can range over every field
+	keyAlgorithms, legacyKeyAlgorithms, nonStandardKeyAlgorithms := []string{}, []string{}, []string{}
+	for _, alg := range append(append(crypto.SupportedKeyAlgorithms, crypto.SymmetricKeyAlgorithms...), crypto.PasswordKeyAlgorithms...) {
+		if allowedKeyAlgorithms != nil && !allowedKeyAlgorithms[string(alg)] {
+			continue
+		}
+		keyAlgorithms = append(keyAlgorithms, string(alg))
+		if alg == jose.RSA1_5 || alg == jose.RSA_OAEP {
+			legacyKeyAlgorithms = append(legacyKeyAlgorithms, string(alg))
+		}
+		if crypto.IsNonStandardKeyAlgorithm(alg) {
+			nonStandardKeyAlgorithms = append(nonStandardKeyAlgorithms, string(alg))
+		}
+	}
+
+	contentEncryptions := []string{}
+	for _, enc := range crypto.SupportedContentEncryptions {
+		if allowedContentEncryptions == nil || allowedContentEncryptions[string(enc)] {
+			contentEncryptions = append(contentEncryptions, string(enc))
+		}
+	}
+
+	signatureAlgorithms := []string{}
+	for _, alg := range crypto.SupportedSignatureAlgorithms {
+		if signatureAllowed(alg) {
+			signatureAlgorithms = append(signatureAlgorithms, string(alg))
+		}
+	}
+
+	passwordKeyAlgorithm, _ := crypto.ParsePasswordKeyAlgorithm("") // The default never fails
+	writeJSON(context, http.StatusOK, model.AlgorithmsResponse{
+		KeyAlgorithms: model.AlgorithmCategory{
+			Supported: keyAlgorithms,
+			Defaults: map[string]string{
+				crypto.KeyTypeRSA.String():    string(crypto.DefaultKeyAlgorithm(crypto.KeyTypeRSA)),
+				crypto.KeyTypeEC.String():     string(crypto.DefaultKeyAlgorithm(crypto.KeyTypeEC)),
+				crypto.KeyTypeX25519.String(): string(crypto.DefaultKeyAlgorithm(crypto.KeyTypeX25519)),
+				"oct":                         string(jose.DIRECT),
+				"password":                    string(passwordKeyAlgorithm),
+			},
+		},
+		LegacyKeyAlgorithms:      legacyKeyAlgorithms,
+		NonStandardKeyAlgorithms: nonStandardKeyAlgorithms,
+		ContentEncryptions: model.AlgorithmCategory{
+			Supported: contentEncryptions,
+			Default:   string(crypto.DefaultContentEncryption),
+		},
+		SignatureAlgorithms: model.AlgorithmCategory{
+			Supported: signatureAlgorithms,
+			Defaults: map[string]string{
+				crypto.KeyTypeRSA.String():     string(crypto.DefaultSignatureAlgorithm(crypto.KeyTypeRSA)),
+				crypto.KeyTypeEC.String():      string(crypto.DefaultSignatureAlgorithm(crypto.KeyTypeEC)),
+				crypto.KeyTypeEd25519.String(): string(crypto.DefaultSignatureAlgorithm(crypto.KeyTypeEd25519)),
+			},
+		},
+		KeyTypes: []string{crypto.KeyTypeRSA.String(), crypto.KeyTypeEC.String(), crypto.KeyTypeX25519.String(), "oct"},
+		Curves:   crypto.SupportedCurves,
+		Serializations: model.AlgorithmCategory{
+			Supported: []string{"compact", "json"},
+			Default:   "compact",
+		},
+	})
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"net/http"
+	"time"
+)
+
+func BatchEncryptEndpoint(context *gin.Context) {
+	var batch model.BatchEncryptRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &batch) {
+		return
+	}
+
+	// Cap the batch before doing any crypto work
+	if len(batch.Plaintexts) > config.Current.MaxBatchSize {
+		writeError(context, http.StatusRequestEntityTooLarge, CodeBatchTooLarge, fmt.Errorf("batch exceeds the maximum of %d plaintexts", config.Current.MaxBatchSize))
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, batch) {
+		return
+	}
+
+	contentEncryption, err := crypto.ParseContentEncryption(batch.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+
+	recipientKey, err := crypto.GetOrImportPublicKey(batch.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(batch.KeyAlgorithm, recipientKey.KeyType, batch.AllowLegacyRSA15, batch.AllowLegacyHash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	serverKid, serverKidHash, ok := recipientServerKid(context, recipientKey, "")
+	if !ok {
+		return
+	}
+
+	// A single pooled encrypter is shared by every item, each Encrypt call still gets a fresh CEK
+	encrypter, err := crypto.Encrypters.Get(crypto.EncrypterKey{
+		Thumbprint:        serverKid,
+		ServerKidHash:     serverKidHash,
+		KeyAlgorithm:      keyAlgorithm,
+		ContentEncryption: contentEncryption,
+	}, recipientKey.PublicKey)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+
+	// Failures are reported per item so one bad entry doesn't fail the batch, the deadline covers the whole batch
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	results := make([]model.BatchEncryptResult, len(batch.Plaintexts))
+	for i, plaintext := range batch.Plaintexts {
+		if failure := contentPolicyError([]byte(plaintext)); failure != nil {
+			itemError := newError(failure.code, failure.err)
+			results[i].Error = &itemError
+			continue
+		}
+
+		start := time.Now()
+		jwe, err := crypto.EncryptWithContext(ctx, encrypter, []byte(plaintext), nil)
+		metrics.Record(metrics.OperationEncrypt, string(keyAlgorithm), string(contentEncryption), err, time.Since(start))
+		if errors.Is(err, crypto.ErrTimeout) {
+			writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+			return
+		}
+		if err != nil {
+			itemError := newError(CodeEncryptionFailed, errEncryptionFailed)
+			results[i].Error = &itemError
+			continue
+		}
+
+		serialized, err := jwe.CompactSerialize()
+		if err != nil {
+			itemError := newError(CodeEncryptionFailed, errSerializationFailed)
+			results[i].Error = &itemError
+			continue
+		}
+
+		results[i].Jwe = serialized
+	}
+
+	writeJSON(context, http.StatusOK, results)
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/config"
+	"net/http"
+	"runtime"
+	"sync"
+)
+
+// Status of each item of a batch rewrap
+const (
+	rewrapStatusRewrapped = "rewrapped"
+	rewrapStatusFailed    = "failed"
+)
+
+// batchRewrapWorkers bounds how many tokens of one batch are rewrapped at the same time
+var batchRewrapWorkers = runtime.GOMAXPROCS(0)
+
+// BatchRewrapEndpoint moves stored tokens from an old key to a new one, for re-keying envelopes at rest.
+// Each token is rewrapped like RewrapEndpoint does and reported apart, a timeout fails the whole batch.
+func BatchRewrapEndpoint(context *gin.Context) {
+	var batch model.BatchRewrapRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &batch) {
+		return
+	}
+
+	// Cap the batch before doing any crypto work
+	if len(batch.Ciphertexts) > config.Current.MaxBatchSize {
+		writeError(context, http.StatusRequestEntityTooLarge, CodeBatchTooLarge, fmt.Errorf("batch exceeds the maximum of %d ciphertexts", config.Current.MaxBatchSize))
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, batch) {
+		return
+	}
+
+	target, ok := newRewrapTarget(context, model.RewrapRequest{
+		PrivateKeyPem:     batch.PrivateKeyPem,
+		PublicKeyPem:      batch.PublicKeyPem,
+		ContentEncryption: batch.ContentEncryption,
+		KeyAlgorithm:      batch.KeyAlgorithm,
+		AllowLegacyRSA15:  batch.AllowLegacyRSA15,
+		AllowLegacyHash:   batch.AllowLegacyHash,
+		PreserveHeaders:   batch.PreserveHeaders,
+	})
+	if !ok {
+		return
+	}
+
+	// The deadline covers the whole batch, each worker zeroes a plaintext before taking the next token
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	results := make([]model.BatchRewrapResult, len(batch.Ciphertexts))
+	failures := make([]*statusError, len(batch.Ciphertexts))
+	indexes := make(chan int)
+	var workers sync.WaitGroup
+	for range min(batchRewrapWorkers, len(batch.Ciphertexts)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range indexes {
+				response, failure := target.rewrap(ctx, batch.Ciphertexts[i])
+				if failure != nil {
+					failures[i] = failure
+					continue
+				}
+				results[i] = model.BatchRewrapResult{Status: rewrapStatusRewrapped, JWE: response.JWE, Alg: response.Alg, Enc: response.Enc}
+			}
+		}()
+	}
+	for i := range batch.Ciphertexts {
+		indexes <- i
+	}
+	close(indexes)
+	workers.Wait()
+
+	response := model.BatchRewrapResponse{Results: results}
+	for i, failure := range failures {
+		if failure == nil {
+			response.Rewrapped++
+			continue
+		}
+		if failure.code == CodeTimeout {
+			writeStatusError(context, failure)
+			return
+		}
+		itemError := newError(failure.code, failure.err)
+		results[i] = model.BatchRewrapResult{Status: rewrapStatusFailed, Error: &itemError}
+		if response.Errors == nil {
+			response.Errors = make(map[string]int)
+		}
+		response.Errors[failure.code]++
+		response.Failed++
+	}
+
+	context.Header(ServerKidResponseHeader, target.serverKid)
+	writeJSON(context, http.StatusOK, response)
+}
@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"jwe-go/packages/json"
+	"jwe-go/packages/pool"
+	"jwe-go/packages/schema"
+	"jwe-go/packages/tracing"
+	"net/http"
+)
+
+// readBody reads the request body into a pooled buffer and strictly unmarshals it into destination.
+// It writes the error response itself and reports whether the handler should continue.
+func readBody(context *gin.Context, destination interface{}) bool {
+	_, span := tracing.Start(context.Request.Context(), "parse")
+	defer span.End()
+
+	// Get a buffer from the pool
+	buf := pool.BufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer pool.BufPool.Put(buf)
+
+	// Read request body
+	if _, err := buf.ReadFrom(context.Request.Body); err != nil {
+		span.SetStatus(codes.Error, "failed to read the request body")
+		writeBodyReadError(context, err)
+		return false
+	}
+	span.SetAttributes(attribute.Int("http.request.body.size", buf.Len()))
+
+	// An empty body would otherwise surface as a confusing JSON error
+	if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+		span.SetStatus(codes.Error, CodeEmptyBody)
+		writeError(context, http.StatusBadRequest, CodeEmptyBody, errors.New("request body is empty"))
+		return false
+	}
+
+	// Use strict unmarshaling
+	if err := json.StrictUnmarshal(buf.Bytes(), destination); err != nil {
+		span.SetStatus(codes.Error, CodeInvalidJSON)
+		writeInvalidJSON(context, err)
+		return false
+	}
+
+	return true
+}
+
+// validateBody runs the validator over the request read by readBody, writing the error response itself like readBody
+func validateBody(context *gin.Context, request interface{}) bool {
+	_, span := tracing.Start(context.Request.Context(), "validate")
+	defer span.End()
+
+	if err := schema.Validate.Struct(request); err != nil {
+		code := validationCode(err)
+		span.SetStatus(codes.Error, code)
+		writeError(context, http.StatusBadRequest, code, validationError(err))
+		return false
+	}
+	return true
+}
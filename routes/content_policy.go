@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Server-wide patterns set by SetContentPolicy, a plaintext matching one is refused before it is encrypted. Nil scans nothing.
+var blockedContentPatterns []*regexp.Regexp
+
+// SetContentPolicy turns the scan of the plaintexts against the patterns on or off, enabled it needs at least one pattern.
+// The streaming route can't scan a plaintext it never holds whole, it is refused while the scan is on.
+func SetContentPolicy(enabled bool, patterns []string) error {
+	if !enabled {
+		blockedContentPatterns = nil
+		return nil
+	}
+	if len(patterns) == 0 {
+		return errors.New("content scanning needs at least one pattern")
+	}
+
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		var err error
+		if compiled[i], err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("blocked content pattern %d is not a valid regular expression: %v", i, err)
+		}
+	}
+	blockedContentPatterns = compiled
+	return nil
+}
+
+// ReadContentPatterns reads one regular expression per line of the file, blank lines and lines starting with # are skipped
+func ReadContentPatterns(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the blocked content patterns: %v", err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the blocked content patterns: %v", err)
+	}
+	return patterns, nil
+}
+
+// checkContentAllowed rejects a plaintext matching a blocked pattern
+func checkContentAllowed(context *gin.Context, plaintext []byte) bool {
+	if failure := contentPolicyError(plaintext); failure != nil {
+		writeStatusError(context, failure)
+		return false
+	}
+	return true
+}
+
+// contentPolicyError is the failure checkContentAllowed reports, nil when no pattern matches.
+// Only the index of the pattern is reported, never the plaintext nor the part of it that matched.
+func contentPolicyError(plaintext []byte) *statusError {
+	for i, pattern := range blockedContentPatterns {
+		if pattern.Match(plaintext) {
+			return &statusError{http.StatusUnprocessableEntity, CodeContentBlocked, fmt.Errorf("the plaintext matches blocked content pattern %d", i)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentPolicyBlocksMatchingPlaintexts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/encrypt/batch", BatchEncryptEndpoint)
+	router.POST("/v1/encrypt/stream", StreamEncryptEndpoint)
+	defer SetContentPolicy(false, nil)
+
+	path := filepath.Join(t.TempDir(), "patterns")
+	// Card numbers and anything marked confidential, comments and blank lines are skipped
+	if err := os.WriteFile(path, []byte("# DLP patterns\n\n\\b4[0-9]{12}(?:[0-9]{3})?\\b\n(?i)confidential\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := ReadContentPatterns(path)
+	if err != nil || len(patterns) != 2 {
+		t.Fatalf("expected the two patterns of the file, got %q: %v", patterns, err)
+	}
+	if err := SetContentPolicy(true, []string{"("}); err == nil {
+		t.Fatal("expected an invalid regular expression to be refused")
+	}
+	if err := SetContentPolicy(true, patterns); err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, err := crypto.ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(path string, request interface{}) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(request)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return recorder
+	}
+
+	for _, test := range []struct {
+		plaintext string
+		status    int
+	}{
+		{"card 4111111111111111 on file", http.StatusUnprocessableEntity},
+		{"Strictly CONFIDENTIAL", http.StatusUnprocessableEntity},
+		{"order 41111 shipped", http.StatusOK},
+	} {
+		recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: test.plaintext, PublicKeyPem: publicKeyPem})
+		if recorder.Code != test.status {
+			t.Fatalf("expected %d encrypting %q, got %d %q", test.status, test.plaintext, recorder.Code, recorder.Body.String())
+		}
+		if test.status != http.StatusOK && (!strings.Contains(recorder.Body.String(), CodeContentBlocked) || strings.Contains(recorder.Body.String(), test.plaintext)) {
+			t.Fatalf("expected %s without the plaintext, got %q", CodeContentBlocked, recorder.Body.String())
+		}
+	}
+
+	// Named fields are scanned as the JSON they are encrypted as
+	if recorder := post("/v1/encrypt", model.EncryptRequest{Fields: map[string]string{"label": "confidential"}, PublicKeyPem: publicKeyPem}); recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected the fields to be blocked, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// A batch only fails the matching items
+	recorder := post("/v1/encrypt/batch", model.BatchEncryptRequest{Plaintexts: []string{"fine", "confidential"}, PublicKeyPem: publicKeyPem})
+	var results []model.BatchEncryptResult
+	if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &results); err != nil || len(results) != 2 {
+		t.Fatalf("expected two results, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if results[0].Error != nil || results[0].Jwe == "" || results[1].Error == nil || results[1].Error.Code != CodeContentBlocked {
+		t.Fatalf("expected only the second item blocked, got %+v", results)
+	}
+
+	if recorder := post("/v1/encrypt/stream", nil); recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected streams to be refused while scanning, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/json"
+	"net/http"
+	"strings"
+)
+
+// ConvertJWEEndpoint rewrites a JWE in the other serialization, no key is needed and nothing is decrypted
+func ConvertJWEEndpoint(context *gin.Context) {
+	var conversion model.ConvertJWERequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &conversion) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, conversion) {
+		return
+	}
+
+	// Parsing checks the token is a JWE before it is converted
+	token := strings.TrimSpace(conversion.JWE)
+	if _, err := jose.ParseEncrypted(
+		token,
+		append(append(crypto.SupportedKeyAlgorithms, crypto.SymmetricKeyAlgorithms...), crypto.PasswordKeyAlgorithms...),
+		crypto.SupportedContentEncryptions,
+	); err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, fmt.Errorf("failed to parse JWE: %v", err))
+		return
+	}
+
+	converted := token
+	var err error
+	switch isJSON := strings.HasPrefix(token, "{"); {
+	case conversion.Serialization == serializationJSON && !isJSON:
+		converted, err = crypto.CompactToJSON(token)
+	case conversion.Serialization == serializationCompact && isJSON:
+		converted, err = crypto.JSONToCompact(token)
+	}
+	if errors.Is(err, crypto.ErrNotConvertible) {
+		writeError(context, http.StatusUnprocessableEntity, CodeNotConvertible, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+		return
+	}
+
+	// The compact token is embedded as a string and the JSON one as the object it is
+	response := model.ConvertJWEResponse{Serialization: conversion.Serialization, JWE: []byte(converted)}
+	if conversion.Serialization == serializationCompact {
+		if response.JWE, err = json.Marshal(converted); err != nil {
+			writeError(context, http.StatusInternalServerError, CodeInternal, errSerializationFailed)
+			return
+		}
+	}
+	writeJSON(context, http.StatusOK, response)
+}
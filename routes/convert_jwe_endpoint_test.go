@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"bytes"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConvertJWEEndpointConvertsBothWays(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/jwe/convert", ConvertJWEEndpoint)
+	convert := func(token, serialization string, status int) model.ConvertJWEResponse {
+		body, _ := encodingjson.Marshal(model.ConvertJWERequest{JWE: token, Serialization: serialization})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/jwe/convert", bytes.NewReader(body)))
+		if recorder.Code != status {
+			t.Fatalf("expected %d converting to %s, got %d %q", status, serialization, recorder.Code, recorder.Body.String())
+		}
+		var response model.ConvertJWEResponse
+		encodingjson.Unmarshal(recorder.Body.Bytes(), &response)
+		return response
+	}
+
+	// {"alg":"dir","enc":"A128GCM"} with a 12 byte IV, a 5 byte ciphertext and a 16 byte tag
+	compact := "eyJhbGciOiJkaXIiLCJlbmMiOiJBMTI4R0NNIn0..AAAAAAAAAAAAAAAA.AAAAAAA.AAAAAAAAAAAAAAAAAAAAAA"
+	flattened := convert(compact, "json", http.StatusOK)
+	var members map[string]string
+	if err := encodingjson.Unmarshal(flattened.JWE, &members); err != nil || members["protected"] != "eyJhbGciOiJkaXIiLCJlbmMiOiJBMTI4R0NNIn0" {
+		t.Fatalf("expected the token as a JSON object, got %s", flattened.JWE)
+	}
+	var back string
+	if err := encodingjson.Unmarshal(convert(string(flattened.JWE), "compact", http.StatusOK).JWE, &back); err != nil || back != compact {
+		t.Fatalf("expected the compact token back, got %q", back)
+	}
+
+	// Two recipients don't fit in a compact token, a token that isn't a JWE is malformed
+	general := `{"protected":"eyJlbmMiOiJBMTI4R0NNIn0","recipients":[{"header":{"alg":"A128KW"},"encrypted_key":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"},` +
+		`{"header":{"alg":"A128KW"},"encrypted_key":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}],"iv":"AAAAAAAAAAAAAAAA","ciphertext":"AAAAAAA","tag":"AAAAAAAAAAAAAAAAAAAAAA"}`
+	convert(general, "compact", http.StatusUnprocessableEntity)
+	convert("eyJhbGciOiJSUzI1NiJ9.e30.c2ln", "json", http.StatusBadRequest)
+}
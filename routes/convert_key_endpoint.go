@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+func ConvertKeyEndpoint(context *gin.Context) {
+	var conversion model.ConvertKeyRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &conversion) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, conversion) {
+		return
+	}
+
+	// The input has to be in the other format than the one asked for
+	switch {
+	case len(conversion.KeyPem) == 0 && len(conversion.KeyJwk) == 0:
+		writeError(context, http.StatusBadRequest, CodeMissingKey, errors.New("either KeyPem or KeyJwk is required"))
+		return
+	case conversion.Format == "pem" && len(conversion.KeyJwk) == 0:
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("format pem requires KeyJwk"))
+		return
+	case conversion.Format == "jwk" && len(conversion.KeyPem) == 0:
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("format jwk requires KeyPem"))
+		return
+	case conversion.Format == "jwk" && len(conversion.PrivateKeyFormat) > 0:
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("privateKeyFormat only applies to format pem"))
+		return
+	}
+
+	if conversion.Format == "jwk" {
+		convertPEMToJWK(context, conversion.KeyPem)
+		return
+	}
+	convertJWKToPEM(context, conversion.KeyJwk, conversion.PrivateKeyFormat)
+}
+
+// convertPEMToJWK returns the JWK of a PEM key, its kid is the thumbprint of the public key
+func convertPEMToJWK(context *gin.Context, keyPem string) {
+	key, private, err := crypto.ImportKeyFromPEM(keyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	var jwk jose.JSONWebKey
+	if private {
+		jwk, err = crypto.ConvertPrivateKeyToJWK(key)
+	} else {
+		jwk, err = crypto.ConvertPublicKeyToJWK(key)
+	}
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+
+	thumbprint, err := crypto.GetJWKThumbprintSHA256(jwk)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, errors.New("failed to compute public key thumbprint"))
+		return
+	}
+	jwk.KeyID = thumbprint
+
+	serialized, err := jwk.MarshalJSON()
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeInvalidKey, errors.New("failed to serialize the JWK"))
+		return
+	}
+
+	writeJSON(context, http.StatusOK, model.ConvertKeyResponse{
+		KeyJwk:     serialized,
+		Kid:        thumbprint,
+		Thumbprint: thumbprint,
+		Private:    private,
+	})
+}
+
+// convertJWKToPEM returns the PEM of a JWK, keeping its kid or falling back to the thumbprint.
+// A private key is encoded in the private key format.
+func convertJWKToPEM(context *gin.Context, keyJwk []byte, privateKeyFormat string) {
+	jwk, err := crypto.ImportKeyFromJWK(keyJwk)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidJWK, err)
+		return
+	}
+
+	var keyPem string
+	private := !jwk.IsPublic()
+	switch key := jwk.Key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		keyPem, err = crypto.ExportPrivateKeyAsPEMFormat(key, privateKeyFormat)
+	default:
+		keyPem, err = crypto.ExportPublicKeyAsPEM(key)
+	}
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+
+	thumbprint, err := crypto.GetJWKThumbprintSHA256(jwk)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, errors.New("failed to compute public key thumbprint"))
+		return
+	}
+	kid := jwk.KeyID
+	if kid == "" {
+		kid = thumbprint
+	}
+
+	writeJSON(context, http.StatusOK, model.ConvertKeyResponse{
+		KeyPem:     keyPem,
+		Kid:        kid,
+		Thumbprint: thumbprint,
+		Private:    private,
+	})
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"context"
+	"jwe-go/packages/config"
+	"net/http"
+)
+
+// cryptoDeadline bounds the crypto work of a request by the configured timeout, a client disconnect cancels it too
+func cryptoDeadline(request *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(request.Context(), config.Current.CryptoTimeout)
+}
@@ -1,13 +1,23 @@
 package routes
 
 import (
-	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"jwe-go/model"
+	"jwe-go/packages/clock"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
 	"jwe-go/packages/json"
-	"jwe-go/packages/pool"
-	"jwe-go/packages/schema"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/tracing"
 	"net/http"
+	"slices"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-jose/go-jose/v4"
@@ -16,67 +26,410 @@ import (
 func DecryptEndpoint(context *gin.Context) {
 	var decryption model.DecryptRequest
 
-	// Get a buffer from the pool
-	buf := pool.BufPool.Get().(*bytes.Buffer)
-	buf.Reset()
-	defer pool.BufPool.Put(buf)
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &decryption) {
+		return
+	}
 
-	// Read request body
-	if _, err := buf.ReadFrom(context.Request.Body); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+	// Manually validate the struct using the validator
+	if !validateBody(context, decryption) {
 		return
 	}
 
-	// Use strict unmarshaling
-	if err := json.StrictUnmarshal(buf.Bytes(), &decryption); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON or unknown field"})
+	// Without a key only the registered keys of the calling tenant are tried
+	keys, ok := tenantKeys(context)
+	if !ok {
 		return
 	}
 
-	// Manually validate the struct using the validator
-	if err := schema.Validate.Struct(decryption); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var decryptionKey interface{}
+	_, importSpan := tracing.Start(context.Request.Context(), "key-import")
+	defer importSpan.End() // Covers the early returns, ending an ended span does nothing
+
+	// Pick the decryption key from either the secret key fields, the private key PEM or JWK, the password,
+	// without one the registered key matching the server_kid header is used
+	switch {
+	case len(decryption.SecretKey) > 0 && len(decryption.SecretKeyBase64) > 0:
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("both SecretKey and SecretKeyBase64 cannot be set at the same time"))
 		return
+	case len(decryption.PrivateKeyPem) > 0 && (len(decryption.SecretKey) > 0 || len(decryption.SecretKeyBase64) > 0):
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("PrivateKeyPem cannot be combined with a secret key"))
+		return
+	case len(decryption.SecretKey) == 32:
+		decryptionKey = []byte(decryption.SecretKey)
+	case len(decryption.SecretKeyBase64) > 0:
+		secretKey, err := crypto.DecodeBase64(decryption.SecretKeyBase64, decryption.StrictBase64)
+
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+			return
+		}
+
+		decryptionKey = secretKey
+	case len(decryption.PrivateKeyPem) > 0:
+		privateKey, _, err := importDecryptionKey(decryption.PrivateKeyPem)
+
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+			return
+		}
+
+		decryptionKey = privateKey
+	case len(decryption.PrivateKeyJwk) > 0:
+		privateKey, _, err := crypto.ImportPrivateKeyFromJWK(decryption.PrivateKeyJwk)
+
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidJWK, err)
+			return
+		}
+
+		decryptionKey = privateKey
+	case len(decryption.Password) > 0:
+		decryptionKey = []byte(decryption.Password)
+	case len(decryption.SecretKey) > 0:
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, errors.New("SecretKey must be 32 bytes"))
+		return
+	}
+	// Secrets and passwords get no size, the length of a password is part of the secret
+	if size := crypto.KeySize(decryptionKey); size > 0 {
+		importSpan.SetAttributes(tracing.AttributeKeySize.Int(size))
 	}
+	importSpan.End()
 
-	// Decrypt the message using the private key
-	decryptedObject, err := jose.ParseEncryptedCompact(
+	// A JWE sent without its ciphertext gets it back before parsing, the tag check on decrypt covers it
+	if len(decryption.DetachedCiphertext) > 0 {
+		attached, err := crypto.AttachContent(decryption.Ciphertext, decryption.DetachedCiphertext)
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+			return
+		}
+		decryption.Ciphertext = attached
+	}
+
+	// Parse the compact or JSON serialized JWE, a malformed token is a client error
+	decryptedObject, err := jose.ParseEncrypted(
 		decryption.Ciphertext,
-		[]jose.KeyAlgorithm{jose.DIRECT},
-		[]jose.ContentEncryption{jose.A256GCM},
+		append(append(crypto.DecryptionKeyAlgorithms, crypto.SymmetricKeyAlgorithms...), crypto.PasswordKeyAlgorithms...),
+		crypto.SupportedContentEncryptions,
 	)
 	if err != nil {
-		context.JSON(http.StatusBadRequest, err.Error())
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+		return
+	}
+	contentEncryption, _ := decryptedObject.Header.ExtraHeaders["enc"].(string)
+	middleware.SetAlgorithms(context, decryptedObject.Header.Algorithm, contentEncryption)
+	if !checkCriticalHeaders(context, decryptedObject) {
 		return
 	}
 
-	var decrypted []byte
-	var secKeyError error
+	// A token encrypted with a derived secret names its info label, the secret is derived again from the master secret
+	if info, ok := decryptedObject.Header.ExtraHeaders[crypto.HKDFInfoHeader].(string); ok && decryptionKey == nil {
+		derived, err := deriveSymmetricKey(info, jose.KeyAlgorithm(decryptedObject.Header.Algorithm), jose.ContentEncryption(contentEncryption))
+		if errors.Is(err, errDerivationDisabled) {
+			writeError(context, http.StatusBadRequest, CodeDerivationDisabled, err)
+			return
+		}
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+			return
+		}
+		defer crypto.Zero(derived)
+		decryptionKey = derived
+	}
 
-	switch {
-	case len(decryption.SecretKey) > 0 && len(decryption.SecretKeyBase64) > 0:
-		context.JSON(http.StatusBadRequest, gin.H{"error": "both SecretKey and SecretKeyBase64 cannot be set at the same time"})
+	// Surface the server_kid header so callers can confirm which key was used
+	serverKid, _ := decryptedObject.Header.ExtraHeaders[crypto.ServerKidHeader].(string)
+	middleware.SetKeyThumbprint(context, serverKid)
+
+	// Decrypt the message, a failure here means the key does not match the token.
+	// Without a key every registered key is tried, the one matching server_kid first.
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	_, decryptSpan := crypto.StartDecryptSpan(ctx, decryptedObject)
+	recipient, err := crypto.RunWithContext(ctx, func() (crypto.DecryptedRecipient, error) {
+		if decryptionKey != nil {
+			return crypto.DecryptRecipient(decryption.Ciphertext, decryptedObject, decryptionKey)
+		}
+		return decryptWithRegisteredKeys(keys, decryption.Ciphertext, decryptedObject, serverKid)
+	})
+	tracing.End(decryptSpan, err)
+	// The alg of a multi-recipient JWE is only known once a recipient matched
+	keyAlgorithm := decryptedObject.Header.Algorithm
+	if recipient.Header.Algorithm != "" {
+		keyAlgorithm = recipient.Header.Algorithm
+		middleware.SetAlgorithms(context, keyAlgorithm, contentEncryption)
+	}
+	metrics.Record(metrics.OperationDecrypt, keyAlgorithm, contentEncryption, err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
 		return
-	case len(decryption.SecretKey) == 32:
-		decrypted, secKeyError = decryptedObject.Decrypt(decryption.SecretKey)
-	case len(decryption.SecretKeyBase64) > 0:
-		secretKey, err := base64.RawURLEncoding.DecodeString(decryption.SecretKeyBase64)
+	}
+	if errors.Is(err, errNoServerKeys) {
+		writeError(context, http.StatusBadRequest, CodeMissingKey, err)
+		return
+	}
+	if errors.Is(err, crypto.ErrInflatedTooLarge) {
+		writeError(context, http.StatusUnprocessableEntity, CodePlaintextTooLarge, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusUnprocessableEntity, CodeDecryptionFailed, decryptFailure(decryption, serverKid, keyAlgorithm, contentEncryption))
+		return
+	}
+	// The jti header is only trusted once decryption authenticated it, a forged one never reaches the audit log
+	if tokenID := crypto.TokenID(decryptedObject.Header); tokenID != "" {
+		middleware.SetTokenID(context, tokenID)
+	}
 
-		if err != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// go-jose unwraps with a secret of any AES size, a secret the key algorithm of the token does not take is refused
+	if secretKey, ok := decryptionKey.([]byte); ok && len(decryption.Password) == 0 && slices.Contains(crypto.SymmetricKeyAlgorithms, jose.KeyAlgorithm(keyAlgorithm)) {
+		if err := crypto.CheckSymmetricKeySize(jose.KeyAlgorithm(keyAlgorithm), jose.ContentEncryption(contentEncryption), secretKey); err != nil {
+			crypto.Zero(recipient.Plaintext)
+			writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
 			return
 		}
+	}
 
-		decrypted, secKeyError = decryptedObject.Decrypt(secretKey)
-	default:
-		context.JSON(http.StatusBadRequest, gin.H{"error": "No valid secret key provided"})
+	// The time headers are only trusted once decryption authenticated the protected header
+	if !checkTimeHeaders(context, decryption.Ciphertext, decryption.MaxAgeSeconds) {
 		return
 	}
 
-	if secKeyError != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": secKeyError.Error()})
+	if !checkReplay(context, decryption.Ciphertext, decryption.RejectReplay) {
 		return
 	}
 
-	context.String(http.StatusOK, string(decrypted))
+	// The decrypted bytes are zeroed once the response is written, the response strings are copies
+	decrypted := recipient.Plaintext
+	defer crypto.Zero(decrypted)
+	if !checkDecryptedPayload(context, decryptedObject, decrypted, decryption.Audience) {
+		return
+	}
+
+	// The decompressed size was capped on decrypt, before the first byte is sent and a failure could still be reported
+	if decryption.Stream {
+		writePlaintextStream(context, decrypted, serverKid)
+		return
+	}
+
+	// Decrypt already checked the AAD against the tag, it is returned so the caller can act on it
+	response := model.DecryptResponse{
+		ServerKid:      serverKid,
+		RecipientIndex: recipient.Index,
+		AdditionalData: base64.RawURLEncoding.EncodeToString(decryptedObject.GetAuthData()),
+	}
+	response.ContentType, _ = decryptedObject.Header.ExtraHeaders["cty"].(string)
+	response.PartyUInfo, response.PartyVInfo = partyInfo(recipient.Header)
+	// The token already parsed, its recipient header can't fail to decode
+	response.RecipientHeader, _ = crypto.RecipientHeader(decryption.Ciphertext, recipient.Index)
+
+	// Binary plaintexts would be mangled in a JSON string, they are returned as base64 unless an encoding was asked for.
+	// A token encrypted from named fields gets them back as they were sent.
+	fields := decryptedFields(response.ContentType, decrypted)
+	switch {
+	case decryption.OutputEncoding != "":
+		if response.Plaintext, err = encodePlaintext(decrypted, decryption.OutputEncoding); err != nil {
+			writeError(context, http.StatusUnprocessableEntity, CodeInvalidEncoding, err)
+			return
+		}
+		response.PlaintextEncoding = decryption.OutputEncoding
+	case fields != nil:
+		response.Fields = fields
+	case utf8.Valid(decrypted):
+		response.Plaintext = string(decrypted)
+	default:
+		response.PlaintextBase64 = base64.StdEncoding.EncodeToString(decrypted)
+	}
+
+	writeJSON(context, http.StatusOK, response)
+}
+
+// writePlaintextStream sends the plaintext alone as the body, in chunks flushed one at a time:
+// the JSON response would hold the plaintext twice more, as a string and encoded in the body
+func writePlaintextStream(context *gin.Context, plaintext []byte, serverKid string) {
+	if serverKid != "" {
+		context.Header(ServerKidResponseHeader, serverKid)
+	}
+	context.Header("Content-Type", mimeOctetStream)
+	context.Status(http.StatusOK)
+	for start := 0; start < len(plaintext); start += streamChunkSize {
+		if _, err := context.Writer.Write(plaintext[start:min(start+streamChunkSize, len(plaintext))]); err != nil {
+			// The client went away, the status is already sent
+			context.Abort()
+			return
+		}
+		context.Writer.Flush()
+	}
+}
+
+// decryptedFields parses the plaintext of a token with cty application/json, nil unless it is a JSON object of strings
+func decryptedFields(contentType string, decrypted []byte) map[string]string {
+	var fields map[string]string
+	if contentType != crypto.JSONContentType || json.CONFIG.Unmarshal(decrypted, &fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+var errNoServerKeys = errors.New("no valid secret key provided and no server keys are registered")
+
+// decryptWithRegisteredKeys tries the registered server keys in turn, so tokens for a key that is
+// being rotated out still decrypt during the overlap window
+func decryptWithRegisteredKeys(keys *crypto.KeyStore, serialized string, encryptedObject *jose.JSONWebEncryption, serverKid string) (crypto.DecryptedRecipient, error) {
+	candidates := keys.Candidates(serverKid)
+	if len(candidates) == 0 {
+		return crypto.DecryptedRecipient{}, errNoServerKeys
+	}
+
+	// Expired keys keep decrypting through the grace period, so tokens issued just before the expiry still open
+	now := clock.Now()
+	for _, candidate := range candidates {
+		if !candidate.Decrypts(now) {
+			continue
+		}
+		recipient, err := crypto.DecryptRecipient(serialized, encryptedObject, candidate.PrivateKey)
+		// Only the key that opened the token gets as far as inflating it
+		if err == nil || errors.Is(err, crypto.ErrInflatedTooLarge) {
+			return recipient, err
+		}
+	}
+	return crypto.DecryptedRecipient{}, errors.New("no registered key decrypts the JWE")
+}
+
+// checkCriticalHeaders rejects tokens whose crit header lists an extension this service does not understand,
+// or whose zip header names a compression it can't undo
+func checkCriticalHeaders(context *gin.Context, encryptedObject *jose.JSONWebEncryption) bool {
+	if failure := criticalHeadersError(encryptedObject); failure != nil {
+		writeStatusError(context, failure)
+		return false
+	}
+	return true
+}
+
+// criticalHeadersError is the failure checkCriticalHeaders reports, nil when every critical header is understood
+func criticalHeadersError(encryptedObject *jose.JSONWebEncryption) *statusError {
+	if err := crypto.CheckCompression(encryptedObject.Header); err != nil {
+		return &statusError{http.StatusUnprocessableEntity, CodeUnsupportedZip, err}
+	}
+	if _, err := crypto.CheckCriticalHeaders(encryptedObject.Header); err != nil {
+		code := CodeInvalidHeader
+		if errors.Is(err, crypto.ErrUnsupportedCritical) {
+			code = CodeUnsupportedCritical
+		}
+		return &statusError{http.StatusUnprocessableEntity, code, err}
+	}
+	return nil
+}
+
+// checkDecryptedPayload applies the claims checks every decrypted plaintext goes through before it is returned
+func checkDecryptedPayload(context *gin.Context, decryptedObject *jose.JSONWebEncryption, decrypted []byte, audience string) bool {
+	if failure := decryptedPayloadError(decryptedObject, decrypted, audience); failure != nil {
+		writeStatusError(context, failure)
+		return false
+	}
+	return true
+}
+
+// decryptedPayloadError is the failure checkDecryptedPayload reports, nil when the plaintext passes
+func decryptedPayloadError(decryptedObject *jose.JSONWebEncryption, decrypted []byte, audience string) *statusError {
+	// JWT claims payloads are only returned while exp and aud hold, nested JWTs carry a JWS and are left alone
+	if contentType, _ := decryptedObject.Header.ExtraHeaders["cty"].(string); contentType == crypto.JWTContentType && crypto.IsClaimsSet(decrypted) {
+		if err := crypto.ValidateClaims(decrypted, audience, config.Current.Leeway); err != nil {
+			return claimsError(err)
+		}
+	}
+	return nil
+}
+
+// checkTimeHeaders applies the iat and nbf protected header checks, the request maximum age overriding the configured one
+func checkTimeHeaders(context *gin.Context, serialized string, maxAgeSeconds int) bool {
+	maxAge := config.Current.MaxTokenAge
+	if maxAgeSeconds > 0 {
+		maxAge = time.Duration(maxAgeSeconds) * time.Second
+	}
+
+	switch err := crypto.ValidateTimeHeaders(serialized, maxAge, config.Current.Leeway); {
+	case err == nil:
+		return true
+	case errors.Is(err, crypto.ErrTokenNotYetValid):
+		writeError(context, http.StatusUnauthorized, CodeTokenNotYetValid, err)
+	case errors.Is(err, crypto.ErrTokenTooOld):
+		writeError(context, http.StatusUnauthorized, CodeTokenTooOld, err)
+	default:
+		writeError(context, http.StatusUnprocessableEntity, CodeInvalidHeader, err)
+	}
+	return false
+}
+
+// checkReplay refuses a token decrypted before within the replay window, when the request or the deployment asks for it.
+// Only tokens that decrypted are recorded, so a failed attempt with a captured token can't lock out its recipient.
+func checkReplay(context *gin.Context, serialized string, rejectReplay bool) bool {
+	if !rejectReplay && !config.Current.ReplayProtection {
+		return true
+	}
+
+	digest, err := crypto.ReplayDigest(serialized)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+		return false
+	}
+	if crypto.Replays.Seen(digest, config.Current.ReplayWindow) {
+		writeError(context, http.StatusConflict, CodeReplayed, errors.New("token was already decrypted"))
+		return false
+	}
+	return true
+}
+
+// partyInfo returns the apu and apv headers of the recipient that decrypted, the key agreement already checked they decode
+func partyInfo(header jose.Header) (string, string) {
+	partyUInfo, _ := header.ExtraHeaders[crypto.PartyUInfoHeader].(string)
+	partyVInfo, _ := header.ExtraHeaders[crypto.PartyVInfoHeader].(string)
+	return partyUInfo, partyVInfo
+}
+
+// writeClaimsError maps claims failures, expired and wrong-audience tokens get their own codes
+func writeClaimsError(context *gin.Context, err error) {
+	writeStatusError(context, claimsError(err))
+}
+
+// claimsError maps a claims validation error to its status and code
+func claimsError(err error) *statusError {
+	switch {
+	case errors.Is(err, crypto.ErrTokenExpired):
+		return &statusError{http.StatusUnauthorized, CodeTokenExpired, err}
+	case errors.Is(err, crypto.ErrInvalidAudience):
+		return &statusError{http.StatusUnauthorized, CodeInvalidAudience, err}
+	default:
+		return &statusError{http.StatusUnauthorized, CodeInvalidClaims, err}
+	}
+}
+
+// importDecryptionKey imports an RSA or EC private key and returns it with its public key, the only types go-jose decrypts with
+func importDecryptionKey(privateKeyPem string) (interface{}, interface{}, error) {
+	privateKey, keyType, err := crypto.ImportPrivateKeyFromPEM(privateKeyPem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return key, &key.PublicKey, nil
+	case *ecdsa.PrivateKey:
+		return key, &key.PublicKey, nil
+	}
+	return nil, nil, fmt.Errorf("%s private keys cannot decrypt, use an RSA or EC key", keyType)
+}
+
+// decryptFailure is the error of a key mismatch, with the header values of the token when the request asks for them.
+// Nothing read while decrypting is reported, only what anyone holding the token can already see.
+func decryptFailure(decryption model.DecryptRequest, serverKid, keyAlgorithm, contentEncryption string) error {
+	err := errors.New("failed to decrypt the JWE with the provided key")
+	if !decryption.FailureMetadata {
+		return err
+	}
+	return &detailedError{
+		error:   err,
+		details: model.DecryptFailureDetails{ServerKid: serverKid, Alg: keyAlgorithm, Enc: contentEncryption},
+	}
 }
@@ -0,0 +1,287 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDecryptEndpointDescribesAKeyMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/decrypt", DecryptEndpoint)
+
+	recipientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKid, err := crypto.GetJWKThumbprintSHA256(jose.JSONWebKey{Key: &recipientKey.PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := crypto.BuildEncrypterOptions(crypto.ServerKidHeaders(serverKid, 0), false)
+	encrypter, err := jose.NewEncrypter(jose.A128CBC_HS256, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &recipientKey.PublicKey}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("the secret plaintext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKeyPem, err := crypto.ExportPrivateKeyAsPEM(wrongKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, metadata := range []bool{false, true} {
+		body, _ := encodingjson.Marshal(model.DecryptRequest{Ciphertext: compact, PrivateKeyPem: wrongKeyPem, FailureMetadata: metadata})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/decrypt", bytes.NewReader(body)))
+
+		var response struct {
+			Code    string                       `json:"code"`
+			Details *model.DecryptFailureDetails `json:"details"`
+		}
+		if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusUnprocessableEntity || response.Code != CodeDecryptionFailed {
+			t.Fatalf("expected a 422 DECRYPTION_FAILED, got %d %q", recorder.Code, recorder.Body.String())
+		}
+		if !metadata {
+			if response.Details != nil {
+				t.Fatalf("expected no details unless asked for, got %q", recorder.Body.String())
+			}
+			continue
+		}
+		expected := model.DecryptFailureDetails{ServerKid: serverKid, Alg: string(jose.RSA_OAEP_256), Enc: string(jose.A128CBC_HS256)}
+		if response.Details == nil || *response.Details != expected {
+			t.Fatalf("expected details %+v, got %q", expected, recorder.Body.String())
+		}
+		// Only the header values are reported, nothing the wrong key unwrapped
+		var raw struct {
+			Details map[string]interface{} `json:"details"`
+		}
+		encodingjson.Unmarshal(recorder.Body.Bytes(), &raw)
+		if strings.Contains(recorder.Body.String(), "secret") || len(raw.Details) != 3 {
+			t.Fatalf("expected only the header values, got %q", recorder.Body.String())
+		}
+	}
+}
+
+func TestDecryptEndpointRejectsUnknownCompression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/decrypt", DecryptEndpoint)
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.A256KW, Key: key}, (&jose.EncrypterOptions{}).WithHeader("zip", "LZW"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("never decompressed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key fits, the token is still refused for its zip rather than as a failed decryption
+	body, _ := encodingjson.Marshal(model.DecryptRequest{Ciphertext: compact, SecretKeyBase64: base64.RawURLEncoding.EncodeToString(key)})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/decrypt", bytes.NewReader(body)))
+	if recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), CodeUnsupportedZip) {
+		t.Fatalf("expected UNSUPPORTED_COMPRESSION, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestAESGCMKeyWrapRoundTrips(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/decrypt", DecryptEndpoint)
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		encoded, _ := encodingjson.Marshal(body)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded)))
+		return recorder
+	}
+
+	for _, test := range []struct {
+		keyAlgorithm string
+		keySize      int
+	}{
+		{"A128GCMKW", 16},
+		{"A192GCMKW", 24},
+		{"A256GCMKW", 32},
+	} {
+		key := make([]byte, test.keySize)
+		rand.Read(key)
+		secret := base64.RawURLEncoding.EncodeToString(key)
+
+		recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "wrapped by a KMS key", SymmetricKey: secret, KeyAlgorithm: test.keyAlgorithm})
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected %s to encrypt, got %d %q", test.keyAlgorithm, recorder.Code, recorder.Body.String())
+		}
+		compact := recorder.Body.String()
+
+		// The key wrap IV and tag travel in the protected header of the compact serialization
+		segment, _, _ := strings.Cut(compact, ".")
+		protected, err := base64.RawURLEncoding.DecodeString(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var header struct {
+			Alg string `json:"alg"`
+			IV  string `json:"iv"`
+			Tag string `json:"tag"`
+		}
+		if err := encodingjson.Unmarshal(protected, &header); err != nil {
+			t.Fatal(err)
+		}
+		iv, ivErr := base64.RawURLEncoding.DecodeString(header.IV)
+		tag, tagErr := base64.RawURLEncoding.DecodeString(header.Tag)
+		if header.Alg != test.keyAlgorithm || ivErr != nil || len(iv) != 12 || tagErr != nil || len(tag) != 16 {
+			t.Fatalf("expected %s with a 96 bit iv and a 128 bit tag, got %s", test.keyAlgorithm, protected)
+		}
+
+		recorder = post("/v1/decrypt", model.DecryptRequest{Ciphertext: compact, SecretKeyBase64: secret})
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "wrapped by a KMS key") {
+			t.Fatalf("expected %s to decrypt, got %d %q", test.keyAlgorithm, recorder.Code, recorder.Body.String())
+		}
+
+		// A secret of another size is refused for the algorithm both ways
+		wrongSize := base64.RawURLEncoding.EncodeToString(make([]byte, test.keySize+8))
+		recorder = post("/v1/encrypt", model.EncryptRequest{Plaintext: "wrapped by a KMS key", SymmetricKey: wrongSize, KeyAlgorithm: test.keyAlgorithm})
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `"code":"INVALID_KEY"`) {
+			t.Fatalf("expected a %d byte key to be refused for %s, got %d %q", test.keySize+8, test.keyAlgorithm, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	// go-jose unwraps an A256GCMKW key with an AES-128 secret, the endpoint does not
+	key := make([]byte, 16)
+	rand.Read(key)
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.A256GCMKW, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("under a short key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, _ := jwe.CompactSerialize()
+	recorder := post("/v1/decrypt", model.DecryptRequest{Ciphertext: compact, SecretKeyBase64: base64.RawURLEncoding.EncodeToString(key)})
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `"code":"INVALID_KEY"`) || strings.Contains(recorder.Body.String(), "under a short key") {
+		t.Fatalf("expected the short key to be refused, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+// countingWriter discards the body, recording the size of every write and the flushes in between
+type countingWriter struct {
+	header  http.Header
+	status  int
+	size    int
+	largest int
+	flushes int
+}
+
+func (writer *countingWriter) Header() http.Header { return writer.header }
+
+func (writer *countingWriter) WriteHeader(status int) { writer.status = status }
+
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	writer.size += len(data)
+	writer.largest = max(writer.largest, len(data))
+	return len(data), nil
+}
+
+func (writer *countingWriter) Flush() { writer.flushes++ }
+
+func TestDecryptEndpointStreamsALargePlaintext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/decrypt", DecryptEndpoint)
+	defer func(previous int) { crypto.MaxInflatedSize = previous }(crypto.MaxInflatedSize)
+	crypto.MaxInflatedSize = 1 << 20
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	secret := base64.RawURLEncoding.EncodeToString(key)
+	encrypt := func(plaintext []byte, options *jose.EncrypterOptions) string {
+		encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: key}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwe, err := encrypter.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact, _ := jwe.CompactSerialize()
+		return compact
+	}
+	// Decrypts into the counting writer, returning the bytes allocated meanwhile
+	decrypt := func(writer *countingWriter, request model.DecryptRequest) uint64 {
+		body, _ := encodingjson.Marshal(request)
+		httpRequest := httptest.NewRequest(http.MethodPost, "/v1/decrypt", bytes.NewReader(body))
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		router.ServeHTTP(writer, httpRequest)
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+
+	plaintext := make([]byte, 4<<20)
+	rand.Read(plaintext)
+	compact := encrypt(plaintext, nil)
+
+	streamed := &countingWriter{header: http.Header{}}
+	streamedAlloc := decrypt(streamed, model.DecryptRequest{Ciphertext: compact, SecretKeyBase64: secret, Stream: true})
+	if streamed.status != http.StatusOK || streamed.size != len(plaintext) || streamed.header.Get("Content-Type") != mimeOctetStream {
+		t.Fatalf("expected the %d bytes of the plaintext streamed, got %d with %d bytes", len(plaintext), streamed.status, streamed.size)
+	}
+	if streamed.largest > streamChunkSize || streamed.flushes < len(plaintext)/streamChunkSize {
+		t.Fatalf("expected writes of at most %d bytes each flushed, got %d flushes and a %d byte write", streamChunkSize, streamed.flushes, streamed.largest)
+	}
+
+	// The JSON response holds the plaintext as a string and in its encoded body on top of what streaming allocates
+	buffered := &countingWriter{header: http.Header{}}
+	bufferedAlloc := decrypt(buffered, model.DecryptRequest{Ciphertext: compact, SecretKeyBase64: secret})
+	if buffered.status != http.StatusOK || streamedAlloc+uint64(len(plaintext)) > bufferedAlloc {
+		t.Fatalf("expected streaming to allocate at least the plaintext size less, streamed %d bytes and buffered %d", streamedAlloc, bufferedAlloc)
+	}
+
+	// The decompression cap holds before a byte is sent
+	compressible := []byte(base64.StdEncoding.EncodeToString(plaintext[:2<<20]))
+	capped := &countingWriter{header: http.Header{}}
+	decrypt(capped, model.DecryptRequest{Ciphertext: encrypt(compressible, &jose.EncrypterOptions{Compression: jose.DEFLATE}), SecretKeyBase64: secret, Stream: true})
+	if capped.status != http.StatusUnprocessableEntity || capped.header.Get("Content-Type") == mimeOctetStream {
+		t.Fatalf("expected the inflated plaintext refused, got %d", capped.status)
+	}
+}
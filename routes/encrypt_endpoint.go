@@ -1,108 +1,820 @@
 package routes
 
 import (
-	"bytes"
-	"crypto/rsa"
+	stdcrypto "crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-jose/go-jose/v4"
+	"go.opentelemetry.io/otel/codes"
 	"jwe-go/model"
+	"jwe-go/packages/clock"
+	"jwe-go/packages/config"
 	"jwe-go/packages/crypto"
 	"jwe-go/packages/json"
-	"jwe-go/packages/pool"
-	"jwe-go/packages/schema"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/tracing"
+	"maps"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// ServerKidResponseHeader tells the client which key thumbprint was embedded as server_kid
+const ServerKidResponseHeader = "X-Server-Kid"
+
+// TokenIDResponseHeader returns the jti header of a token encrypted with IncludeTokenID
+const TokenIDResponseHeader = "X-Token-ID"
+
+// tokenIDKey holds the jti of the token being encrypted until serializeJWE has issued it
+const tokenIDKey = "pendingTokenID"
+
+// WarningResponseHeader carries non-fatal advice about the request, like a weak PBES2 iteration count
+const WarningResponseHeader = "Warning"
+
 func EncryptEndpoint(context *gin.Context) {
 	var encryption model.EncryptRequest
 
-	// Get a buffer from the pool
-	buf := pool.BufPool.Get().(*bytes.Buffer)
-	buf.Reset()
-	defer pool.BufPool.Put(buf)
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &encryption) {
+		return
+	}
 
-	// Read request body
-	if _, err := buf.ReadFrom(context.Request.Body); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+	// Manually validate the struct using the validator, through a pointer so the request is not copied on every call
+	if !validateBody(context, &encryption) {
 		return
 	}
 
-	// Use strict unmarshaling
-	if err := json.StrictUnmarshal(buf.Bytes(), &encryption); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON or unknown field"})
+	// Resolve the content encryption algorithm, defaulting to A256GCM
+	contentEncryption, err := crypto.ParseContentEncryption(encryption.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
 		return
 	}
 
-	// Manually validate the struct using the validator
-	if err := schema.Validate.Struct(encryption); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Reject client headers that collide with the JOSE structure, zip is set through Compress and only ever DEF
+	if zip, ok := encryption.ProtectedHeaders["zip"]; ok {
+		if err := crypto.ValidateCompression(zip); err != nil {
+			writeError(context, http.StatusBadRequest, CodeUnsupportedZip, err)
+			return
+		}
+	}
+	if err := crypto.ValidateProtectedHeaders(encryption.ProtectedHeaders); err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidHeader, err)
+		return
+	}
+	if !checkCustomHeadersAllowed(context, encryption.ProtectedHeaders) {
+		return
+	}
+	if err := crypto.ValidateCriticalHeaders(encryption.CriticalHeaders, encryption.ProtectedHeaders); err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidHeader, err)
 		return
 	}
 
-	var publicKey *rsa.PublicKey
-	var err error
+	// The token ID goes in with the client headers, which were checked above
+	if encryption.IncludeTokenID {
+		tokenID, err := crypto.NewTokenID()
+		if err != nil {
+			writeError(context, http.StatusInternalServerError, CodeInternal, err)
+			return
+		}
+		headers := make(map[string]string, len(encryption.ProtectedHeaders)+1)
+		maps.Copy(headers, encryption.ProtectedHeaders)
+		headers[crypto.TokenIDHeader] = tokenID
+		encryption.ProtectedHeaders = headers
+		context.Set(tokenIDKey, tokenID)
+	}
+
+	// Additional authenticated data is dropped by the compact serialization, so it has to be asked for with json
+	if len(encryption.AdditionalData) > 0 && encryption.Serialization != "json" {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("AdditionalData requires the json serialization"))
+		return
+	}
+
+	// Tokens without server_kid can't be checked against a thumbprint, there is no hash to pick for one
+	if !includesServerKid(encryption) && len(encryption.ServerKidHash) > 0 {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("ServerKidHash cannot be combined with IncludeServerKid false"))
+		return
+	}
+
+	// The size is known before decoding, an oversized plaintext is never allocated
+	if !checkPlaintextSize(context, decodedPlaintextSize(encryption.Plaintext, encryption.PlaintextEncoding)) {
+		return
+	}
+
+	// Binary plaintexts arrive base64url encoded, the string holds the raw bytes from here on
+	plaintext, err := decodePlaintext(encryption.Plaintext, encryption.PlaintextEncoding)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidEncoding, err)
+		return
+	}
+	encryption.Plaintext = string(plaintext)
 
-	// Try to import the RSA public key from either the Public Key PEM or Certificate PEM.
+	// Named fields are encrypted together as one JSON object
+	if len(encryption.Fields) > 0 {
+		fields, err := json.Marshal(encryption.Fields)
+		if err != nil {
+			writeError(context, http.StatusInternalServerError, CodeInternal, errors.New("failed to serialize the fields"))
+			return
+		}
+		encryption.Plaintext = string(fields)
+		if !checkPlaintextSize(context, len(encryption.Plaintext)) {
+			return
+		}
+	}
+
+	if !checkContentAllowed(context, []byte(encryption.Plaintext)) {
+		return
+	}
+
+	// In JWT mode the plaintext becomes a claims set carrying the standard claims
+	if sendsClaims(encryption) {
+		claims, err := crypto.BuildClaims(encryption.Plaintext, encryption.Subject, encryption.Audience, time.Duration(encryption.ExpiresInSeconds)*time.Second)
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidClaims, err)
+			return
+		}
+		encryption.Plaintext = string(claims)
+	}
+
+	// A supplied CEK replaces the random one, Recipients and Password were ruled out by validation
+	contentKey, ok := clientContentKey(context, encryption, contentEncryption)
+	if !ok {
+		return
+	}
+	defer crypto.Zero(contentKey)
+
+	// Multiple recipients can only be represented in the JSON serialization
+	if len(encryption.Recipients) > 0 {
+		if len(encryption.PublicKeyPem) > 0 || len(encryption.PublicKeyJwk) > 0 || len(encryption.PublicKeyJwks) > 0 || len(encryption.CertificatePem) > 0 || len(encryption.SymmetricKey) > 0 || len(encryption.Password) > 0 || len(encryption.CertificateChainPem) > 0 {
+			writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("Recipients cannot be combined with PublicKeyPem, PublicKeyJwk, PublicKeyJwks, CertificatePem, CertificateChainPem, SymmetricKey or Password"))
+			return
+		}
+		if encryption.Kid != nil {
+			writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("Kid cannot be combined with Recipients, each recipient is tagged with its thumbprint"))
+			return
+		}
+		if len(encryption.Recipients) > config.Current.MaxRecipients {
+			writeError(context, http.StatusRequestEntityTooLarge, CodeTooManyRecipients, fmt.Errorf("request exceeds the maximum of %d recipients", config.Current.MaxRecipients))
+			return
+		}
+		if len(encryption.Recipients) > 1 && encryption.Serialization == "compact" {
+			writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("compact serialization supports a single recipient only, use json"))
+			return
+		}
+		encryptToRecipients(context, encryption, contentEncryption)
+		return
+	}
+
+	// A shared secret, supplied or derived from the master secret, skips the public key import and the encrypter pool
+	if len(encryption.SymmetricKey) > 0 || encryption.KeyDerivationInfo != "" {
+		if len(encryption.CertificateChainPem) > 0 {
+			writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("CertificateChainPem cannot be combined with SymmetricKey"))
+			return
+		}
+		encryptWithSymmetricKey(context, encryption, contentEncryption, contentKey)
+		return
+	}
+
+	// A password derives the key wrapping key with PBES2
+	if len(encryption.Password) > 0 {
+		if len(encryption.CertificateChainPem) > 0 {
+			writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("CertificateChainPem cannot be combined with Password"))
+			return
+		}
+		encryptWithPassword(context, encryption, contentEncryption)
+		return
+	}
+	if encryption.PBES2Iterations > 0 {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("PBES2Iterations requires Password"))
+		return
+	}
+
+	var recipientKey crypto.PublicKeyEntry
+	var publicKey interface{}
+	var certificate *x509.Certificate
+	var storedKey *crypto.PrivateKeyEntry
+	importErrorCode := CodeInvalidPEM
+	_, importSpan := tracing.Start(context.Request.Context(), "key-import")
+	defer importSpan.End() // Covers the early returns, ending an ended span does nothing
+
+	// Try to import the public key from the Public Key PEM, Public Key JWK, JWK set or Certificate PEM.
+	// PEM keys go through the key cache, which also holds their JWK and thumbprint.
 	switch {
 	case len(encryption.PublicKeyPem) > 0 && len(encryption.CertificatePem) > 0:
-		context.JSON(http.StatusBadRequest, gin.H{"error": "both PublicKeyPem and CertificatePem cannot be set at the same time"})
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("both PublicKeyPem and CertificatePem cannot be set at the same time"))
 		return
 	case len(encryption.PublicKeyPem) > 0:
-		publicKey, err = crypto.ImportRSAPublicKeyFromPEM(encryption.PublicKeyPem)
+		recipientKey, err = crypto.GetOrImportPublicKey(encryption.PublicKeyPem)
+	case len(encryption.PublicKeyJwk) > 0:
+		importErrorCode = CodeInvalidJWK
+		// A key restricted to signatures must not be encrypted to by mistake
+		if err = crypto.ValidateKeyUsage(encryption.PublicKeyJwk, crypto.KeyOperationEncrypt); errors.Is(err, crypto.ErrKeyUsage) {
+			importErrorCode = CodeInvalidKeyUsage
+		} else if err == nil {
+			if publicKey, _, err = crypto.ImportPublicKeyFromJWK(encryption.PublicKeyJwk); err == nil {
+				recipientKey, err = crypto.NewPublicKeyEntry(publicKey)
+			}
+		}
+	case len(encryption.PublicKeyJwks) > 0:
+		if encryption.Kid == nil {
+			writeError(context, http.StatusBadRequest, CodeValidationFailed, errors.New("Kid is required to select a key from PublicKeyJwks"))
+			return
+		}
+		importErrorCode = CodeInvalidJWK
+		if publicKey, _, err = crypto.SelectKeyFromJWKS(encryption.PublicKeyJwks, *encryption.Kid); err == nil {
+			recipientKey, err = crypto.NewPublicKeyEntry(publicKey)
+		} else if errors.Is(err, crypto.ErrKidNotFound) {
+			importErrorCode = CodeKeyNotFound
+		}
 	case len(encryption.CertificatePem) > 0:
-		publicKey, err = crypto.ImportRSAPublicKeyFromCertificatePEM(encryption.CertificatePem)
+		if certificate, err = crypto.ParseCertificatePEM(encryption.CertificatePem); err != nil {
+			break
+		}
+		if !checkCertificateValidity(context, certificate) {
+			return
+		}
+		importErrorCode = CodeInvalidKey
+		if publicKey, err = crypto.PublicKeyFromCertificate(certificate); err == nil {
+			recipientKey, err = crypto.NewPublicKeyEntry(publicKey)
+		}
+	case encryption.Kid != nil:
+		// A kid without key material selects a registered server key by its thumbprint
+		keys, ok := tenantKeys(context)
+		if !ok {
+			return
+		}
+		entry, found := keys.Get(*encryption.Kid)
+		if !found {
+			importErrorCode, err = CodeKeyNotFound, fmt.Errorf("%w: %q", crypto.ErrKeyNotFound, *encryption.Kid)
+			break
+		}
+		if err = entry.CheckExpiry(clock.Now()); err != nil {
+			importErrorCode = CodeKeyExpired
+			break
+		}
+		storedKey = &entry
+		recipientKey, err = crypto.NewPublicKeyEntry(entry.PublicKey)
 	default:
-		context.JSON(http.StatusBadRequest, gin.H{"error": "No valid PEM provided"})
+		writeError(context, http.StatusBadRequest, CodeMissingKey, errors.New("no valid PEM or JWK provided"))
 		return
 	}
 
 	// Handle any error from the import functions.
 	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		importSpan.SetStatus(codes.Error, importErrorCode)
+		writeError(context, http.StatusBadRequest, importErrorCode, err)
+		return
+	}
+	importSpan.SetAttributes(tracing.AttributeKeyType.String(recipientKey.KeyType.String()), tracing.AttributeKeySize.Int(crypto.KeySize(recipientKey.PublicKey)))
+	importSpan.End()
+
+	// Resolve the key management algorithm for the imported key type
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(encryption.KeyAlgorithm, recipientKey.KeyType, encryption.AllowLegacyRSA15, encryption.AllowLegacyHash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) {
+		return
+	}
+	if storedKey != nil {
+		if err := storedKey.CheckAlgorithm(string(keyAlgorithm)); err != nil {
+			writeError(context, http.StatusBadRequest, CodeAlgorithmNotAllowed, err)
+			return
+		}
+	}
+	if (len(encryption.PartyUInfo) > 0 || len(encryption.PartyVInfo) > 0) && keyAlgorithm != jose.ECDH_ES_A256KW {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, fmt.Errorf("apu and apv only apply to ECDH-ES key agreement, not %s", keyAlgorithm))
 		return
 	}
+	if !checkContentKeyAlgorithm(context, contentKey, keyAlgorithm) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	// Clients opting out of server_kid skip the thumbprint along with the headers
+	var serverKid string
+	var serverKidHash stdcrypto.Hash
+	if includesServerKid(encryption) {
+		if serverKid, serverKidHash, ok = recipientServerKid(context, recipientKey, encryption.ServerKidHash); !ok {
+			return
+		}
+	}
+
+	// A client supplied kid labels the token, server_kid still carries the thumbprint
+	var keyID string
+	if encryption.Kid != nil {
+		keyID = *encryption.Kid
+	}
+
+	encrypterKey := crypto.EncrypterKey{
+		Thumbprint:        serverKid,
+		ServerKidHash:     serverKidHash,
+		KeyAlgorithm:      keyAlgorithm,
+		ContentEncryption: contentEncryption,
+		Compress:          encryption.Compress,
+		KeyID:             keyID,
+		ContentType:       payloadContentType(encryption),
+		Type:              jose.ContentType(encryption.Typ),
+	}
+
+	// The leaf of an optional certificate chain must hold the encryption key
+	var certificateChain []*x509.Certificate
+	if len(encryption.CertificateChainPem) > 0 {
+		certificateChain, err = crypto.ParseCertificateChainPEM(encryption.CertificateChainPem)
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+			return
+		}
+		if !crypto.CertificateMatchesKey(certificateChain[0], recipientKey.PublicKey) {
+			writeError(context, http.StatusBadRequest, CodeInvalidKey, errors.New("leaf certificate does not match the encryption key"))
+			return
+		}
+	}
 
-	// Convert the RSA public key to a JWK
-	jwk, err := crypto.ConvertRSAPublicKeyToJWK(publicKey)
+	// Reuse a pooled encrypter unless the request carries its own protected headers, time headers, party info, a certificate or a CEK.
+	// Pooled encrypters always stamp server_kid, a request leaving it out gets an encrypter of its own.
+	var encrypter jose.Encrypter
+	if serverKid != "" && len(encryption.ProtectedHeaders) == 0 && certificate == nil && certificateChain == nil && !encryption.IssuedAt && encryption.NotBeforeInSeconds == nil && len(encryption.PartyUInfo) == 0 && len(encryption.PartyVInfo) == 0 && contentKey == nil {
+		encrypter, err = crypto.Encrypters.Get(encrypterKey, recipientKey.PublicKey)
+	} else {
+		headers := requestHeaders(encryption)
+		if serverKid != "" {
+			for name, value := range crypto.ServerKidHeaders(serverKid, serverKidHash) {
+				headers[name] = value // Add custom headers (server_kid and its hash)
+			}
+		}
+		// The recipient certificate is identified by its thumbprint, a chain carries its leaf's
+		if certificate != nil {
+			headers[crypto.CertificateThumbprintHeader] = crypto.CertificateThumbprint(certificate)
+		}
+		if certificateChain != nil {
+			headers[crypto.CertificateChainHeader], headers[crypto.CertificateThumbprintHeader] = crypto.CertificateChainHeaders(certificateChain)
+		}
+		options := encrypterOptions(encryption, headers)
+
+		// Create JWE Encrypter with the requested key management and content encryption algorithms
+		recipient := jose.Recipient{
+			Algorithm: keyAlgorithm,           // Key encryption algorithm
+			Key:       recipientKey.PublicKey, // Recipient's public key
+			KeyID:     keyID,                  // Optional kid header
+		}
+		if contentKey != nil {
+			encrypter, err = crypto.NewContentKeyEncrypter(contentEncryption, recipient, options, contentKey)
+		} else {
+			encrypter, err = crypto.NewEncrypter(contentEncryption, recipient, options)
+		}
+	}
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+	if answerDryRun(context, model.ValidateResponse{Kid: keyID, ServerKid: serverKid, Alg: string(keyAlgorithm), Enc: string(contentEncryption)}) {
 		return
 	}
 
-	// Compute thumbprint of the public key (SHA256)
-	thumbprint, err := crypto.GetJWKThumbprint(jwk)
+	// Encrypt the data
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	jwe, err := crypto.EncryptWithContext(ctx, encrypter, []byte(encryption.Plaintext), additionalData(encryption))
+	metrics.Record(metrics.OperationEncrypt, string(keyAlgorithm), string(contentEncryption), err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute public key thumbprint"})
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed)
 		return
 	}
+	if serverKid != "" {
+		context.Header(ServerKidResponseHeader, serverKid)
+	}
 
-	// Create JWE Encrypter with RSA-OAEP-256 and AES-GCM
-	encrypter, err := jose.NewEncrypter(
-		jose.A256GCM, // Content encryption algorithm
-		jose.Recipient{
-			Algorithm: jose.RSA_OAEP_256, // Key encryption algorithm
-			Key:       publicKey,         // Recipient's public key
-		},
-		(&jose.EncrypterOptions{}).WithHeader("server_kid", thumbprint), // Add custom header (server_kid)
-	)
+	// Serialize JWE to the compact format, or the JSON one when requested
+	writeEncryptResult(context, jwe, encryption, model.EncryptResponse{
+		Serialization: encryption.Serialization,
+		Kid:           keyID,
+		Alg:           string(keyAlgorithm),
+		Enc:           string(contentEncryption),
+	})
+}
+
+// encryptToRecipients encrypts the plaintext once for every recipient and returns the full JSON serialization
+func encryptToRecipients(context *gin.Context, encryption model.EncryptRequest, contentEncryption jose.ContentEncryption) {
+	recipients := make([]jose.Recipient, 0, len(encryption.Recipients))
+	keyAlgorithms := make([]string, 0, len(encryption.Recipients))
+	recipientHeaders := make([]map[string]string, 0, len(encryption.Recipients))
+	hasRecipientHeaders, ownEncrypter := false, false
+	protectedHeaders := requestHeaders(encryption)
+
+	// Every recipient is checked on its own, the failures are all reported together
+	var failures []model.RecipientError
+	thumbprints := make(map[string]int, len(encryption.Recipients))
+	for i, spec := range encryption.Recipients {
+		recipient, header, failure := recipientFromSpec(spec, len(encryption.Recipients), contentEncryption, protectedHeaders)
+		if failure == nil {
+			if first, ok := thumbprints[recipient.thumbprint]; ok {
+				failure = &statusError{http.StatusBadRequest, CodeDuplicateRecipient, fmt.Errorf("recipient %d has the same key as recipient %d", i, first)}
+			} else {
+				thumbprints[recipient.thumbprint] = i
+			}
+		}
+		if failure != nil {
+			failures = append(failures, model.RecipientError{Index: i, Code: failure.code, Message: failure.Error()})
+			continue
+		}
+		ownEncrypter = ownEncrypter || recipient.ownEncrypter
+
+		keyAlgorithms = append(keyAlgorithms, string(recipient.Algorithm))
+		recipientHeaders = append(recipientHeaders, header)
+		hasRecipientHeaders = hasRecipientHeaders || len(header) > 0
+		recipients = append(recipients, recipient.Recipient)
+	}
+	if len(failures) > 0 {
+		writeError(context, http.StatusBadRequest, CodeInvalidRecipients, &detailedError{
+			error:   fmt.Errorf("recipient %d: %s", failures[0].Index, failures[0].Message),
+			details: map[string]interface{}{"recipients": failures},
+		})
+		return
+	}
+
+	// The compact serialization has no unprotected header to carry them
+	if hasRecipientHeaders && encryption.Serialization == serializationCompact {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("recipient headers require the json serialization"))
+		return
+	}
+
+	middleware.SetAlgorithms(context, strings.Join(keyAlgorithms, ","), string(contentEncryption))
+
+	options := encrypterOptions(encryption, protectedHeaders)
+
+	var encrypter jose.Encrypter
+	var err error
+	if ownEncrypter {
+		encrypter, err = crypto.NewEncrypter(contentEncryption, recipients[0], options)
+	} else {
+		encrypter, err = jose.NewMultiEncrypter(contentEncryption, recipients, options)
+	}
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+	if answerDryRun(context, model.ValidateResponse{Enc: string(contentEncryption)}) {
 		return
 	}
 
-	// Encrypt the data
-	jwe, err := encrypter.Encrypt([]byte(encryption.Plaintext))
+	// Multi-recipient messages have no single alg, they are labelled as other
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	jwe, err := crypto.EncryptWithContext(ctx, encrypter, []byte(encryption.Plaintext), additionalData(encryption))
+	metrics.Record(metrics.OperationEncrypt, "", string(contentEncryption), err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed)
 		return
 	}
 
-	// Serialize JWE to a compact format
-	serialized, err := jwe.CompactSerialize()
+	if hasRecipientHeaders {
+		context.Set(recipientHeadersKey, recipientHeaders)
+	}
+
+	// Each recipient has its own alg and kid, only enc is shared
+	writeEncryptResult(context, jwe, encryption, model.EncryptResponse{
+		Serialization: serializationJSON,
+		Enc:           string(contentEncryption),
+	})
+}
+
+// encryptWithSymmetricKey encrypts the plaintext with a pre-shared key using dir or AES key wrap
+func encryptWithSymmetricKey(context *gin.Context, encryption model.EncryptRequest, contentEncryption jose.ContentEncryption, contentKey []byte) {
+	var symmetricKey []byte
+	var err error
+	if encryption.KeyDerivationInfo == "" {
+		symmetricKey, err = crypto.DecodeBase64(encryption.SymmetricKey, encryption.StrictBase64)
+	} else {
+		// The secret is derived in the size the requested algorithm takes, dir by default
+		derivationAlgorithm := jose.KeyAlgorithm(encryption.KeyAlgorithm)
+		if derivationAlgorithm == "" {
+			derivationAlgorithm = jose.DIRECT
+		}
+		symmetricKey, err = deriveSymmetricKey(encryption.KeyDerivationInfo, derivationAlgorithm, contentEncryption)
+		if errors.Is(err, errDerivationDisabled) {
+			writeError(context, http.StatusBadRequest, CodeDerivationDisabled, err)
+			return
+		}
+		defer crypto.Zero(symmetricKey)
+	}
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
 		return
 	}
 
-	context.String(http.StatusOK, serialized)
+	keyAlgorithm, err := crypto.ParseSymmetricKeyAlgorithm(encryption.KeyAlgorithm, contentEncryption, symmetricKey)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) || !checkContentKeyAlgorithm(context, contentKey, keyAlgorithm) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	options := encrypterOptions(encryption, requestHeaders(encryption))
+
+	recipient := jose.Recipient{Algorithm: keyAlgorithm, Key: symmetricKey}
+	if encryption.Kid != nil {
+		recipient.KeyID = *encryption.Kid
+	}
+
+	var encrypter jose.Encrypter
+	if contentKey != nil {
+		encrypter, err = crypto.NewContentKeyEncrypter(contentEncryption, recipient, options, contentKey)
+	} else {
+		encrypter, err = jose.NewEncrypter(contentEncryption, recipient, options)
+	}
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+	if answerDryRun(context, model.ValidateResponse{Kid: recipient.KeyID, Alg: string(keyAlgorithm), Enc: string(contentEncryption)}) {
+		return
+	}
+
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	jwe, err := crypto.EncryptWithContext(ctx, encrypter, []byte(encryption.Plaintext), additionalData(encryption))
+	metrics.Record(metrics.OperationEncrypt, string(keyAlgorithm), string(contentEncryption), err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed)
+		return
+	}
+
+	writeEncryptResult(context, jwe, encryption, model.EncryptResponse{
+		Serialization: encryption.Serialization,
+		Kid:           recipient.KeyID,
+		Alg:           string(keyAlgorithm),
+		Enc:           string(contentEncryption),
+	})
+}
+
+// encryptWithPassword encrypts the plaintext with PBES2, go-jose generates the p2s salt and emits it with p2c
+func encryptWithPassword(context *gin.Context, encryption model.EncryptRequest, contentEncryption jose.ContentEncryption) {
+	keyAlgorithm, err := crypto.ParsePasswordKeyAlgorithm(encryption.KeyAlgorithm)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	iterations, err := crypto.ResolvePBES2Iterations(encryption.PBES2Iterations)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeValidationFailed, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	options := encrypterOptions(encryption, requestHeaders(encryption))
+
+	recipient := jose.Recipient{Algorithm: keyAlgorithm, Key: []byte(encryption.Password), PBES2Count: iterations}
+	if encryption.Kid != nil {
+		recipient.KeyID = *encryption.Kid
+	}
+
+	encrypter, err := jose.NewEncrypter(contentEncryption, recipient, options)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+	if answerDryRun(context, model.ValidateResponse{Kid: recipient.KeyID, Alg: string(keyAlgorithm), Enc: string(contentEncryption)}) {
+		return
+	}
+
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	jwe, err := crypto.EncryptWithContext(ctx, encrypter, []byte(encryption.Plaintext), additionalData(encryption))
+	metrics.Record(metrics.OperationEncrypt, string(keyAlgorithm), string(contentEncryption), err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed)
+		return
+	}
+
+	// The minimum is a floor, not a recommendation, so the client is told when it sits on it
+	if iterations == crypto.MinPBES2Iterations {
+		context.Header(WarningResponseHeader, fmt.Sprintf(`299 - "PBES2 iteration count %d is the configured minimum, prefer %d or more"`, iterations, crypto.DefaultPBES2Iterations))
+	}
+
+	writeEncryptResult(context, jwe, encryption, model.EncryptResponse{
+		Serialization: encryption.Serialization,
+		Kid:           recipient.KeyID,
+		Alg:           string(keyAlgorithm),
+		Enc:           string(contentEncryption),
+	})
+}
+
+// clientContentKey decodes the CEK the request supplies, nil when the encrypter draws a random one.
+// Supplied keys are refused unless the server allows them, and every use is answered with a warning.
+func clientContentKey(context *gin.Context, encryption model.EncryptRequest, contentEncryption jose.ContentEncryption) ([]byte, bool) {
+	if len(encryption.ContentEncryptionKey) == 0 {
+		return nil, true
+	}
+	if !config.Current.AllowClientContentKey {
+		writeError(context, http.StatusForbidden, CodeContentKeyDisabled, errors.New("ContentEncryptionKey is disabled on this server"))
+		return nil, false
+	}
+
+	cek, _ := crypto.DecodeBase64(encryption.ContentEncryptionKey, encryption.StrictBase64) // Checked by the flexbase64 rule
+	if err := crypto.ValidateContentEncryptionKey(cek, contentEncryption); err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return nil, false
+	}
+	context.Header(WarningResponseHeader, `299 - "a supplied content encryption key must never be reused, every message encrypted under it can be read with it"`)
+	return cek, true
+}
+
+// checkContentKeyAlgorithm rejects a supplied CEK with the key management algorithms that don't wrap one
+func checkContentKeyAlgorithm(context *gin.Context, contentKey []byte, keyAlgorithm jose.KeyAlgorithm) bool {
+	if contentKey != nil && !crypto.SupportsContentKey(keyAlgorithm) {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, fmt.Errorf("ContentEncryptionKey cannot be used with %s, it does not wrap a content encryption key", keyAlgorithm))
+		return false
+	}
+	return true
+}
+
+// checkCertificateValidity refuses a recipient certificate outside its validity period, unless the check is turned off
+func checkCertificateValidity(context *gin.Context, certificate *x509.Certificate) bool {
+	if !config.Current.EnforceCertValidity {
+		return true
+	}
+	err := crypto.CheckCertificateValidity(certificate, clock.Now())
+	switch {
+	case errors.Is(err, crypto.ErrCertificateExpired):
+		writeError(context, http.StatusBadRequest, CodeCertExpired, err)
+		return false
+	case err != nil:
+		writeError(context, http.StatusBadRequest, CodeCertNotYetValid, err)
+		return false
+	}
+	return true
+}
+
+// sendsClaims reports whether the request asks for the plaintext to be sent as JWT claims
+func sendsClaims(encryption model.EncryptRequest) bool {
+	return encryption.Audience != "" || encryption.Subject != "" || encryption.ExpiresInSeconds > 0
+}
+
+// specRecipient is a recipient of a multi-recipient request with the thumbprint of its key
+type specRecipient struct {
+	jose.Recipient
+	thumbprint string
+	// ownEncrypter is set for the keys and algorithms go-jose can't encrypt to itself
+	ownEncrypter bool
+}
+
+// recipientFromSpec imports the key of a recipient and resolves its algorithm and unprotected header,
+// the failure is what is reported for that recipient
+func recipientFromSpec(spec model.RecipientSpec, count int, contentEncryption jose.ContentEncryption, protectedHeaders map[string]interface{}) (specRecipient, map[string]string, *statusError) {
+	recipientKey, err := crypto.GetOrImportPublicKey(spec.PublicKeyPem)
+	if err != nil {
+		return specRecipient{}, nil, &statusError{http.StatusBadRequest, CodeInvalidPEM, err}
+	}
+
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(spec.KeyAlgorithm, recipientKey.KeyType, spec.AllowLegacyRSA15, spec.AllowLegacyHash)
+	if err != nil {
+		return specRecipient{}, nil, &statusError{http.StatusBadRequest, CodeUnsupportedAlg, err}
+	}
+	if failure := encryptionPolicyError(keyAlgorithm, contentEncryption); failure != nil {
+		return specRecipient{}, nil, failure
+	}
+
+	// go-jose builds multi-recipient messages itself and has neither X25519 nor the non-standard algorithms
+	if recipientKey.KeyType == crypto.KeyTypeX25519 && count > 1 {
+		return specRecipient{}, nil, &statusError{http.StatusBadRequest, CodeUnsupportedAlg, errors.New("X25519 keys are only supported for a single recipient")}
+	}
+	if crypto.IsNonStandardKeyAlgorithm(keyAlgorithm) && count > 1 {
+		return specRecipient{}, nil, &statusError{http.StatusBadRequest, CodeUnsupportedAlg, fmt.Errorf("key algorithm %s is only supported for a single recipient", keyAlgorithm)}
+	}
+
+	// The unprotected header names must not repeat the protected ones, go-jose sets kid itself
+	if err := crypto.ValidateRecipientHeaders(spec.Header, protectedHeaders); err != nil {
+		return specRecipient{}, nil, &statusError{http.StatusBadRequest, CodeInvalidHeader, err}
+	}
+	keyID := recipientKey.Thumbprint
+	header := make(map[string]string, len(spec.Header))
+	for name, value := range spec.Header {
+		if name == "kid" {
+			keyID = value
+		} else {
+			header[name] = value
+		}
+	}
+
+	// Each recipient is tagged with its own thumbprint as kid, unless its header names another
+	return specRecipient{
+		Recipient: jose.Recipient{
+			Algorithm: keyAlgorithm,
+			Key:       recipientKey.PublicKey,
+			KeyID:     keyID,
+		},
+		thumbprint:   recipientKey.Thumbprint,
+		ownEncrypter: recipientKey.KeyType == crypto.KeyTypeX25519 || crypto.IsNonStandardKeyAlgorithm(keyAlgorithm),
+	}, header, nil
+}
+
+// includesServerKid reports whether the token gets the server_kid headers, the default unless the request opts out
+func includesServerKid(encryption model.EncryptRequest) bool {
+	return encryption.IncludeServerKid == nil || *encryption.IncludeServerKid
+}
+
+// additionalData decodes the AdditionalData of the request, nil when there is none
+func additionalData(encryption model.EncryptRequest) []byte {
+	if len(encryption.AdditionalData) == 0 {
+		return nil
+	}
+	aad, _ := crypto.DecodeBase64(encryption.AdditionalData, encryption.StrictBase64) // Checked by the flexbase64 rule
+	return aad
+}
+
+// requestHeaders collects the protected headers the request asks for, the client headers, crit, the cty, the time headers,
+// apu and apv and the HKDF info label
+func requestHeaders(encryption model.EncryptRequest) map[string]interface{} {
+	headers := make(map[string]interface{}, len(encryption.ProtectedHeaders)+4)
+	for name, value := range encryption.ProtectedHeaders {
+		headers[name] = value
+	}
+	if len(encryption.CriticalHeaders) > 0 {
+		headers[crypto.CriticalHeader] = encryption.CriticalHeaders
+	}
+	if contentType := payloadContentType(encryption); contentType != "" {
+		headers["cty"] = string(contentType)
+	}
+	for name, value := range crypto.TimeHeaders(encryption.IssuedAt, notBeforeDelay(encryption)) {
+		headers[name] = value
+	}
+	if encryption.KeyDerivationInfo != "" {
+		headers[crypto.HKDFInfoHeader] = encryption.KeyDerivationInfo
+	}
+	if len(encryption.PartyUInfo) > 0 {
+		headers[crypto.PartyUInfoHeader] = encryption.PartyUInfo
+	}
+	if len(encryption.PartyVInfo) > 0 {
+		headers[crypto.PartyVInfoHeader] = encryption.PartyVInfo
+	}
+	return headers
+}
+
+// encrypterOptions builds the encrypter options of the request from its headers, with the typ it asks for
+func encrypterOptions(encryption model.EncryptRequest, headers map[string]interface{}) *jose.EncrypterOptions {
+	options := crypto.BuildEncrypterOptions(headers, encryption.Compress)
+	if encryption.Typ != "" {
+		options.WithType(jose.ContentType(encryption.Typ))
+	}
+	return options
+}
+
+// writeEncryptResult sends the JWE of an encrypt request, with the ciphertext apart when the request detaches it
+func writeEncryptResult(context *gin.Context, jwe *jose.JSONWebEncryption, encryption model.EncryptRequest, metadata model.EncryptResponse) {
+	if encryption.DetachedContent {
+		writeDetachedJWE(context, jwe, metadata)
+		return
+	}
+	writeJWE(context, jwe, metadata)
+}
+
+// notBeforeDelay returns how long after now the token becomes valid, nil without an nbf header
+func notBeforeDelay(encryption model.EncryptRequest) *time.Duration {
+	if encryption.NotBeforeInSeconds == nil {
+		return nil
+	}
+	delay := time.Duration(*encryption.NotBeforeInSeconds) * time.Second
+	return &delay
+}
+
+// payloadContentType returns the cty of the request, JWT in claims mode, application/json for fields and none otherwise
+func payloadContentType(encryption model.EncryptRequest) jose.ContentType {
+	if sendsClaims(encryption) {
+		return crypto.JWTContentType
+	}
+	if len(encryption.Fields) > 0 {
+		return crypto.JSONContentType
+	}
+	return ""
 }
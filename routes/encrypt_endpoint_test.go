@@ -0,0 +1,783 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	encodingjson "encoding/json"
+	"encoding/pem"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/audit"
+	"jwe-go/packages/clock"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/json"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/schema"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// BenchmarkEncryptEndpoint sends the same request from every goroutine, as a busy client encrypting to one key does.
+// Run it with -benchmem, the key cache and the encrypter pool are warm after the first request.
+func BenchmarkEncryptEndpoint(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name      string
+		publicKey interface{}
+	}{
+		{"RSA-OAEP-256", &rsaKey.PublicKey},
+		{"ECDH-ES+A256KW", &ecKey.PublicKey},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			publicKeyPem, err := crypto.ExportPublicKeyAsPEM(test.publicKey)
+			if err != nil {
+				b.Fatal(err)
+			}
+			body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "a short message to encrypt", PublicKeyPem: publicKeyPem})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					recorder := httptest.NewRecorder()
+					router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+					if recorder.Code != http.StatusOK {
+						b.Fatalf("expected 200, got %d %q", recorder.Code, recorder.Body.String())
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+		})
+	}
+}
+
+func TestEncryptEndpointCanOmitTheServerKid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, err := crypto.ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(encryption model.EncryptRequest) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(encryption)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		return recorder
+	}
+	protectedHeader := func(recorder *httptest.ResponseRecorder) map[string]interface{} {
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected the token, got %d %q", recorder.Code, recorder.Body.String())
+		}
+		encoded, _, _ := strings.Cut(recorder.Body.String(), ".")
+		decoded, _ := base64.RawURLEncoding.DecodeString(encoded)
+		var header map[string]interface{}
+		if err := encodingjson.Unmarshal(decoded, &header); err != nil {
+			t.Fatal(err)
+		}
+		return header
+	}
+
+	included := send(model.EncryptRequest{Plaintext: "tagged", PublicKeyPem: publicKeyPem})
+	if header := protectedHeader(included); header[crypto.ServerKidHeader] == nil || included.Header().Get(ServerKidResponseHeader) == "" {
+		t.Fatalf("expected server_kid by default, got %v", header)
+	}
+
+	omit := false
+	omitted := send(model.EncryptRequest{Plaintext: "untagged", PublicKeyPem: publicKeyPem, IncludeServerKid: &omit})
+	header := protectedHeader(omitted)
+	if _, ok := header[crypto.ServerKidHeader]; ok {
+		t.Fatalf("expected no server_kid, got %v", header)
+	}
+	if _, ok := header[crypto.ServerKidHashHeader]; ok || omitted.Header().Get(ServerKidResponseHeader) != "" {
+		t.Fatalf("expected no server_kid_hash nor response header, got %v", header)
+	}
+
+	// A thumbprint hash only applies to a server_kid
+	conflicting := send(model.EncryptRequest{Plaintext: "untagged", PublicKeyPem: publicKeyPem, IncludeServerKid: &omit, ServerKidHash: "SHA-384"})
+	if conflicting.Code != http.StatusBadRequest || !strings.Contains(conflicting.Body.String(), CodeConflictingFields) {
+		t.Fatalf("expected CONFLICTING_FIELDS, got %d %q", conflicting.Code, conflicting.Body.String())
+	}
+}
+
+func TestEncryptEndpointEmitsTheType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/inspect", InspectEndpoint)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, err := crypto.ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(path string, value interface{}) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(value)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return recorder
+	}
+
+	// The pooled encrypter and the one a request builds for its own headers both stamp typ
+	for _, encryption := range []model.EncryptRequest{
+		{Plaintext: "routed", PublicKeyPem: publicKeyPem, Typ: "application/jose"},
+		{Plaintext: "routed", PublicKeyPem: publicKeyPem, Typ: "application/vnd.example+jwe", ProtectedHeaders: map[string]string{"x-tenant": "a"}},
+	} {
+		encrypted := send("/v1/encrypt", encryption)
+		if encrypted.Code != http.StatusOK {
+			t.Fatalf("expected the token, got %d %q", encrypted.Code, encrypted.Body.String())
+		}
+		inspected := send("/v1/inspect", model.InspectRequest{Ciphertext: encrypted.Body.String()})
+		var response model.InspectResponse
+		if err := encodingjson.Unmarshal(inspected.Body.Bytes(), &response); err != nil || response.Typ != encryption.Typ || response.Header["typ"] != encryption.Typ {
+			t.Fatalf("expected typ %s on inspect, got %d %q", encryption.Typ, inspected.Code, inspected.Body.String())
+		}
+	}
+
+	for _, test := range []struct {
+		encryption model.EncryptRequest
+		code       string
+	}{
+		{model.EncryptRequest{Plaintext: "routed", PublicKeyPem: publicKeyPem, Typ: "not a media type"}, CodeValidationFailed},
+		{model.EncryptRequest{Plaintext: "routed", PublicKeyPem: publicKeyPem, Typ: " application/jose"}, CodeValidationFailed},
+		{model.EncryptRequest{Plaintext: "routed", PublicKeyPem: publicKeyPem, ProtectedHeaders: map[string]string{"typ": "JOSE"}}, CodeInvalidHeader},
+	} {
+		if recorder := send("/v1/encrypt", test.encryption); recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), test.code) {
+			t.Fatalf("expected %s for typ %q, got %d %q", test.code, test.encryption.Typ, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestEncryptEndpointEncryptsToACertificate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificatePem := func(notBefore, notAfter time.Time) (string, []byte) {
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "recipient"}, NotBefore: notBefore, NotAfter: notAfter}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), der
+	}
+	send := func(certificate string) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "for the certificate holder", CertificatePem: certificate})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		return recorder
+	}
+
+	// The token names the certificate by its x5t#S256 and decrypts with the certificate key
+	valid, der := certificatePem(time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	recorder := send(valid)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the token, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	object, err := jose.ParseEncrypted(recorder.Body.String(), crypto.SupportedKeyAlgorithms, crypto.SupportedContentEncryptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+	if thumbprint := object.Header.ExtraHeaders[crypto.CertificateThumbprintHeader]; thumbprint != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("expected the certificate thumbprint, got %v", thumbprint)
+	}
+	if plaintext, err := object.Decrypt(privateKey); err != nil || string(plaintext) != "for the certificate holder" {
+		t.Fatalf("expected the token to decrypt with the certificate key, got %v", err)
+	}
+
+	expired, _ := certificatePem(time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	if recorder := send(expired); recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), CodeCertExpired) {
+		t.Fatalf("expected CERTIFICATE_EXPIRED, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	defer func(enforce bool) { config.Current.EnforceCertValidity = enforce }(config.Current.EnforceCertValidity)
+	config.Current.EnforceCertValidity = false
+	if recorder := send(expired); recorder.Code != http.StatusOK {
+		t.Fatalf("expected the expired certificate to be accepted without enforcement, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestEncryptEndpointRejectsUnknownCompression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+
+	symmetricKey := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	for _, test := range []struct {
+		zip  string
+		code string
+	}{
+		{"LZW", CodeUnsupportedZip},
+		{"", CodeUnsupportedZip},
+		// DEF is asked for with Compress, not as a header
+		{"DEF", CodeInvalidHeader},
+	} {
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "compressible", SymmetricKey: symmetricKey, ProtectedHeaders: map[string]string{"zip": test.zip}})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), test.code) {
+			t.Fatalf("expected %s for zip %q, got %d %q", test.code, test.zip, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestEncryptEndpointEnforcesTheCustomHeaderAllowlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+
+	if err := SetCustomHeaderPolicy([]string{"kid"}); err == nil {
+		t.Fatal("expected a reserved header to be refused in the allowlist")
+	}
+	if err := SetCustomHeaderPolicy([]string{"x-tenant"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCustomHeaderPolicy(nil)
+
+	symmetricKey := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	for _, test := range []struct {
+		headers map[string]string
+		status  int
+	}{
+		{map[string]string{"x-tenant": "a"}, http.StatusOK},
+		{nil, http.StatusOK},
+		{map[string]string{"x-tenant": "a", "x-trace": "b"}, http.StatusBadRequest},
+	} {
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "allowlisted", SymmetricKey: symmetricKey, ProtectedHeaders: test.headers})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		if recorder.Code != test.status {
+			t.Fatalf("expected %d for headers %v, got %d %q", test.status, test.headers, recorder.Code, recorder.Body.String())
+		}
+		if test.status == http.StatusBadRequest && !strings.Contains(recorder.Body.String(), CodeHeaderNotAllowed) {
+			t.Fatalf("expected HEADER_NOT_ALLOWED, got %q", recorder.Body.String())
+		}
+	}
+}
+
+func TestEncryptEndpointRejectsAnEmptyPlaintextUnlessAllowed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/encrypt/batch", BatchEncryptEndpoint)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, _ := crypto.ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	for _, test := range []struct {
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"/v1/encrypt", model.EncryptRequest{PublicKeyPem: publicKeyPem}, http.StatusBadRequest},
+		{"/v1/encrypt", model.EncryptRequest{PublicKeyPem: publicKeyPem, AllowEmpty: true}, http.StatusOK},
+		{"/v1/encrypt/batch", model.BatchEncryptRequest{Plaintexts: []string{"first", ""}, PublicKeyPem: publicKeyPem}, http.StatusBadRequest},
+		{"/v1/encrypt/batch", model.BatchEncryptRequest{Plaintexts: []string{"first", ""}, PublicKeyPem: publicKeyPem, AllowEmpty: true}, http.StatusOK},
+	} {
+		body, _ := encodingjson.Marshal(test.body)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader(body)))
+		if recorder.Code != test.status {
+			t.Fatalf("expected %d from %s for %+v, got %d %q", test.status, test.path, test.body, recorder.Code, recorder.Body.String())
+		}
+		if test.status == http.StatusBadRequest && !strings.Contains(recorder.Body.String(), `"code":"EMPTY_PLAINTEXT"`) {
+			t.Fatalf("expected EMPTY_PLAINTEXT, got %q", recorder.Body.String())
+		}
+	}
+}
+
+func TestEncryptEndpointRestrictsARegisteredKeyToItsAlgorithms(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	defer func(store *crypto.KeyStore) { crypto.PrivateKeys = store }(crypto.PrivateKeys)
+	crypto.PrivateKeys = crypto.NewKeyStore()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := crypto.PrivateKeys.RegisterKey(crypto.Key{PrivateKey: privateKey, Algorithms: []string{"RSA-OAEP-256"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := "not-a-registered-thumbprint"
+	for _, test := range []struct {
+		kid          *string
+		keyAlgorithm string
+		status       int
+		code         string
+	}{
+		{&entry.Thumbprint, "", http.StatusOK, ""},
+		{&entry.Thumbprint, "RSA-OAEP-256", http.StatusOK, ""},
+		{&entry.Thumbprint, "RSA-OAEP-384", http.StatusBadRequest, CodeAlgorithmNotAllowed},
+		{&entry.Thumbprint, "RSA-OAEP-512", http.StatusBadRequest, CodeAlgorithmNotAllowed},
+		{&unknown, "RSA-OAEP-256", http.StatusBadRequest, CodeKeyNotFound},
+	} {
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "to a registered key", Kid: test.kid, KeyAlgorithm: test.keyAlgorithm})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		if recorder.Code != test.status {
+			t.Fatalf("expected %d encrypting with %q, got %d %q", test.status, test.keyAlgorithm, recorder.Code, recorder.Body.String())
+		}
+		if test.code != "" && !strings.Contains(recorder.Body.String(), `"code":"`+test.code+`"`) {
+			t.Fatalf("expected %s encrypting with %q, got %q", test.code, test.keyAlgorithm, recorder.Body.String())
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		parsed, err := jose.ParseEncrypted(recorder.Body.String(), []jose.KeyAlgorithm{jose.RSA_OAEP_256}, []jose.ContentEncryption{jose.A256GCM})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext, err := parsed.Decrypt(privateKey); err != nil || string(plaintext) != "to a registered key" {
+			t.Fatalf("expected the registered key to decrypt the token, got %q: %v", plaintext, err)
+		}
+	}
+}
+
+func TestEncryptEndpointAcceptsStandardBase64UnlessStrict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+
+	// This key has + and / in standard base64
+	key := bytes.Repeat([]byte{0xfb, 0xff}, 16)
+	for _, test := range []struct {
+		symmetricKey string
+		strict       bool
+		status       int
+	}{
+		{base64.StdEncoding.EncodeToString(key), false, http.StatusOK},
+		{base64.URLEncoding.EncodeToString(key), false, http.StatusOK},
+		{base64.StdEncoding.EncodeToString(key), true, http.StatusBadRequest},
+		{base64.RawURLEncoding.EncodeToString(key), true, http.StatusOK},
+	} {
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "flexible", SymmetricKey: test.symmetricKey, StrictBase64: test.strict})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		if recorder.Code != test.status {
+			t.Fatalf("expected %d for %q with strict %v, got %d %q", test.status, test.symmetricKey, test.strict, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestExpiredKeyStopsEncryptingButDecryptsDuringTheGracePeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/decrypt", DecryptEndpoint)
+	defer func(store *crypto.KeyStore) { crypto.PrivateKeys = store }(crypto.PrivateKeys)
+	crypto.PrivateKeys = crypto.NewKeyStore()
+	defer func(previous clock.Clock) { clock.Current = previous }(clock.Current)
+	fake := clock.NewFake(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	clock.Current = fake
+	defer func(grace time.Duration) { crypto.DecryptionGracePeriod = grace }(crypto.DecryptionGracePeriod)
+	crypto.DecryptionGracePeriod = 24 * time.Hour
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := crypto.PrivateKeys.RegisterKey(crypto.Key{PrivateKey: privateKey, NotAfter: fake.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(path string, request interface{}) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(request)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return recorder
+	}
+
+	recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "before the expiry", Kid: &entry.Thumbprint})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the key to encrypt before its expiry, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	token := recorder.Body.String()
+
+	fake.Advance(2 * time.Hour)
+	if recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "after the expiry", Kid: &entry.Thumbprint}); recorder.Code != http.StatusBadRequest ||
+		!strings.Contains(recorder.Body.String(), `"code":"`+CodeKeyExpired+`"`) {
+		t.Fatalf("expected %s after the expiry, got %d %q", CodeKeyExpired, recorder.Code, recorder.Body.String())
+	}
+	var response model.DecryptResponse
+	recorder = post("/v1/decrypt", model.DecryptRequest{Ciphertext: token})
+	if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK || response.Plaintext != "before the expiry" {
+		t.Fatalf("expected the expired key to decrypt within the grace period, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	fake.Advance(24 * time.Hour)
+	if recorder := post("/v1/decrypt", model.DecryptRequest{Ciphertext: token}); recorder.Code == http.StatusOK {
+		t.Fatalf("expected the key to stop decrypting after the grace period, got %q", recorder.Body.String())
+	}
+}
+
+func TestEncryptEndpointChecksEveryRecipient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	defer func(current config.Config) { config.Current = current }(config.Current)
+	config.Current.MaxRecipients = 3
+
+	newKey := func() string {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKeyPem, err := crypto.ExportPublicKeyAsPEM(&privateKey.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return publicKeyPem
+	}
+	first, second := newKey(), newKey()
+	send := func(recipients ...model.RecipientSpec) (*httptest.ResponseRecorder, model.ErrorResponse) {
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "to several recipients", Recipients: recipients})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		var response model.ErrorResponse
+		encodingjson.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder, response
+	}
+
+	if recorder, _ := send(model.RecipientSpec{PublicKeyPem: first}, model.RecipientSpec{PublicKeyPem: second}); recorder.Code != http.StatusOK {
+		t.Fatalf("expected two distinct recipients to encrypt, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder, response := send(
+		model.RecipientSpec{PublicKeyPem: first}, model.RecipientSpec{PublicKeyPem: second},
+		model.RecipientSpec{PublicKeyPem: first}, model.RecipientSpec{PublicKeyPem: second},
+	); recorder.Code != http.StatusRequestEntityTooLarge || response.Code != CodeTooManyRecipients {
+		t.Fatalf("expected %s over the cap, got %d %q", CodeTooManyRecipients, recorder.Code, recorder.Body.String())
+	}
+
+	// Each failing recipient is listed with its own code, the valid ones are not
+	recorder, response := send(
+		model.RecipientSpec{PublicKeyPem: first},
+		model.RecipientSpec{PublicKeyPem: first},
+		model.RecipientSpec{PublicKeyPem: second, KeyAlgorithm: "RSA-OAEP-256"},
+	)
+	if recorder.Code != http.StatusBadRequest || response.Code != CodeInvalidRecipients {
+		t.Fatalf("expected %s, got %d %q", CodeInvalidRecipients, recorder.Code, recorder.Body.String())
+	}
+	var details struct {
+		Recipients []model.RecipientError `json:"recipients"`
+	}
+	encoded, _ := encodingjson.Marshal(response.Details)
+	if err := encodingjson.Unmarshal(encoded, &details); err != nil || len(details.Recipients) != 2 {
+		t.Fatalf("expected the two failing recipients in the details, got %s", encoded)
+	}
+	if failure := details.Recipients[0]; failure.Index != 1 || failure.Code != CodeDuplicateRecipient || !strings.Contains(failure.Message, "recipient 0") {
+		t.Fatalf("expected the second recipient to be a duplicate of the first, got %+v", failure)
+	}
+	if failure := details.Recipients[1]; failure.Index != 2 || failure.Code != CodeUnsupportedAlg {
+		t.Fatalf("expected an RSA algorithm for an EC key to be refused, got %+v", failure)
+	}
+}
+
+func TestEncryptEndpointRoundTripsNamedFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/decrypt", DecryptEndpoint)
+	post := func(path string, request interface{}) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(request)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return recorder
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	fields := map[string]string{"iban": "DE89370400440532013000", "name": "Erika Mustermann", "note": ""}
+	recorder := post("/v1/encrypt", model.EncryptRequest{Fields: fields, SymmetricKey: secret})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the fields to encrypt, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	token := recorder.Body.String()
+	if header := compactProtectedHeader(token); header["cty"] != crypto.JSONContentType {
+		t.Fatalf("expected cty %s, got %v", crypto.JSONContentType, header)
+	}
+
+	var response model.DecryptResponse
+	recorder = post("/v1/decrypt", model.DecryptRequest{Ciphertext: token, SecretKeyBase64: secret})
+	if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected the token to decrypt, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if len(response.Fields) != len(fields) || response.Fields["iban"] != fields["iban"] || response.Fields["name"] != fields["name"] || response.Plaintext != "" {
+		t.Fatalf("expected the fields back in place of the plaintext, got %+v", response)
+	}
+
+	// Field names can't be empty and the fields replace the plaintext
+	for _, request := range []model.EncryptRequest{
+		{Fields: map[string]string{"": "unnamed"}, SymmetricKey: secret},
+		{Fields: map[string]string{}, SymmetricKey: secret},
+		{Fields: fields, Plaintext: "both", SymmetricKey: secret},
+	} {
+		if recorder := post("/v1/encrypt", request); recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), CodeValidationFailed) {
+			t.Fatalf("expected %+v to fail validation, got %d %q", request.Fields, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestEncryptEndpointDerivesTheSecretFromTheMasterSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/decrypt", DecryptEndpoint)
+	defer func(secret []byte) { masterSecret = secret }(masterSecret)
+	post := func(path string, request interface{}) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(request)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		return recorder
+	}
+
+	if err := SetMasterSecret(base64.StdEncoding.EncodeToString(make([]byte, 16))); err == nil {
+		t.Fatal("expected a short master secret to be refused")
+	}
+	SetMasterSecret("")
+	if recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "derived", KeyDerivationInfo: "invoices"}); !strings.Contains(recorder.Body.String(), CodeDerivationDisabled) {
+		t.Fatalf("expected %s without a master secret, got %d %q", CodeDerivationDisabled, recorder.Code, recorder.Body.String())
+	}
+
+	master := bytes.Repeat([]byte{0x42}, 32)
+	if err := SetMasterSecret(base64.StdEncoding.EncodeToString(master)); err != nil {
+		t.Fatal(err)
+	}
+	for _, keyAlgorithm := range []string{"", "A256KW"} {
+		recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "derived", KeyDerivationInfo: "invoices", KeyAlgorithm: keyAlgorithm})
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected the derived secret to encrypt with %q, got %d %q", keyAlgorithm, recorder.Code, recorder.Body.String())
+		}
+		token := recorder.Body.String()
+		if header := compactProtectedHeader(token); header[crypto.HKDFInfoHeader] != "invoices" {
+			t.Fatalf("expected the info label in the header, got %v", header)
+		}
+
+		// The secret is derived again from the header, the client can also derive it itself
+		var response model.DecryptResponse
+		recorder = post("/v1/decrypt", model.DecryptRequest{Ciphertext: token})
+		if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK || response.Plaintext != "derived" {
+			t.Fatalf("expected the token to decrypt with the derived secret, got %d %q", recorder.Code, recorder.Body.String())
+		}
+		keyAlgorithmValue := jose.DIRECT
+		if keyAlgorithm != "" {
+			keyAlgorithmValue = jose.KeyAlgorithm(keyAlgorithm)
+		}
+		size, _ := crypto.SymmetricKeySize(keyAlgorithmValue, jose.A256GCM)
+		secret, err := crypto.DeriveKey(master, "invoices", size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := jose.ParseEncrypted(token, []jose.KeyAlgorithm{keyAlgorithmValue}, []jose.ContentEncryption{jose.A256GCM})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext, err := parsed.Decrypt(secret); err != nil || string(plaintext) != "derived" {
+			t.Fatalf("expected the HKDF output to decrypt the token, got %q: %v", plaintext, err)
+		}
+	}
+
+	// The label can't be combined with a key of its own
+	if recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "derived", KeyDerivationInfo: "invoices", SymmetricKey: base64.StdEncoding.EncodeToString(master)}); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected KeyDerivationInfo with SymmetricKey to be refused, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestEncryptEndpointCapsTheDecodedPlaintext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	defer func(current config.Config) { config.Current = current }(config.Current)
+	config.Current.MaxPlaintextSize = 1024
+
+	symmetricKey := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	for _, test := range []struct {
+		name   string
+		size   int
+		status int
+	}{
+		{"at the cap", 1024, http.StatusOK},
+		{"over the cap", 1025, http.StatusRequestEntityTooLarge},
+	} {
+		// 1368 encoded characters at the cap, the body limit alone would let more through
+		plaintext := base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{0xa5}, test.size))
+		body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: plaintext, PlaintextEncoding: "base64url", SymmetricKey: symmetricKey})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+		if recorder.Code != test.status {
+			t.Fatalf("%s: expected %d, got %d %q", test.name, test.status, recorder.Code, recorder.Body.String())
+		}
+		if test.status != http.StatusOK && !strings.Contains(recorder.Body.String(), `"code":"PLAINTEXT_TOO_LARGE"`) {
+			t.Fatalf("%s: expected PLAINTEXT_TOO_LARGE, got %q", test.name, recorder.Body.String())
+		}
+	}
+
+	// Named fields are capped once serialized
+	body, _ := encodingjson.Marshal(model.EncryptRequest{Fields: map[string]string{"card": strings.Repeat("4", 1024)}, SymmetricKey: symmetricKey})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body)))
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the serialized fields capped, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+// recordingSink keeps the audit events of the requests for the assertions
+type recordingSink struct {
+	events []audit.AuditEvent
+}
+
+func (sink *recordingSink) Record(event audit.AuditEvent) {
+	sink.events = append(sink.events, event)
+}
+
+func TestTokenIDCorrelatesTheEncryptAndDecryptAuditEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	sink := &recordingSink{}
+	audit.SetSink(sink)
+	defer audit.SetSink(discardAudit(t))
+	router := gin.New()
+	router.Use(middleware.Audit(map[string]string{"/v1/encrypt": audit.EventEncrypt, "/v1/decrypt": audit.EventDecrypt}))
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/decrypt", DecryptEndpoint)
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		encoded, _ := encodingjson.Marshal(body)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded)))
+		return recorder
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "traced", SymmetricKey: secret, IncludeTokenID: true, ProtectedHeaders: map[string]string{"app": "billing"}})
+	tokenID := recorder.Header().Get(TokenIDResponseHeader)
+	if recorder.Code != http.StatusOK || len(tokenID) != 22 {
+		t.Fatalf("expected a token ID returned, got %d %q %q", recorder.Code, tokenID, recorder.Body.String())
+	}
+	token := recorder.Body.String()
+	object, err := jose.ParseEncrypted(token, []jose.KeyAlgorithm{jose.DIRECT}, []jose.ContentEncryption{jose.A256GCM})
+	if err != nil || crypto.TokenID(object.Header) != tokenID || object.Header.ExtraHeaders["app"] != "billing" {
+		t.Fatalf("expected the token ID as the jti protected header next to the client headers, got %v: %v", object, err)
+	}
+
+	if recorder := post("/v1/decrypt", model.DecryptRequest{Ciphertext: token, SecretKeyBase64: secret}); recorder.Code != http.StatusOK {
+		t.Fatalf("expected the token to decrypt, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	wrongSecret := base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	if recorder := post("/v1/decrypt", model.DecryptRequest{Ciphertext: token, SecretKeyBase64: wrongSecret}); recorder.Code == http.StatusOK {
+		t.Fatal("expected the wrong secret to fail")
+	}
+	if len(sink.events) != 3 {
+		t.Fatalf("expected the encrypt and both decrypt events, got %+v", sink.events)
+	}
+	for i, event := range sink.events[:2] {
+		if event.TokenID != tokenID {
+			t.Fatalf("expected event %d to carry the token ID, got %+v", i, event)
+		}
+	}
+	// The failed decrypt did not authenticate the header, its jti is not recorded
+	if sink.events[2].TokenID != "" {
+		t.Fatalf("expected no token ID for the failed decrypt, got %+v", sink.events[2])
+	}
+
+	// Emission is opt-in, and the header stays reserved to it
+	recorder = post("/v1/encrypt", model.EncryptRequest{Plaintext: "untraced", SymmetricKey: secret})
+	if recorder.Header().Get(TokenIDResponseHeader) != "" || sink.events[3].TokenID != "" {
+		t.Fatalf("expected no token ID without IncludeTokenID, got %+v", sink.events[3])
+	}
+	if recorder := post("/v1/encrypt", model.EncryptRequest{Plaintext: "forged", SymmetricKey: secret, ProtectedHeaders: map[string]string{"jti": "chosen"}}); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected a client jti header to be refused, got %d", recorder.Code)
+	}
+
+	// A request failing after the ID was drawn issued no token, so it reports no ID
+	recorder = post("/v1/encrypt", model.EncryptRequest{Plaintext: "refused", SymmetricKey: secret, IncludeTokenID: true, AdditionalData: "YWFk"})
+	failed := sink.events[len(sink.events)-1]
+	if recorder.Code != http.StatusBadRequest || recorder.Header().Get(TokenIDResponseHeader) != "" || failed.TokenID != "" {
+		t.Fatalf("expected no token ID for the failed encrypt, got %d %+v", recorder.Code, failed)
+	}
+}
+
+func discardAudit(t *testing.T) audit.Sink {
+	sink, err := audit.NewSink(audit.SinkNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func TestEncryptEndpointRejectsARepeatedKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	defer func(reject bool) { json.RejectDuplicateKeys = reject }(json.RejectDuplicateKeys)
+	json.RejectDuplicateKeys = true
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+
+	symmetricKey := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	body := `{"plaintext":"benign","symmetricKey":"` + symmetricKey + `","plaintext":"smuggled"}`
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/encrypt", strings.NewReader(body)))
+	var response struct {
+		Code    string            `json:"code"`
+		Details map[string]string `json:"details"`
+	}
+	encodingjson.Unmarshal(recorder.Body.Bytes(), &response)
+	if recorder.Code != http.StatusBadRequest || response.Code != CodeDuplicateKey || response.Details["path"] != "plaintext" {
+		t.Fatalf("expected the repeated plaintext refused, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
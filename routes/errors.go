@@ -0,0 +1,162 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/json"
+	"jwe-go/packages/middleware"
+	"net/http"
+)
+
+// Stable machine-readable error codes returned in model.ErrorResponse
+const (
+	CodeInvalidBody         = "INVALID_BODY"
+	CodeEmptyBody           = "EMPTY_BODY"
+	CodeInvalidJSON         = "INVALID_JSON"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeConflictingFields   = "CONFLICTING_FIELDS"
+	CodeMissingKey          = "MISSING_KEY"
+	CodeInvalidPEM          = "INVALID_PEM"
+	CodeInvalidJWK          = "INVALID_JWK"
+	CodeInvalidKey          = "INVALID_KEY"
+	CodeUnsupportedAlg      = "UNSUPPORTED_ALGORITHM"
+	CodeInvalidHeader       = "INVALID_HEADER"
+	CodeMalformedJWE        = "MALFORMED_JWE"
+	CodeNotAJWE             = "NOT_A_JWE"
+	CodeEncryptionFailed    = "ENCRYPTION_FAILED"
+	CodeDecryptionFailed    = "DECRYPTION_FAILED"
+	CodeThumbprintFailed    = "THUMBPRINT_FAILED"
+	CodeKeyGenerationFailed = "KEY_GENERATION_FAILED"
+	CodeBatchTooLarge       = "BATCH_TOO_LARGE"
+	CodePlaintextTooLarge   = "PLAINTEXT_TOO_LARGE"
+	CodeSigningFailed       = "SIGNING_FAILED"
+	CodeSigningUnavailable  = "SIGNING_UNAVAILABLE"
+	CodeMalformedJWS        = "MALFORMED_JWS"
+	CodeInvalidSignature    = "INVALID_SIGNATURE"
+	CodeInvalidPKCS12       = "INVALID_PKCS12"
+	CodeBodyTooLarge        = middleware.CodeBodyTooLarge
+	CodeInternal            = middleware.CodeInternal
+	CodeSelfTestFailed      = "SELF_TEST_FAILED"
+	CodeKeyNotFound         = "KEY_NOT_FOUND"
+	CodeKeyExpired          = "KEY_EXPIRED"
+	CodeKeyInUse            = "KEY_IN_USE"
+	CodeKeyReloadFailed     = "KEY_RELOAD_FAILED"
+	CodeInvalidClaims       = "INVALID_CLAIMS"
+	CodeTokenExpired        = "TOKEN_EXPIRED"
+	CodeInvalidAudience     = "INVALID_AUDIENCE"
+	CodeTokenNotYetValid    = "TOKEN_NOT_YET_VALID"
+	CodeTokenTooOld         = "TOKEN_TOO_OLD"
+	CodeReplayed            = "REPLAYED"
+	CodeInvalidKeyUsage     = "INVALID_KEY_USAGE"
+	CodeInvalidEncoding     = "INVALID_ENCODING"
+	CodeAlgorithmNotAllowed = "ALGORITHM_NOT_ALLOWED"
+	CodeTooManyStreams      = "TOO_MANY_STREAMS"
+	CodeTimeout             = "TIMEOUT"
+	CodeUnsupportedCritical = "UNSUPPORTED_CRITICAL_HEADER"
+	CodeInvalidTenant       = "INVALID_TENANT"
+	CodeContentKeyDisabled  = "CONTENT_KEY_DISABLED"
+	CodeCertExpired         = "CERTIFICATE_EXPIRED"
+	CodeCertNotYetValid     = "CERTIFICATE_NOT_YET_VALID"
+	CodeUnsupportedZip      = "UNSUPPORTED_COMPRESSION"
+	CodeHeaderNotAllowed    = "HEADER_NOT_ALLOWED"
+	CodeNotANestedJWT       = "NOT_A_NESTED_JWT"
+	CodeEmptyPlaintext      = "EMPTY_PLAINTEXT"
+	CodeUnexpectedAlg       = "UNEXPECTED_ALGORITHM"
+	CodeNotConvertible      = "NOT_CONVERTIBLE"
+	CodeTooManyRecipients   = "TOO_MANY_RECIPIENTS"
+	CodeInvalidRecipients   = "INVALID_RECIPIENTS"
+	CodeDuplicateRecipient  = "DUPLICATE_RECIPIENT"
+	CodeDerivationDisabled  = "KEY_DERIVATION_DISABLED"
+	CodeContentBlocked      = "CONTENT_BLOCKED"
+	CodeDuplicateKey        = "DUPLICATE_KEY"
+	CodeTenantForbidden     = "TENANT_FORBIDDEN"
+)
+
+// Fixed messages for crypto failures, so go-jose internals are not echoed to clients
+var (
+	errEncrypterSetup      = errors.New("failed to set up the encrypter for the key and algorithms")
+	errEncryptionFailed    = errors.New("failed to encrypt the plaintext")
+	errSerializationFailed = errors.New("failed to serialize the JWE")
+)
+
+// detailedError attaches extra context that ends up in the details field
+type detailedError struct {
+	error
+	details interface{}
+}
+
+// newError builds the error envelope for a code and error
+func newError(code string, err error) model.ErrorResponse {
+	response := model.ErrorResponse{
+		Code:    code,
+		Message: err.Error(),
+	}
+
+	var detailed *detailedError
+	if errors.As(err, &detailed) {
+		response.Details = detailed.details
+	}
+
+	return response
+}
+
+// writeInvalidJSON reports a body StrictUnmarshal refused, an object repeating a key gets its own code
+func writeInvalidJSON(context *gin.Context, err error) {
+	var duplicateKey *json.DuplicateKeyError
+	if errors.As(err, &duplicateKey) {
+		writeError(context, http.StatusBadRequest, CodeDuplicateKey, &detailedError{
+			error:   duplicateKey,
+			details: map[string]string{"key": duplicateKey.Key, "path": duplicateKey.Path},
+		})
+		return
+	}
+	writeError(context, http.StatusBadRequest, CodeInvalidJSON, invalidJSONError(err))
+}
+
+// invalidJSONError names the offending field when the body has an unknown one
+func invalidJSONError(err error) error {
+	var unknownField *json.UnknownFieldError
+	if errors.As(err, &unknownField) {
+		return &detailedError{
+			error:   unknownField,
+			details: map[string]string{"field": unknownField.Field, "path": unknownField.Path},
+		}
+	}
+	return errors.New("invalid JSON or unknown field")
+}
+
+// writeBodyReadError reports a failed body read, a body over the size limit gets a 413
+func writeBodyReadError(context *gin.Context, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		writeError(context, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Errorf("request body exceeds the limit of %d bytes", maxBytesError.Limit))
+		return
+	}
+	writeError(context, http.StatusBadRequest, CodeInvalidBody, errors.New("failed to read request body"))
+}
+
+// statusError is a failure with the status and code it is reported with, so the checks shared by whole requests
+// and batch items can fail either the request or a single item
+type statusError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (failure *statusError) Error() string {
+	return failure.err.Error()
+}
+
+// writeStatusError aborts the request with the envelope of the failure
+func writeStatusError(context *gin.Context, failure *statusError) {
+	writeError(context, failure.status, failure.code, failure.err)
+}
+
+// writeError aborts the request with the error envelope, used by every endpoint
+func writeError(context *gin.Context, status int, code string, err error) {
+	context.Set(middleware.ErrorCodeKey, code)
+	context.Abort()
+	writeJSON(context, status, newError(code, err))
+}
@@ -0,0 +1,100 @@
+package routes
+
+import (
+	stdcrypto "crypto"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+	"slices"
+)
+
+// EstimateSizeEndpoint computes the length of the compact JWE an encrypt request would return, without encrypting
+func EstimateSizeEndpoint(context *gin.Context) {
+	var estimate model.EstimateSizeRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &estimate) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, estimate) {
+		return
+	}
+
+	contentEncryption, err := crypto.ParseContentEncryption(estimate.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+
+	// Shared secrets and passwords pick their algorithm by name, public keys by the key type the curve implies
+	keyAlgorithm := jose.KeyAlgorithm(estimate.KeyAlgorithm)
+	publicKey := !slices.Contains(crypto.SymmetricKeyAlgorithms, keyAlgorithm) && !slices.Contains(crypto.PasswordKeyAlgorithms, keyAlgorithm)
+	if publicKey {
+		keyType := crypto.KeyTypeRSA
+		if estimate.Curve == "X25519" {
+			keyType = crypto.KeyTypeX25519
+		} else if estimate.Curve != "" {
+			keyType = crypto.KeyTypeEC
+		}
+		// Nothing is encrypted, so the legacy algorithms need no opt-in to be measured
+		if keyAlgorithm, err = crypto.ParseKeyAlgorithm(estimate.KeyAlgorithm, keyType, true, true); err != nil {
+			writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+			return
+		}
+	}
+	if failure := encryptionPolicyError(keyAlgorithm, contentEncryption); failure != nil {
+		writeStatusError(context, failure)
+		return
+	}
+
+	// Only public key tokens carry server_kid, computed with the configured hash unless the request picks one
+	includeServerKid := publicKey && (estimate.IncludeServerKid == nil || *estimate.IncludeServerKid)
+	if !includeServerKid && len(estimate.ServerKidHash) > 0 {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("ServerKidHash only applies to public key tokens carrying server_kid"))
+		return
+	}
+	var serverKidHash stdcrypto.Hash
+	if includeServerKid {
+		serverKidHash = crypto.ServerKidHash
+		if len(estimate.ServerKidHash) > 0 {
+			serverKidHash, _ = crypto.ParseThumbprintHash(estimate.ServerKidHash) // Checked by the oneof rule
+		}
+	}
+
+	keySize := estimate.KeySize
+	if keySize == 0 {
+		keySize = 2048
+	}
+	curve := estimate.Curve
+	if curve == "" {
+		curve = "P-256"
+	}
+	size, err := crypto.EstimateJWESize(crypto.JWESizeParameters{
+		PlaintextLength:   *estimate.PlaintextLength,
+		KeyAlgorithm:      keyAlgorithm,
+		ContentEncryption: contentEncryption,
+		KeySize:           keySize,
+		Curve:             curve,
+		ServerKidHash:     serverKidHash,
+		KeyID:             estimate.Kid,
+		PBES2Iterations:   estimate.PBES2Iterations,
+		Compress:          estimate.Compress,
+		CompressionRatio:  estimate.CompressionRatio,
+	})
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeValidationFailed, err)
+		return
+	}
+
+	writeJSON(context, http.StatusOK, model.EstimateSizeResponse{
+		Size:  size,
+		Alg:   string(keyAlgorithm),
+		Enc:   string(contentEncryption),
+		Exact: !estimate.Compress,
+	})
+}
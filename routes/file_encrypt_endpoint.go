@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// defaultFileContentType is used for uploads that don't name their media type
+const defaultFileContentType = "application/octet-stream"
+
+// FileEncryptEndpoint encrypts the raw bytes of an uploaded file into a compact JWE.
+// The multipart form carries the "file" part and the publicKeyPem, contentEncryption, keyAlgorithm,
+// allowLegacyRSA15 and allowLegacyHash fields. The media type of the file becomes the cty header.
+func FileEncryptEndpoint(context *gin.Context) {
+	// The body limit of the route already caps the form, so it is parsed in memory
+	if err := context.Request.ParseMultipartForm(config.Current.MaxEncryptBodySize); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			writeBodyReadError(context, err)
+			return
+		}
+		writeError(context, http.StatusBadRequest, CodeInvalidBody, errors.New("expected a multipart form with a file and a publicKeyPem field"))
+		return
+	}
+
+	file, header, err := context.Request.FormFile("file")
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidBody, errors.New("the form has no file part"))
+		return
+	}
+	defer file.Close()
+
+	upload := model.FileEncryptRequest{
+		PublicKeyPem:      context.PostForm("publicKeyPem"),
+		ContentEncryption: context.PostForm("contentEncryption"),
+		KeyAlgorithm:      context.PostForm("keyAlgorithm"),
+		AllowLegacyRSA15:  context.PostForm("allowLegacyRSA15") == "true",
+		AllowLegacyHash:   context.PostForm("allowLegacyHash") == "true",
+		ContentType:       header.Header.Get("Content-Type"),
+	}
+	if upload.ContentType == "" {
+		upload.ContentType = defaultFileContentType
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, upload) {
+		return
+	}
+	if _, _, err := mime.ParseMediaType(upload.ContentType); err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidHeader, errors.New("the file part has an invalid Content-Type"))
+		return
+	}
+
+	// go-jose can't decrypt an empty JWE, so empty files are rejected
+	var plaintext bytes.Buffer
+	if _, err := plaintext.ReadFrom(file); err != nil {
+		writeBodyReadError(context, err)
+		return
+	}
+	if plaintext.Len() == 0 {
+		writeError(context, http.StatusBadRequest, CodeEmptyBody, errors.New("the uploaded file is empty"))
+		return
+	}
+	defer crypto.Zero(plaintext.Bytes())
+	if !checkContentAllowed(context, plaintext.Bytes()) {
+		return
+	}
+
+	contentEncryption, err := crypto.ParseContentEncryption(upload.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+
+	recipientKey, err := crypto.GetOrImportPublicKey(upload.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(upload.KeyAlgorithm, recipientKey.KeyType, upload.AllowLegacyRSA15, upload.AllowLegacyHash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	serverKid, serverKidHash, ok := recipientServerKid(context, recipientKey, "")
+	if !ok {
+		return
+	}
+
+	// The cty differs per upload, so the encrypter isn't pooled
+	options := crypto.BuildEncrypterOptions(crypto.ServerKidHeaders(serverKid, serverKidHash), false).
+		WithContentType(jose.ContentType(upload.ContentType))
+	encrypter, err := crypto.NewEncrypter(contentEncryption, jose.Recipient{Algorithm: keyAlgorithm, Key: recipientKey.PublicKey}, options)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	jwe, err := crypto.EncryptWithContext(ctx, encrypter, plaintext.Bytes(), nil)
+	metrics.Record(metrics.OperationEncrypt, string(keyAlgorithm), string(contentEncryption), err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed)
+		return
+	}
+
+	context.Header(ServerKidResponseHeader, serverKid)
+	if acceptsJSON(context) {
+		writeJWE(context, jwe, model.EncryptResponse{
+			Alg: string(keyAlgorithm),
+			Enc: string(contentEncryption),
+		})
+		return
+	}
+
+	serialized, err := jwe.CompactSerialize()
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errSerializationFailed)
+		return
+	}
+	context.Data(http.StatusOK, "application/jose; charset=utf-8", []byte(serialized))
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+func GenerateKeyEndpoint(context *gin.Context) {
+	var generation model.GenerateKeyRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &generation) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, generation) {
+		return
+	}
+
+	// PKCS#1 has no encoding for EC keys
+	if generation.KeyType == "EC" && generation.PrivateKeyFormat == crypto.PrivateKeyFormatPKCS1 {
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("privateKeyFormat pkcs1 only applies to RSA keys"))
+		return
+	}
+
+	var keyPair crypto.KeyPair
+	var err error
+
+	switch generation.KeyType {
+	case "EC":
+		keyPair, err = crypto.GenerateECKeyPair(generation.Curve)
+	default:
+		keyPair, err = crypto.GenerateRSAKeyPair(generation.Size, generation.PrivateKeyFormat)
+	}
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeKeyGenerationFailed, err)
+		return
+	}
+
+	// Compute thumbprint of the public key so clients know the server_kid it will produce
+	jwk, err := crypto.ConvertPublicKeyToJWK(keyPair.PublicKey)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, err)
+		return
+	}
+
+	thumbprint, err := crypto.GetJWKThumbprintSHA256(jwk)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, errors.New("failed to compute public key thumbprint"))
+		return
+	}
+
+	writeJSON(context, http.StatusOK, model.GenerateKeyResponse{
+		PublicKeyPem:  keyPair.PublicKeyPem,
+		PrivateKeyPem: keyPair.PrivateKeyPem,
+		Thumbprint:    thumbprint,
+	})
+}
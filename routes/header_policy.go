@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+// Server-wide allowlist of custom protected header names set by SetCustomHeaderPolicy, nil allows every name
+var allowedCustomHeaders map[string]bool
+
+// SetCustomHeaderPolicy restricts the custom protected headers clients may set, an empty list allows any name.
+// Reserved names are refused in the list, no request could set them anyway.
+func SetCustomHeaderPolicy(names []string) error {
+	if len(names) == 0 {
+		allowedCustomHeaders = nil
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if err := crypto.ValidateProtectedHeaders(map[string]string{name: ""}); err != nil {
+			return err
+		}
+		allowed[name] = true
+	}
+	allowedCustomHeaders = allowed
+	return nil
+}
+
+// checkCustomHeadersAllowed rejects client supplied protected headers missing from the server allowlist
+func checkCustomHeadersAllowed(context *gin.Context, headers map[string]string) bool {
+	if allowedCustomHeaders == nil {
+		return true
+	}
+	for name := range headers {
+		if !allowedCustomHeaders[name] {
+			writeError(context, http.StatusBadRequest, CodeHeaderNotAllowed, fmt.Errorf("protected header %q is not allowed by the server policy", name))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+// HealthEndpoint is the liveness probe, it only reports that the process serves requests
+func HealthEndpoint(context *gin.Context) {
+	writeJSON(context, http.StatusOK, model.HealthResponse{Status: "ok"})
+}
+
+// ReadyEndpoint is the readiness probe, it runs an encrypt and decrypt round trip first
+func ReadyEndpoint(context *gin.Context) {
+	if err := crypto.SelfTest(); err != nil {
+		writeError(context, http.StatusServiceUnavailable, CodeSelfTestFailed, err)
+		return
+	}
+
+	writeJSON(context, http.StatusOK, model.HealthResponse{Status: "ready"})
+}
@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/json"
+	"net/http"
+	"strings"
+)
+
+func InspectEndpoint(context *gin.Context) {
+	var inspection model.InspectRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &inspection) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, inspection) {
+		return
+	}
+
+	// Segments are counted before parsing, so a JWS sent by mistake gets a clear error instead of a parse failure
+	if !strings.HasPrefix(strings.TrimSpace(inspection.Ciphertext), "{") {
+		switch segments := strings.Count(inspection.Ciphertext, ".") + 1; {
+		case segments == 3:
+			if alg, _ := compactProtectedHeader(inspection.Ciphertext)["alg"].(string); crypto.IsSignatureAlgorithm(alg) {
+				writeError(context, http.StatusBadRequest, CodeNotAJWE, fmt.Errorf("token is a compact JWS signed with %s, not a JWE", alg))
+				return
+			}
+			fallthrough
+		case segments != 5:
+			writeError(context, http.StatusBadRequest, CodeMalformedJWE, fmt.Errorf("compact JWE must have 5 segments, got %d", segments))
+			return
+		}
+	}
+
+	// Parsing only decodes the headers, no key is needed
+	encryptedObject, err := jose.ParseEncrypted(
+		inspection.Ciphertext,
+		append(append(crypto.SupportedKeyAlgorithms, crypto.SymmetricKeyAlgorithms...), crypto.PasswordKeyAlgorithms...),
+		crypto.SupportedContentEncryptions,
+	)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, fmt.Errorf("failed to parse JWE: %v", err))
+		return
+	}
+
+	// A truncated tag or IV would only fail on decryption, compliance checks want to know without the key
+	if inspection.Strict {
+		if err := crypto.ValidateJWEStructure(inspection.Ciphertext); err != nil {
+			writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+			return
+		}
+	}
+
+	// Without a key the header is not authenticated, the check only tells callers the token would be refused
+	if !checkTimeHeaders(context, inspection.Ciphertext, inspection.MaxAgeSeconds) {
+		return
+	}
+
+	// go-jose lifts alg and kid out of the header, everything else stays in ExtraHeaders
+	header := make(map[string]interface{}, len(encryptedObject.Header.ExtraHeaders)+2)
+	for name, value := range encryptedObject.Header.ExtraHeaders {
+		header[string(name)] = value
+	}
+	if encryptedObject.Header.Algorithm != "" {
+		header["alg"] = encryptedObject.Header.Algorithm
+	}
+	if encryptedObject.Header.KeyID != "" {
+		header["kid"] = encryptedObject.Header.KeyID
+	}
+
+	// go-jose drops x5c from the parsed header, compact tokens show their raw protected header instead
+	for name, value := range compactProtectedHeader(inspection.Ciphertext) {
+		header[name] = value
+	}
+
+	typ, _ := header["typ"].(string)
+	response := model.InspectResponse{
+		Header: header,
+		Typ:    typ,
+	}
+
+	// The segments of a compact token, a JSON serialization has its members already
+	if inspection.Components {
+		components, err := crypto.DecomposeCompactJWE(inspection.Ciphertext)
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeMalformedJWE, fmt.Errorf("components are only available for a compact JWE: %v", err))
+			return
+		}
+		response.Components = &model.JWEComponents{
+			ProtectedHeader:  components.ProtectedHeader,
+			EncryptedKey:     components.EncryptedKey,
+			IV:               components.IV,
+			CiphertextLength: components.CiphertextLength,
+			Tag:              components.Tag,
+		}
+	}
+	writeJSON(context, http.StatusOK, response)
+}
+
+// compactProtectedHeader decodes the first segment of a compact JWE, nil for other serializations
+func compactProtectedHeader(ciphertext string) map[string]interface{} {
+	segment, _, found := strings.Cut(ciphertext, ".")
+	if !found {
+		return nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil
+	}
+
+	var header map[string]interface{}
+	if json.CONFIG.Unmarshal(decoded, &header) != nil {
+		return nil
+	}
+	return header
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"bytes"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInspectEndpointRejectsJWS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/inspect", InspectEndpoint)
+
+	for _, test := range []struct {
+		ciphertext string
+		code       string
+	}{
+		// {"alg":"RS256"} is a signature algorithm, {"alg":"RSA-OAEP-256"} a key algorithm
+		{"eyJhbGciOiJSUzI1NiJ9.e30.c2ln", CodeNotAJWE},
+		{"eyJhbGciOiJSU0EtT0FFUC0yNTYifQ.e30.c2ln", CodeMalformedJWE},
+		{"eyJhbGciOiJSUzI1NiJ9.e30", CodeMalformedJWE},
+	} {
+		body, _ := encodingjson.Marshal(model.InspectRequest{Ciphertext: test.ciphertext})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/inspect", bytes.NewReader(body)))
+
+		var response model.ErrorResponse
+		if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusBadRequest || response.Code != test.code {
+			t.Fatalf("expected %s for %s, got %d %q", test.code, test.ciphertext, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func FuzzInspectEndpoint(f *testing.F) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/inspect", InspectEndpoint)
+
+	for _, seed := range []string{
+		`{"ciphertext":"eyJhbGciOiJSU0EtT0FFUC0yNTYiLCJlbmMiOiJBMjU2R0NNIn0.a.b.c.d"}`,
+		`{"ciphertext":"{\"protected\":\"e30\",\"recipients\":[{},{}]}"}`,
+		`{"ciphertext":"....","maxAgeSeconds":1}`,
+		`{"ciphertext":"e30.."}`,
+		`{"ciphertext":"eyJhbGciOiJSUzI1NiJ9.e30.c2ln"}`,
+		`{}`,
+		``,
+		`[`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	// Any body gets a response, errors with a code and never a panic or a 5xx
+	f.Fuzz(func(t *testing.T, body []byte) {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/v1/inspect", bytes.NewReader(body))
+		router.ServeHTTP(recorder, request)
+
+		if recorder.Code == http.StatusOK {
+			var response model.InspectResponse
+			if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("invalid inspect response %q: %v", recorder.Body.String(), err)
+			}
+			return
+		}
+		var response model.ErrorResponse
+		if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Code == "" {
+			t.Fatalf("expected an error response with a code, got %d %q", recorder.Code, recorder.Body.String())
+		}
+		if recorder.Code >= http.StatusInternalServerError {
+			t.Fatalf("expected a client error, got %d %q", recorder.Code, recorder.Body.String())
+		}
+	})
+}
+
+func TestInspectEndpointReturnsTheComponents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/inspect", InspectEndpoint)
+
+	// {"alg":"dir","enc":"A128GCM"} with a 12 byte IV, a 5 byte ciphertext and a 16 byte tag
+	token := "eyJhbGciOiJkaXIiLCJlbmMiOiJBMTI4R0NNIn0..AAAAAAAAAAAAAAAA.AAAAAAA.AAAAAAAAAAAAAAAAAAAAAA"
+	body, _ := encodingjson.Marshal(model.InspectRequest{Ciphertext: token, Components: true})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/inspect", bytes.NewReader(body)))
+	var response model.InspectResponse
+	if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK || response.Components == nil {
+		t.Fatalf("expected the components, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if components := response.Components; components.ProtectedHeader["enc"] != "A128GCM" || components.EncryptedKey != "" ||
+		components.IV != "AAAAAAAAAAAAAAAA" || components.CiphertextLength != 5 || components.Tag != "AAAAAAAAAAAAAAAAAAAAAA" {
+		t.Fatalf("expected the segments of the token, got %+v", components)
+	}
+
+	// Without asking for them the response only has the header
+	body, _ = encodingjson.Marshal(model.InspectRequest{Ciphertext: token})
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/inspect", bytes.NewReader(body)))
+	if bytes.Contains(recorder.Body.Bytes(), []byte("components")) {
+		t.Fatalf("expected no components, got %q", recorder.Body.String())
+	}
+}
+
+func TestInspectEndpointStrictlyChecksTheTagLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/inspect", InspectEndpoint)
+
+	// {"alg":"dir","enc":"A128GCM"} with a 12 byte IV and a 15 byte tag
+	token := "eyJhbGciOiJkaXIiLCJlbmMiOiJBMTI4R0NNIn0..AAAAAAAAAAAAAAAA.AAAAAAA.AAAAAAAAAAAAAAAAAAAA"
+	for _, test := range []struct {
+		strict bool
+		status int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusBadRequest},
+	} {
+		body, _ := encodingjson.Marshal(model.InspectRequest{Ciphertext: token, Strict: test.strict})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/inspect", bytes.NewReader(body)))
+		if recorder.Code != test.status {
+			t.Fatalf("expected %d inspecting a truncated tag with strict %t, got %d %q", test.status, test.strict, recorder.Code, recorder.Body.String())
+		}
+	}
+}
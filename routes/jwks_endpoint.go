@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/clock"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/json"
+	"net/http"
+	"time"
+)
+
+// Key set served by JWKSEndpoint, set once by SetPublicKeySet
+var jwksKeySet = publishedKeySet{}
+
+// publishedKeySet holds the keys of a key set in order, each serialized alone. The set itself is serialized
+// per request, a key drops out of it and its ETag changes as soon as the key expires.
+type publishedKeySet struct {
+	keys  []publishedKey
+	byKid map[string]publishedKey
+}
+
+// publishedKey is a serialized JWK of a key set and its ETag, served alone by PublicKeyEndpoint until it expires
+type publishedKey struct {
+	crypto.PublishedKey
+	body []byte
+	etag string
+}
+
+// A key is published under its thumbprint and never changes, only its retirement does
+const (
+	publicKeyMaxAge       = time.Hour
+	publicKeyCacheControl = "public, max-age=3600"
+)
+
+// Key sets of the tenants, set at startup by SetTenantPublicKeySet and only read afterwards.
+// A tenant without one is served the empty set.
+var tenantKeySets = map[string]publishedKeySet{}
+
+// SetPublicKeySet replaces the key set served by JWKSEndpoint
+func SetPublicKeySet(keys []crypto.PublishedKey) error {
+	keySet, err := publishKeys(keys)
+	if err != nil {
+		return err
+	}
+	jwksKeySet = keySet
+	return nil
+}
+
+// SetTenantPublicKeySet replaces the key set JWKSEndpoint serves to the tenant, it must be called before the server starts
+func SetTenantPublicKeySet(tenant string, keys []crypto.PublishedKey) error {
+	if err := crypto.ValidateTenantID(tenant); err != nil {
+		return err
+	}
+	keySet, err := publishKeys(keys)
+	if err != nil {
+		return fmt.Errorf("failed to serialize key set of tenant %q: %v", tenant, err)
+	}
+	tenantKeySets[tenant] = keySet
+	return nil
+}
+
+// publishKeys serializes each key of the set, those with a kid are also served alone under it
+func publishKeys(keys []crypto.PublishedKey) (publishedKeySet, error) {
+	keySet := publishedKeySet{keys: make([]publishedKey, 0, len(keys)), byKid: make(map[string]publishedKey, len(keys))}
+	for _, key := range keys {
+		body, err := json.Marshal(key.JWK)
+		if err != nil {
+			return publishedKeySet{}, fmt.Errorf("failed to serialize key %q: %v", key.JWK.KeyID, err)
+		}
+		published := publishedKey{PublishedKey: key, body: body, etag: computeETag(body)}
+		keySet.keys = append(keySet.keys, published)
+		if key.JWK.KeyID != "" {
+			keySet.byKid[key.JWK.KeyID] = published
+		}
+	}
+	return keySet, nil
+}
+
+// current serializes the keys of the set not expired at now and returns the ETag of that serialization
+func (keySet publishedKeySet) current(now time.Time) ([]byte, string) {
+	bodies := make([][]byte, 0, len(keySet.keys))
+	for _, key := range keySet.keys {
+		if !key.Expired(now) {
+			bodies = append(bodies, key.body)
+		}
+	}
+	body := append(append([]byte(`{"keys":[`), bytes.Join(bodies, []byte(","))...), "]}"...)
+	return body, computeETag(body)
+}
+
+// JWKSEndpoint serves the key set of the tenant named in the path or the tenant header, a tenant without one gets an empty set
+func JWKSEndpoint(context *gin.Context) {
+	tenant, ok := namedTenant(context)
+	if !ok {
+		return
+	}
+	keySet := jwksKeySet
+	if tenant != crypto.DefaultTenant {
+		keySet = tenantKeySets[tenant]
+	}
+	body, etag := keySet.current(clock.Now())
+
+	// The set depends on the tenant header, shared caches must not serve one tenant the set of another
+	context.Writer.Header().Add("Vary", TenantHeader)
+	context.Header("ETag", etag)
+
+	// Clients that already hold the current key set get an empty 304
+	if context.GetHeader("If-None-Match") == etag {
+		context.Status(http.StatusNotModified)
+		return
+	}
+
+	context.Data(http.StatusOK, "application/jwk-set+json", body)
+}
+
+// PublicKeyEndpoint serves the single JWK of the tenant key set whose kid is the thumbprint in the path
+func PublicKeyEndpoint(context *gin.Context) {
+	tenant, ok := namedTenant(context)
+	if !ok {
+		return
+	}
+	keySet := jwksKeySet
+	if tenant != crypto.DefaultTenant {
+		keySet = tenantKeySets[tenant]
+	}
+
+	context.Writer.Header().Add("Vary", TenantHeader)
+	now := clock.Now()
+	key, ok := keySet.byKid[context.Param("kid")]
+	if !ok || key.Expired(now) {
+		// The key may be published later, clients must not remember that it was missing
+		context.Header("Cache-Control", "no-store")
+		writeError(context, http.StatusNotFound, CodeKeyNotFound, fmt.Errorf("no published key with kid %q", context.Param("kid")))
+		return
+	}
+	// Caches must not keep serving a key past its expiry
+	cacheControl := publicKeyCacheControl
+	if !key.NotAfter.IsZero() && key.NotAfter.Sub(now) < publicKeyMaxAge {
+		cacheControl = fmt.Sprintf("public, max-age=%d", int(key.NotAfter.Sub(now).Seconds()))
+	}
+	context.Header("Cache-Control", cacheControl)
+	context.Header("ETag", key.etag)
+
+	if context.GetHeader("If-None-Match") == key.etag {
+		context.Status(http.StatusNotModified)
+		return
+	}
+
+	context.Data(http.StatusOK, "application/jwk+json", key.body)
+}
+
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("%q", base64.RawURLEncoding.EncodeToString(sum[:]))
+}
@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/clock"
+	"jwe-go/packages/crypto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicKeyEndpointServesASingleKeyOfTheSet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/keys/:kid", PublicKeyEndpoint)
+	router.GET("/tenants/:tenant/keys/:kid", PublicKeyEndpoint)
+	router.GET("/jwks", JWKSEndpoint)
+	defer func(keySet publishedKeySet) { jwksKeySet = keySet }(jwksKeySet)
+	defer delete(tenantKeySets, "keys-tenant")
+	defer func(previous clock.Clock) { clock.Current = previous }(clock.Current)
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	clock.Current = fake
+
+	keySet := jose.JSONWebKeySet{}
+	for range 3 {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk, _ := crypto.ConvertPublicKeyToJWK(&privateKey.PublicKey)
+		if jwk.KeyID, err = crypto.GetJWKThumbprintSHA256(jwk); err != nil {
+			t.Fatal(err)
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+	// The third key expires in half an hour
+	expiring := crypto.PublishedKey{JWK: keySet.Keys[2], NotAfter: fake.Now().Add(30 * time.Minute)}
+	if err := SetPublicKeySet([]crypto.PublishedKey{{JWK: keySet.Keys[0]}, expiring}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTenantPublicKeySet("keys-tenant", []crypto.PublishedKey{{JWK: keySet.Keys[1]}}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	kid := keySet.Keys[0].KeyID
+	recorder := get("/keys/"+kid, "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/jwk+json" {
+		t.Fatalf("expected the JWK, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Cache-Control") != publicKeyCacheControl || recorder.Header().Get("ETag") == "" {
+		t.Fatalf("expected the key to be cacheable, got %v", recorder.Header())
+	}
+	var jwk map[string]interface{}
+	if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &jwk); err != nil {
+		t.Fatal(err)
+	}
+	if jwk["kid"] != kid || jwk["use"] != "enc" || jwk["alg"] != "ECDH-ES+A256KW" || jwk["d"] != nil {
+		t.Fatalf("expected the public JWK with kid, use and alg, got %v", jwk)
+	}
+	if revalidated := get("/keys/"+kid, recorder.Header().Get("ETag")); revalidated.Code != http.StatusNotModified {
+		t.Fatalf("expected a 304 for the current ETag, got %d", revalidated.Code)
+	}
+
+	// The keys of a tenant are served to that tenant only
+	tenantKid := keySet.Keys[1].KeyID
+	if recorder := get("/tenants/keys-tenant/keys/"+tenantKid, ""); recorder.Code != http.StatusOK {
+		t.Fatalf("expected the key of the tenant, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	for _, path := range []string{"/keys/" + tenantKid, "/tenants/keys-tenant/keys/" + kid, "/tenants/other-tenant/keys/" + kid} {
+		recorder := get(path, "")
+		if recorder.Code != http.StatusNotFound || !strings.Contains(recorder.Body.String(), `"code":"KEY_NOT_FOUND"`) {
+			t.Fatalf("expected a 404 for %s, got %d %q", path, recorder.Code, recorder.Body.String())
+		}
+		if recorder.Header().Get("Cache-Control") != "no-store" {
+			t.Fatalf("expected a miss not to be cached, got %q", recorder.Header().Get("Cache-Control"))
+		}
+	}
+
+	// The expiring key is cached until its expiry only, and leaves the set and its ETag when it expires
+	expiringKid := keySet.Keys[2].KeyID
+	if recorder := get("/keys/"+expiringKid, ""); recorder.Header().Get("Cache-Control") != "public, max-age=1800" {
+		t.Fatalf("expected the key cached until it expires, got %q", recorder.Header().Get("Cache-Control"))
+	}
+	published := get("/jwks", "")
+	if !strings.Contains(published.Body.String(), expiringKid) {
+		t.Fatalf("expected the expiring key in the set, got %q", published.Body.String())
+	}
+	fake.Advance(31 * time.Minute)
+	if recorder := get("/keys/"+expiringKid, ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected the expired key no longer served, got %d", recorder.Code)
+	}
+	current := get("/jwks", published.Header().Get("ETag"))
+	if current.Code != http.StatusOK || strings.Contains(current.Body.String(), expiringKid) || !strings.Contains(current.Body.String(), kid) {
+		t.Fatalf("expected the set without the expired key, got %d %q", current.Code, current.Body.String())
+	}
+}
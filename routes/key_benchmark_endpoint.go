@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"crypto/rand"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Defaults of a benchmark request leaving the iterations or the plaintext size unset
+const (
+	defaultBenchmarkIterations    = 100
+	defaultBenchmarkPlaintextSize = 1024
+)
+
+// KeyBenchmarkEndpoint times encryptions to the client key so clients can weigh, say, RSA 4096 against EC P-256.
+// The encryptions tie up a worker for the whole run, so the route is only registered with ENABLE_TEST_VECTORS
+// outside release mode.
+func KeyBenchmarkEndpoint(context *gin.Context) {
+	var benchmark model.KeyBenchmarkRequest
+
+	if !readBody(context, &benchmark) {
+		return
+	}
+
+	if !validateBody(context, benchmark) {
+		return
+	}
+
+	contentEncryption, err := crypto.ParseContentEncryption(benchmark.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+
+	recipientKey, err := crypto.GetOrImportPublicKey(benchmark.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(benchmark.KeyAlgorithm, recipientKey.KeyType, benchmark.AllowLegacyRSA15, benchmark.AllowLegacyHash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	iterations, plaintextSize := benchmark.Iterations, benchmark.PlaintextSize
+	if iterations == 0 {
+		iterations = defaultBenchmarkIterations
+	}
+	if plaintextSize == 0 {
+		plaintextSize = defaultBenchmarkPlaintextSize
+	}
+	plaintext := make([]byte, plaintextSize)
+	rand.Read(plaintext)
+
+	// One encrypter serves every iteration, as the pool does for real traffic, so only the encryption is timed
+	encrypter, err := crypto.NewEncrypter(contentEncryption, jose.Recipient{Algorithm: keyAlgorithm, Key: recipientKey.PublicKey}, nil)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+
+	// The run is timed iteration by iteration and left out of the metrics, it is not traffic
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	latencies := make([]time.Duration, iterations)
+	var total time.Duration
+	for i := range latencies {
+		if ctx.Err() != nil {
+			writeError(context, http.StatusServiceUnavailable, CodeTimeout, crypto.ErrTimeout)
+			return
+		}
+		start := time.Now()
+		if _, err := encrypter.Encrypt(plaintext); err != nil {
+			writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed)
+			return
+		}
+		latencies[i] = time.Since(start)
+		total += latencies[i]
+	}
+
+	// The p99 is the latency 99% of the iterations stayed within
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	p99 := latencies[(iterations*99+99)/100-1]
+	average := total / time.Duration(iterations)
+	opsPerSecond := 0.0
+	if total > 0 {
+		opsPerSecond = float64(iterations) / total.Seconds()
+	}
+
+	writeJSON(context, http.StatusOK, model.KeyBenchmarkResponse{
+		KeyType:             recipientKey.KeyType.String(),
+		KeySize:             crypto.KeySize(recipientKey.PublicKey),
+		Alg:                 string(keyAlgorithm),
+		Enc:                 string(contentEncryption),
+		Iterations:          iterations,
+		PlaintextSize:       plaintextSize,
+		AverageMicroseconds: microseconds(average),
+		P99Microseconds:     microseconds(p99),
+		OpsPerSecond:        opsPerSecond,
+	})
+}
+
+func microseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Microsecond)
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeyBenchmarkEndpointTimesTheKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/diagnostics/key-benchmark", KeyBenchmarkEndpoint)
+	benchmark := func(request model.KeyBenchmarkRequest) (*httptest.ResponseRecorder, model.KeyBenchmarkResponse) {
+		body, _ := encodingjson.Marshal(request)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/diagnostics/key-benchmark", bytes.NewReader(body)))
+		var response model.KeyBenchmarkResponse
+		encodingjson.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder, response
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPem, _ := crypto.ExportPublicKeyAsPEM(&ecKey.PublicKey)
+	rsaPem, _ := crypto.ExportPublicKeyAsPEM(&rsaKey.PublicKey)
+
+	for _, test := range []struct {
+		publicKeyPem string
+		keySize      int
+		alg          string
+	}{
+		{ecPem, 256, "ECDH-ES+A256KW"},
+		{rsaPem, 2048, "RSA-OAEP-256"},
+	} {
+		recorder, response := benchmark(model.KeyBenchmarkRequest{PublicKeyPem: test.publicKeyPem, Iterations: 20, PlaintextSize: 64})
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected the %s key benchmarked, got %d %q", test.alg, recorder.Code, recorder.Body.String())
+		}
+		if response.KeySize != test.keySize || response.Alg != test.alg || response.Enc != "A256GCM" || response.Iterations != 20 || response.PlaintextSize != 64 {
+			t.Fatalf("expected the key and run described, got %+v", response)
+		}
+		if response.AverageMicroseconds <= 0 || response.P99Microseconds <= 0 || response.OpsPerSecond <= 0 {
+			t.Fatalf("expected positive timings, got %+v", response)
+		}
+	}
+
+	if _, response := benchmark(model.KeyBenchmarkRequest{PublicKeyPem: ecPem}); response.Iterations != defaultBenchmarkIterations || response.PlaintextSize != defaultBenchmarkPlaintextSize {
+		t.Fatalf("expected the default run, got %+v", response)
+	}
+	if recorder, _ := benchmark(model.KeyBenchmarkRequest{PublicKeyPem: ecPem, Iterations: 1001}); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected too many iterations refused, got %d", recorder.Code)
+	}
+}
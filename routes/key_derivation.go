@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/crypto"
+)
+
+// masterSecret derives the shared secrets of the requests naming a KeyDerivationInfo label, nil disables derivation
+var masterSecret []byte
+
+var errDerivationDisabled = errors.New("key derivation is not configured, set MASTER_SECRET")
+
+// SetMasterSecret sets the base64 master secret keys are derived from, empty disables key derivation
+func SetMasterSecret(encoded string) error {
+	if encoded == "" {
+		masterSecret = nil
+		return nil
+	}
+	secret, err := crypto.DecodeFlexibleBase64(encoded)
+	if err != nil {
+		return err
+	}
+	if len(secret) < crypto.MinMasterSecretSize {
+		return fmt.Errorf("the master secret must be at least %d bytes, got %d", crypto.MinMasterSecretSize, len(secret))
+	}
+	masterSecret = secret
+	return nil
+}
+
+// deriveSymmetricKey derives the shared secret of the info label in the size the algorithms take
+func deriveSymmetricKey(info string, keyAlgorithm jose.KeyAlgorithm, contentEncryption jose.ContentEncryption) ([]byte, error) {
+	if masterSecret == nil {
+		return nil, errDerivationDisabled
+	}
+	keySize, err := crypto.SymmetricKeySize(keyAlgorithm, contentEncryption)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DeriveKey(masterSecret, info, keySize)
+}
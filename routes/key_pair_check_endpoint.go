@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+// KeyPairCheckEndpoint reports whether the private key belongs to the public key, a mismatch is a result and not an error
+func KeyPairCheckEndpoint(context *gin.Context) {
+	var check model.KeyPairCheckRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &check) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, check) {
+		return
+	}
+
+	publicKey, _, err := crypto.ImportPublicKeyFromPEM(check.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+	privateKey, _, err := crypto.ImportPrivateKeyFromPEM(check.PrivateKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	method, err := crypto.RunWithContext(ctx, func() (string, error) {
+		return crypto.CheckKeyPair(publicKey, privateKey)
+	})
+	switch {
+	case errors.Is(err, crypto.ErrTimeout):
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	case errors.Is(err, crypto.ErrKeyPairMismatch):
+		writeJSON(context, http.StatusOK, model.KeyPairCheckResponse{Match: false, Method: method, Reason: err.Error()})
+		return
+	case err != nil:
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+
+	entry, err := crypto.NewPublicKeyEntry(publicKey)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, errors.New("failed to compute public key thumbprint"))
+		return
+	}
+	writeJSON(context, http.StatusOK, model.KeyPairCheckResponse{Match: true, Method: method, Thumbprint: entry.Thumbprint})
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NestedDecryptEndpoint opens what NestedEncryptEndpoint produces: it decrypts the JWE, checks its cty is JWT
+// and verifies the JWS inside. Each stage fails with its own code, so callers can tell a wrong decryption key
+// from a wrong signer.
+func NestedDecryptEndpoint(context *gin.Context) {
+	var nested model.NestedDecryptRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &nested) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, nested) {
+		return
+	}
+
+	privateKey, publicKey, err := importDecryptionKey(nested.PrivateKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+	decryptionKey, err := crypto.NewPublicKeyEntry(publicKey)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+	verificationKey, err := crypto.GetOrImportPublicKey(nested.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	// Only the algorithms fitting the verification key are accepted, which prevents algorithm confusion
+	algorithms := make([]jose.SignatureAlgorithm, 0, len(crypto.SupportedSignatureAlgorithms))
+	for _, algorithm := range crypto.SupportedSignatureAlgorithms {
+		if _, err := crypto.ParseSignatureAlgorithm(string(algorithm), verificationKey.KeyType); err == nil && signatureAllowed(algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if len(algorithms) == 0 {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, fmt.Errorf("none of the allowed algorithms can be used with a %s key", verificationKey.KeyType))
+		return
+	}
+
+	decryptedObject, err := jose.ParseEncrypted(nested.Ciphertext, crypto.DecryptionKeyAlgorithms, crypto.SupportedContentEncryptions)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+		return
+	}
+	contentEncryption, _ := decryptedObject.Header.ExtraHeaders["enc"].(string)
+	middleware.SetAlgorithms(context, decryptedObject.Header.Algorithm, contentEncryption)
+	middleware.SetKeyThumbprint(context, decryptionKey.Thumbprint)
+
+	if !checkCriticalHeaders(context, decryptedObject) {
+		return
+	}
+
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	recipient, err := crypto.RunWithContext(ctx, func() (crypto.DecryptedRecipient, error) {
+		return crypto.DecryptRecipient(nested.Ciphertext, decryptedObject, privateKey)
+	})
+	metrics.Record(metrics.OperationDecrypt, decryptedObject.Header.Algorithm, contentEncryption, err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
+	if errors.Is(err, crypto.ErrInflatedTooLarge) {
+		writeError(context, http.StatusUnprocessableEntity, CodePlaintextTooLarge, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusUnprocessableEntity, CodeDecryptionFailed, errors.New("failed to decrypt the JWE with the provided key"))
+		return
+	}
+	decrypted := recipient.Plaintext
+	defer crypto.Zero(decrypted)
+
+	// The cty header is only trusted once decryption authenticated it, RFC 7519 compares it case-insensitively
+	if contentType, _ := decryptedObject.Header.ExtraHeaders["cty"].(string); !strings.EqualFold(contentType, crypto.JWTContentType) {
+		writeError(context, http.StatusUnprocessableEntity, CodeNotANestedJWT, fmt.Errorf("JWE content type %q is not JWT", contentType))
+		return
+	}
+
+	signature, err := jose.ParseSignedCompact(string(decrypted), algorithms)
+	if err != nil {
+		writeError(context, http.StatusUnprocessableEntity, CodeMalformedJWS, fmt.Errorf("failed to parse the nested JWS: %v", err))
+		return
+	}
+	payload, err := signature.Verify(verificationKey.PublicKey)
+	if err != nil {
+		writeError(context, http.StatusUnprocessableEntity, CodeInvalidSignature, errors.New("nested JWS signature verification failed"))
+		return
+	}
+
+	if crypto.IsClaimsSet(payload) {
+		if err := crypto.ValidateClaims(payload, nested.Audience, config.Current.Leeway); err != nil {
+			writeClaimsError(context, err)
+			return
+		}
+	}
+
+	writeJSON(context, http.StatusOK, model.NestedDecryptResponse{
+		Payload:         string(payload),
+		Header:          signatureHeader(signature.Signatures[0].Protected),
+		DecryptionKid:   decryptionKey.Thumbprint,
+		VerificationKid: verificationKey.Thumbprint,
+	})
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNestedDecryptEndpointRoundTrips(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	// As if the request came with an API key bound to the tenant
+	router.Use(func(context *gin.Context) { context.Set(middleware.APIKeyTenantKey, "nested-decrypt") })
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	router.POST("/v1/encrypt/nested", NestedEncryptEndpoint)
+	router.POST("/v1/decrypt/nested", NestedDecryptEndpoint)
+	send := func(path string, body interface{}) *httptest.ResponseRecorder {
+		encoded, _ := encodingjson.Marshal(body)
+		request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+		request.Header.Set(TenantHeader, "nested-decrypt")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	keys := make([]*rsa.PrivateKey, 3)
+	for i := range keys {
+		var err error
+		if keys[i], err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signingKey, recipientKey, otherKey := keys[0], keys[1], keys[2]
+	signer, err := crypto.TenantKeys.Store("nested-decrypt").Register(signingKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerPem, _ := crypto.ExportPublicKeyAsPEM(&signingKey.PublicKey)
+	recipientPublicPem, _ := crypto.ExportPublicKeyAsPEM(&recipientKey.PublicKey)
+	recipientPrivatePem, _ := crypto.ExportPrivateKeyAsPEM(recipientKey)
+	otherPublicPem, _ := crypto.ExportPublicKeyAsPEM(&otherKey.PublicKey)
+	otherPrivatePem, _ := crypto.ExportPrivateKeyAsPEM(otherKey)
+	recipient, _ := crypto.NewPublicKeyEntry(&recipientKey.PublicKey)
+
+	encrypted := send("/v1/encrypt/nested", model.NestedEncryptRequest{Plaintext: "signed then encrypted", PublicKeyPem: recipientPublicPem})
+	if encrypted.Code != http.StatusOK {
+		t.Fatalf("expected the nested token, got %d %q", encrypted.Code, encrypted.Body.String())
+	}
+	token := encrypted.Body.String()
+
+	recorder := send("/v1/decrypt/nested", model.NestedDecryptRequest{Ciphertext: token, PrivateKeyPem: recipientPrivatePem, PublicKeyPem: signerPem})
+	var response model.NestedDecryptResponse
+	if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected the verified payload, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if response.Payload != "signed then encrypted" || response.DecryptionKid != recipient.Thumbprint || response.VerificationKid != signer.Thumbprint {
+		t.Fatalf("expected the payload with both thumbprints, got %+v", response)
+	}
+
+	plain := send("/v1/encrypt", model.EncryptRequest{Plaintext: "not signed", PublicKeyPem: recipientPublicPem})
+	if plain.Code != http.StatusOK {
+		t.Fatalf("expected the token, got %d %q", plain.Code, plain.Body.String())
+	}
+
+	// Each stage fails with its own code
+	for _, test := range []struct {
+		name    string
+		request model.NestedDecryptRequest
+		code    string
+	}{
+		{"wrong decryption key", model.NestedDecryptRequest{Ciphertext: token, PrivateKeyPem: otherPrivatePem, PublicKeyPem: signerPem}, CodeDecryptionFailed},
+		{"wrong signer", model.NestedDecryptRequest{Ciphertext: token, PrivateKeyPem: recipientPrivatePem, PublicKeyPem: otherPublicPem}, CodeInvalidSignature},
+		{"no cty", model.NestedDecryptRequest{Ciphertext: plain.Body.String(), PrivateKeyPem: recipientPrivatePem, PublicKeyPem: signerPem}, CodeNotANestedJWT},
+	} {
+		if recorder := send("/v1/decrypt/nested", test.request); recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), test.code) {
+			t.Fatalf("%s: expected 422 %s, got %d %q", test.name, test.code, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"crypto/rsa"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"net/http"
+	"time"
+)
+
+// SetSigningKey registers the server private key and makes it the primary that signs nested JWTs
+func SetSigningKey(privateKey *rsa.PrivateKey) error {
+	entry, err := crypto.PrivateKeys.Register(privateKey, nil)
+	if err != nil {
+		return err
+	}
+
+	return crypto.PrivateKeys.SetPrimary(entry.Thumbprint)
+}
+
+func NestedEncryptEndpoint(context *gin.Context) {
+	var nested model.NestedEncryptRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &nested) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, nested) {
+		return
+	}
+
+	// New tokens are always signed with the primary key of the tenant
+	keys, ok := tenantKeys(context)
+	if !ok {
+		return
+	}
+	primary, ok := keys.Primary()
+	if !ok {
+		writeError(context, http.StatusServiceUnavailable, CodeSigningUnavailable, errors.New("no server signing key is configured"))
+		return
+	}
+
+	contentEncryption, err := crypto.ParseContentEncryption(nested.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+
+	recipientKey, err := crypto.GetOrImportPublicKey(nested.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(nested.KeyAlgorithm, recipientKey.KeyType, nested.AllowLegacyRSA15, nested.AllowLegacyHash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) || !checkSignatureAllowed(context, primary.Algorithm) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	// Sign first, the JWS becomes the JWE payload
+	payload, ok := signingPayload(context, nested.Plaintext, nested.Canonicalize)
+	if !ok || !checkContentAllowed(context, payload) {
+		return
+	}
+	signature, err := primary.Signer.Sign(payload)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeSigningFailed, errors.New("failed to sign the plaintext"))
+		return
+	}
+	token, err := signature.CompactSerialize()
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeSigningFailed, errors.New("failed to serialize the JWS"))
+		return
+	}
+
+	serverKid, serverKidHash, ok := recipientServerKid(context, recipientKey, "")
+	if !ok {
+		return
+	}
+
+	// The cty header tells the recipient the payload is itself a JWT
+	encrypter, err := crypto.Encrypters.Get(crypto.EncrypterKey{
+		Thumbprint:        serverKid,
+		ServerKidHash:     serverKidHash,
+		KeyAlgorithm:      keyAlgorithm,
+		ContentEncryption: contentEncryption,
+		ContentType:       "JWT",
+	}, recipientKey.PublicKey)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	start := time.Now()
+	jwe, err := crypto.EncryptWithContext(ctx, encrypter, []byte(token), nil)
+	metrics.Record(metrics.OperationEncrypt, string(keyAlgorithm), string(contentEncryption), err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed)
+		return
+	}
+
+	writeJWE(context, jwe, model.EncryptResponse{
+		Alg: string(keyAlgorithm),
+		Enc: string(contentEncryption),
+	})
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/config"
+	"jwe-go/packages/json"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Encodings of the plaintexts carried in JSON strings, base64url lets binary payloads through
+const (
+	encodingUTF8      = "utf8"
+	encodingBase64URL = "base64url"
+)
+
+// decodePlaintext returns the bytes of a request plaintext, decoding base64url ones
+func decodePlaintext(plaintext, encoding string) ([]byte, error) {
+	if encoding != encodingBase64URL {
+		return []byte(plaintext), nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("Plaintext is not valid unpadded base64url: %v", err)
+	}
+	return decoded, nil
+}
+
+// decodedPlaintextSize is the length decodePlaintext returns for a valid plaintext, known before decoding it
+func decodedPlaintextSize(plaintext, encoding string) int {
+	if encoding == encodingBase64URL {
+		return base64.RawURLEncoding.DecodedLen(len(plaintext))
+	}
+	return len(plaintext)
+}
+
+// checkPlaintextSize refuses a plaintext over the configured cap with a 413, the body limit only bounds its encoded form
+func checkPlaintextSize(context *gin.Context, size int) bool {
+	if size > config.Current.MaxPlaintextSize {
+		writeError(context, http.StatusRequestEntityTooLarge, CodePlaintextTooLarge, fmt.Errorf("plaintext exceeds the maximum of %d bytes", config.Current.MaxPlaintextSize))
+		return false
+	}
+	return true
+}
+
+// encodePlaintext renders a decrypted plaintext in the encoding, utf8 refuses bytes that are not valid UTF-8
+func encodePlaintext(plaintext []byte, encoding string) (string, error) {
+	if encoding == encodingBase64URL {
+		return base64.RawURLEncoding.EncodeToString(plaintext), nil
+	}
+	if !utf8.Valid(plaintext) {
+		return "", errors.New("plaintext is not valid UTF-8, ask for the base64url output encoding")
+	}
+	return string(plaintext), nil
+}
+
+// signingPayload returns the payload to sign, in the RFC 8785 canonical form when asked for so the signature
+// doesn't depend on whitespace or member order. A payload that isn't JSON can't be canonicalized and gets a 400.
+func signingPayload(context *gin.Context, payload string, canonicalize bool) ([]byte, bool) {
+	if !canonicalize {
+		return []byte(payload), true
+	}
+	canonical, err := json.Canonicalize([]byte(payload))
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidJSON, fmt.Errorf("payload must be JSON to be canonicalized: %v", err))
+		return nil, false
+	}
+	return canonical, true
+}
@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+	"time"
+)
+
+// Largest PKCS#12 upload accepted, real bundles are a few kilobytes
+const maxPKCS12Size = 1 << 20
+
+// RegisterPKCS12Endpoint registers the private key of an uploaded PKCS#12 file, the route needs the admin token.
+// The multipart form carries the file as "file" and its password as "password".
+func RegisterPKCS12Endpoint(context *gin.Context) {
+	tenant, ok := requestTenant(context)
+	if !ok {
+		return
+	}
+
+	reader, err := context.Request.MultipartReader()
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidBody, errors.New("expected a multipart form with file and password"))
+		return
+	}
+
+	var data, password []byte
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeBodyReadError(context, err)
+			return
+		}
+
+		var buf bytes.Buffer
+		n, err := buf.ReadFrom(io.LimitReader(part, maxPKCS12Size+1))
+		part.Close()
+		if err != nil {
+			writeBodyReadError(context, err)
+			return
+		}
+		if n > maxPKCS12Size {
+			writeError(context, http.StatusRequestEntityTooLarge, CodeInvalidPKCS12, fmt.Errorf("form field %q exceeds %d bytes", part.FormName(), maxPKCS12Size))
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			data = buf.Bytes()
+		case "password":
+			password = buf.Bytes()
+		}
+	}
+
+	if len(data) == 0 {
+		writeError(context, http.StatusBadRequest, CodeValidationFailed, errors.New("file is required"))
+		return
+	}
+
+	registerPKCS12(context, tenant, data, password)
+}
+
+// registerPKCS12 imports the decoded form into the key store of the tenant and clears the password bytes
+func registerPKCS12(context *gin.Context, tenant string, data, password []byte) {
+	// go-pkcs12 takes the password as a string, only the form bytes can be scrubbed, not that copy
+	defer crypto.Zero(password)
+
+	privateKey, certificate, err := crypto.ImportFromPKCS12(data, string(password))
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPKCS12, err)
+		return
+	}
+
+	entry, err := crypto.TenantKeys.Store(tenant).Register(privateKey, certificate)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+
+	publicKeyPem, err := crypto.ExportPublicKeyAsPEM(certificate.PublicKey)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeInvalidKey, err)
+		return
+	}
+
+	writeJSON(context, http.StatusOK, model.RegisterKeyResponse{
+		Thumbprint:   entry.Thumbprint,
+		KeyType:      entry.KeyType.String(),
+		PublicKeyPem: publicKeyPem,
+		Subject:      certificate.Subject.String(),
+		NotAfter:     certificate.NotAfter.UTC().Format(time.RFC3339),
+	})
+}
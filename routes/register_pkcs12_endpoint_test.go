@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterPKCS12ClearsThePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	context, _ := gin.CreateTestContext(httptest.NewRecorder())
+	password := []byte("bundle password")
+
+	// The bytes are cleared whether or not the bundle decodes
+	registerPKCS12(context, "pkcs12", []byte("not a PKCS#12 file"), password)
+	if context.Writer.Status() != http.StatusBadRequest {
+		t.Fatalf("expected the invalid bundle refused, got %d", context.Writer.Status())
+	}
+	if !bytes.Equal(password, make([]byte, len(password))) {
+		t.Fatalf("expected the password bytes cleared, got %q", password)
+	}
+}
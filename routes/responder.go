@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/json"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/tracing"
+	"log"
+	"net/http"
+)
+
+// Serializations of the JWE responses
+const (
+	serializationCompact = "compact"
+	serializationJSON    = "json"
+)
+
+// mimeJSON is the content type gin gives JSON responses, mimePlain the one it gives strings,
+// mimeOctetStream the one of streamed plaintexts
+const (
+	mimeJSON  = "application/json; charset=utf-8"
+	mimePlain = "text/plain; charset=utf-8"
+	// Binary bodies carry no charset
+	mimeOctetStream = "application/octet-stream"
+)
+
+// recipientHeadersKey holds the unprotected recipient headers serializeJWE adds to a JSON serialized JWE
+const recipientHeadersKey = "recipientHeaders"
+
+// acceptsJSON reports whether the client asked for application/json over plain text, a missing or wildcard Accept keeps the plain form
+func acceptsJSON(context *gin.Context) bool {
+	if context.GetHeader("Accept") == "" {
+		return false
+	}
+	return context.NegotiateFormat(gin.MIMEPlain, gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// writeJSON sends the value encoded by packages/json, the same instance that decodes the requests
+func writeJSON(context *gin.Context, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("failed to encode %T response: %v", value, err)
+		context.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	context.Data(status, mimeJSON, body)
+}
+
+// writeJWE sends the JWE in the serialization of the metadata, the compact one as text and the JSON one as application/json.
+// Clients accepting application/json get either wrapped in a model.EncryptResponse with the kid, alg and enc.
+func writeJWE(context *gin.Context, jwe *jose.JSONWebEncryption, metadata model.EncryptResponse) {
+	serialized, ok := serializeJWE(context, jwe, &metadata)
+	if !ok {
+		return
+	}
+
+	if !acceptsJSON(context) {
+		if metadata.Serialization == serializationJSON {
+			writeSignedData(context, gin.MIMEJSON, []byte(serialized))
+		} else {
+			writeSignedData(context, mimePlain, []byte(serialized))
+		}
+		return
+	}
+	writeEncryptResponse(context, serialized, metadata)
+}
+
+// writeDetachedJWE sends the JWE without its ciphertext and the ciphertext beside it, always in a model.EncryptResponse
+func writeDetachedJWE(context *gin.Context, jwe *jose.JSONWebEncryption, metadata model.EncryptResponse) {
+	serialized, ok := serializeJWE(context, jwe, &metadata)
+	if !ok {
+		return
+	}
+
+	detached, ciphertext, err := crypto.DetachContent(serialized)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errSerializationFailed)
+		return
+	}
+	metadata.Ciphertext = ciphertext
+	writeEncryptResponse(context, detached, metadata)
+}
+
+// serializeJWE serializes the JWE as the metadata asks, defaulting it to compact
+func serializeJWE(context *gin.Context, jwe *jose.JSONWebEncryption, metadata *model.EncryptResponse) (string, bool) {
+	serialized, ok := serializeToken(context, jwe, metadata)
+	if !ok {
+		return "", false
+	}
+
+	// The token ID is only reported for a token that was actually issued
+	if tokenID := context.GetString(tokenIDKey); tokenID != "" {
+		middleware.SetTokenID(context, tokenID)
+		context.Header(TokenIDResponseHeader, tokenID)
+	}
+	return serialized, true
+}
+
+// serializeToken serializes the JWE in the form the request asked for
+func serializeToken(context *gin.Context, jwe *jose.JSONWebEncryption, metadata *model.EncryptResponse) (string, bool) {
+	_, span := tracing.Start(context.Request.Context(), "serialize")
+	defer span.End()
+
+	if metadata.Serialization == serializationJSON {
+		span.SetAttributes(tracing.AttributeSerialization.String(serializationJSON))
+		headers, ok := context.Get(recipientHeadersKey)
+		if !ok {
+			return jwe.FullSerialize(), true
+		}
+		serialized, err := crypto.AddRecipientHeaders(jwe.FullSerialize(), headers.([]map[string]string))
+		if err != nil {
+			writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errSerializationFailed)
+			return "", false
+		}
+		return serialized, true
+	}
+
+	metadata.Serialization = serializationCompact
+	span.SetAttributes(tracing.AttributeSerialization.String(serializationCompact))
+	serialized, err := jwe.CompactSerialize()
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errSerializationFailed)
+		return "", false
+	}
+	return serialized, true
+}
+
+// writeEncryptResponse embeds the serialized JWE in the metadata, a compact token as a string and a JSON one as an object
+func writeEncryptResponse(context *gin.Context, serialized string, metadata model.EncryptResponse) {
+	metadata.JWE = []byte(serialized)
+	if metadata.Serialization == serializationCompact {
+		quoted, err := json.Marshal(serialized)
+		if err != nil {
+			writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errSerializationFailed)
+			return
+		}
+		metadata.JWE = quoted
+	}
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errSerializationFailed)
+		return
+	}
+	writeSignedData(context, mimeJSON, body)
+}
@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/crypto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponsesGoThroughTheJSONPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/decrypt", func(context *gin.Context) {
+		writeError(context, http.StatusBadRequest, CodeValidationFailed, errors.New(`field "aud" must be <api>`))
+	})
+	router.GET("/.well-known/jwks.json", JWKSEndpoint)
+
+	// jsoniter leaves the HTML characters alone where encoding/json would escape them
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/decrypt", nil))
+	if expected := `{"code":"VALIDATION_FAILED","message":"field \"aud\" must be <api>"}`; recorder.Body.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+	}
+	if recorder.Code != http.StatusBadRequest || recorder.Header().Get("Content-Type") != mimeJSON {
+		t.Fatalf("expected a 400 JSON error, got %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	defer func(keySet publishedKeySet) { jwksKeySet = keySet }(jwksKeySet)
+	publicKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public()
+	if err := SetPublicKeySet([]crypto.PublishedKey{{JWK: jose.JSONWebKey{Key: publicKey, KeyID: "k1", Algorithm: "EdDSA", Use: "sig"}}}); err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if expected := `{"keys":[{"use":"sig","kty":"OKP","kid":"k1","crv":"Ed25519","alg":"EdDSA","x":"O2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik"}]}`; recorder.Body.String() != expected {
+		t.Fatalf("expected %s, got %s", expected, recorder.Body.String())
+	}
+}
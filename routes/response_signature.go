@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+// ResponseSignatureHeader carries a detached compact JWS over the response body, signed by the primary key
+// of the tenant, so a client can later prove the server produced the token
+const ResponseSignatureHeader = "X-Response-Signature"
+
+// writeSignedData sends a successful JWE response, signed when SIGN_RESPONSES is set
+func writeSignedData(context *gin.Context, contentType string, body []byte) {
+	if config.Current.SignResponses {
+		signature, ok := signResponse(context, body)
+		if !ok {
+			return
+		}
+		context.Header(ResponseSignatureHeader, signature)
+	}
+	context.Data(http.StatusOK, contentType, body)
+}
+
+// signResponse signs the body bytes as they go on the wire, the JWS payload is left out of the header
+func signResponse(context *gin.Context, body []byte) (string, bool) {
+	keys, ok := tenantKeys(context)
+	if !ok {
+		return "", false
+	}
+	primary, ok := keys.Primary()
+	if !ok {
+		writeError(context, http.StatusServiceUnavailable, CodeSigningUnavailable, errors.New("responses are signed but no server signing key is configured"))
+		return "", false
+	}
+
+	signature, err := signDetached(primary, body)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeSigningFailed, errors.New("failed to sign the response"))
+		return "", false
+	}
+	return signature, true
+}
+
+// signDetached signs the payload with the kid of the key in the protected header, so clients can pick it from the JWKS
+func signDetached(key crypto.PrivateKeyEntry, payload []byte) (string, error) {
+	options := (&jose.SignerOptions{}).WithHeader(jose.HeaderKey("kid"), key.Thumbprint)
+	signer, err := crypto.NewSigner(key.Algorithm, key.PrivateKey, options)
+	if err != nil {
+		return "", err
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return signed.DetachedCompactSerialize()
+}
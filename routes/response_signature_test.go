@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEncryptResponsesAreSignedWithTheServerKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/encrypt", EncryptEndpoint)
+	defer func(current config.Config) { config.Current = current }(config.Current)
+	config.Current.SignResponses = true
+	defer func(store *crypto.KeyStore) { crypto.PrivateKeys = store }(crypto.PrivateKeys)
+	crypto.PrivateKeys = crypto.NewKeyStore()
+
+	recipientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, _ := crypto.ExportPublicKeyAsPEM(&recipientKey.PublicKey)
+	body, _ := encodingjson.Marshal(model.EncryptRequest{Plaintext: "signed by the server", PublicKeyPem: publicKeyPem})
+	encrypt := func(accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/v1/encrypt", bytes.NewReader(body))
+		request.Header.Set("Accept", accept)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// Signing responses without a key to sign with fails rather than sending them unsigned
+	if recorder := encrypt(""); recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get(ResponseSignatureHeader) != "" {
+		t.Fatalf("expected a 503 without a signing key, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := crypto.PrivateKeys.Register(serverKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, accept := range []string{"", gin.MIMEJSON} {
+		recorder := encrypt(accept)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 accepting %q, got %d %q", accept, recorder.Code, recorder.Body.String())
+		}
+		signature := recorder.Header().Get(ResponseSignatureHeader)
+		signed, err := jose.ParseDetached(signature, recorder.Body.Bytes(), []jose.SignatureAlgorithm{jose.ES256})
+		if err != nil {
+			t.Fatalf("expected a detached JWS accepting %q, got %q: %v", accept, signature, err)
+		}
+		if signed.Signatures[0].Protected.KeyID != entry.Thumbprint || signed.Signatures[0].Header.KeyID != entry.Thumbprint {
+			t.Fatalf("expected the signature tagged with the server key, got kid %q", signed.Signatures[0].Header.KeyID)
+		}
+		if _, err := signed.Verify(&serverKey.PublicKey); err != nil {
+			t.Fatalf("expected the signature to verify against the server public key: %v", err)
+		}
+
+		// The signature covers the exact bytes sent, another body does not verify
+		tampered, err := jose.ParseDetached(signature, append(recorder.Body.Bytes(), ' '), []jose.SignatureAlgorithm{jose.ES256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tampered.Verify(&serverKey.PublicKey); err == nil {
+			t.Fatal("expected a changed body to fail verification")
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package routes
+
+import (
+	stdcontext "context"
+	stdcrypto "crypto"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/tracing"
+	"net/http"
+	"time"
+)
+
+// defaultPreservedHeaders are copied to the rewrapped JWE when the request names none
+var defaultPreservedHeaders = []string{"cty"}
+
+// RewrapEndpoint decrypts a JWE and encrypts its plaintext to a new recipient, the plaintext never leaves the server
+func RewrapEndpoint(context *gin.Context) {
+	var rewrap model.RewrapRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &rewrap) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, rewrap) {
+		return
+	}
+
+	target, ok := newRewrapTarget(context, rewrap)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	response, failure := target.rewrap(ctx, rewrap.Ciphertext)
+	if failure != nil {
+		writeStatusError(context, failure)
+		return
+	}
+	middleware.SetAlgorithms(context, response.Alg, response.Enc)
+
+	context.Header(ServerKidResponseHeader, target.serverKid)
+	writeJSON(context, http.StatusOK, response)
+}
+
+// newRewrapTarget imports the keys and resolves the algorithms of a rewrap request, ignoring its Ciphertext
+func newRewrapTarget(context *gin.Context, rewrap model.RewrapRequest) (rewrapTarget, bool) {
+	// Headers managed by go-jose or this service are set afresh for the new recipient, never copied
+	preserveHeaders := rewrap.PreserveHeaders
+	if len(preserveHeaders) == 0 {
+		preserveHeaders = defaultPreservedHeaders
+	}
+	for _, name := range preserveHeaders {
+		if err := crypto.ValidateProtectedHeaders(map[string]string{name: ""}); err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidHeader, err)
+			return rewrapTarget{}, false
+		}
+	}
+
+	privateKey, publicKey, err := importDecryptionKey(rewrap.PrivateKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return rewrapTarget{}, false
+	}
+	sourceKey, err := crypto.NewPublicKeyEntry(publicKey)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return rewrapTarget{}, false
+	}
+
+	recipientKey, err := crypto.GetOrImportPublicKey(rewrap.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return rewrapTarget{}, false
+	}
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(rewrap.KeyAlgorithm, recipientKey.KeyType, rewrap.AllowLegacyRSA15, rewrap.AllowLegacyHash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return rewrapTarget{}, false
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), rewrap.ContentEncryption)
+
+	serverKid, serverKidHash, ok := recipientServerKid(context, recipientKey, "")
+	if !ok {
+		return rewrapTarget{}, false
+	}
+	return rewrapTarget{
+		privateKey:        privateKey,
+		sourceThumbprint:  sourceKey.Thumbprint,
+		recipientKey:      recipientKey,
+		keyAlgorithm:      keyAlgorithm,
+		contentEncryption: rewrap.ContentEncryption,
+		preserveHeaders:   preserveHeaders,
+		serverKid:         serverKid,
+		serverKidHash:     serverKidHash,
+	}, true
+}
+
+// rewrapTarget is the key pair a rewrap request moves tokens between, shared by every token of a batch
+type rewrapTarget struct {
+	privateKey       interface{}
+	sourceThumbprint string
+	recipientKey     crypto.PublicKeyEntry
+	keyAlgorithm     jose.KeyAlgorithm
+	// contentEncryption is the enc of the new tokens, empty keeps the one of each token
+	contentEncryption string
+	preserveHeaders   []string
+	serverKid         string
+	serverKidHash     stdcrypto.Hash
+}
+
+// rewrap decrypts the token with the private key and encrypts its plaintext to the recipient key,
+// the plaintext is zeroed before returning
+func (target rewrapTarget) rewrap(ctx stdcontext.Context, ciphertext string) (model.RewrapResponse, *statusError) {
+	decryptedObject, err := jose.ParseEncrypted(
+		ciphertext,
+		crypto.DecryptionKeyAlgorithms,
+		crypto.SupportedContentEncryptions,
+	)
+	if err != nil {
+		return model.RewrapResponse{}, &statusError{http.StatusBadRequest, CodeMalformedJWE, err}
+	}
+	if failure := criticalHeadersError(decryptedObject); failure != nil {
+		return model.RewrapResponse{}, failure
+	}
+
+	// A compact JWE has nowhere to carry the AAD, dropping it would silently weaken the token
+	if len(decryptedObject.GetAuthData()) > 0 {
+		return model.RewrapResponse{}, &statusError{http.StatusUnprocessableEntity, CodeInvalidHeader, errors.New("JWE with additional data cannot be rewrapped to a compact JWE")}
+	}
+
+	// The new JWE keeps the content encryption of the source unless the request picks another
+	sourceEncryption, _ := decryptedObject.Header.ExtraHeaders["enc"].(string)
+	contentEncryptionName := target.contentEncryption
+	if contentEncryptionName == "" {
+		contentEncryptionName = sourceEncryption
+	}
+	contentEncryption, err := crypto.ParseContentEncryption(contentEncryptionName)
+	if err != nil {
+		return model.RewrapResponse{}, &statusError{http.StatusBadRequest, CodeUnsupportedAlg, err}
+	}
+	if failure := encryptionPolicyError(target.keyAlgorithm, contentEncryption); failure != nil {
+		return model.RewrapResponse{}, failure
+	}
+
+	start := time.Now()
+	_, decryptSpan := crypto.StartDecryptSpan(ctx, decryptedObject)
+	recipient, err := crypto.RunWithContext(ctx, func() (crypto.DecryptedRecipient, error) {
+		return crypto.DecryptRecipient(ciphertext, decryptedObject, target.privateKey)
+	})
+	tracing.End(decryptSpan, err)
+	sourceAlgorithm := decryptedObject.Header.Algorithm
+	if recipient.Header.Algorithm != "" {
+		sourceAlgorithm = recipient.Header.Algorithm
+	}
+	metrics.Record(metrics.OperationDecrypt, sourceAlgorithm, sourceEncryption, err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		return model.RewrapResponse{}, &statusError{http.StatusServiceUnavailable, CodeTimeout, err}
+	}
+	if errors.Is(err, crypto.ErrInflatedTooLarge) {
+		return model.RewrapResponse{}, &statusError{http.StatusUnprocessableEntity, CodePlaintextTooLarge, err}
+	}
+	if err != nil {
+		return model.RewrapResponse{}, &statusError{http.StatusUnprocessableEntity, CodeDecryptionFailed, errors.New("failed to decrypt the JWE with the provided key")}
+	}
+
+	// EncryptWithContext zeroes the plaintext once encrypted again, the deferred call covers the early returns
+	plaintext := recipient.Plaintext
+	defer crypto.Zero(plaintext)
+	if failure := decryptedPayloadError(decryptedObject, plaintext, ""); failure != nil {
+		return model.RewrapResponse{}, failure
+	}
+
+	headers := crypto.ServerKidHeaders(target.serverKid, target.serverKidHash)
+	for _, name := range target.preserveHeaders {
+		if value, ok := decryptedObject.Header.ExtraHeaders[jose.HeaderKey(name)]; ok {
+			headers[name] = value
+		}
+	}
+	_, compressed := decryptedObject.Header.ExtraHeaders["zip"]
+	encrypter, err := crypto.NewEncrypter(contentEncryption, jose.Recipient{Algorithm: target.keyAlgorithm, Key: target.recipientKey.PublicKey}, crypto.BuildEncrypterOptions(headers, compressed))
+	if err != nil {
+		return model.RewrapResponse{}, &statusError{http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup}
+	}
+
+	start = time.Now()
+	jwe, err := crypto.EncryptWithContext(ctx, encrypter, plaintext, nil)
+	metrics.Record(metrics.OperationEncrypt, string(target.keyAlgorithm), string(contentEncryption), err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		return model.RewrapResponse{}, &statusError{http.StatusServiceUnavailable, CodeTimeout, err}
+	}
+	if err != nil {
+		return model.RewrapResponse{}, &statusError{http.StatusInternalServerError, CodeEncryptionFailed, errEncryptionFailed}
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		return model.RewrapResponse{}, &statusError{http.StatusInternalServerError, CodeEncryptionFailed, fmt.Errorf("failed to serialize JWE: %v", err)}
+	}
+
+	return model.RewrapResponse{
+		JWE:                 compact,
+		SourceThumbprint:    target.sourceThumbprint,
+		RecipientThumbprint: target.serverKid,
+		Alg:                 string(target.keyAlgorithm),
+		Enc:                 string(contentEncryption),
+	}, nil
+}
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/audit"
+	"jwe-go/packages/config"
+	"jwe-go/packages/middleware"
+	"log"
+)
+
+// V1Prefix is the path of the first API version, a breaking change gets a group of its own next to it
+const V1Prefix = "/v1"
+
+// apiKeys are the API keys the v1 routes require, none leaves them open
+var apiKeys []middleware.APIKeyHash
+
+// SetAPIKeys sets the salted API key hashes the v1 routes require
+func SetAPIKeys(hashes []string) error {
+	keys, err := middleware.ParseAPIKeyHashes(hashes)
+	if err != nil {
+		return err
+	}
+	apiKeys = keys
+	return nil
+}
+
+// RegisterV1 registers the v1 API on the router with its rate limits and body limits, and returns its group
+func RegisterV1(router *gin.Engine) *gin.RouterGroup {
+	v1 := router.Group(V1Prefix)
+
+	// The crypto routes leave an audit event, also when the rate or body limits turn them away
+	v1.Use(middleware.Audit(map[string]string{
+		V1Prefix + "/encrypt":        audit.EventEncrypt,
+		V1Prefix + "/encrypt/batch":  audit.EventEncrypt,
+		V1Prefix + "/encrypt/nested": audit.EventEncrypt,
+		V1Prefix + "/encrypt/stream": audit.EventEncrypt,
+		V1Prefix + "/encrypt/file":   audit.EventEncrypt,
+		V1Prefix + "/decrypt":        audit.EventDecrypt,
+		V1Prefix + "/decrypt/trial":  audit.EventDecrypt,
+		V1Prefix + "/decrypt/nested": audit.EventDecrypt,
+		V1Prefix + "/rewrap":         audit.EventRewrap,
+		V1Prefix + "/rewrap/batch":   audit.EventRewrap,
+		V1Prefix + "/sign":           audit.EventSign,
+		V1Prefix + "/verify":         audit.EventVerify,
+		V1Prefix + "/keys/generate":  audit.EventKeyGenerate,
+	}))
+
+	// With API keys configured every v1 route needs one, admin routes on top of the admin token
+	if len(apiKeys) > 0 {
+		v1.Use(middleware.APIKeyAuth(apiKeys))
+	} else {
+		log.Printf("v1 routes are open, set API_KEY_HASHES to require API keys")
+	}
+
+	// Each client gets a token bucket per route, key generation and the multi-operation routes cost the most
+	heavyLimit := middleware.RateLimit{Rate: float64(config.Current.HeavyRateLimitPerSecond), Burst: config.Current.HeavyRateLimitBurst}
+	v1.Use(middleware.RateLimiter(middleware.NewMemoryRateLimiterStore(), middleware.RateLimit{
+		Rate:  float64(config.Current.RateLimitPerSecond),
+		Burst: config.Current.RateLimitBurst,
+	}, map[string]middleware.RateLimit{
+		V1Prefix + "/encrypt/batch":             heavyLimit,
+		V1Prefix + "/encrypt/stream":            heavyLimit,
+		V1Prefix + "/decrypt/trial":             heavyLimit,
+		V1Prefix + "/rewrap":                    heavyLimit,
+		V1Prefix + "/rewrap/batch":              heavyLimit,
+		V1Prefix + "/keys/generate":             heavyLimit,
+		V1Prefix + "/diagnostics/key-benchmark": heavyLimit,
+	}))
+	v1.Use(middleware.BodyLimit(config.Current.MaxBodySize, map[string]int64{
+		V1Prefix + "/encrypt":          config.Current.MaxEncryptBodySize,
+		V1Prefix + "/encrypt/batch":    config.Current.MaxEncryptBodySize,
+		V1Prefix + "/encrypt/nested":   config.Current.MaxEncryptBodySize,
+		V1Prefix + "/encrypt/stream":   config.Current.MaxStreamBodySize,
+		V1Prefix + "/encrypt/file":     config.Current.MaxEncryptBodySize,
+		V1Prefix + "/encrypt/validate": config.Current.MaxEncryptBodySize,
+		V1Prefix + "/sign":             config.Current.MaxEncryptBodySize,
+		V1Prefix + "/decrypt":          config.Current.MaxEncryptBodySize,
+		V1Prefix + "/decrypt/trial":    config.Current.MaxEncryptBodySize,
+		V1Prefix + "/decrypt/nested":   config.Current.MaxEncryptBodySize,
+		V1Prefix + "/rewrap":           config.Current.MaxEncryptBodySize,
+		V1Prefix + "/rewrap/batch":     config.Current.MaxEncryptBodySize,
+		V1Prefix + "/inspect":          config.Current.MaxInspectBodySize,
+		V1Prefix + "/jwe/convert":      config.Current.MaxEncryptBodySize,
+		V1Prefix + "/verify-decrypt":   config.Current.MaxInspectBodySize,
+	}))
+	// Bodies have to declare their media type, a form encoded body would only fail later as invalid JSON
+	multipart := []string{"multipart/form-data"}
+	v1.Use(middleware.ContentType(config.Current.AcceptedContentTypes, map[string][]string{
+		V1Prefix + "/encrypt/stream": multipart,
+		V1Prefix + "/encrypt/file":   multipart,
+		V1Prefix + "/keys/pkcs12":    multipart,
+	}))
+
+	// Retries of an encrypt call sending the same Idempotency-Key get the token the first call produced
+	idempotency := middleware.Idempotency(middleware.NewMemoryIdempotencyStore(), config.Current.IdempotencyTTL)
+
+	v1.POST("/encrypt", Compressed(idempotency, EncryptEndpoint)...)
+	v1.POST("/encrypt/batch", idempotency, BatchEncryptEndpoint)
+	v1.POST("/encrypt/nested", idempotency, NestedEncryptEndpoint)
+	v1.POST("/encrypt/stream", StreamEncryptEndpoint)
+	v1.POST("/encrypt/file", FileEncryptEndpoint)
+	v1.POST("/encrypt/validate", ValidateEndpoint)
+	v1.POST("/encrypt/estimate", EstimateSizeEndpoint)
+	v1.POST("/decrypt", DecryptEndpoint)
+	v1.POST("/decrypt/trial", TrialDecryptEndpoint)
+	v1.POST("/decrypt/nested", NestedDecryptEndpoint)
+	v1.POST("/rewrap", RewrapEndpoint)
+	v1.POST("/rewrap/batch", BatchRewrapEndpoint)
+	v1.POST("/sign", SignEndpoint)
+	v1.POST("/verify", VerifyEndpoint)
+	v1.POST("/verify-decrypt", VerifyKidEndpoint)
+	v1.POST("/inspect", InspectEndpoint)
+	v1.POST("/jwe/convert", ConvertJWEEndpoint)
+	v1.GET("/algorithms", AlgorithmsEndpoint)
+	v1.POST("/keys/generate", GenerateKeyEndpoint)
+	v1.POST("/keys/thumbprint", ThumbprintEndpoint)
+	v1.POST("/keys/convert", ConvertKeyEndpoint)
+	v1.POST("/keys/check-pair", KeyPairCheckEndpoint)
+	// The key management routes add keys and change which key signs and decrypts, the key cache routes tell which keys
+	// clients encrypt to: they all need the admin token and are not registered without one
+	if config.Current.AdminToken != "" {
+		adminAuth := middleware.AdminAuth(config.Current.AdminToken)
+		v1.POST("/keys/pkcs12", adminAuth, RegisterPKCS12Endpoint)
+		v1.GET("/admin/keys", adminAuth, ListKeysEndpoint)
+		v1.POST("/admin/keys/promote", adminAuth, PromoteKeyEndpoint)
+		v1.POST("/admin/keys/retire", adminAuth, RetireKeyEndpoint)
+		v1.GET("/admin/cache", adminAuth, KeyCacheEndpoint)
+		v1.DELETE("/admin/cache/:kid", adminAuth, EvictCachedKeyEndpoint)
+	} else {
+		log.Printf("admin routes disabled, set ADMIN_TOKEN to enable them")
+	}
+	if keyProvider != nil && config.Current.AdminToken != "" {
+		v1.POST("/admin/reload-keys", middleware.AdminAuth(config.Current.AdminToken), ReloadKeysEndpoint)
+	} else if keyProvider != nil {
+		log.Printf("key reload route disabled, set ADMIN_TOKEN to enable it")
+	}
+	if config.Current.EnableTestVectors {
+		log.Printf("test vectors and key benchmark routes enabled, they are for testing only")
+		v1.POST("/test-vectors", TestVectorEndpoint)
+		v1.POST("/diagnostics/key-benchmark", KeyBenchmarkEndpoint)
+	}
+	if config.Current.AllowClientContentKey {
+		log.Printf("client supplied content encryption keys enabled, a reused CEK exposes every message encrypted under it")
+	}
+	return v1
+}
+
+// Compressed puts the gzip middleware in front of the handlers when GZIP_RESPONSES is on. Only the JWKS and the
+// encrypt route use it: a compressed decrypt, trial or rewrap response would let a client mixing its own guesses
+// into the request learn the plaintext from the response size (BREACH).
+func Compressed(handlers ...gin.HandlerFunc) []gin.HandlerFunc {
+	if !config.Current.GzipResponses {
+		return handlers
+	}
+	return append([]gin.HandlerFunc{middleware.Gzip(config.Current.GzipMinSize)}, handlers...)
+}
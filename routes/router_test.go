@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterV1ServesTheVersionedPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	RegisterV1(router)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, err := crypto.ExportPublicKeyAsPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyPem, err := crypto.ExportPrivateKeyAsPEM(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = encodingjson.Marshal(body)
+		}
+		request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := send(http.MethodGet, V1Prefix+"/algorithms", nil); recorder.Code != http.StatusOK {
+		t.Fatalf("expected the algorithms under %s, got %d", V1Prefix, recorder.Code)
+	}
+
+	encrypted := send(http.MethodPost, V1Prefix+"/encrypt", model.EncryptRequest{Plaintext: "versioned", PublicKeyPem: publicKeyPem})
+	if encrypted.Code != http.StatusOK {
+		t.Fatalf("expected the token, got %d %q", encrypted.Code, encrypted.Body.String())
+	}
+	decrypted := send(http.MethodPost, V1Prefix+"/decrypt", model.DecryptRequest{Ciphertext: encrypted.Body.String(), PrivateKeyPem: privateKeyPem})
+	var response model.DecryptResponse
+	if err := encodingjson.Unmarshal(decrypted.Body.Bytes(), &response); err != nil || decrypted.Code != http.StatusOK || response.Plaintext != "versioned" {
+		t.Fatalf("expected the plaintext back, got %d %q", decrypted.Code, decrypted.Body.String())
+	}
+
+	// Only the versioned paths exist, unversioned clients get a 404 rather than some future version
+	for _, path := range []string{"/encrypt", "/decrypt", "/v2/encrypt"} {
+		if recorder := send(http.MethodPost, path, model.EncryptRequest{Plaintext: "unversioned", PublicKeyPem: publicKeyPem}); recorder.Code != http.StatusNotFound {
+			t.Fatalf("expected %s to be unknown, got %d", path, recorder.Code)
+		}
+	}
+}
+
+func TestRegisterV1GuardsTheKeyManagementRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(current config.Config) { config.Current = current }(config.Current)
+	send := func(router *gin.Engine, method, path, token string) int {
+		request := httptest.NewRequest(method, path, bytes.NewReader([]byte(`{}`)))
+		request.Header.Set("Content-Type", "application/json")
+		if strings.HasSuffix(path, "/pkcs12") {
+			request.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+		}
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	routes := []struct{ method, path string }{
+		{http.MethodGet, V1Prefix + "/admin/keys"},
+		{http.MethodPost, V1Prefix + "/admin/keys/promote"},
+		{http.MethodPost, V1Prefix + "/admin/keys/retire"},
+		{http.MethodPost, V1Prefix + "/keys/pkcs12"},
+	}
+
+	// Without an admin token the routes don't exist
+	config.Current.AdminToken = ""
+	open := gin.New()
+	RegisterV1(open)
+	for _, route := range routes {
+		if status := send(open, route.method, route.path, ""); status != http.StatusNotFound {
+			t.Fatalf("expected %s unregistered without ADMIN_TOKEN, got %d", route.path, status)
+		}
+	}
+
+	config.Current.AdminToken = "admin-secret"
+	guarded := gin.New()
+	RegisterV1(guarded)
+	for _, route := range routes {
+		if status := send(guarded, route.method, route.path, ""); status != http.StatusUnauthorized {
+			t.Fatalf("expected %s to require the admin token, got %d", route.path, status)
+		}
+		if status := send(guarded, route.method, route.path, "wrong"); status != http.StatusUnauthorized {
+			t.Fatalf("expected %s to refuse a wrong admin token, got %d", route.path, status)
+		}
+	}
+	if status := send(guarded, http.MethodGet, V1Prefix+"/admin/keys", "admin-secret"); status != http.StatusOK {
+		t.Fatalf("expected the key list with the admin token, got %d", status)
+	}
+}
+
+func TestRegisterV1CompressesTheEncryptRouteOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	defer func(current config.Config) { config.Current = current }(config.Current)
+	config.Current.GzipResponses, config.Current.GzipMinSize = true, 1
+	router := gin.New()
+	RegisterV1(router)
+
+	// All four answer the empty body with a JSON error, only the encrypt one is compressed
+	for _, test := range []struct {
+		path       string
+		compressed bool
+	}{
+		{V1Prefix + "/encrypt", true},
+		{V1Prefix + "/decrypt", false},
+		{V1Prefix + "/decrypt/trial", false},
+		{V1Prefix + "/rewrap", false},
+	} {
+		request := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(`{}`))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Accept-Encoding", "gzip")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if compressed := recorder.Header().Get("Content-Encoding") == "gzip"; compressed != test.compressed {
+			t.Fatalf("%s: expected compressed %v, got headers %v", test.path, test.compressed, recorder.Header())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	stdcrypto "crypto"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/config"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"net/http"
+)
+
+// recipientServerKid computes the server_kid of the recipient key, a request hash overriding the configured one,
+// and records the SHA-256 thumbprint of the key for the audit log.
+// SHA-1 only serves legacy interop and is refused unless the deployment allows it.
+func recipientServerKid(context *gin.Context, recipientKey crypto.PublicKeyEntry, hashName string) (string, stdcrypto.Hash, bool) {
+	middleware.SetKeyThumbprint(context, recipientKey.Thumbprint)
+	hash := crypto.ServerKidHash
+	if hashName != "" {
+		var err error
+		if hash, err = crypto.ParseThumbprintHash(hashName); err != nil {
+			writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+			return "", 0, false
+		}
+		if hash == stdcrypto.SHA1 && !config.Current.AllowSHA1ServerKid {
+			writeError(context, http.StatusBadRequest, CodeAlgorithmNotAllowed, errors.New("SHA-1 server_kid thumbprints are disabled, they are for legacy interop only"))
+			return "", 0, false
+		}
+	}
+
+	kid, err := recipientKey.ServerKid(hash)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, errors.New("failed to compute public key thumbprint"))
+		return "", 0, false
+	}
+	return kid, hash, true
+}
@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"net/http"
+	"strings"
+)
+
+func SignEndpoint(context *gin.Context) {
+	var signing model.SignRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &signing) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, signing) {
+		return
+	}
+
+	// Several signers countersign the same payload, which only the JSON serialization can carry
+	signers := signing.Signers
+	if len(signers) == 0 {
+		signers = []model.SignerSpec{{PrivateKeyPem: signing.PrivateKeyPem, Algorithm: signing.Algorithm, PSSSaltLength: signing.PSSSaltLength}}
+	}
+	signingKeys := make([]jose.SigningKey, len(signers))
+	algorithms := make([]string, len(signers))
+	for i, spec := range signers {
+		var ok bool
+		if signingKeys[i], ok = newSigningKey(context, spec); !ok {
+			return
+		}
+		algorithms[i] = string(signingKeys[i].Algorithm)
+	}
+	middleware.SetAlgorithms(context, strings.Join(algorithms, ","), "")
+
+	signer, err := crypto.NewMultiSigner(signingKeys, nil)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+
+	payload, ok := signingPayload(context, signing.Payload, signing.Canonicalize)
+	if !ok {
+		return
+	}
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeSigningFailed, errors.New("failed to sign the payload"))
+		return
+	}
+
+	if len(signing.Signers) > 0 {
+		context.Data(http.StatusOK, gin.MIMEJSON, []byte(signature.FullSerialize()))
+		return
+	}
+
+	serialized, err := signature.CompactSerialize()
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeSigningFailed, errors.New("failed to serialize the JWS"))
+		return
+	}
+
+	context.String(http.StatusOK, serialized)
+}
+
+// newSigningKey imports the signer's private key and checks its algorithm, writing the error when it fails
+func newSigningKey(context *gin.Context, spec model.SignerSpec) (jose.SigningKey, bool) {
+	privateKey, keyType, err := crypto.ImportPrivateKeyFromPEM(spec.PrivateKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return jose.SigningKey{}, false
+	}
+
+	// Reject algorithms that don't fit the key, e.g. ES256 with an RSA key
+	algorithm, err := crypto.ParseSignatureAlgorithm(spec.Algorithm, keyType)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return jose.SigningKey{}, false
+	}
+	if !checkSignatureAllowed(context, algorithm) {
+		return jose.SigningKey{}, false
+	}
+
+	// Strict verifiers may want another PSS salt than the hash length go-jose signs with
+	var signingKey jose.SigningKey
+	if spec.PSSSaltLength != nil {
+		switch algorithm {
+		case jose.PS256, jose.PS384, jose.PS512:
+		default:
+			writeError(context, http.StatusBadRequest, CodeConflictingFields, fmt.Errorf("PSSSaltLength only applies to the PSS algorithms, not %s", algorithm))
+			return jose.SigningKey{}, false
+		}
+		// ParseSignatureAlgorithm only lets RSA keys through with the PSS algorithms
+		rsaKey := privateKey.(*rsa.PrivateKey)
+		if err := crypto.ValidatePSSSaltLength(algorithm, &rsaKey.PublicKey, *spec.PSSSaltLength); err != nil {
+			writeError(context, http.StatusBadRequest, CodeValidationFailed, err)
+			return jose.SigningKey{}, false
+		}
+		signingKey, err = crypto.NewPSSSigningKey(algorithm, rsaKey, *spec.PSSSaltLength)
+	} else {
+		signingKey, err = crypto.NewSigningKey(algorithm, privateKey)
+	}
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return jose.SigningKey{}, false
+	}
+	return signingKey, true
+}
@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	encodingjson "encoding/json"
+	"encoding/pem"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignEndpointCanonicalizesTheJSONPayload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/sign", SignEndpoint)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	sign := func(payload string, canonicalize bool) *httptest.ResponseRecorder {
+		body, _ := encodingjson.Marshal(model.SignRequest{Payload: payload, PrivateKeyPem: privateKeyPem, Canonicalize: canonicalize})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/sign", bytes.NewReader(body)))
+		return recorder
+	}
+
+	// EdDSA signatures are deterministic, the same canonical payload gives the same JWS
+	first := sign(`{"b": [1.50, true], "a": "x"}`, true)
+	second := sign("{\n  \"a\": \"x\",\n  \"b\": [1.5, true]\n}", true)
+	if first.Code != http.StatusOK || first.Body.String() != second.Body.String() {
+		t.Fatalf("expected the same JWS for both formattings, got %d %q and %q", first.Code, first.Body.String(), second.Body.String())
+	}
+	if expected := `eyJhIjoieCIsImIiOlsxLjUsdHJ1ZV19`; strings.Split(first.Body.String(), ".")[1] != expected {
+		t.Fatalf("expected the canonical payload {\"a\":\"x\",\"b\":[1.5,true]}, got %q", first.Body.String())
+	}
+	if uncanonical := sign(`{"b": [1.50, true], "a": "x"}`, false); uncanonical.Body.String() == first.Body.String() {
+		t.Fatal("expected the payload to be signed as sent without canonicalize")
+	}
+
+	if invalid := sign(`{"a": 1,}`, true); invalid.Code != http.StatusBadRequest || !strings.Contains(invalid.Body.String(), CodeInvalidJSON) {
+		t.Fatalf("expected a payload that isn't JSON to be refused, got %d %q", invalid.Code, invalid.Body.String())
+	}
+}
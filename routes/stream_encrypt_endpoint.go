@@ -0,0 +1,255 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"io"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/json"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+// Largest metadata part accepted before the plaintext part
+const maxStreamMetadataSize = 64 << 10
+
+// Plaintext bytes per chunk and the slots bounding how many streams run at once, set by SetStreamLimits
+var streamChunkSize = 1 << 20
+var streamSlots = make(chan struct{}, 8)
+
+// SetStreamLimits sets the chunk size and the number of concurrent streams.
+// A stream holds two plaintext chunks and one serialized JWE, about 4 x chunkSize, so the
+// streaming route never holds more than maxConcurrent x 4 x chunkSize (32 MiB by default).
+func SetStreamLimits(chunkSize, maxConcurrent int) error {
+	if chunkSize < 1 || maxConcurrent < 1 {
+		return fmt.Errorf("stream chunk size and concurrency must be positive, got %d and %d", chunkSize, maxConcurrent)
+	}
+
+	streamChunkSize = chunkSize
+	streamSlots = make(chan struct{}, maxConcurrent)
+	return nil
+}
+
+// StreamEncryptEndpoint encrypts a plaintext of any size without buffering it.
+// The multipart form carries the JSON "metadata" part first and the raw "plaintext" part second.
+// The plaintext is cut into chunks, each encrypted as its own compact JWE on its own line. Every
+// chunk carries the stream ID, its index and, on the final one, last=true, so reordered, spliced
+// or truncated streams are detected by the recipient. The body is only read as fast as the client
+// accepts the output, which gives backpressure for free.
+func StreamEncryptEndpoint(context *gin.Context) {
+	select {
+	case streamSlots <- struct{}{}:
+		defer func() { <-streamSlots }()
+	default:
+		writeError(context, http.StatusServiceUnavailable, CodeTooManyStreams, errors.New("too many streams are being encrypted, retry later"))
+		return
+	}
+
+	// A pattern could span two chunks, a stream can't be scanned reliably
+	if blockedContentPatterns != nil {
+		writeError(context, http.StatusUnprocessableEntity, CodeContentBlocked, errors.New("streamed plaintexts cannot be scanned, use the encrypt or file route while content scanning is on"))
+		return
+	}
+
+	reader, err := context.Request.MultipartReader()
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidBody, errors.New("expected a multipart form with metadata and plaintext"))
+		return
+	}
+
+	var stream model.StreamEncryptRequest
+	if !readStreamMetadata(context, reader, &stream) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, stream) {
+		return
+	}
+
+	contentEncryption, err := crypto.ParseContentEncryption(stream.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+
+	recipientKey, err := crypto.GetOrImportPublicKey(stream.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	keyAlgorithm, err := crypto.ParseKeyAlgorithm(stream.KeyAlgorithm, recipientKey.KeyType, stream.AllowLegacyRSA15, stream.AllowLegacyHash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	if !checkEncryptionAllowed(context, keyAlgorithm, contentEncryption) {
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	serverKid, serverKidHash, ok := recipientServerKid(context, recipientKey, "")
+	if !ok {
+		return
+	}
+
+	plaintext, err := reader.NextPart()
+	if err != nil || plaintext.FormName() != "plaintext" {
+		writeError(context, http.StatusBadRequest, CodeInvalidBody, errors.New("expected the plaintext part after the metadata"))
+		return
+	}
+	defer plaintext.Close()
+
+	// go-jose can't decrypt an empty JWE, so an empty stream is rejected before the status is sent
+	buffered := bufio.NewReader(plaintext)
+	if _, err := buffered.Peek(1); err != nil {
+		if err == io.EOF {
+			writeError(context, http.StatusBadRequest, CodeEmptyBody, errors.New("plaintext part is empty"))
+		} else {
+			writeBodyReadError(context, err)
+		}
+		return
+	}
+
+	streamID := make([]byte, 16)
+	if _, err := rand.Read(streamID); err != nil {
+		writeError(context, http.StatusInternalServerError, CodeEncryptionFailed, errEncrypterSetup)
+		return
+	}
+
+	context.Header(ServerKidResponseHeader, serverKid)
+	context.Header("Content-Type", "application/jose; charset=utf-8")
+	context.Status(http.StatusOK)
+
+	chunks := &chunkEncrypter{
+		recipient:         jose.Recipient{Algorithm: keyAlgorithm, Key: recipientKey.PublicKey},
+		contentEncryption: contentEncryption,
+		thumbprint:        serverKid,
+		thumbprintHash:    serverKidHash.String(),
+		streamID:          base64.RawURLEncoding.EncodeToString(streamID),
+	}
+
+	start := time.Now()
+	err = encryptChunks(buffered, streamChunkSize, func(index int, chunk []byte, last bool) error {
+		serialized, err := chunks.encrypt(index, chunk, last)
+		if err != nil {
+			return err
+		}
+		if _, err := context.Writer.Write(append([]byte(serialized), '\n')); err != nil {
+			return err
+		}
+		context.Writer.Flush()
+		return nil
+	})
+	metrics.Record(metrics.OperationEncrypt, string(keyAlgorithm), string(contentEncryption), err, time.Since(start))
+
+	// The status is already sent, the missing last chunk tells the client the stream failed
+	if err != nil {
+		context.Set(middleware.ErrorCodeKey, CodeEncryptionFailed)
+		context.Abort()
+	}
+}
+
+// readStreamMetadata strictly unmarshals the metadata part, which has to come first
+func readStreamMetadata(context *gin.Context, reader *multipart.Reader, destination interface{}) bool {
+	part, err := reader.NextPart()
+	if err != nil {
+		writeBodyReadError(context, err)
+		return false
+	}
+	defer part.Close()
+
+	if part.FormName() != "metadata" {
+		writeError(context, http.StatusBadRequest, CodeInvalidBody, errors.New("the metadata part has to come before the plaintext"))
+		return false
+	}
+
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(io.LimitReader(part, maxStreamMetadataSize+1))
+	if err != nil {
+		writeBodyReadError(context, err)
+		return false
+	}
+	if n > maxStreamMetadataSize {
+		writeError(context, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Errorf("metadata exceeds %d bytes", maxStreamMetadataSize))
+		return false
+	}
+
+	if err := json.StrictUnmarshal(buf.Bytes(), destination); err != nil {
+		writeInvalidJSON(context, err)
+		return false
+	}
+	return true
+}
+
+// chunkEncrypter encrypts the chunks of one stream, each with its own CEK
+type chunkEncrypter struct {
+	recipient         jose.Recipient
+	contentEncryption jose.ContentEncryption
+	thumbprint        string
+	thumbprintHash    string
+	streamID          string
+}
+
+func (chunks *chunkEncrypter) encrypt(index int, chunk []byte, last bool) (string, error) {
+	options := (&jose.EncrypterOptions{}).
+		WithHeader(crypto.ServerKidHeader, chunks.thumbprint).
+		WithHeader(crypto.ServerKidHashHeader, chunks.thumbprintHash).
+		WithHeader(crypto.StreamIDHeader, chunks.streamID).
+		WithHeader(crypto.ChunkIndexHeader, index)
+	if last {
+		options.WithHeader(crypto.LastChunkHeader, true)
+	}
+
+	encrypter, err := crypto.NewEncrypter(chunks.contentEncryption, chunks.recipient, options)
+	if err != nil {
+		return "", err
+	}
+	jwe, err := encrypter.Encrypt(chunk)
+	if err != nil {
+		return "", err
+	}
+	return jwe.CompactSerialize()
+}
+
+// encryptChunks reads the plaintext chunk by chunk and hands each to emit, reading one chunk ahead
+// to know which one is last. Only two chunk buffers are ever allocated.
+func encryptChunks(plaintext io.Reader, chunkSize int, emit func(index int, chunk []byte, last bool) error) error {
+	current, next := make([]byte, chunkSize), make([]byte, chunkSize)
+	defer crypto.Zero(current)
+	defer crypto.Zero(next)
+
+	n, err := io.ReadFull(plaintext, current)
+	for index := 0; ; index++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+
+		// Read ahead, a stream ending exactly on a chunk boundary makes the current chunk the last
+		var m int
+		if !last {
+			m, err = io.ReadFull(plaintext, next)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			last = m == 0 && err == io.EOF
+		}
+
+		if emitErr := emit(index, current[:n], last); emitErr != nil || last {
+			return emitErr
+		}
+		current, next, n = next, current, m
+	}
+}
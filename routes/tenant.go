@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"net/http"
+)
+
+// TenantHeader names the tenant whose keys a request uses, requests without one use the default keys
+const TenantHeader = "X-Tenant-ID"
+
+// requestTenant returns the tenant whose keys the caller uses, the one namedTenant reads checked against the caller.
+// A caller authenticated by an API key may only use the tenant of its key and uses it when naming none,
+// admin requests may use any, and unauthenticated callers only the default keys.
+func requestTenant(context *gin.Context) (string, bool) {
+	tenant, ok := namedTenant(context)
+	if !ok || context.GetBool(middleware.AdminKey) {
+		return tenant, ok
+	}
+
+	_, authenticated := context.Get(middleware.APIKeyTenantKey)
+	bound := context.GetString(middleware.APIKeyTenantKey)
+	if authenticated && tenant == crypto.DefaultTenant {
+		return bound, true
+	}
+	if tenant != crypto.DefaultTenant && (!authenticated || bound != tenant) {
+		writeError(context, http.StatusForbidden, CodeTenantForbidden, fmt.Errorf("the caller may not use the keys of tenant %q", tenant))
+		return "", false
+	}
+	return tenant, true
+}
+
+// namedTenant returns the tenant named by the tenant path parameter or the tenant header, they must agree when both are set
+func namedTenant(context *gin.Context) (string, bool) {
+	tenant, fromHeader := context.Param("tenant"), context.GetHeader(TenantHeader)
+	switch {
+	case tenant == "":
+		tenant = fromHeader
+	case fromHeader != "" && fromHeader != tenant:
+		writeError(context, http.StatusBadRequest, CodeInvalidTenant, errors.New("the tenant header and the tenant in the path differ"))
+		return "", false
+	}
+	if tenant == crypto.DefaultTenant {
+		return tenant, true
+	}
+
+	if err := crypto.ValidateTenantID(tenant); err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidTenant, err)
+		return "", false
+	}
+	return tenant, true
+}
+
+// tenantKeys returns the key store of the calling tenant, the only keys the request may use
+func tenantKeys(context *gin.Context) (*crypto.KeyStore, bool) {
+	tenant, ok := requestTenant(context)
+	if !ok {
+		return nil, false
+	}
+	return crypto.TenantKeys.Lookup(tenant), true
+}
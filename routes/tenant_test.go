@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecryptEndpointUsesOnlyTheTenantKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	hashes := make([]string, 0, 2)
+	for _, entry := range []string{"tenant-a-key", "default-key"} {
+		hash, err := middleware.HashAPIKey(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	keys, err := middleware.ParseAPIKeyHashes([]string{hashes[0] + ":tenant-a", hashes[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.POST("/v1/decrypt", middleware.APIKeyAuth(keys), DecryptEndpoint)
+
+	defer func(previous *crypto.KeyNamespaces) { crypto.TenantKeys = previous }(crypto.TenantKeys)
+	crypto.TenantKeys = crypto.NewKeyNamespaces()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := crypto.TenantKeys.Store("tenant-a").Register(privateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := crypto.BuildEncrypterOptions(crypto.ServerKidHeaders(entry.Thumbprint, 0), false)
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: &privateKey.PublicKey}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, err := encrypter.Encrypt([]byte("for tenant-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jwe.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := encodingjson.Marshal(model.DecryptRequest{Ciphertext: compact})
+
+	// The key bound to tenant-a uses its keys without naming it, and may not name another tenant. The key bound to
+	// no tenant only uses the default keys, which can't decrypt the token, and naming tenant-a is not enough to get them.
+	for _, test := range []struct {
+		apiKey string
+		tenant string
+		status int
+	}{
+		{"tenant-a-key", "tenant-a", http.StatusOK},
+		{"tenant-a-key", "", http.StatusOK},
+		{"tenant-a-key", "tenant-b", http.StatusForbidden},
+		{"tenant-a-key", "../tenant-a", http.StatusBadRequest},
+		{"default-key", "tenant-a", http.StatusForbidden},
+		{"default-key", "", http.StatusBadRequest},
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/v1/decrypt", bytes.NewReader(body))
+		request.Header.Set(middleware.APIKeyHeader, test.apiKey)
+		request.Header.Set(TenantHeader, test.tenant)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != test.status {
+			t.Fatalf("%s for tenant %q: expected %d, got %d %q", test.apiKey, test.tenant, test.status, recorder.Code, recorder.Body.String())
+		}
+	}
+}
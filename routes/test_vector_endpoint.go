@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"net/http"
+)
+
+// TestVectorEndpoint produces a reproducible compact JWE from a fixed key, CEK and IV, for partners running
+// known-answer tests against their implementation. It is for testing only: reusing a CEK and IV gives up the
+// confidentiality of AES-GCM, so the route is only registered with ENABLE_TEST_VECTORS outside release mode.
+func TestVectorEndpoint(context *gin.Context) {
+	var vector model.TestVectorRequest
+
+	if !readBody(context, &vector) {
+		return
+	}
+
+	if !validateBody(context, vector) {
+		return
+	}
+
+	contentEncryption, err := crypto.ParseContentEncryption(vector.ContentEncryption)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+	if err := crypto.ValidateProtectedHeaders(vector.ProtectedHeaders); err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidHeader, err)
+		return
+	}
+	if !checkCustomHeadersAllowed(context, vector.ProtectedHeaders) {
+		return
+	}
+
+	// The base64rawurl rules already checked the encodings
+	symmetricKey, _ := base64.RawURLEncoding.DecodeString(vector.SymmetricKey)
+	contentKey, _ := base64.RawURLEncoding.DecodeString(vector.ContentEncryptionKey)
+	iv, _ := base64.RawURLEncoding.DecodeString(vector.IV)
+
+	keyAlgorithm, err := crypto.ParseSymmetricKeyAlgorithm(vector.KeyAlgorithm, contentEncryption, symmetricKey)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+	switch {
+	case keyAlgorithm == jose.DIRECT && len(contentKey) > 0:
+		writeError(context, http.StatusBadRequest, CodeConflictingFields, errors.New("ContentEncryptionKey cannot be set with dir, the symmetric key is the CEK"))
+		return
+	case keyAlgorithm != jose.DIRECT && len(contentKey) == 0:
+		writeError(context, http.StatusBadRequest, CodeMissingKey, errors.New("ContentEncryptionKey is required with the key wrap algorithms"))
+		return
+	}
+	middleware.SetAlgorithms(context, string(keyAlgorithm), string(contentEncryption))
+
+	options := &jose.EncrypterOptions{}
+	for name, value := range vector.ProtectedHeaders {
+		options.WithHeader(jose.HeaderKey(name), value)
+	}
+	recipient := jose.Recipient{Algorithm: keyAlgorithm, Key: symmetricKey}
+	if vector.Kid != nil {
+		recipient.KeyID = *vector.Kid
+	}
+
+	encrypter, err := crypto.NewTestVectorEncrypter(contentEncryption, recipient, options, crypto.FixedKeyMaterial{
+		ContentEncryptionKey: contentKey,
+		InitializationVector: iv,
+	})
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+
+	// A CEK or IV of the wrong length is a client error
+	jwe, err := encrypter.Encrypt([]byte(vector.Plaintext))
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidKey, err)
+		return
+	}
+
+	writeJWE(context, jwe, model.EncryptResponse{
+		Kid: recipient.KeyID,
+		Alg: string(keyAlgorithm),
+		Enc: string(contentEncryption),
+	})
+}
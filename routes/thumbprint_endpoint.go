@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+func ThumbprintEndpoint(context *gin.Context) {
+	var thumbprintRequest model.ThumbprintRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &thumbprintRequest) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, thumbprintRequest) {
+		return
+	}
+
+	hash, err := crypto.ParseThumbprintHash(thumbprintRequest.Hash)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, err)
+		return
+	}
+
+	publicKey, _, err := crypto.ImportPublicKeyFromPEM(thumbprintRequest.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+
+	jwk, err := crypto.ConvertPublicKeyToJWK(publicKey)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, err)
+		return
+	}
+
+	thumbprint, err := crypto.GetJWKThumbprint(jwk, hash)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, errors.New("failed to compute public key thumbprint"))
+		return
+	}
+
+	// Return the exact JSON that was hashed so clients can reproduce the value
+	canonicalJwk, err := crypto.GetJWKThumbprintInput(jwk)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, err)
+		return
+	}
+
+	// SHA-1 thumbprints have no URI form, the raw value is still returned
+	thumbprintURI, _ := crypto.GetJWKThumbprintURI(jwk, hash)
+
+	writeJSON(context, http.StatusOK, model.ThumbprintResponse{
+		Thumbprint:    thumbprint,
+		Hash:          hash.String(),
+		CanonicalJwk:  canonicalJwk,
+		ThumbprintURI: thumbprintURI,
+	})
+}
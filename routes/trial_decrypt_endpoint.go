@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/metrics"
+	"jwe-go/packages/middleware"
+	"jwe-go/packages/tracing"
+	"net/http"
+	"time"
+)
+
+func TrialDecryptEndpoint(context *gin.Context) {
+	var trial model.TrialDecryptRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &trial) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, trial) {
+		return
+	}
+
+	// Import every key before trying any, so a bad key fails the request whatever the token
+	privateKeys := make([]interface{}, len(trial.PrivateKeyPems))
+	thumbprints := make([]string, len(trial.PrivateKeyPems))
+	for i, privateKeyPem := range trial.PrivateKeyPems {
+		privateKey, publicKey, err := importDecryptionKey(privateKeyPem)
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidPEM, fmt.Errorf("key %d: %v", i, err))
+			return
+		}
+		entry, err := crypto.NewPublicKeyEntry(publicKey)
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidPEM, fmt.Errorf("key %d: %v", i, err))
+			return
+		}
+		privateKeys[i], thumbprints[i] = privateKey, entry.Thumbprint
+	}
+
+	decryptedObject, err := jose.ParseEncrypted(
+		trial.Ciphertext,
+		crypto.DecryptionKeyAlgorithms,
+		crypto.SupportedContentEncryptions,
+	)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+		return
+	}
+	contentEncryption, _ := decryptedObject.Header.ExtraHeaders["enc"].(string)
+	middleware.SetAlgorithms(context, decryptedObject.Header.Algorithm, contentEncryption)
+
+	if !checkCriticalHeaders(context, decryptedObject) {
+		return
+	}
+
+	// Every key is tried even after a match, so the response time does not tell which index fit
+	ctx, cancel := cryptoDeadline(context.Request)
+	defer cancel()
+	match := -1
+	start := time.Now()
+	_, decryptSpan := crypto.StartDecryptSpan(ctx, decryptedObject)
+	recipient, err := crypto.RunWithContext(ctx, func() (crypto.DecryptedRecipient, error) {
+		var matched crypto.DecryptedRecipient
+		var inflateErr error
+		for i, privateKey := range privateKeys {
+			decrypted, err := crypto.DecryptRecipient(trial.Ciphertext, decryptedObject, privateKey)
+			if err == nil && match < 0 {
+				match, matched = i, decrypted
+			}
+			if errors.Is(err, crypto.ErrInflatedTooLarge) {
+				inflateErr = err
+			}
+		}
+		if match < 0 && inflateErr != nil {
+			return matched, inflateErr
+		}
+		if match < 0 {
+			return matched, errors.New("none of the provided keys decrypts the JWE")
+		}
+		return matched, nil
+	})
+	tracing.End(decryptSpan, err)
+	keyAlgorithm := decryptedObject.Header.Algorithm
+	if recipient.Header.Algorithm != "" {
+		keyAlgorithm = recipient.Header.Algorithm
+		middleware.SetAlgorithms(context, keyAlgorithm, contentEncryption)
+	}
+	metrics.Record(metrics.OperationDecrypt, keyAlgorithm, contentEncryption, err, time.Since(start))
+	if errors.Is(err, crypto.ErrTimeout) {
+		writeError(context, http.StatusServiceUnavailable, CodeTimeout, err)
+		return
+	}
+	if errors.Is(err, crypto.ErrInflatedTooLarge) {
+		writeError(context, http.StatusUnprocessableEntity, CodePlaintextTooLarge, err)
+		return
+	}
+	if err != nil {
+		writeError(context, http.StatusUnprocessableEntity, CodeDecryptionFailed, err)
+		return
+	}
+	middleware.SetKeyThumbprint(context, thumbprints[match])
+
+	if !checkTimeHeaders(context, trial.Ciphertext, trial.MaxAgeSeconds) {
+		return
+	}
+
+	if !checkReplay(context, trial.Ciphertext, trial.RejectReplay) {
+		return
+	}
+
+	decrypted := recipient.Plaintext
+	defer crypto.Zero(decrypted)
+	if !checkDecryptedPayload(context, decryptedObject, decrypted, trial.Audience) {
+		return
+	}
+
+	// Without an output encoding the plaintext is returned as it is
+	plaintext := string(decrypted)
+	if trial.OutputEncoding != "" {
+		if plaintext, err = encodePlaintext(decrypted, trial.OutputEncoding); err != nil {
+			writeError(context, http.StatusUnprocessableEntity, CodeInvalidEncoding, err)
+			return
+		}
+	}
+
+	serverKid, _ := decryptedObject.Header.ExtraHeaders[crypto.ServerKidHeader].(string)
+	partyUInfo, partyVInfo := partyInfo(recipient.Header)
+	recipientHeader, _ := crypto.RecipientHeader(trial.Ciphertext, recipient.Index)
+	writeJSON(context, http.StatusOK, model.TrialDecryptResponse{
+		Plaintext:         plaintext,
+		PlaintextEncoding: trial.OutputEncoding,
+		Thumbprint:        thumbprints[match],
+		ServerKid:         serverKid,
+		RecipientIndex:    recipient.Index,
+		AdditionalData:    base64.RawURLEncoding.EncodeToString(decryptedObject.GetAuthData()),
+		PartyUInfo:        partyUInfo,
+		PartyVInfo:        partyVInfo,
+		RecipientHeader:   recipientHeader,
+	})
+}
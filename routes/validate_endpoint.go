@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"jwe-go/model"
+	"net/http"
+)
+
+// dryRunKey marks a request ValidateEndpoint runs through the encrypt path without encrypting
+const dryRunKey = "dryRun"
+
+// ValidateEndpoint takes an encrypt request through every check of EncryptEndpoint and reports the key and algorithms it would use
+func ValidateEndpoint(context *gin.Context) {
+	context.Set(dryRunKey, true)
+	EncryptEndpoint(context)
+}
+
+// answerDryRun replies to a validate request once the encrypter is set up, it reports whether it did
+func answerDryRun(context *gin.Context, response model.ValidateResponse) bool {
+	if !context.GetBool(dryRunKey) {
+		return false
+	}
+	response.Valid = true
+	writeJSON(context, http.StatusOK, response)
+	return true
+}
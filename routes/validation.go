@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"jwe-go/model"
+	"reflect"
+	"strings"
+)
+
+// Descriptions of the pem=<kind> rule params for error messages
+var pemKindNames = map[string]string{
+	"public":      "public key",
+	"private":     "private key",
+	"certificate": "certificate",
+}
+
+// Rules whose failure has a code of its own rather than VALIDATION_FAILED
+var ruleCodes = map[string]string{
+	"nonempty": CodeEmptyPlaintext,
+}
+
+// validationCode is the code of the first failing rule having one, VALIDATION_FAILED otherwise
+func validationCode(err error) string {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		for _, fieldError := range validationErrors {
+			if code, ok := ruleCodes[fieldError.Tag()]; ok {
+				return code
+			}
+		}
+	}
+	return CodeValidationFailed
+}
+
+// validationError turns a validator error into one with a message a client can act on
+func validationError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) || len(validationErrors) == 0 {
+		return err
+	}
+
+	// Every failing field is listed in the details with its own message, the top level message describes the first one
+	fields := make([]string, 0, len(validationErrors))
+	fieldErrors := make([]model.FieldError, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		fields = append(fields, fieldError.Field())
+		fieldErrors = append(fieldErrors, model.FieldError{
+			Field:   fieldPath(fieldError),
+			Tag:     fieldError.Tag(),
+			Message: fieldErrorMessage(fieldError),
+		})
+	}
+
+	return &detailedError{
+		error:   errors.New(fieldErrors[0].Message),
+		details: map[string]interface{}{"fields": fields, "errors": fieldErrors},
+	}
+}
+
+// fieldPath names the field from the request root, so items of a list are told apart
+func fieldPath(fieldError validator.FieldError) string {
+	namespace := fieldError.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// fieldErrorMessage describes a failed rule in words, unknown rules fall back to naming the rule
+func fieldErrorMessage(fieldError validator.FieldError) string {
+	field := fieldPath(fieldError)
+	switch fieldError.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "base64":
+		return fmt.Sprintf("%s must be standard base64", field)
+	case "base64rawurl":
+		return fmt.Sprintf("%s must be base64url without padding", field)
+	case "flexbase64":
+		return fmt.Sprintf("%s must be base64 or base64url, only base64url without padding when %s is set", field, fieldError.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fieldError.Param(), " ", ", "))
+	case "pem":
+		return fmt.Sprintf("%s must be a PEM encoded %s", field, pemKindNames[fieldError.Param()])
+	case "nonempty":
+		return fmt.Sprintf("%s must not be empty unless %s is set", field, strings.Join(strings.Fields(fieldError.Param()), " or "))
+	case "mutex":
+		return fmt.Sprintf("%s cannot be combined with %s", field, strings.Join(strings.Fields(fieldError.Param()), " or "))
+	case "min", "max":
+		bound := "at least"
+		if fieldError.Tag() == "max" {
+			bound = "at most"
+		}
+		switch fieldError.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("%s must be %s %s characters long", field, bound, fieldError.Param())
+		case reflect.Slice, reflect.Map:
+			return fmt.Sprintf("%s must have a length of %s %s", field, bound, fieldError.Param())
+		default:
+			return fmt.Sprintf("%s must be %s %s", field, bound, fieldError.Param())
+		}
+	case "printascii":
+		return fmt.Sprintf("%s must only contain printable ASCII characters", field)
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field, fieldError.Tag())
+	}
+}
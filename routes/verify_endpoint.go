@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/middleware"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+func VerifyEndpoint(context *gin.Context) {
+	var verification model.VerifyRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &verification) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, verification) {
+		return
+	}
+
+	// Without a key only the registered keys of the calling tenant are tried
+	keys, ok := tenantKeys(context)
+	if !ok {
+		return
+	}
+
+	var publicKeys []interface{}
+	var keyTypes []crypto.KeyType
+
+	// Import the public keys from the Public Key PEMs or the Public Key JWK
+	switch {
+	case len(verification.PublicKeyPem) > 0 || len(verification.PublicKeyPems) > 0:
+		pems := verification.PublicKeyPems
+		if len(verification.PublicKeyPem) > 0 {
+			pems = []string{verification.PublicKeyPem}
+		}
+		for _, publicKeyPem := range pems {
+			recipientKey, err := crypto.GetOrImportPublicKey(publicKeyPem)
+			if err != nil {
+				writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+				return
+			}
+			publicKeys, keyTypes = append(publicKeys, recipientKey.PublicKey), append(keyTypes, recipientKey.KeyType)
+		}
+	case len(verification.PublicKeyJwk) > 0:
+		publicKey, keyType, err := crypto.ImportPublicKeyFromJWK(verification.PublicKeyJwk)
+		if err != nil {
+			writeError(context, http.StatusBadRequest, CodeInvalidJWK, err)
+			return
+		}
+		publicKeys, keyTypes = []interface{}{publicKey}, []crypto.KeyType{keyType}
+	default:
+		// Without a key the token is checked against the registered server keys
+		for _, candidate := range keys.Candidates("") {
+			keyTypes = append(keyTypes, candidate.KeyType)
+		}
+		if len(keyTypes) == 0 {
+			writeError(context, http.StatusBadRequest, CodeMissingKey, errors.New("no valid PEM or JWK provided and no server keys are registered"))
+			return
+		}
+	}
+
+	// Only the algorithms the caller expects are accepted, and only those fitting a key, which prevents algorithm confusion
+	expected := make([]jose.SignatureAlgorithm, len(verification.Algorithms))
+	fitting := 0
+	for i, name := range verification.Algorithms {
+		expected[i] = jose.SignatureAlgorithm(name)
+		if !checkSignatureAllowed(context, expected[i]) {
+			return
+		}
+		if fitsAnyKeyType(expected[i], keyTypes) {
+			fitting++
+		}
+	}
+	if fitting == 0 {
+		writeError(context, http.StatusBadRequest, CodeUnsupportedAlg, fmt.Errorf("none of the expected algorithms can be used with a %s key", keyTypes[0]))
+		return
+	}
+
+	// Every registered algorithm parses, so a token naming an unexpected one, HS256 over an RSA key say,
+	// is told apart from a malformed one and rejected before any key sees it
+	signature, err := jose.ParseSigned(verification.Jws, crypto.RegisteredSignatureAlgorithms)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWS, fmt.Errorf("failed to parse JWS: %v", err))
+		return
+	}
+	for i, candidate := range signature.Signatures {
+		if alg := jose.SignatureAlgorithm(candidate.Protected.Algorithm); !slices.Contains(expected, alg) {
+			writeError(context, http.StatusBadRequest, CodeUnexpectedAlg, fmt.Errorf("signature %d uses %s, expected one of: %s", i, alg, strings.Join(verification.Algorithms, ", ")))
+			return
+		}
+	}
+	// A signature whose algorithm fits none of the keys only fails on its own, a lone one fails as before
+	if len(signature.Signatures) == 1 && !fitsAnyKeyType(jose.SignatureAlgorithm(signature.Signatures[0].Protected.Algorithm), keyTypes) {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWS, fmt.Errorf("failed to parse JWS: signature algorithm %q fits none of the keys", signature.Signatures[0].Protected.Algorithm))
+		return
+	}
+
+	// Each signature is checked on its own, a countersigned document may carry signatures the caller has no key for
+	results := make([]model.SignatureResult, len(signature.Signatures))
+	signatureAlgorithms := make([]string, len(signature.Signatures))
+	var payload []byte
+	var header jose.Header
+	verified := false
+	for i, candidate := range signature.Signatures {
+		signatureAlgorithms[i] = candidate.Protected.Algorithm
+		results[i] = model.SignatureResult{Index: i, Alg: candidate.Protected.Algorithm, Kid: candidate.Protected.KeyID}
+
+		var signedPayload []byte
+		var err error
+		if publicKeys != nil {
+			signedPayload, err = verifyWithKeys(publicKeys, keyTypes, signature, i)
+		} else {
+			signedPayload, err = verifyWithRegisteredKeys(keys, signature, i)
+		}
+		if err != nil {
+			continue
+		}
+		results[i].Valid = true
+		if !verified {
+			payload, header, verified = signedPayload, candidate.Protected, true
+		}
+	}
+	middleware.SetAlgorithms(context, strings.Join(signatureAlgorithms, ","), "")
+	if !verified {
+		writeError(context, http.StatusUnprocessableEntity, CodeInvalidSignature, errors.New("signature verification failed"))
+		return
+	}
+
+	response := model.VerifyResponse{
+		Payload: string(payload),
+		Header:  signatureHeader(header),
+	}
+	if len(results) > 1 || len(verification.PublicKeyPems) > 0 {
+		response.Signatures = results
+	}
+	writeJSON(context, http.StatusOK, response)
+}
+
+// signatureHeader flattens the protected header of a signature, go-jose lifts alg and kid out of it
+// and leaves everything else in ExtraHeaders
+func signatureHeader(header jose.Header) map[string]interface{} {
+	protected := make(map[string]interface{}, len(header.ExtraHeaders)+2)
+	for name, value := range header.ExtraHeaders {
+		protected[string(name)] = value
+	}
+	protected["alg"] = header.Algorithm
+	if header.KeyID != "" {
+		protected["kid"] = header.KeyID
+	}
+	return protected
+}
+
+func fitsAnyKeyType(algorithm jose.SignatureAlgorithm, keyTypes []crypto.KeyType) bool {
+	for _, keyType := range keyTypes {
+		if _, err := crypto.ParseSignatureAlgorithm(string(algorithm), keyType); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyWithKeys tries the given keys that fit the algorithm of the signature at index
+func verifyWithKeys(publicKeys []interface{}, keyTypes []crypto.KeyType, signature *jose.JSONWebSignature, index int) ([]byte, error) {
+	header := signature.Signatures[index].Protected
+	for i, publicKey := range publicKeys {
+		if _, err := crypto.ParseSignatureAlgorithm(header.Algorithm, keyTypes[i]); err != nil {
+			continue
+		}
+		if payload, err := crypto.VerifySignature(signature, index, publicKey); err == nil {
+			return payload, nil
+		}
+	}
+	return nil, errors.New("no given key verifies the signature")
+}
+
+// verifyWithRegisteredKeys tries the registered server keys that fit the algorithm of the signature at index,
+// the one matching its kid first
+func verifyWithRegisteredKeys(keys *crypto.KeyStore, signature *jose.JSONWebSignature, index int) ([]byte, error) {
+	header := signature.Signatures[index].Protected
+	for _, candidate := range keys.Candidates(header.KeyID) {
+		if _, err := crypto.ParseSignatureAlgorithm(header.Algorithm, candidate.KeyType); err != nil {
+			continue
+		}
+		if payload, err := crypto.VerifySignature(signature, index, candidate.PublicKey); err == nil {
+			return payload, nil
+		}
+	}
+	return nil, errors.New("no registered key verifies the JWS")
+}
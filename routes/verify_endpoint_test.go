@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	encodingjson "encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"jwe-go/packages/schema"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyEndpointReportsEachSignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/sign", SignEndpoint)
+	router.POST("/v1/verify", VerifyEndpoint)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivatePem, _ := crypto.ExportPrivateKeyAsPEM(rsaKey)
+	ecPrivatePem, _ := crypto.ExportPrivateKeyAsPEM(ecKey)
+	rsaPublicPem, _ := crypto.ExportPublicKeyAsPEM(&rsaKey.PublicKey)
+	otherPublicPem, _ := crypto.ExportPublicKeyAsPEM(&otherKey.PublicKey)
+
+	body, _ := encodingjson.Marshal(model.SignRequest{Payload: "countersigned", Signers: []model.SignerSpec{
+		{PrivateKeyPem: rsaPrivatePem, Algorithm: "PS256"},
+		{PrivateKeyPem: ecPrivatePem},
+	}})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/sign", bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the payload to be signed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	jws := recorder.Body.String()
+
+	// Only the RSA signer's key is known, the EC signature is reported invalid next to the valid one
+	body, _ = encodingjson.Marshal(model.VerifyRequest{Jws: jws, PublicKeyPems: []string{rsaPublicPem, otherPublicPem}, Algorithms: []string{"PS256", "ES256"}})
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/verify", bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected a partial verification, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	var response model.VerifyResponse
+	if err := encodingjson.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Payload != "countersigned" || response.Header["alg"] != "PS256" {
+		t.Fatalf("expected the payload and header of the PS256 signature, got %+v", response)
+	}
+	if len(response.Signatures) != 2 || !response.Signatures[0].Valid || response.Signatures[1].Valid || response.Signatures[1].Alg != "ES256" {
+		t.Fatalf("expected the PS256 signature valid and the ES256 one invalid, got %+v", response.Signatures)
+	}
+
+	// Without a key for any signer nothing verifies
+	body, _ = encodingjson.Marshal(model.VerifyRequest{Jws: jws, PublicKeyPems: []string{otherPublicPem}, Algorithms: []string{"PS256", "ES256"}})
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/verify", bytes.NewReader(body)))
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 without a matching key, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestVerifyEndpointRejectsTheRS256ToHS256Confusion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	schema.Validate = schema.New()
+	router := gin.New()
+	router.POST("/v1/verify", VerifyEndpoint)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPem, _ := crypto.ExportPublicKeyAsPEM(&rsaKey.PublicKey)
+	publicKeyJwk, _ := encodingjson.Marshal(jose.JSONWebKey{Key: &rsaKey.PublicKey, Algorithm: "RS256", Use: "sig"})
+
+	// The attacker signs with HS256, using the published public key as the HMAC secret
+	forger, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte(publicKeyPem)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := forger.Sign([]byte(`{"sub":"admin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := forged.CompactSerialize()
+
+	for _, test := range []struct {
+		name    string
+		request model.VerifyRequest
+		code    string
+	}{
+		{"no expected algorithm", model.VerifyRequest{Jws: token, PublicKeyPem: publicKeyPem}, CodeValidationFailed},
+		{"HS256 expected", model.VerifyRequest{Jws: token, PublicKeyPem: publicKeyPem, Algorithms: []string{"HS256"}}, CodeValidationFailed},
+		{"RS256 expected", model.VerifyRequest{Jws: token, PublicKeyPem: publicKeyPem, Algorithms: []string{"RS256"}}, CodeUnexpectedAlg},
+		{"RS256 expected with a JWK", model.VerifyRequest{Jws: token, PublicKeyJwk: publicKeyJwk, Algorithms: []string{"RS256", "PS256"}}, CodeUnexpectedAlg},
+	} {
+		body, _ := encodingjson.Marshal(test.request)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/verify", bytes.NewReader(body)))
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `"code":"`+test.code+`"`) {
+			t.Fatalf("%s: expected a 400 %s, got %d %s", test.name, test.code, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"jwe-go/model"
+	"jwe-go/packages/crypto"
+	"net/http"
+)
+
+func VerifyKidEndpoint(context *gin.Context) {
+	var verification model.VerifyKidRequest
+
+	// Read and strictly unmarshal the request body
+	if !readBody(context, &verification) {
+		return
+	}
+
+	// Manually validate the struct using the validator
+	if !validateBody(context, verification) {
+		return
+	}
+
+	// Only the protected header is needed, so the token is parsed but never decrypted
+	encryptedObject, err := jose.ParseEncryptedCompact(
+		verification.Ciphertext,
+		crypto.SupportedKeyAlgorithms,
+		crypto.SupportedContentEncryptions,
+	)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeMalformedJWE, err)
+		return
+	}
+
+	serverKid, _ := encryptedObject.Header.ExtraHeaders[crypto.ServerKidHeader].(string)
+	if serverKid == "" {
+		writeError(context, http.StatusBadRequest, CodeInvalidHeader, errors.New("JWE has no server_kid header"))
+		return
+	}
+
+	// Tokens without server_kid_hash predate it and were always SHA-256
+	hashName, _ := encryptedObject.Header.ExtraHeaders[crypto.ServerKidHashHeader].(string)
+	hash, err := crypto.ParseThumbprintHash(hashName)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidHeader, err)
+		return
+	}
+
+	// The cached entry holds the thumbprint computed with GetJWKThumbprintSHA256, others are computed here
+	recipientKey, err := crypto.GetOrImportPublicKey(verification.PublicKeyPem)
+	if err != nil {
+		writeError(context, http.StatusBadRequest, CodeInvalidPEM, err)
+		return
+	}
+	expectedKid, err := recipientKey.ServerKid(hash)
+	if err != nil {
+		writeError(context, http.StatusInternalServerError, CodeThumbprintFailed, errors.New("failed to compute public key thumbprint"))
+		return
+	}
+
+	contentEncryption, _ := encryptedObject.Header.ExtraHeaders["enc"].(string)
+
+	writeJSON(context, http.StatusOK, model.VerifyKidResponse{
+		Match:             crypto.ThumbprintsEqual(serverKid, expectedKid),
+		ServerKid:         serverKid,
+		ExpectedKid:       expectedKid,
+		KeyAlgorithm:      encryptedObject.Header.Algorithm,
+		ContentEncryption: contentEncryption,
+	})
+}